@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/oigele/bazo-miner/metrics"
+	"github.com/oigele/bazo-miner/miner"
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/storage"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"strings"
+)
+
+type lightArgs struct {
+	dbname 					string
+	myNodeAddress			string
+	bootstrapNodeAddress	string
+	walletFiles				string
+	metricsAddress			string
+}
+
+func GetStartLightCommand(logger *logging.Logger) cli.Command {
+	return cli.Command {
+		Name:	"light",
+		Usage:	"start a light client, which follows the block headers and fetches the blocks of its wallets",
+		Action:	func(c *cli.Context) error {
+			args := &lightArgs {
+				dbname: 				c.String("database"),
+				myNodeAddress: 			c.String("address"),
+				bootstrapNodeAddress: 	c.String("bootstrap"),
+				walletFiles: 			c.String("wallet"),
+				metricsAddress:			c.String("metrics"),
+			}
+
+			err := args.ValidateInput()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(args.String())
+
+			return StartLight(args, logger)
+		},
+		Flags:	[]cli.Flag {
+			cli.StringFlag {
+				Name: 	"database, d",
+				Usage: 	"load database of the disk-based key/value store from `FILE` (:memory: keeps it in memory)",
+				Value:	"light.db",
+			},
+			cli.StringFlag {
+				Name: 	"address, a",
+				Usage: 	"announce `IP:PORT` to the miners, the light client does not listen on it",
+				Value: 	"localhost:8002",
+			},
+			cli.StringFlag {
+				Name: 	"bootstrap, b",
+				Usage: 	"connect to bootstrap nodes at `IP:PORT[,IP:PORT...]`",
+				Value: 	"localhost:8000",
+			},
+			cli.StringFlag {
+				Name: 	"wallet, w",
+				Usage: 	"fetch the blocks of the public keys in `FILE[,FILE...]`",
+			},
+			cli.StringFlag {
+				Name: 	"metrics",
+				Usage: 	"serve metrics for Prometheus at `IP:PORT` (disabled if not set)",
+			},
+		},
+	}
+}
+
+func StartLight(args *lightArgs, logger *logging.Logger) error {
+	//Entries of several nodes can be told apart when their logs are merged
+	logging.AddFields("node", args.myNodeAddress)
+
+	var addresses [][64]byte
+	if len(args.walletFiles) > 0 {
+		for _, walletFile := range strings.Split(args.walletFiles, ",") {
+			pubKey, err := crypto.ExtractECDSAPublicKeyFromFile(strings.TrimSpace(walletFile))
+			if err != nil {
+				logger.Printf("%v\n", err)
+				return err
+			}
+			addresses = append(addresses, crypto.GetAddressFromPubKey(pubKey))
+		}
+	}
+
+	p2p.SetCapabilities(p2p.CAPABILITY_LIGHT)
+
+	storage.Init(args.dbname, args.bootstrapNodeAddress)
+	p2p.InitLight(args.myNodeAddress)
+
+	if len(args.metricsAddress) > 0 {
+		metrics.Init(args.metricsAddress)
+	}
+
+	miner.InitLight(addresses)
+
+	return nil
+}
+
+func (args lightArgs) ValidateInput() error {
+	if len(args.dbname) == 0 {
+		return errors.New("argument missing: dbname")
+	}
+
+	if len(args.myNodeAddress) == 0 {
+		return errors.New("argument missing: myNodeAddress")
+	}
+
+	if len(args.bootstrapNodeAddress) == 0 {
+		return errors.New("argument missing: bootstrapNodeAddress")
+	}
+
+	return startArgs{bootstrapNodeAddress: args.bootstrapNodeAddress}.validateNetworkAddresses()
+}
+
+func (args lightArgs) String() string {
+	return fmt.Sprintf("Starting bazo light client with arguments \n" +
+			"- Database Name:\t\t %v\n" +
+			"- My Address:\t\t\t %v\n" +
+			"- Bootstrap Address:\t\t %v\n" +
+			"- Wallet Files:\t\t\t %v\n",
+		args.dbname,
+		args.myNodeAddress,
+		args.bootstrapNodeAddress,
+		args.walletFiles)
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+//Applies the global logging flags before any command runs.
+func ConfigureLogging(c *cli.Context) error {
+	level, err := logging.ParseLevel(c.GlobalString("log-level"))
+	if err != nil {
+		return err
+	}
+
+	subsystemLevels, err := logging.ParseSubsystemLevels(c.GlobalString("log-verbosity"))
+	if err != nil {
+		return err
+	}
+
+	format := c.GlobalString("log-format")
+	if format != logging.FORMAT_TEXT && format != logging.FORMAT_JSON {
+		return errors.New(fmt.Sprintf("unknown log format: %v", format))
+	}
+
+	logging.Configure(&logging.Config{
+		Level:           level,
+		SubsystemLevels: subsystemLevels,
+		Format:          format,
+	})
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/oigele/bazo-miner/storage"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"os"
+)
+
+type snapshotArgs struct {
+	dbname			string
+	file			string
+	epochBlockHash	string
+	walletFile		string
+}
+
+func GetSnapshotCommand(logger *logging.Logger) cli.Command {
+	return cli.Command {
+		Name:	"snapshot",
+		Usage:	"export or import the state of the last closed epoch block",
+		Subcommands: []cli.Command {
+			{
+				Name:	"export",
+				Usage:	"write the last closed epoch block and its state to a snapshot file",
+				Action:	func(c *cli.Context) error {
+					args := &snapshotArgs {
+						dbname:	c.String("database"),
+						file:	c.String("file"),
+					}
+
+					if err := args.ValidateInput(); err != nil {
+						return err
+					}
+
+					return ExportSnapshot(args, logger)
+				},
+				Flags:	[]cli.Flag {
+					cli.StringFlag {
+						Name: 	"database, d",
+						Usage: 	"export from the database `FILE`",
+						Value:	"store.db",
+					},
+					cli.StringFlag {
+						Name: 	"file, f",
+						Usage: 	"write the snapshot to `FILE`",
+						Value:	"snapshot.bin",
+					},
+				},
+			},
+			{
+				Name:	"import",
+				Usage:	"load a snapshot file into the database",
+				Action:	func(c *cli.Context) error {
+					args := &snapshotArgs {
+						dbname:			c.String("database"),
+						file:			c.String("file"),
+						epochBlockHash:	c.String("hash"),
+						walletFile:		c.String("wallet"),
+					}
+
+					if err := args.ValidateInput(); err != nil {
+						return err
+					}
+
+					if len(args.epochBlockHash) == 0 {
+						return errors.New("argument missing: hash")
+					}
+
+					return ImportSnapshot(args, logger)
+				},
+				Flags:	[]cli.Flag {
+					cli.StringFlag {
+						Name: 	"database, d",
+						Usage: 	"import into the database `FILE`",
+						Value:	"store.db",
+					},
+					cli.StringFlag {
+						Name: 	"file, f",
+						Usage: 	"read the snapshot from `FILE`",
+						Value:	"snapshot.bin",
+					},
+					cli.StringFlag {
+						Name: 	"hash",
+						Usage: 	"only accept a snapshot of the epoch block with hash `HEX`",
+					},
+					cli.StringFlag {
+						Name: 	"wallet, w",
+						Usage: 	"load validator's public key from `FILE`",
+						Value: 	"wallet.txt",
+					},
+				},
+			},
+		},
+	}
+}
+
+func ExportSnapshot(args *snapshotArgs, logger *logging.Logger) error {
+	storage.Init(args.dbname, "")
+	defer storage.TearDown()
+
+	snapshot, err := storage.NewSnapshot()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(args.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := snapshot.Write(file); err != nil {
+		return err
+	}
+
+	logger.Printf("Exported snapshot of epoch block (%x) at height %v with %v accounts to %v\n", snapshot.EpochBlock.Hash[0:8], snapshot.EpochBlock.Height, len(snapshot.State), args.file)
+	fmt.Printf("Epoch block hash: %x\n", snapshot.EpochBlock.Hash)
+
+	return nil
+}
+
+func ImportSnapshot(args *snapshotArgs, logger *logging.Logger) error {
+	epochBlockHash, err := parseHash(args.epochBlockHash)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	snapshot, err := storage.ReadSnapshot(file, epochBlockHash)
+	if err != nil {
+		return err
+	}
+
+	//The shard of the imported state is the one of the validator the node is started with
+	validatorPubKey, err := crypto.ExtractECDSAPublicKeyFromFile(args.walletFile)
+	if err != nil {
+		return err
+	}
+	storage.ValidatorAccAddress = crypto.GetAddressFromPubKey(validatorPubKey)
+
+	storage.Init(args.dbname, "")
+	defer storage.TearDown()
+
+	if err := snapshot.Import(); err != nil {
+		return err
+	}
+
+	logger.Printf("Imported snapshot of epoch block (%x) at height %v with %v accounts into %v\n", snapshot.EpochBlock.Hash[0:8], snapshot.EpochBlock.Height, len(snapshot.State), args.dbname)
+
+	return nil
+}
+
+func parseHash(encoded string) (hash [32]byte, err error) {
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil || len(decoded) != len(hash) {
+		return hash, errors.New(fmt.Sprintf("invalid hash: %v", encoded))
+	}
+
+	copy(hash[:], decoded)
+	return hash, nil
+}
+
+func (args snapshotArgs) ValidateInput() error {
+	if len(args.dbname) == 0 {
+		return errors.New("argument missing: dbname")
+	}
+
+	if len(args.file) == 0 {
+		return errors.New("argument missing: file")
+	}
+
+	return nil
+}
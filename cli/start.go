@@ -2,29 +2,42 @@ package cli
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/oigele/bazo-miner/metrics"
 	"github.com/oigele/bazo-miner/miner"
 	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/rpc"
 	"github.com/oigele/bazo-miner/storage"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
-	"log"
+	"net"
+	"strconv"
+	"strings"
 )
 
 type startArgs struct {
 	dbname 					string
 	myNodeAddress			string
 	bootstrapNodeAddress	string
+	listenAddress			string
+	advertiseAddress		string
 	walletFile				string
 	multisigFile			string
 	commitmentFile			string
 	rootKeyFile				string
 	rootCommitmentFile		string
 	committeeFile			string
+	rpcAddress				string
+	rpcSubmit				bool
+	metricsAddress			string
+	shardAssignment			string
+	pinnedAccounts			string
 }
 
-func GetStartCommand(logger *log.Logger) cli.Command {
+func GetStartCommand(logger *logging.Logger) cli.Command {
 	return cli.Command {
 		Name:	"start",
 		Usage:	"start the miner",
@@ -33,11 +46,18 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 				dbname: 				c.String("database"),
 				myNodeAddress: 			c.String("address"),
 				bootstrapNodeAddress: 	c.String("bootstrap"),
+				listenAddress:			c.String("listen"),
+				advertiseAddress:		c.String("advertise"),
 				walletFile: 			c.String("wallet"),
 				multisigFile: 			c.String("multisig"),
 				commitmentFile:			c.String("commitment"),
 				rootKeyFile:			c.String("rootwallet"),
 				rootCommitmentFile: 	c.String("rootcommitment"),
+				rpcAddress:				c.String("rpc"),
+				rpcSubmit:				c.Bool("rpc-submit"),
+				metricsAddress:			c.String("metrics"),
+				shardAssignment:		c.String("shard-assignment"),
+				pinnedAccounts:			c.String("pin"),
 			}
 
 			if !c.IsSet("bootstrap") {
@@ -60,7 +80,7 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 		Flags:	[]cli.Flag {
 			cli.StringFlag {
 				Name: 	"database, d",
-				Usage: 	"load database of the disk-based key/value store from `FILE`",
+				Usage: 	"load database of the disk-based key/value store from `FILE` (:memory: keeps it in memory)",
 				Value:	"store.db",
 			},
 			cli.StringFlag {
@@ -70,9 +90,17 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 			},
 			cli.StringFlag {
 				Name: 	"bootstrap, b",
-				Usage: 	"connect to bootstrap node at `IP:PORT`",
+				Usage: 	"connect to bootstrap nodes at `IP:PORT[,IP:PORT...]`",
 				Value: 	"localhost:8000",
 			},
+			cli.StringFlag {
+				Name: 	"listen",
+				Usage: 	"listen for connections at `IP:PORT` (all interfaces on the port of --address if not set)",
+			},
+			cli.StringFlag {
+				Name: 	"advertise",
+				Usage: 	"advertise `HOST:PORT` to other nodes, e.g. the public address of a node behind a NAT (--address if not set)",
+			},
 			cli.StringFlag {
 				Name: 	"wallet, w",
 				Usage: 	"load validator's public key from `FILE`",
@@ -97,6 +125,27 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 				Usage: 	"load root's RSA public-private key from `FILE`",
 				Value: 	"commitment.txt",
 			},
+			cli.StringFlag {
+				Name: 	"rpc",
+				Usage: 	"serve the read-only JSON-RPC API at `IP:PORT` (disabled if not set)",
+			},
+			cli.BoolFlag {
+				Name: 	"rpc-submit",
+				Usage: 	"allow transaction submission through the JSON-RPC API",
+			},
+			cli.StringFlag {
+				Name: 	"metrics",
+				Usage: 	"serve metrics for Prometheus at `IP:PORT` (disabled if not set)",
+			},
+			cli.StringFlag {
+				Name: 	"shard-assignment",
+				Usage: 	"assign accounts to shards by `STRATEGY` (hashrange or consistent), has to be the same on all nodes",
+				Value:	"hashrange",
+			},
+			cli.StringFlag {
+				Name: 	"pin",
+				Usage: 	"pin accounts to shards with `HASH:SHARD[,HASH:SHARD...]`, has to be the same on all nodes",
+			},
 			cli.BoolFlag {
 				Name: 	"confirm",
 				Usage: 	"user must press enter before starting the miner",
@@ -105,7 +154,7 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 	}
 }
 
-func GetStartCommitteeCommand(logger *log.Logger) cli.Command {
+func GetStartCommitteeCommand(logger *logging.Logger) cli.Command {
 	return cli.Command {
 		Name:	"committee",
 		Usage:	"start the committee",
@@ -114,8 +163,15 @@ func GetStartCommitteeCommand(logger *log.Logger) cli.Command {
 				dbname: 				c.String("database"),
 				myNodeAddress: 			c.String("address"),
 				bootstrapNodeAddress: 	c.String("bootstrap"),
+				listenAddress:			c.String("listen"),
+				advertiseAddress:		c.String("advertise"),
 				walletFile: 			c.String("wallet"),
 				committeeFile:			c.String("committee"),
+				rpcAddress:				c.String("rpc"),
+				rpcSubmit:				c.Bool("rpc-submit"),
+				metricsAddress:			c.String("metrics"),
+				shardAssignment:		c.String("shard-assignment"),
+				pinnedAccounts:			c.String("pin"),
 			}
 
 			if !c.IsSet("bootstrap") {
@@ -138,7 +194,7 @@ func GetStartCommitteeCommand(logger *log.Logger) cli.Command {
 		Flags:	[]cli.Flag {
 			cli.StringFlag {
 				Name: 	"database, d",
-				Usage: 	"load database of the disk-based key/value store from `FILE`",
+				Usage: 	"load database of the disk-based key/value store from `FILE` (:memory: keeps it in memory)",
 				Value:	"store.db",
 			},
 			cli.StringFlag {
@@ -148,9 +204,17 @@ func GetStartCommitteeCommand(logger *log.Logger) cli.Command {
 			},
 			cli.StringFlag {
 				Name: 	"bootstrap, b",
-				Usage: 	"connect to bootstrap node at `IP:PORT`",
+				Usage: 	"connect to bootstrap nodes at `IP:PORT[,IP:PORT...]`",
 				Value: 	"localhost:8000",
 			},
+			cli.StringFlag {
+				Name: 	"listen",
+				Usage: 	"listen for connections at `IP:PORT` (all interfaces on the port of --address if not set)",
+			},
+			cli.StringFlag {
+				Name: 	"advertise",
+				Usage: 	"advertise `HOST:PORT` to other nodes, e.g. the public address of a node behind a NAT (--address if not set)",
+			},
 			cli.StringFlag {
 				Name: 	"wallet, w",
 				Usage: 	"load validator's public key from `FILE`",
@@ -161,6 +225,27 @@ func GetStartCommitteeCommand(logger *log.Logger) cli.Command {
 				Usage: 	"load validator's RSA public-private key from `FILE`",
 				Value: 	"committee.txt",
 			},
+			cli.StringFlag {
+				Name: 	"rpc",
+				Usage: 	"serve the read-only JSON-RPC API at `IP:PORT` (disabled if not set)",
+			},
+			cli.BoolFlag {
+				Name: 	"rpc-submit",
+				Usage: 	"allow transaction submission through the JSON-RPC API",
+			},
+			cli.StringFlag {
+				Name: 	"metrics",
+				Usage: 	"serve metrics for Prometheus at `IP:PORT` (disabled if not set)",
+			},
+			cli.StringFlag {
+				Name: 	"shard-assignment",
+				Usage: 	"assign accounts to shards by `STRATEGY` (hashrange or consistent), has to be the same on all nodes",
+				Value:	"hashrange",
+			},
+			cli.StringFlag {
+				Name: 	"pin",
+				Usage: 	"pin accounts to shards with `HASH:SHARD[,HASH:SHARD...]`, has to be the same on all nodes",
+			},
 			cli.BoolFlag {
 				Name: 	"confirm",
 				Usage: 	"user must press enter before starting the miner",
@@ -169,9 +254,9 @@ func GetStartCommitteeCommand(logger *log.Logger) cli.Command {
 	}
 }
 
-func StartCommittee(args *startArgs, logger *log.Logger) error {
-	storage.Init(args.dbname, args.bootstrapNodeAddress)
-	p2p.Init(args.myNodeAddress)
+func StartCommittee(args *startArgs, logger *logging.Logger) error {
+	//Entries of several nodes can be told apart when their logs are merged
+	logging.AddFields("node", args.myNodeAddress)
 
 	logger.Printf("Starting committee")
 
@@ -189,6 +274,28 @@ func StartCommittee(args *startArgs, logger *log.Logger) error {
 		return err
 	}
 
+	//Connections to other nodes are authenticated with the committee key, which has to be set before connecting
+	p2p.SetIdentity(crypto.GetAddressFromPubKey(validatorPubKey), committeePrivKey, p2p.IDENTITY_COMMITTEE)
+	p2p.SetCapabilities(p2p.CAPABILITY_COMMITTEE)
+
+	storage.Init(args.dbname, args.bootstrapNodeAddress)
+	p2p.SetListenAddress(args.listenAddress)
+	p2p.SetAdvertiseAddress(args.advertiseAddress)
+	p2p.Init(args.myNodeAddress)
+
+	shardAssignment, err := args.newShardAssignment()
+	if err != nil {
+		return err
+	}
+	miner.SetShardAssignment(shardAssignment)
+
+	if len(args.rpcAddress) > 0 {
+		rpc.Init(args.rpcAddress, args.rpcSubmit, miner.VerifyTx)
+	}
+
+	if len(args.metricsAddress) > 0 {
+		metrics.Init(args.metricsAddress)
+	}
 
 	miner.InitCommittee(validatorPubKey, validatorPrivKey, committeePrivKey)
 
@@ -196,9 +303,9 @@ func StartCommittee(args *startArgs, logger *log.Logger) error {
 
 }
 
-func Start(args *startArgs, logger *log.Logger) error {
-	storage.Init(args.dbname, args.bootstrapNodeAddress)
-	p2p.Init(args.myNodeAddress)
+func Start(args *startArgs, logger *logging.Logger) error {
+	//Entries of several nodes can be told apart when their logs are merged
+	logging.AddFields("node", args.myNodeAddress)
 
 	validatorPubKey, err := crypto.ExtractECDSAPublicKeyFromFile(args.walletFile)
 	if err != nil {
@@ -235,6 +342,29 @@ func Start(args *startArgs, logger *log.Logger) error {
 		return err
 	}
 
+	//Connections to other nodes are authenticated with the commitment key, which has to be set before connecting
+	p2p.SetIdentity(crypto.GetAddressFromPubKey(validatorPubKey), commPrivKey, p2p.IDENTITY_VALIDATOR)
+	p2p.SetCapabilities(p2p.CAPABILITY_VALIDATOR | p2p.CAPABILITY_ARCHIVE)
+
+	storage.Init(args.dbname, args.bootstrapNodeAddress)
+	p2p.SetListenAddress(args.listenAddress)
+	p2p.SetAdvertiseAddress(args.advertiseAddress)
+	p2p.Init(args.myNodeAddress)
+
+	shardAssignment, err := args.newShardAssignment()
+	if err != nil {
+		return err
+	}
+	miner.SetShardAssignment(shardAssignment)
+
+	if len(args.rpcAddress) > 0 {
+		rpc.Init(args.rpcAddress, args.rpcSubmit, miner.VerifyTx)
+	}
+
+	if len(args.metricsAddress) > 0 {
+		metrics.Init(args.metricsAddress)
+	}
+
 	if p2p.IsBootstrap() {
 		miner.InitFirstStart(validatorPubKey, multisigPubKey, &rootPrivKey.PublicKey, commPrivKey, rootCommPrivKey)
 		logger.Printf("Me is Bootstrap!\n")
@@ -273,7 +403,11 @@ func (args startArgs) ValidateInput() error {
 		return errors.New("argument missing: rootCommitmentFile")
 	}
 
-	return nil
+	if _, err := args.newShardAssignment(); err != nil {
+		return err
+	}
+
+	return args.validateNetworkAddresses()
 }
 
 func (args startArgs) ValidateCommitteeInput() error {
@@ -297,25 +431,105 @@ func (args startArgs) ValidateCommitteeInput() error {
 		return errors.New("argument missing: committeeFile")
 	}
 
+	if _, err := args.newShardAssignment(); err != nil {
+		return err
+	}
+
+	return args.validateNetworkAddresses()
+}
+
+//The listen and advertise addresses are optional, but have to contain a port if set. Every bootstrap address needs
+//a port as well.
+func (args startArgs) validateNetworkAddresses() error {
+	for _, bootstrapAddress := range strings.Split(args.bootstrapNodeAddress, ",") {
+		if _, _, err := net.SplitHostPort(strings.TrimSpace(bootstrapAddress)); err != nil {
+			return errors.New(fmt.Sprintf("invalid bootstrapNodeAddress: %v", err))
+		}
+	}
+
+	if len(args.listenAddress) > 0 {
+		if _, _, err := net.SplitHostPort(args.listenAddress); err != nil {
+			return errors.New(fmt.Sprintf("invalid listenAddress: %v", err))
+		}
+	}
+
+	if len(args.advertiseAddress) > 0 {
+		if _, _, err := net.SplitHostPort(args.advertiseAddress); err != nil {
+			return errors.New(fmt.Sprintf("invalid advertiseAddress: %v", err))
+		}
+	}
+
 	return nil
 }
 
+//Pinned accounts are given by the hex encoded hash of their address.
+func (args startArgs) newShardAssignment() (miner.ShardAssignment, error) {
+	var assignment miner.ShardAssignment
+	switch args.shardAssignment {
+	case "", "hashrange":
+		assignment = miner.HashRangeAssignment{}
+	case "consistent":
+		assignment = miner.NewConsistentHashAssignment()
+	default:
+		return nil, errors.New(fmt.Sprintf("invalid shardAssignment: %v", args.shardAssignment))
+	}
+
+	if len(args.pinnedAccounts) == 0 {
+		return assignment, nil
+	}
+
+	pins := make(map[[32]byte]int)
+	for _, pin := range strings.Split(args.pinnedAccounts, ",") {
+		parts := strings.Split(strings.TrimSpace(pin), ":")
+		if len(parts) != 2 {
+			return nil, errors.New(fmt.Sprintf("invalid pin: %v", pin))
+		}
+
+		hash, err := hex.DecodeString(parts[0])
+		if err != nil || len(hash) != 32 {
+			return nil, errors.New(fmt.Sprintf("invalid account hash of pin: %v", pin))
+		}
+		shard, err := strconv.Atoi(parts[1])
+		if err != nil || shard < 1 {
+			return nil, errors.New(fmt.Sprintf("invalid shard of pin: %v", pin))
+		}
+
+		var address [32]byte
+		copy(address[:], hash)
+		pins[address] = shard
+	}
+
+	return miner.NewPinnedAssignment(pins, assignment), nil
+}
+
 func (args startArgs) String() string {
 	return fmt.Sprintf("Starting bazo miner with arguments \n" +
 			"- Database Name:\t\t %v\n" +
 			"- My Address:\t\t\t %v\n" +
 			"- Bootstrap Address:\t\t %v\n" +
+			"- Listen Address:\t\t %v\n" +
+			"- Advertise Address:\t\t %v\n" +
 			"- Wallet File:\t\t\t %v\n" +
 			"- Multisig File:\t\t %v\n" +
 			"- Commitment File:\t\t %v\n" +
 			"- Root Wallet File:\t\t %v\n" +
-			"- Root Commitment File:\t\t %v\n",
+			"- Root Commitment File:\t\t %v\n" +
+			"- RPC Address:\t\t\t %v\n" +
+			"- RPC Submission:\t\t %v\n" +
+			"- Shard Assignment:\t\t %v\n" +
+			"- Pinned Accounts:\t\t %v\n",
 		args.dbname,
 		args.myNodeAddress,
 		args.bootstrapNodeAddress,
+		args.listenAddress,
+		args.advertiseAddress,
 		args.walletFile,
 		args.multisigFile,
 		args.commitmentFile,
 		args.rootKeyFile,
-		args.rootCommitmentFile)
+		args.rootCommitmentFile,
+		args.rpcAddress,
+		args.rpcSubmit,
+		args.shardAssignment,
+		args.pinnedAccounts)
 }
\ No newline at end of file
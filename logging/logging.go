@@ -0,0 +1,322 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Logger writes levelled log entries with key/value fields for a subsystem (miner, p2p, storage, ...). The verbosity
+//can be set per subsystem, such that e.g. the p2p layer can be debugged without drowning in the miner's output.
+//Entries are either written as text or as one JSON object per line, which allows the logs of several validators to
+//be merged and queried.
+type Logger struct {
+	subsystem string
+	fields    []interface{}
+}
+
+type Level int
+
+const (
+	LEVEL_DEBUG Level = iota
+	LEVEL_INFO
+	LEVEL_WARN
+	LEVEL_ERROR
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+
+	TIME_FORMAT = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var (
+	levelNames = map[Level]string{
+		LEVEL_DEBUG: "debug",
+		LEVEL_INFO:  "info",
+		LEVEL_WARN:  "warn",
+		LEVEL_ERROR: "error",
+	}
+
+	config      = newConfig()
+	configMutex = &sync.RWMutex{}
+
+	output      io.Writer
+	outputMutex = &sync.Mutex{}
+)
+
+type Config struct {
+	Level           Level
+	SubsystemLevels map[string]Level
+	Format          string
+	//Fields added to every entry, e.g. the address of the node.
+	Fields []interface{}
+}
+
+func newConfig() *Config {
+	return &Config{
+		Level:           LEVEL_INFO,
+		SubsystemLevels: make(map[string]Level),
+		Format:          FORMAT_TEXT,
+	}
+}
+
+func New(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+//Returns a logger that adds the given key/value pairs to every entry.
+func (logger *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(logger.fields)+len(keysAndValues))
+	fields = append(fields, logger.fields...)
+	fields = append(fields, keysAndValues...)
+
+	return &Logger{logger.subsystem, fields}
+}
+
+func (logger *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	logger.log(LEVEL_DEBUG, msg, keysAndValues)
+}
+
+func (logger *Logger) Info(msg string, keysAndValues ...interface{}) {
+	logger.log(LEVEL_INFO, msg, keysAndValues)
+}
+
+func (logger *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	logger.log(LEVEL_WARN, msg, keysAndValues)
+}
+
+func (logger *Logger) Error(msg string, keysAndValues ...interface{}) {
+	logger.log(LEVEL_ERROR, msg, keysAndValues)
+}
+
+//Printf and Println log unstructured messages at info level.
+func (logger *Logger) Printf(format string, v ...interface{}) {
+	logger.log(LEVEL_INFO, strings.TrimRight(fmt.Sprintf(format, v...), "\n"), nil)
+}
+
+func (logger *Logger) Println(v ...interface{}) {
+	logger.log(LEVEL_INFO, strings.TrimRight(fmt.Sprintln(v...), "\n"), nil)
+}
+
+//Logs the message at error level and exits.
+func (logger *Logger) Fatal(v ...interface{}) {
+	logger.log(LEVEL_ERROR, fmt.Sprint(v...), nil)
+	os.Exit(1)
+}
+
+func (logger *Logger) Enabled(level Level) bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	if subsystemLevel, exists := config.SubsystemLevels[logger.subsystem]; exists {
+		return level >= subsystemLevel
+	}
+
+	return level >= config.Level
+}
+
+func (logger *Logger) log(level Level, msg string, keysAndValues []interface{}) {
+	if !logger.Enabled(level) {
+		return
+	}
+
+	configMutex.RLock()
+	format := config.Format
+	fields := make([]interface{}, 0, len(config.Fields)+len(logger.fields)+len(keysAndValues))
+	fields = append(fields, config.Fields...)
+	configMutex.RUnlock()
+	fields = append(fields, logger.fields...)
+	fields = append(fields, keysAndValues...)
+
+	caller := ""
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+
+	var entry []byte
+	if format == FORMAT_JSON {
+		entry = formatJSON(time.Now(), level, logger.subsystem, caller, msg, fields)
+	} else {
+		entry = formatText(time.Now(), level, logger.subsystem, caller, msg, fields)
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if output == nil {
+		output = newDefaultOutput()
+	}
+	output.Write(entry)
+}
+
+func formatText(now time.Time, level Level, subsystem string, caller string, msg string, fields []interface{}) []byte {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%v %-5v %v %v: %v", now.Format(TIME_FORMAT), strings.ToUpper(levelNames[level]), caller, subsystem, msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		value := fieldValue(fieldAt(fields, i+1))
+		text := fmt.Sprint(value)
+		if strings.ContainsAny(text, " \t\n\"=") {
+			text = strconv.Quote(text)
+		}
+		fmt.Fprintf(&builder, " %v=%v", fieldKey(fields[i]), text)
+	}
+	builder.WriteByte('\n')
+
+	return []byte(builder.String())
+}
+
+func formatJSON(now time.Time, level Level, subsystem string, caller string, msg string, fields []interface{}) []byte {
+	entry := map[string]interface{}{
+		"time":      now.Format(TIME_FORMAT),
+		"level":     levelNames[level],
+		"subsystem": subsystem,
+		"caller":    caller,
+		"msg":       msg,
+	}
+	for i := 0; i < len(fields); i += 2 {
+		entry[fieldKey(fields[i])] = fieldValue(fieldAt(fields, i+1))
+	}
+
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		encoded, _ = json.Marshal(map[string]interface{}{
+			"time":  entry["time"],
+			"level": entry["level"],
+			"msg":   msg,
+			"error": err.Error(),
+		})
+	}
+
+	return append(encoded, '\n')
+}
+
+func fieldAt(fields []interface{}, i int) interface{} {
+	if i < len(fields) {
+		return fields[i]
+	}
+
+	return "MISSING"
+}
+
+func fieldKey(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+
+	return fmt.Sprint(key)
+}
+
+//Hashes and addresses are logged as hex, errors by their message. Other values are kept as they are, such that
+//numbers stay numbers in JSON.
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case error:
+		return v.Error()
+	case string, bool, int, int8, int16, int32, int64, uint, uint16, uint32, uint64, float32, float64:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(value)
+	if (rv.Kind() == reflect.Array || rv.Kind() == reflect.Slice) && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return fmt.Sprintf("%x", value)
+	}
+
+	return fmt.Sprint(value)
+}
+
+//All entries are written to stdout and to a log file of this run, as well as the entries of the standard logger.
+func newDefaultOutput() io.Writer {
+	filename := "LoggerMiner" + time.Now().Format("150405") + ".log"
+	logFile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		log.Fatalf("error opening file: %v", err)
+	}
+
+	writer := io.MultiWriter(os.Stdout, logFile)
+	log.SetOutput(writer)
+	return writer
+}
+
+//Replaces the default output of stdout and the log file.
+func SetOutput(writer io.Writer) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output = writer
+}
+
+func Configure(newConfig *Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if newConfig.SubsystemLevels == nil {
+		newConfig.SubsystemLevels = make(map[string]Level)
+	}
+	config = newConfig
+}
+
+//Adds key/value pairs to every entry of all loggers, e.g. the address of the node.
+func AddFields(keysAndValues ...interface{}) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	config.Fields = append(config.Fields, keysAndValues...)
+}
+
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.ToLower(name) == levelName {
+			return level, nil
+		}
+	}
+
+	return LEVEL_INFO, errors.New(fmt.Sprintf("unknown log level: %v", name))
+}
+
+//Parses the verbosity of the subsystems in the form "miner=debug,p2p=warn".
+func ParseSubsystemLevels(verbosity string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	if len(verbosity) == 0 {
+		return levels, nil
+	}
+
+	for _, setting := range strings.Split(verbosity, ",") {
+		parts := strings.SplitN(strings.TrimSpace(setting), "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, errors.New(fmt.Sprintf("invalid subsystem verbosity: %v", setting))
+		}
+
+		level, err := ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[parts[0]] = level
+	}
+
+	return levels, nil
+}
+
+//Returns the names of the levels, e.g. for usage messages.
+func LevelNames() string {
+	var names []string
+	for level := LEVEL_DEBUG; level <= LEVEL_ERROR; level++ {
+		names = append(names, levelNames[level])
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func captureOutput(t *testing.T, config *Config) *bytes.Buffer {
+	buffer := new(bytes.Buffer)
+	SetOutput(buffer)
+	Configure(config)
+
+	return buffer
+}
+
+func TestLevels(t *testing.T) {
+	buffer := captureOutput(t, &Config{
+		Level:           LEVEL_INFO,
+		SubsystemLevels: map[string]Level{"p2p": LEVEL_DEBUG, "miner": LEVEL_WARN},
+		Format:          FORMAT_TEXT,
+	})
+	defer Configure(newConfig())
+
+	New("storage").Debug("storage debug")
+	New("storage").Info("storage info")
+	New("p2p").Debug("p2p debug")
+	New("miner").Info("miner info")
+	New("miner").Printf("miner printf %d", 1)
+	New("miner").Error("miner error")
+
+	output := buffer.String()
+	for _, expected := range []string{"storage info", "p2p debug", "miner error"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Entry %q not logged:\n%v", expected, output)
+		}
+	}
+	for _, unexpected := range []string{"storage debug", "miner info", "miner printf"} {
+		if strings.Contains(output, unexpected) {
+			t.Errorf("Entry %q logged below its level:\n%v", unexpected, output)
+		}
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	buffer := captureOutput(t, &Config{Level: LEVEL_DEBUG, Format: FORMAT_TEXT})
+	defer Configure(newConfig())
+
+	New("miner").With("shard", 2).Info("Block mined", "hash", [4]byte{0xab, 0xcd, 0, 1}, "height", 7, "error", errors.New("some error"))
+
+	output := buffer.String()
+	for _, expected := range []string{"INFO ", "logging_test.go:", "miner: Block mined", "shard=2", "hash=abcd0001", "height=7", `error="some error"`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Text entry does not contain %q: %v", expected, output)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buffer := captureOutput(t, &Config{Level: LEVEL_DEBUG, Format: FORMAT_JSON})
+	defer Configure(newConfig())
+	AddFields("node", "127.0.0.1:8000")
+
+	New("p2p").Warn("Miner disconnected", "peer", "127.0.0.1:8001", "height", uint32(3))
+	New("p2p").Printf("Unstructured %v\n", "message")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 entries, got %v: %v", len(lines), buffer.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Entry is not valid JSON: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"level":     "warn",
+		"subsystem": "p2p",
+		"msg":       "Miner disconnected",
+		"node":      "127.0.0.1:8000",
+		"peer":      "127.0.0.1:8001",
+		"height":    float64(3),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Field %v is %v, expected %v", key, entry[key], value)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["msg"] != "Unstructured message" {
+		t.Errorf("Unstructured entry not logged as message: %v", lines[1])
+	}
+}
+
+func TestParseSubsystemLevels(t *testing.T) {
+	levels, err := ParseSubsystemLevels("miner=warn, p2p=DEBUG")
+	if err != nil || levels["miner"] != LEVEL_WARN || levels["p2p"] != LEVEL_DEBUG {
+		t.Errorf("Subsystem levels not parsed: %v, %v", levels, err)
+	}
+
+	for _, invalid := range []string{"miner", "miner=verbose", "=info"} {
+		if _, err := ParseSubsystemLevels(invalid); err == nil {
+			t.Errorf("Invalid verbosity %q accepted", invalid)
+		}
+	}
+}
@@ -2,13 +2,13 @@ package main
 
 import (
 	"github.com/oigele/bazo-miner/cli"
-	"github.com/oigele/bazo-miner/storage"
+	"github.com/oigele/bazo-miner/logging"
 	cli2 "github.com/urfave/cli"
 	"os"
 )
 
 func main() {
-	logger := storage.InitLogger()
+	logger := logging.New("cli")
 
 	app := cli2.NewApp()
 
@@ -16,11 +16,30 @@ func main() {
 	app.Usage = "the command line interface for running a full Bazo blockchain node implemented in Go."
 	app.Version = "1.0.0"
 	app.EnableBashCompletion = true
+	app.Flags = []cli2.Flag {
+		cli2.StringFlag {
+			Name:	"log-level",
+			Usage:	"log entries of at least `LEVEL` (" + logging.LevelNames() + ")",
+			Value:	"info",
+		},
+		cli2.StringFlag {
+			Name:	"log-verbosity",
+			Usage:	"override the log level per subsystem, e.g. `miner=warn,p2p=debug`",
+		},
+		cli2.StringFlag {
+			Name:	"log-format",
+			Usage:	"write log entries as `FORMAT` (text or json)",
+			Value:	logging.FORMAT_TEXT,
+		},
+	}
+	app.Before = cli.ConfigureLogging
 	app.Commands = []cli2.Command {
 		cli.GetStartCommand(logger),
 		cli.GetStartCommitteeCommand(logger),
+		cli.GetStartLightCommand(logger),
 		cli.GetGenerateWalletCommand(),
 		cli.GetGenerateCommitmentCommand(),
+		cli.GetSnapshotCommand(logger),
 	}
 
 	err := app.Run(os.Args)
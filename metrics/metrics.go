@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oigele/bazo-miner/logging"
+)
+
+//The metrics are exposed in the Prometheus text format, such that they can be scraped without any client library.
+//Every package registers its own metrics as package variables, values of gauges are only collected when scraped.
+const (
+	METRICS_PATH   = "/metrics"
+	METRICS_PREFIX = "bazo_"
+	CONTENT_TYPE   = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	logger *logging.Logger
+
+	registry      []collector
+	registryMutex = &sync.Mutex{}
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+type Counter struct {
+	value uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+//CounterVec is a family of counters, one for each value of its label.
+type CounterVec struct {
+	name     string
+	help     string
+	label    string
+	counters map[string]*Counter
+	mutex    sync.Mutex
+}
+
+//Counter without labels.
+type counterMetric struct {
+	*Counter
+	name string
+	help string
+}
+
+//Gauges read their value from the running node when the metrics are scraped.
+type Gauge struct {
+	name  string
+	help  string
+	label string
+	fn    func() map[string]float64
+}
+
+func NewCounter(name string, help string) *Counter {
+	metric := &counterMetric{new(Counter), METRICS_PREFIX + name, help}
+	register(metric)
+	return metric.Counter
+}
+
+func NewCounterVec(name string, help string, label string) *CounterVec {
+	vec := &CounterVec{
+		name:     METRICS_PREFIX + name,
+		help:     help,
+		label:    label,
+		counters: make(map[string]*Counter),
+	}
+	register(vec)
+	return vec
+}
+
+func NewGaugeFunc(name string, help string, fn func() float64) *Gauge {
+	return NewGaugeVecFunc(name, help, "", func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	})
+}
+
+//fn returns the value of the gauge for each value of the label.
+func NewGaugeVecFunc(name string, help string, label string, fn func() map[string]float64) *Gauge {
+	gauge := &Gauge{METRICS_PREFIX + name, help, label, fn}
+	register(gauge)
+	return gauge
+}
+
+func register(c collector) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, c)
+}
+
+func (vec *CounterVec) WithLabel(value string) *Counter {
+	vec.mutex.Lock()
+	defer vec.mutex.Unlock()
+
+	counter, exists := vec.counters[value]
+	if !exists {
+		counter = new(Counter)
+		vec.counters[value] = counter
+	}
+
+	return counter
+}
+
+func (metric *counterMetric) write(w io.Writer) {
+	writeHeader(w, metric.name, metric.help, "counter")
+	fmt.Fprintf(w, "%v %v\n", metric.name, metric.Value())
+}
+
+func (vec *CounterVec) write(w io.Writer) {
+	vec.mutex.Lock()
+	values := make(map[string]float64, len(vec.counters))
+	for value, counter := range vec.counters {
+		values[value] = float64(counter.Value())
+	}
+	vec.mutex.Unlock()
+
+	writeHeader(w, vec.name, vec.help, "counter")
+	writeSamples(w, vec.name, vec.label, values)
+}
+
+func (gauge *Gauge) write(w io.Writer) {
+	writeHeader(w, gauge.name, gauge.help, "gauge")
+	writeSamples(w, gauge.name, gauge.label, gauge.fn())
+}
+
+func writeHeader(w io.Writer, name string, help string, metricType string) {
+	fmt.Fprintf(w, "# HELP %v %v\n", name, help)
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, metricType)
+}
+
+//Samples are sorted by their label value, such that consecutive scrapes are easy to compare.
+func writeSamples(w io.Writer, name string, label string, values map[string]float64) {
+	labelValues := make([]string, 0, len(values))
+	for value := range values {
+		labelValues = append(labelValues, value)
+	}
+	sort.Strings(labelValues)
+
+	for _, value := range labelValues {
+		if label == "" {
+			fmt.Fprintf(w, "%v %v\n", name, values[value])
+		} else {
+			fmt.Fprintf(w, "%v{%v=\"%v\"} %v\n", name, label, escapeLabelValue(value), values[value])
+		}
+	}
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+//Writes all registered metrics in the Prometheus text format.
+func WriteMetrics(w io.Writer) {
+	registryMutex.Lock()
+	collectors := make([]collector, len(registry))
+	copy(collectors, registry)
+	registryMutex.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	WriteMetrics(w)
+}
+
+//Entry point for the metrics package. The metrics are served at METRICS_PATH in their own goroutine.
+func Init(address string) {
+	logger = logging.New("metrics")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(METRICS_PATH, handleRequest)
+
+	go func() {
+		logger.Printf("Starting metrics server at %v%v\n", address, METRICS_PATH)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Printf("Metrics server stopped: %v\n", err)
+		}
+	}()
+}
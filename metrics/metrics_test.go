@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	counter := NewCounter("test_counter_total", "Test counter.")
+	counter.Add(2)
+	counter.Inc()
+
+	vec := NewCounterVec("test_messages_total", "Test counter vector.", "type")
+	vec.WithLabel("BLOCK_BRDCST").Inc()
+	vec.WithLabel("BLOCK_BRDCST").Inc()
+	vec.WithLabel("FUNDSTX_BRDCST").Inc()
+
+	height := 5
+	NewGaugeFunc("test_height", "Test gauge.", func() float64 {
+		return float64(height)
+	})
+	NewGaugeVecFunc("test_pool_size", "Test gauge vector.", "pool", func() map[string]float64 {
+		return map[string]float64{"open": 1, "in\"valid": 2}
+	})
+
+	height = 7
+	var buffer bytes.Buffer
+	WriteMetrics(&buffer)
+	output := buffer.String()
+
+	expected := []string{
+		"# HELP bazo_test_counter_total Test counter.\n",
+		"# TYPE bazo_test_counter_total counter\n",
+		"bazo_test_counter_total 3\n",
+		"bazo_test_messages_total{type=\"BLOCK_BRDCST\"} 2\nbazo_test_messages_total{type=\"FUNDSTX_BRDCST\"} 1\n",
+		"# TYPE bazo_test_height gauge\nbazo_test_height 7\n",
+		"bazo_test_pool_size{pool=\"in\\\"valid\"} 2\nbazo_test_pool_size{pool=\"open\"} 1\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("Metrics do not contain %q:\n%v", line, output)
+		}
+	}
+}
+
+func TestHandleRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleRequest(rec, httptest.NewRequest(http.MethodGet, METRICS_PATH, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != CONTENT_TYPE {
+		t.Errorf("Metrics not served: %v, %v\n", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	handleRequest(rec, httptest.NewRequest(http.MethodPost, METRICS_PATH, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST request was not rejected: %v\n", rec.Code)
+	}
+}
@@ -0,0 +1,770 @@
+package miner
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+//The validators of a shard agree on every block of the shard before it is broadcast, see protocol/quorum.go. The
+//proposer of a round is chosen round robin among the validators of the shard. A validator prevotes for the proposed
+//block once it checked it, executes the block once a quorum prevoted for it and commits to the resulting relative
+//state. With a quorum of commit votes the block is final, the votes form its certificate. A validator that committed
+//to a block is locked on it and only prevotes for another block if a quorum prevoted for that one in a later round.
+//If a round does not finish in time, the next round starts with the next proposer, such that a crashed validator does
+//not stall the shard. With n validators, a quorum of 2n/3+1 tolerates (n-1)/3 faulty validators.
+//Like state transitions, proposals and votes are not relayed, the validators of a network are connected to each other.
+
+//Agreement on the block of one height, only used by the mining routine.
+type agreement struct {
+	height      uint32
+	round       int
+	lockedHash  [32]byte
+	lockedRound int
+	//Last proposal a quorum prevoted for, it is proposed again in later rounds
+	validProposal *protocol.Proposal
+}
+
+type stashedProposal struct {
+	proposal *protocol.Proposal
+	verified bool
+}
+
+type stashedVote struct {
+	vote     *protocol.Vote
+	verified bool
+}
+
+var (
+	currentAgreement *agreement
+
+	//key: height, value: proposals and votes for the blocks of this height, by the hash of the whole message
+	proposalStash = make(map[uint32]map[[32]byte]*stashedProposal)
+	voteStash     = make(map[uint32]map[[32]byte]*stashedVote)
+	//Proposals and votes below this height are dropped
+	agreementFloor uint32
+	agreementMutex = &sync.Mutex{}
+	//Signals the mining routine that a proposal or vote arrived
+	agreementUpdate = make(chan bool, 1)
+)
+
+//Hashes of the validators of the shard, sorted such that all validators agree on the proposers.
+func shardValidators(shardID int) [][32]byte {
+	var validators [][32]byte
+	if ValidatorShardMap == nil {
+		return validators
+	}
+
+	for address, id := range ValidatorShardMap.ValMapping {
+		if id == shardID {
+			validators = append(validators, protocol.SerializeHashContent(address))
+		}
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i][:], validators[j][:]) < 0
+	})
+
+	return validators
+}
+
+//Votes of n validators needed to agree, any two quorums share a correct validator.
+func quorum(n int) int {
+	return 2*n/3 + 1
+}
+
+//The proposers rotate with the height, such that not always the same validator proposes first, and with the round,
+//such that a crashed proposer is skipped.
+func proposerOf(validators [][32]byte, height uint32, round int) [32]byte {
+	if len(validators) == 0 {
+		return [32]byte{}
+	}
+
+	return validators[(int(height)+round)%len(validators)]
+}
+
+//Agrees with the other validators of the shard on the block after the given one. Runs one round, if no block is
+//agreed on the next call runs the next round, since the last block stays the same.
+func agreeOnBlock(hashPrevBlock [32]byte, heightPrevBlock uint32) {
+	height := heightPrevBlock + 1
+	if currentAgreement == nil || currentAgreement.height != height {
+		currentAgreement = &agreement{height: height, lockedRound: -1}
+		pruneAgreementStash(height)
+	} else {
+		currentAgreement.round++
+	}
+	a := currentAgreement
+
+	self := protocol.SerializeHashContent(ValidatorAccAddress)
+	validators := shardValidators(storage.ThisShardID)
+	if !containsAddress(validators, self) {
+		logger.Warn("Not a validator of the shard", "shard", storage.ThisShardID, "height", height)
+		time.Sleep(BLOCK_INTERVAL * time.Second)
+		return
+	}
+
+	//The other validators may have agreed on the block without this one, e.g. because it was too slow
+	if block, load := agreedBlock(height, validators); block != nil {
+		if err := validateCertificate(block); err != nil {
+			logger.Warn("Invalid certificate of agreed block", "hash", block.Hash[0:8], "height", height, "error", err)
+			return
+		}
+		if err := validate(block, false); err != nil {
+			logger.Error("Agreed block could not be validated", "hash", block.Hash[0:8], "height", height, "shard", storage.ThisShardID, "error", err)
+			return
+		}
+		logger.Info("Took over agreed block", "hash", block.Hash[0:8], "height", height, "shard", storage.ThisShardID)
+		finishBlock(block, load, false)
+		return
+	}
+
+	var proposal *protocol.Proposal
+	if proposerOf(validators, height, a.round) == self {
+		if a.validProposal != nil {
+			proposal = protocol.NewProposal(a.round, a.validProposal.Load, a.validProposal.Block, self)
+		} else {
+			block := proposeBlock(hashPrevBlock, heightPrevBlock)
+			if block == nil {
+				return
+			}
+			proposal = protocol.NewProposal(a.round, ownShardLoad(block), block, self)
+		}
+
+		signature, err := crypto.SignMessageWithRSAKey(commPrivKey, proposal.Message())
+		if err != nil {
+			logger.Error("Signing proposal failed", "height", height, "round", a.round, "error", err)
+			return
+		}
+		proposal.Signature = signature
+		stashProposal(proposal, true)
+		broadcastProposal(proposal)
+		logger.Info("Proposed block", "hash", proposal.Block.Hash[0:8], "height", height, "round", a.round, "shard", storage.ThisShardID)
+	} else {
+		waitForAgreement(BFT_PROPOSAL_TIMEOUT*time.Second, func() bool {
+			proposal = nextProposal(height, a.round, validators)
+			return proposal != nil || certificateFor(height, validators) != nil
+		})
+		if proposal == nil {
+			proposer := proposerOf(validators, height, a.round)
+			logger.Warn("No proposal received", "height", height, "round", a.round, "proposer", proposer[0:8])
+			return
+		}
+		//The other validators are in a later round already
+		a.round = proposal.Round
+	}
+	block := proposal.Block
+
+	blockValidation.Lock()
+	data, err := checkProposal(a, proposal, hashPrevBlock, validators)
+	blockValidation.Unlock()
+	if err != nil {
+		logger.Warn("Not prevoting for proposal", "hash", block.Hash[0:8], "height", height, "round", a.round, "error", err)
+		return
+	}
+
+	if err := castVote(protocol.VOTE_PREVOTE, height, a.round, block.Hash, [32]byte{}); err != nil {
+		logger.Error("Prevote failed", "height", height, "round", a.round, "error", err)
+		return
+	}
+	//A certificate for another round ends the round early, the block is taken over with the next call
+	q := quorum(len(validators))
+	prevoted := false
+	waitForAgreement(BFT_VOTE_TIMEOUT*time.Second, func() bool {
+		prevoted = len(agreementVotes(validators, protocol.VOTE_PREVOTE, height, a.round, block.Hash, [32]byte{})) >= q
+		return prevoted || certificateFor(height, validators) != nil
+	})
+	if !prevoted {
+		logger.Warn("No quorum prevoted", "hash", block.Hash[0:8], "height", height, "round", a.round)
+		return
+	}
+	a.validProposal = proposal
+
+	blockValidation.Lock()
+	stateCopy, err := applyBlock(data, false)
+	blockValidation.Unlock()
+	if err != nil {
+		logger.Error("Proposed block could not be applied", "hash", block.Hash[0:8], "height", height, "round", a.round, "error", err)
+		return
+	}
+
+	stateHash := protocol.RelativeStateHash(storage.RelativeState)
+	a.lockedHash, a.lockedRound = block.Hash, a.round
+	if err := castVote(protocol.VOTE_COMMIT, height, a.round, block.Hash, stateHash); err != nil {
+		logger.Error("Commit vote failed", "height", height, "round", a.round, "error", err)
+	}
+	var commits []*protocol.Vote
+	waitForAgreement(BFT_VOTE_TIMEOUT*time.Second, func() bool {
+		commits = agreementVotes(validators, protocol.VOTE_COMMIT, height, a.round, block.Hash, stateHash)
+		return len(commits) >= q || certificateFor(height, validators) != nil
+	})
+	if len(commits) < q {
+		logger.Warn("No quorum committed", "hash", block.Hash[0:8], "height", height, "round", a.round, "commits", len(commits))
+		blockValidation.Lock()
+		resetState(stateCopy)
+		blockValidation.Unlock()
+		return
+	}
+
+	//The certificate is not covered by the block hash, the block is final now
+	block.Certificate = protocol.NewQuorumCertificate(commits)
+	blockValidation.Lock()
+	postValidate(data, false)
+	blockValidation.Unlock()
+	logger.Info("Agreed on block", "hash", block.Hash[0:8], "height", height, "round", a.round, "shard", storage.ThisShardID, "commits", len(commits))
+
+	//Only the proposer broadcasts, the others answer requests for the block and the state transition
+	finishBlock(block, proposal.Load, proposal.Proposer == self)
+}
+
+//Creates the block proposed by this validator.
+func proposeBlock(hashPrevBlock [32]byte, heightPrevBlock uint32) *protocol.Block {
+	logger.Debug("Create next block")
+	//This is the same mutex that is claimed at the beginning of a block validation. The reason we do this is
+	//that before start mining a new block we empty the mempool which contains tx data that is likely to be
+	//validated with block validation, so we wait in order to not work on tx data that is already validated
+	//when we finish the block.
+	blockValidation.Lock()
+	currentBlock := newBlock(hashPrevBlock, [crypto.COMM_PROOF_LENGTH]byte{}, heightPrevBlock+1)
+
+	//Set shard identifier in block (not necessary? It's already written inside the block)
+	currentBlock.ShardId = storage.ThisShardID
+	logger.Debug("Mining in shard", "shard", storage.ThisShardID)
+
+	logger.Debug("Prepare next block")
+	prepareBlock(currentBlock)
+	blockValidation.Unlock()
+	logger.Debug("Prepared next block")
+	blockBeingProcessed = currentBlock
+	logger.Debug("Finalize next block")
+	err := finalizeBlock(currentBlock)
+
+	logger.Debug("Finalized next block", "height", blockBeingProcessed.Height)
+	if err != nil {
+		logger.Error("Finalizing block failed", "height", blockBeingProcessed.Height, "shard", storage.ThisShardID, "error", err)
+		return nil
+	}
+
+	logger.Info("Block mined", "hash", currentBlock.Hash[0:8], "height", currentBlock.Height, "shard", storage.ThisShardID)
+	return currentBlock
+}
+
+//Keeps the state transition of the agreed block, such that the validator can answer requests for it.
+func finishBlock(block *protocol.Block, load protocol.ShardLoad, broadcast bool) {
+	//only the shards which do not create the epoch block need to send out a state transition
+	if storage.ThisShardID != 1 {
+		commitmentProof, err := crypto.SignMessageWithRSAKey(commPrivKey, fmt.Sprint(block.Height))
+		if err != nil {
+			logger.Error("Could not create the commitment proof", "shard", storage.ThisShardID, "height", block.Height, "error", err)
+			return
+		}
+		stateTransition := protocol.NewStateTransition(storage.RelativeState, storage.OutboundReceipts, load, int(block.Height), storage.ThisShardID, commitmentProof)
+		storage.WriteToOwnStateTransitionkStash(stateTransition)
+		if broadcast {
+			broadcastStateTransition(stateTransition)
+		}
+	}
+	if broadcast {
+		broadcastBlock(block)
+	}
+	logger.Debug("Validated block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height)
+}
+
+//Checks the proposal and the lock of the validator. The caller holds blockValidation.
+func checkProposal(a *agreement, proposal *protocol.Proposal, hashPrevBlock [32]byte, validators [][32]byte) (blockData, error) {
+	block := proposal.Block
+	if block.Height != a.height || block.ShardId != storage.ThisShardID || block.PrevHash != hashPrevBlock {
+		return blockData{}, errors.New(fmt.Sprintf("Proposed block (%x) does not follow the last block (%x).", block.Hash[0:8], hashPrevBlock[0:8]))
+	}
+	if storage.ReadClosedBlock(block.Hash) != nil {
+		return blockData{}, errors.New(fmt.Sprintf("Proposed block (%x) has already been validated.", block.Hash[0:8]))
+	}
+	if a.lockedRound >= 0 && a.lockedHash != block.Hash && prevoteQuorumRound(a.height, block.Hash, validators) <= a.lockedRound {
+		return blockData{}, errors.New(fmt.Sprintf("Locked on block %x in round %d.", a.lockedHash[0:8], a.lockedRound))
+	}
+	if !ValidateBlockSender(block) {
+		return blockData{}, errors.New(fmt.Sprintf("Beneficiary of proposed block (%x) is not a validator of the shard.", block.Hash[0:8]))
+	}
+
+	return checkBlock(block, false)
+}
+
+//Certificate of the block with a quorum of commit votes and the load of its proposal, if the other validators agreed
+//on a block of the height already. If they are at later heights, the block is downloaded.
+func agreedBlock(height uint32, validators [][32]byte) (*protocol.Block, protocol.ShardLoad) {
+	certificate := certificateFor(height, validators)
+	if certificate != nil {
+		agreementMutex.Lock()
+		for _, stashed := range proposalStash[height] {
+			if stashed.proposal.Block.Hash == certificate.BlockHash {
+				block := *stashed.proposal.Block
+				block.Certificate = certificate
+				agreementMutex.Unlock()
+				return &block, stashed.proposal.Load
+			}
+		}
+		agreementMutex.Unlock()
+	}
+
+	agreementMutex.Lock()
+	behind := false
+	for voteHeight, votes := range voteStash {
+		for _, stashed := range votes {
+			if voteHeight > height && stashed.vote.ShardID == storage.ThisShardID {
+				behind = true
+			}
+		}
+	}
+	agreementMutex.Unlock()
+	if certificate == nil && !behind {
+		return nil, protocol.ShardLoad{}
+	}
+
+	for _, blocks := range syncBlocks([]blockRange{{storage.ThisShardID, height, 1}}) {
+		for _, block := range blocks {
+			if block.Height == height && block.Certificate != nil {
+				return block, ownShardLoad(block)
+			}
+		}
+	}
+
+	return nil, protocol.ShardLoad{}
+}
+
+//Waits until the condition holds for the proposals and votes received so far, at most for the given time.
+func waitForAgreement(timeout time.Duration, condition func() bool) bool {
+	deadline := time.After(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		select {
+		case <-agreementUpdate:
+		case <-deadline:
+			return condition()
+		}
+	}
+}
+
+func castVote(stage uint8, height uint32, round int, blockHash [32]byte, stateHash [32]byte) error {
+	vote := protocol.NewVote(stage, height, storage.ThisShardID, round, blockHash, stateHash, protocol.SerializeHashContent(ValidatorAccAddress))
+	signature, err := crypto.SignMessageWithRSAKey(commPrivKey, vote.Message())
+	if err != nil {
+		return err
+	}
+	vote.Signature = signature
+
+	stashVote(vote, true)
+	broadcastVote(vote)
+	return nil
+}
+
+//Checks the signature of a validator of the shard over a message of the agreement.
+func verifyAgreementSignature(validators [][32]byte, signer [32]byte, message string, signature [crypto.COMM_PROOF_LENGTH]byte) error {
+	if !containsAddress(validators, signer) {
+		return errors.New(fmt.Sprintf("%x is not a validator of the shard.", signer[0:8]))
+	}
+
+	acc, err := storage.GetAccount(signer)
+	if err != nil {
+		return err
+	}
+
+	commitmentPubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitmentKey)
+	if err != nil {
+		return errors.New("Invalid commitment key in account.")
+	}
+
+	return crypto.VerifyMessageWithRSAKey(commitmentPubKey, message, signature)
+}
+
+//Proposal of the earliest round not before the given one, from the proposer of its round.
+func nextProposal(height uint32, round int, validators [][32]byte) *protocol.Proposal {
+	agreementMutex.Lock()
+	var candidates []*stashedProposal
+	for _, stashed := range proposalStash[height] {
+		if stashed.proposal.Round >= round && stashed.proposal.Block.ShardId == storage.ThisShardID {
+			candidates = append(candidates, stashed)
+		}
+	}
+	agreementMutex.Unlock()
+
+	var next *protocol.Proposal
+	for _, stashed := range candidates {
+		proposal := stashed.proposal
+		if next != nil && proposal.Round >= next.Round {
+			continue
+		}
+		if !verifyStashed(&stashed.verified, func() error {
+			if proposal.Proposer != proposerOf(validators, height, proposal.Round) {
+				return errors.New(fmt.Sprintf("%x is not the proposer of round %d.", proposal.Proposer[0:8], proposal.Round))
+			}
+			return verifyAgreementSignature(validators, proposal.Proposer, proposal.Message(), proposal.Signature)
+		}, protocol.SerializeHashContent(proposal.Encode())) {
+			continue
+		}
+		next = proposal
+	}
+
+	return next
+}
+
+//Verified votes of distinct validators for the block in the given stage and round.
+func agreementVotes(validators [][32]byte, stage uint8, height uint32, round int, blockHash [32]byte, stateHash [32]byte) []*protocol.Vote {
+	agreementMutex.Lock()
+	var candidates []*stashedVote
+	for _, stashed := range voteStash[height] {
+		vote := stashed.vote
+		if vote.Stage == stage && vote.ShardID == storage.ThisShardID && vote.Round == round && vote.BlockHash == blockHash && vote.StateHash == stateHash {
+			candidates = append(candidates, stashed)
+		}
+	}
+	agreementMutex.Unlock()
+
+	return verifiedVotes(candidates, validators)
+}
+
+func verifiedVotes(candidates []*stashedVote, validators [][32]byte) []*protocol.Vote {
+	var votes []*protocol.Vote
+	counted := make(map[[32]byte]bool)
+	for _, stashed := range candidates {
+		vote := stashed.vote
+		if counted[vote.Validator] {
+			continue
+		}
+		if !verifyStashed(&stashed.verified, func() error {
+			return verifyAgreementSignature(validators, vote.Validator, vote.Message(), vote.Signature)
+		}, protocol.SerializeHashContent(vote.Encode())) {
+			continue
+		}
+		counted[vote.Validator] = true
+		votes = append(votes, vote)
+	}
+
+	return votes
+}
+
+//Verifies a stashed proposal, vote or endorsement once. Messages with an invalid signature are reported, the ones of
+//validators outside of the shard are kept, since the validator assignment may not be up to date.
+func verifyStashed(verified *bool, verify func() error, hash [32]byte) bool {
+	agreementMutex.Lock()
+	done := *verified
+	agreementMutex.Unlock()
+	if done {
+		return true
+	}
+
+	if err := verify(); err != nil {
+		logger.Debug("Proposal or vote not verified", "error", err)
+		if err == rsa.ErrVerification {
+			p2p.ReportInvalid(hash, p2p.MISBEHAVIOR_PROTOCOL_VIOLATION)
+		}
+		return false
+	}
+
+	agreementMutex.Lock()
+	*verified = true
+	agreementMutex.Unlock()
+	return true
+}
+
+//Latest round in which a quorum prevoted for the block, -1 if there is none.
+func prevoteQuorumRound(height uint32, blockHash [32]byte, validators [][32]byte) int {
+	agreementMutex.Lock()
+	rounds := make(map[int][]*stashedVote)
+	for _, stashed := range voteStash[height] {
+		if stashed.vote.Stage == protocol.VOTE_PREVOTE && stashed.vote.ShardID == storage.ThisShardID && stashed.vote.BlockHash == blockHash {
+			rounds[stashed.vote.Round] = append(rounds[stashed.vote.Round], stashed)
+		}
+	}
+	agreementMutex.Unlock()
+
+	latest := -1
+	for round, candidates := range rounds {
+		if round > latest && len(verifiedVotes(candidates, validators)) >= quorum(len(validators)) {
+			latest = round
+		}
+	}
+
+	return latest
+}
+
+//Certificate of a quorum of commit votes for the same block and state in a round of the height, nil if there is none.
+func certificateFor(height uint32, validators [][32]byte) *protocol.QuorumCertificate {
+	type commitKey struct {
+		round     int
+		blockHash [32]byte
+		stateHash [32]byte
+	}
+
+	agreementMutex.Lock()
+	commits := make(map[commitKey][]*stashedVote)
+	for _, stashed := range voteStash[height] {
+		vote := stashed.vote
+		if vote.Stage == protocol.VOTE_COMMIT && vote.ShardID == storage.ThisShardID {
+			key := commitKey{vote.Round, vote.BlockHash, vote.StateHash}
+			commits[key] = append(commits[key], stashed)
+		}
+	}
+	agreementMutex.Unlock()
+
+	for _, candidates := range commits {
+		if len(candidates) < quorum(len(validators)) {
+			continue
+		}
+		if votes := verifiedVotes(candidates, validators); len(votes) >= quorum(len(validators)) {
+			return protocol.NewQuorumCertificate(votes)
+		}
+	}
+
+	return nil
+}
+
+//A block is certified by a quorum of the validators of its shard that committed to the same state.
+func validateCertificate(b *protocol.Block) error {
+	certificate := b.Certificate
+	if certificate == nil {
+		return errors.New(fmt.Sprintf("Block (%x) has no certificate.", b.Hash[0:8]))
+	}
+	if certificate.Height != b.Height || certificate.ShardID != b.ShardId || certificate.BlockHash != b.Hash {
+		return errors.New(fmt.Sprintf("Certificate of block (%x) certifies block %x of shard %d at height %d.", b.Hash[0:8], certificate.BlockHash[0:8], certificate.ShardID, certificate.Height))
+	}
+
+	validators := shardValidators(b.ShardId)
+	signers := make(map[[32]byte]bool)
+	for _, vote := range certificate.Commits {
+		if vote.Stage != protocol.VOTE_COMMIT || vote.Height != certificate.Height || vote.ShardID != certificate.ShardID ||
+			vote.Round != certificate.Round || vote.BlockHash != certificate.BlockHash || vote.StateHash != certificate.StateHash {
+			return errors.New(fmt.Sprintf("Certificate of block (%x) contains a vote for something else: %v", b.Hash[0:8], vote))
+		}
+		if signers[vote.Validator] {
+			return errors.New(fmt.Sprintf("Certificate of block (%x) contains two votes of %x.", b.Hash[0:8], vote.Validator[0:8]))
+		}
+		if err := verifyAgreementSignature(validators, vote.Validator, vote.Message(), vote.Signature); err != nil {
+			return errors.New(fmt.Sprintf("Certificate of block (%x) contains an invalid vote: %v", b.Hash[0:8], err))
+		}
+		signers[vote.Validator] = true
+	}
+
+	if len(signers) < quorum(len(validators)) {
+		return errors.New(fmt.Sprintf("Certificate of block (%x) has %d commit votes, but %d of %d validators are needed.", b.Hash[0:8], len(signers), quorum(len(validators)), len(validators)))
+	}
+
+	return nil
+}
+
+//The committee takes over the relative state of a block a quorum of its shard committed to, instead of executing the
+//block again. The state can not be trusted if the shard has too few validators to tolerate a faulty one.
+//Shard 1 sends no state transition, its blocks are always executed again.
+func trustsCertificate(b *protocol.Block) bool {
+	if b.ShardId == 1 || len(shardValidators(b.ShardId)) < BFT_MIN_VALIDATORS {
+		return false
+	}
+	if err := validateCertificate(b); err != nil {
+		logger.Warn("Certificate not accepted", "shard", b.ShardId, "height", b.Height, "error", err)
+		return false
+	}
+
+	return true
+}
+
+//Block whose relative state is only reconstructed if no state transition of its shard matches its certificate.
+type certifiedBlock struct {
+	block       *protocol.Block
+	reconstruct func() *protocol.RelativeState
+}
+
+func newCertifiedBlock(b *protocol.Block, accTxs []*protocol.AccTx, stakeTxs []*protocol.StakeTx, committeeTxs []*protocol.CommitteeTx, fundsTxs []*protocol.FundsTx, dataTxs []*protocol.DataTx, fineTxs []*protocol.FineTx) certifiedBlock {
+	return certifiedBlock{b, func() *protocol.RelativeState {
+		return ReconstructRelativeState(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs)
+	}}
+}
+
+//The state transition of a certified block has to report the state its validators committed to.
+func adoptCertifiedStates(blocks []certifiedBlock, transitions []*protocol.StateTransition, relativeStates map[int]*protocol.RelativeState) {
+	for _, certified := range blocks {
+		b := certified.block
+		var adopted *protocol.RelativeState
+		for _, st := range transitions {
+			if st.ShardID == b.ShardId && protocol.RelativeStateHash(st.RelativeStateChange) == b.Certificate.StateHash {
+				adopted = protocol.NewRelativeState(st.RelativeStateChange, b.ShardId, b.Beneficiary)
+				break
+			}
+		}
+
+		if adopted == nil {
+			logger.Warn("No state transition matches the certificate", "shard", b.ShardId, "height", b.Height)
+			ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+			adopted = certified.reconstruct()
+		} else {
+			logger.Debug("Took over certified relative state", "shard", b.ShardId, "height", b.Height)
+		}
+		relativeStates[b.ShardId] = adopted
+	}
+}
+
+//A validator gets at most BFT_STASHED_ROUNDS proposals per height, the one of its earliest round makes room for a later
+//one.
+func stashProposal(proposal *protocol.Proposal, verified bool) [32]byte {
+	hash := protocol.SerializeHashContent(proposal.Encode())
+
+	agreementMutex.Lock()
+	height := proposal.Block.Height
+	if stashable(height) {
+		if proposalStash[height] == nil {
+			proposalStash[height] = make(map[[32]byte]*stashedProposal)
+		}
+		if _, exists := proposalStash[height][hash]; !exists {
+			var count int
+			var earliest [32]byte
+			earliestRound := proposal.Round
+			for stashedHash, stashed := range proposalStash[height] {
+				if stashed.proposal.Proposer == proposal.Proposer {
+					count++
+					if stashed.proposal.Round < earliestRound {
+						earliest, earliestRound = stashedHash, stashed.proposal.Round
+					}
+				}
+			}
+			if count >= BFT_STASHED_ROUNDS && earliestRound < proposal.Round {
+				delete(proposalStash[height], earliest)
+			}
+			if count < BFT_STASHED_ROUNDS || earliestRound < proposal.Round {
+				proposalStash[height][hash] = &stashedProposal{proposal, verified}
+			}
+		}
+	}
+	agreementMutex.Unlock()
+
+	notifyAgreement()
+	return hash
+}
+
+//Same for the votes, a validator votes twice per round.
+func stashVote(vote *protocol.Vote, verified bool) [32]byte {
+	hash := protocol.SerializeHashContent(vote.Encode())
+
+	agreementMutex.Lock()
+	if stashable(vote.Height) {
+		if voteStash[vote.Height] == nil {
+			voteStash[vote.Height] = make(map[[32]byte]*stashedVote)
+		}
+		if _, exists := voteStash[vote.Height][hash]; !exists {
+			var count int
+			var earliest [32]byte
+			earliestRound := vote.Round
+			for stashedHash, stashed := range voteStash[vote.Height] {
+				if stashed.vote.Validator == vote.Validator {
+					count++
+					if stashed.vote.Round < earliestRound {
+						earliest, earliestRound = stashedHash, stashed.vote.Round
+					}
+				}
+			}
+			if count >= 2*BFT_STASHED_ROUNDS && earliestRound < vote.Round {
+				delete(voteStash[vote.Height], earliest)
+			}
+			if count < 2*BFT_STASHED_ROUNDS || earliestRound < vote.Round {
+				voteStash[vote.Height][hash] = &stashedVote{vote, verified}
+			}
+		}
+	}
+	agreementMutex.Unlock()
+
+	notifyAgreement()
+	return hash
+}
+
+//Proposals and votes are only stashed if they are signed with the commitment key of a staking account. Whether the
+//signer is a validator of the shard is checked once they are used, since the validator assignment may not be up to
+//date. They are processed outside of the miner's goroutine, so the key is taken from the state of the last closed block.
+func verifyValidatorSignature(signer [32]byte, message string, signature [crypto.COMM_PROOF_LENGTH]byte) error {
+	state, _ := storage.ReadStateSnapshot()
+	acc := state[signer]
+	if acc == nil || !acc.IsStaking {
+		return errors.New(fmt.Sprintf("%x is not a validator.", signer[0:8]))
+	}
+
+	commitmentPubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitmentKey)
+	if err != nil {
+		return errors.New("Invalid commitment key in account.")
+	}
+
+	return crypto.VerifyMessageWithRSAKey(commitmentPubKey, message, signature)
+}
+
+//Only heights from the one agreed on up to DELAYED_BLOCKS later are kept. The caller holds agreementMutex.
+func stashable(height uint32) bool {
+	return height >= agreementFloor && (agreementFloor == 0 || height <= agreementFloor+DELAYED_BLOCKS)
+}
+
+func pruneAgreementStash(height uint32) {
+	agreementMutex.Lock()
+	defer agreementMutex.Unlock()
+
+	agreementFloor = height
+	for stashedHeight := range proposalStash {
+		if stashedHeight < height {
+			delete(proposalStash, stashedHeight)
+		}
+	}
+	for stashedHeight := range voteStash {
+		if stashedHeight < height {
+			delete(voteStash, stashedHeight)
+		}
+	}
+}
+
+func notifyAgreement() {
+	select {
+	case agreementUpdate <- true:
+	default:
+	}
+}
+
+func processProposal(payload []byte) {
+	var proposal *protocol.Proposal
+	if proposal = proposal.Decode(payload); proposal == nil {
+		p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+	//the committee does not take part in the agreement
+	if storage.IsCommittee {
+		return
+	}
+	if err := verifyValidatorSignature(proposal.Proposer, proposal.Message(), proposal.Signature); err != nil {
+		logger.Debug("Proposal not stashed", "proposer", proposal.Proposer[0:8], "height", proposal.Block.Height, "error", err)
+		if err == rsa.ErrVerification {
+			p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_PROTOCOL_VIOLATION)
+		}
+		return
+	}
+
+	p2p.LinkSender(payload, stashProposal(proposal, false))
+}
+
+func processVote(payload []byte) {
+	var vote *protocol.Vote
+	if vote = vote.Decode(payload); vote == nil {
+		p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+	if storage.IsCommittee {
+		return
+	}
+	if err := verifyValidatorSignature(vote.Validator, vote.Message(), vote.Signature); err != nil {
+		logger.Debug("Vote not stashed", "validator", vote.Validator[0:8], "height", vote.Height, "error", err)
+		if err == rsa.ErrVerification {
+			p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_PROTOCOL_VIOLATION)
+		}
+		return
+	}
+
+	p2p.LinkSender(payload, stashVote(vote, false))
+}
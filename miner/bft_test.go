@@ -0,0 +1,240 @@
+package miner
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"testing"
+)
+
+//Adds staking validators with fresh commitment keys to the given shard.
+func addShardValidators(t *testing.T, shardID int, n int) (validators [][32]byte, keys map[[32]byte]*rsa.PrivateKey) {
+	keys = make(map[[32]byte]*rsa.PrivateKey)
+	ValidatorShardMap = protocol.NewMapping()
+	for i := 0; i < n; i++ {
+		key, err := rsa.GenerateKey(rand.Reader, crypto.COMM_KEY_LENGTH*8)
+		if err != nil {
+			t.Fatalf("Could not create commitment key: %v\n", err)
+		}
+
+		acc := &protocol.Account{Address: [64]byte{byte(i + 1), 0xbf}, IsStaking: true}
+		copy(acc.CommitmentKey[:], key.N.Bytes())
+		storage.State[acc.Hash()] = acc
+		ValidatorShardMap.ValMapping[acc.Address] = shardID
+		keys[acc.Hash()] = key
+	}
+
+	return shardValidators(shardID), keys
+}
+
+func signedCommit(t *testing.T, key *rsa.PrivateKey, b *protocol.Block, stateHash [32]byte, validator [32]byte) *protocol.Vote {
+	vote := protocol.NewVote(protocol.VOTE_COMMIT, b.Height, b.ShardId, 1, b.Hash, stateHash, validator)
+	signature, err := crypto.SignMessageWithRSAKey(key, vote.Message())
+	if err != nil {
+		t.Fatalf("Could not sign vote: %v\n", err)
+	}
+	vote.Signature = signature
+
+	return vote
+}
+
+func TestQuorum(t *testing.T) {
+	for n, expected := range map[int]int{1: 1, 2: 2, 3: 3, 4: 3, 6: 5, 7: 5, 10: 7} {
+		if q := quorum(n); q != expected {
+			t.Errorf("Quorum of %d validators is %d instead of %d\n", n, q, expected)
+		}
+		//two quorums share more than a third of the validators
+		if 3*(2*quorum(n)-n) <= n {
+			t.Errorf("Quorums of %d validators overlap too little\n", n)
+		}
+	}
+}
+
+func TestProposerRotation(t *testing.T) {
+	validators := [][32]byte{{1}, {2}, {3}, {4}}
+	if proposerOf(nil, 5, 0) != [32]byte{} {
+		t.Errorf("Proposer of a shard without validators\n")
+	}
+
+	proposers := make(map[[32]byte]bool)
+	for round := 0; round < len(validators); round++ {
+		proposers[proposerOf(validators, 5, round)] = true
+	}
+	if len(proposers) != len(validators) {
+		t.Errorf("Rounds of a height have %d instead of %d proposers\n", len(proposers), len(validators))
+	}
+	if proposerOf(validators, 5, 0) == proposerOf(validators, 6, 0) {
+		t.Errorf("Same validator proposes first at consecutive heights\n")
+	}
+	if proposerOf(validators, 5, 1) != proposerOf(validators, 6, 0) {
+		t.Errorf("Proposers do not rotate with height and round alike\n")
+	}
+}
+
+func TestValidateCertificate(t *testing.T) {
+	cleanAndPrepare()
+	defer func() { ValidatorShardMap = nil }()
+
+	validators, keys := addShardValidators(t, 2, 4)
+	b := newBlock([32]byte{1}, [crypto.COMM_PROOF_LENGTH]byte{}, 7)
+	b.ShardId = 2
+	b.Hash = [32]byte{7}
+	stateHash := [32]byte{8}
+
+	var commits []*protocol.Vote
+	for _, validator := range validators {
+		commits = append(commits, signedCommit(t, keys[validator], b, stateHash, validator))
+	}
+
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Block without certificate accepted\n")
+	}
+
+	b.Certificate = protocol.NewQuorumCertificate(commits[:3])
+	if err := validateCertificate(b); err != nil {
+		t.Errorf("Certificate of a quorum rejected: %v\n", err)
+	}
+
+	b.Certificate = protocol.NewQuorumCertificate(commits[:2])
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Certificate without quorum accepted\n")
+	}
+
+	b.Certificate = protocol.NewQuorumCertificate([]*protocol.Vote{commits[0], commits[1], commits[1]})
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Certificate counting a validator twice accepted\n")
+	}
+
+	other := signedCommit(t, keys[validators[2]], b, [32]byte{9}, validators[2])
+	b.Certificate = protocol.NewQuorumCertificate([]*protocol.Vote{commits[0], commits[1], other})
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Certificate with votes for different states accepted\n")
+	}
+
+	forged := *commits[2]
+	forged.Validator = validators[3]
+	b.Certificate = protocol.NewQuorumCertificate([]*protocol.Vote{commits[0], commits[1], &forged})
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Certificate with a forged vote accepted\n")
+	}
+
+	b.Certificate = protocol.NewQuorumCertificate(commits[:3])
+	b.Hash = [32]byte{6}
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Certificate of another block accepted\n")
+	}
+	b.Hash = [32]byte{7}
+
+	//The validators of another shard can't certify the block
+	for address := range ValidatorShardMap.ValMapping {
+		ValidatorShardMap.ValMapping[address] = 3
+	}
+	if err := validateCertificate(b); err == nil {
+		t.Errorf("Certificate of the validators of another shard accepted\n")
+	}
+}
+
+func TestCertificateFromVotes(t *testing.T) {
+	cleanAndPrepare()
+	defer func() { ValidatorShardMap = nil }()
+
+	validators, keys := addShardValidators(t, 2, 4)
+	storage.ThisShardID = 2
+	defer func() { storage.ThisShardID = 0 }()
+
+	b := newBlock([32]byte{1}, [crypto.COMM_PROOF_LENGTH]byte{}, 12)
+	b.ShardId = 2
+	b.Hash = [32]byte{12}
+	pruneAgreementStash(b.Height)
+
+	stashVote(signedCommit(t, keys[validators[0]], b, [32]byte{1}, validators[0]), false)
+	stashVote(signedCommit(t, keys[validators[1]], b, [32]byte{1}, validators[1]), false)
+	//a vote for another state does not count towards the quorum
+	stashVote(signedCommit(t, keys[validators[2]], b, [32]byte{2}, validators[2]), false)
+	if certificateFor(b.Height, validators) != nil {
+		t.Errorf("Certificate without quorum\n")
+	}
+
+	stashVote(signedCommit(t, keys[validators[3]], b, [32]byte{1}, validators[3]), false)
+	certificate := certificateFor(b.Height, validators)
+	if certificate == nil || len(certificate.Commits) != 3 || certificate.StateHash != [32]byte{1} {
+		t.Fatalf("No certificate of the quorum: %v\n", certificate)
+	}
+	if votes := agreementVotes(validators, protocol.VOTE_COMMIT, b.Height, 1, b.Hash, [32]byte{1}); len(votes) != 3 {
+		t.Errorf("%d instead of 3 commit votes counted\n", len(votes))
+	}
+
+	b.Certificate = certificate
+	if err := validateCertificate(b); err != nil {
+		t.Errorf("Certificate of the stashed votes rejected: %v\n", err)
+	}
+
+	//Votes for heights that were agreed on are dropped
+	pruneAgreementStash(b.Height + 1)
+	if certificateFor(b.Height, validators) != nil {
+		t.Errorf("Votes of an agreed height kept\n")
+	}
+	pruneAgreementStash(0)
+}
+
+func TestResetState(t *testing.T) {
+	cleanAndPrepare()
+
+	stateCopy := CopyState(storage.State)
+	accA.Balance -= 10
+	created := &protocol.Account{Address: [64]byte{9, 9}}
+	storage.State[created.Hash()] = created
+
+	resetState(stateCopy)
+	if storage.State[accA.Hash()] != accA || accA.Balance != 123232345678 {
+		t.Errorf("Account not reset in place: %v\n", storage.State[accA.Hash()])
+	}
+	if _, exists := storage.State[created.Hash()]; exists {
+		t.Errorf("Account created by the block kept\n")
+	}
+}
+
+func TestProcessVote(t *testing.T) {
+	cleanAndPrepare()
+	defer func() { ValidatorShardMap = nil }()
+	defer pruneAgreementStash(0)
+
+	validators, keys := addShardValidators(t, 2, 2)
+	//Votes are checked against the state of the last closed block
+	storage.WriteLastClosedBlock(genesisBlock)
+	pruneAgreementStash(12)
+
+	signedVote := func(key *rsa.PrivateKey, round int, validator [32]byte) *protocol.Vote {
+		vote := protocol.NewVote(protocol.VOTE_PREVOTE, 12, 2, round, [32]byte{12}, [32]byte{}, validator)
+		signature, err := crypto.SignMessageWithRSAKey(key, vote.Message())
+		if err != nil {
+			t.Fatalf("Could not sign vote: %v\n", err)
+		}
+		vote.Signature = signature
+		return vote
+	}
+
+	//Votes of accounts that don't stake and forged votes are not stashed
+	outsider, _ := rsa.GenerateKey(rand.Reader, crypto.COMM_KEY_LENGTH*8)
+	processVote(signedVote(outsider, 0, accA.Hash()).Encode())
+	processVote(signedVote(keys[validators[0]], 0, validators[1]).Encode())
+	if len(voteStash[12]) != 0 {
+		t.Errorf("Unverified votes stashed: %v\n", voteStash[12])
+	}
+
+	//A validator can't fill the stash, only the votes of its latest rounds are kept
+	for round := 0; round < 2*BFT_STASHED_ROUNDS+2; round++ {
+		processVote(signedVote(keys[validators[0]], round, validators[0]).Encode())
+	}
+	processVote(signedVote(keys[validators[1]], 0, validators[1]).Encode())
+	if len(voteStash[12]) != 2*BFT_STASHED_ROUNDS+1 {
+		t.Errorf("%d votes stashed instead of %d\n", len(voteStash[12]), 2*BFT_STASHED_ROUNDS+1)
+	}
+	for _, stashed := range voteStash[12] {
+		if stashed.vote.Validator == validators[0] && stashed.vote.Round < 2 {
+			t.Errorf("Vote of round %d kept instead of a later one\n", stashed.vote.Round)
+		}
+	}
+}
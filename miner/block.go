@@ -29,6 +29,8 @@ type blockData struct {
 	aggTxSlice	  		  		[]*protocol.AggTx
 	aggregatedFundsTxSlice  	[]*protocol.FundsTx
 	fineTxSlice					[]*protocol.FineTx
+	receipts					[]*protocol.Receipt
+	creditedReceipts			[]*protocol.Receipt
 	block        		  		*protocol.Block
 }
 
@@ -73,7 +75,7 @@ var (
 func finalizeBlock(block *protocol.Block) error {
 	//Check if we have a slashing proof that we can add to the block.
 	//The slashingDict is updated when a new block is received and when a slashing proof is provided.
-	logger.Printf("-- Start Finalize")
+	logger.Debug("Finalizing block", "shard", block.ShardId, "height", block.Height)
 	if len(slashingDict) != 0 {
 		//Get the first slashing proof.
 		for hash, slashingProof := range slashingDict {
@@ -87,7 +89,9 @@ func finalizeBlock(block *protocol.Block) error {
 	}
 
 	//Merkle tree includes the hashes of all txs in this block
+	block.NrReceipts = uint16(len(block.ReceiptData))
 	block.MerkleRoot = protocol.BuildMerkleTree(block).MerkleRoot()
+	block.ReceiptsRoot = protocol.BuildReceiptsMerkleTree(blockReceipts(block, assignedFundsTxs(block))).MerkleRoot()
 	validatorAcc, err := storage.GetAccount(protocol.SerializeHashContent(ValidatorAccAddress))
 	if err != nil {
 		return err
@@ -122,7 +126,7 @@ func finalizeBlock(block *protocol.Block) error {
 			storage.DeleteAllFundsTxBeforeAggregation()
 			storage.DeleteAllDataTxBeforeAggregation()
 		}
-		logger.Printf("We have an error in proof of stake in finalization")
+		logger.Debug("Proof of stake aborted", "shard", block.ShardId, "height", block.Height, "error", err)
 		return err
 	}
 
@@ -148,7 +152,7 @@ func finalizeBlock(block *protocol.Block) error {
 	block.NrFineTx = uint16(len(block.FineTxData))
 
 	copy(block.CommitmentProof[0:crypto.COMM_PROOF_LENGTH], commitmentProof[:])
-	logger.Printf("-- End Finalization")
+	logger.Debug("Finalized block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height)
 	return nil
 }
 
@@ -170,20 +174,28 @@ func finalizeEpochBlock(epochBlock *protocol.EpochBlock) error {
 		return err
 	}
 
-	partialHash := epochBlock.HashEpochBlock()
+	//Commit to the state of the epoch block, such that receivers can check the state they derive or fetch
+	epochBlock.MerklePatriciaRoot = protocol.StateRoot(storage.State)
+
+	/*Determine new number of shards needed based on current state and the loads of the shards, see resharding.go*/
+	epochBlock.NofShards = detNumberOfShardsForLoad(shardCapacity(storage.State), epochBlock.ShardLoads)
+	migrations := accountMigrations(storage.State, NumberOfShards, epochBlock.NofShards)
+	epochBlock.MigrationsRoot = protocol.BuildMigrationsMerkleTree(migrations).MerkleRoot()
+	if len(migrations) > 0 {
+		logger.Info("Resharding", "from", NumberOfShards, "to", epochBlock.NofShards, "migrations", len(migrations))
+	}
+	NumberOfShards = epochBlock.NofShards
 
-	/*Determine new number of shards needed based on current state*/
-	NumberOfShards = DetNumberOfShards()
+	partialHash := epochBlock.HashEpochBlock()
 
 	//generate new validator mapping and include mappping in the epoch block
 	valMapping := protocol.NewMapping()
-	logger.Printf("Initiating new mapping")
 	valMapping.ValMapping = AssignValidatorsToShards()
 	valMapping.EpochHeight = int(epochBlock.Height)
 
 	epochBlock.ValMapping = valMapping
 	ValidatorShardMap = epochBlock.ValMapping
-	epochBlock.NofShards = DetNumberOfShards()
+	storage.ValShardMapping = ValidatorShardMap
 
 	epochBlock.CommitteeLeader = ChooseCommitteeLeader()
 	storage.CommitteeLeader = epochBlock.CommitteeLeader
@@ -191,14 +203,20 @@ func finalizeEpochBlock(epochBlock *protocol.EpochBlock) error {
 	storage.ThisShardID = ValidatorShardMap.ValMapping[ValidatorAccAddress]
 	storage.ThisShardMap[int(epochBlock.Height)] = storage.ThisShardID
 
-	epochBlock.State = storage.State
-	logger.Printf("Before Epoch Block proofofstake for height: %d\n",epochBlock.Height)
+	//Only the accounts changed since the previous epoch block are sent along, see epochBlockState
+	var previousState map[[32]byte]*protocol.Account
+	if persisted := storage.ReadLastClosedEpochBlockState(); persisted != nil && persisted.BlockHash == lastEpochBlock.Hash {
+		previousState = persisted.State
+	}
+	epochBlock.StateDelta = storage.GetStateDelta(previousState, storage.State)
+
+	logger.Debug("Starting proof of stake of the epoch block", "height", epochBlock.Height)
 
 	nonce, err := proofOfStakeEpoch(getDifficulty(), lastEpochBlock.Hash, epochBlock.Height, validatorAcc.Balance, commitmentProof)
 	if err != nil {
 		return err
 	}
-	logger.Printf("After Epoch Block proofofstake for height: %d\n",epochBlock.Height)
+	logger.Debug("Finished proof of stake of the epoch block", "height", epochBlock.Height)
 
 	var nonceBuf [8]byte
 	binary.BigEndian.PutUint64(nonceBuf[:], uint64(nonce))
@@ -239,7 +257,8 @@ func addTx(b *protocol.Block, tx protocol.Transaction) error {
 	//So the trade-off is effectively clean abstraction vs. tx size. Everything related to fundsTx is postponed because
 	//the txs depend on each other.
 	if !verify(tx) {
-		logger.Printf("Transaction could not be verified: %v", tx)
+		logger.Debug("Transaction could not be verified", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
+		p2p.ReportInvalid(tx.Hash(), p2p.MISBEHAVIOR_INVALID_TX)
 		return errors.New("Transaction could not be verified.")
 	}
 
@@ -247,43 +266,43 @@ func addTx(b *protocol.Block, tx protocol.Transaction) error {
 	case *protocol.AccTx:
 		err := addAccTx(b, tx.(*protocol.AccTx))
 		if err != nil {
-			logger.Printf("Adding accTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.AccTx))
+			logger.Debug("Adding accTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 
 			return err
 		}
 	case *protocol.FundsTx:
 		err := addFundsTx(b, tx.(*protocol.FundsTx))
 		if err != nil {
-			logger.Printf("Adding fundsTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.FundsTx))
+			logger.Debug("Adding fundsTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 			//logger.Printf("Adding fundsTx (%x) failed (%v)",tx.Hash(), err)
 			return err
 		}
 	case *protocol.ConfigTx:
 		err := addConfigTx(b, tx.(*protocol.ConfigTx))
 		if err != nil {
-			logger.Printf("Adding configTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.ConfigTx))
+			logger.Debug("Adding configTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 			return err
 		}
 	case *protocol.StakeTx:
 		err := addStakeTx(b, tx.(*protocol.StakeTx))
 		if err != nil {
-			logger.Printf("Adding stakeTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.StakeTx))
+			logger.Debug("Adding stakeTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 			return err
 		}
 	case *protocol.CommitteeTx:
 		err := addCommitteeTx(b, tx.(*protocol.CommitteeTx))
 		if err != nil {
-			logger.Printf("Adding committeeTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.CommitteeTx))
+			logger.Debug("Adding committeeTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 		}
 	case *protocol.DataTx:
 		err := addDataTx(b, tx.(*protocol.DataTx))
 		if err != nil {
-			logger.Printf("Adding dataTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.DataTx))
+			logger.Debug("Adding dataTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 		}
 	case *protocol.FineTx:
 		err := addFineTx(b, tx.(*protocol.FineTx))
 		if err != nil {
-			logger.Printf("Adding fineTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.FineTx))
+			logger.Debug("Adding fineTx failed", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "error", err)
 		}
 	default:
 		return errors.New("Transaction type not recognized.")
@@ -308,9 +327,9 @@ func addAccTx(b *protocol.Block, tx *protocol.AccTx) error {
 	if !containsAccTx(b.AccTxData, tx.Hash()) {
 		//Add the tx hash to the block header and write it to open storage (non-validated transactions).
 		b.AccTxData = append(b.AccTxData, tx.Hash())
-		logger.Printf("Added tx (%x) to the AccTxData slice: %v", tx.Hash(), *tx)
+		logger.Debug("Added accTx", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
 	} else {
-		logger.Printf("might have a problem")
+		logger.Debug("AccTx already in the block", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
 	}
 
 	//Add the tx hash to the block header and write it to open storage (non-validated transactions).
@@ -322,7 +341,7 @@ func addCommitteeTx(b *protocol.Block, tx *protocol.CommitteeTx) (err error){
 	//No further checks needed, static checks were already done with verify().
 	b.CommitteeTxData = append(b.CommitteeTxData, tx.Hash())
 	newCommitteeNode = tx.Account
-	logger.Printf("Added tx (%x) to the CommitteeTx slice: %v", tx.Hash(), *tx)
+	logger.Debug("Added committeeTx", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
 
 	return nil
 }
@@ -352,7 +371,7 @@ func addFundsTx(b *protocol.Block, tx *protocol.FundsTx) error {
 		} else {
 			storage.WriteINVALIDOpenTx(tx)
 			addFundsTxMutex.Unlock()
-			logger.Printf("Sender account not present in the state: %x\n", tx.From)
+			logger.Debug("Sender account not present in the state", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "from", tx.From[0:8])
 			return errors.New(fmt.Sprintf("Sender account not present in the state: %x\n", tx.From))
 		}
 	}
@@ -414,31 +433,55 @@ func addFundsTx(b *protocol.Block, tx *protocol.FundsTx) error {
 		addFundsTxMutex.Unlock()
 		return errors.New(err)
 	}
+ */
 
 	//Check if transaction has data and the receiver account has a smart contract
-	if tx.Data != nil && b.StateCopy[tx.To].Contract != nil {
-		context := protocol.NewContext(*b.StateCopy[tx.To], *tx)
-		virtualMachine := vm.NewVM(context)
+	isCall := isContractCall(tx, b.StateCopy[tx.To])
+	if isCall {
+		variables, err := execContract(b.StateCopy[tx.To], tx, func(address [32]byte) (*protocol.Account, error) {
+			if acc, exists := b.StateCopy[address]; exists {
+				return acc, nil
+			}
+			return storage.GetAccount(address)
+		})
 
-		// Check if vm execution run without error
-		if !virtualMachine.Exec(false) {
+		//Check if vm execution run without error
+		if err != nil {
 			storage.WriteINVALIDOpenTx(tx)
 			addFundsTxMutex.Unlock()
-			return errors.New(virtualMachine.GetErrorMsg())
+			return err
 		}
 
-		//Update changes vm has made to the contract variables
-		context.PersistChanges()
+		//The state copy only holds a shallow copy of the account, so the variables are replaced instead of changed.
+		for address, contractVariables := range variables {
+			if _, exists := b.StateCopy[address]; !exists {
+				newAcc := *storage.State[address]
+				b.StateCopy[address] = &newAcc
+			}
+			b.StateCopy[address].ContractVariables = contractVariables
+		}
 	}
- */
+
 	//Update state copy.
 	//State copy does not get serialized and doesn't make a change for the actual state of the blockchain
 	accSender := b.StateCopy[tx.From]
 	accSender.TxCnt += 1
 	accSender.Balance = accSender.Balance - (tx.Amount + tx.Fee)
 
-	accReceiver := b.StateCopy[tx.To]
-	accReceiver.Balance += tx.Amount
+	//The receiver of a cross-shard transfer is credited by its own shard, see receipts.go
+	crossShard := isCrossShard(tx)
+	if !crossShard {
+		accReceiver := b.StateCopy[tx.To]
+		accReceiver.Balance += tx.Amount
+	}
+
+	//Contract calls are not aggregated, their order in the block is the order in which they have to be executed.
+	//Cross-shard transfers are not aggregated either, every one of them needs its own receipt.
+	if isCall || crossShard {
+		addFundsTxFinal(b, tx)
+		addFundsTxMutex.Unlock()
+		return nil
+	}
 
 	//Add teh transaction to the storage where all Funds-transactions are stored before they where aggregated.
 	storage.WriteFundsTxBeforeAggregation(tx)
@@ -485,7 +528,7 @@ func addDataTx(b *protocol.Block, tx *protocol.DataTx) error {
 			}
 		} else {
 			storage.WriteINVALIDOpenTx(tx)
-			logger.Printf("Sender account not present in the state: %x\n", tx.From)
+			logger.Debug("Sender account not present in the state", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "from", tx.From[0:8])
 			return errors.New(fmt.Sprintf("Sender account not present in the state: %x\n", tx.From))
 		}
 	}
@@ -543,7 +586,7 @@ func addFineTx(b *protocol.Block, tx *protocol.FineTx) error {
 			}
 		} else {
 			storage.WriteINVALIDOpenTx(tx)
-			logger.Printf("Sender account not present in the state: %x\n", tx.From)
+			logger.Debug("Sender account not present in the state", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash(), "from", tx.From[0:8])
 			return errors.New(fmt.Sprintf("Sender account not present in the state: %x\n", tx.From))
 		}
 	}
@@ -564,7 +607,7 @@ func addFineTx(b *protocol.Block, tx *protocol.FineTx) error {
 		}
 	}
 
-	logger.Printf("Added tx (%x) to the FineTxData slice: %v", tx.Hash(), *tx)
+	logger.Debug("Added fineTx", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
 	b.FineTxData = append(b.FineTxData, tx.Hash())
 
 	return nil
@@ -580,8 +623,7 @@ func splitSortedAggregatableTransactions(b *protocol.Block){
 	PossibleTransactionsToAggregate := storage.ReadFundsTxBeforeAggregation()
 	PossibleDataTransactionsToAggregate := storage.ReadDataTxBeforeAggregation()
 
-	logger.Printf("#PossibleTransactionsToAggregate: %d", len(PossibleTransactionsToAggregate))
-	logger.Printf("#PossibleDataTransactionsToAggregate: %d", len(PossibleDataTransactionsToAggregate))
+	logger.Debug("Transactions to aggregate", "shard", b.ShardId, "height", b.Height, "fundsTxs", len(PossibleTransactionsToAggregate), "dataTxs", len(PossibleDataTransactionsToAggregate))
 
 	for _, tx := range PossibleTransactionsToAggregate {
 		storage.DifferentSenders[tx.From] = storage.DifferentSenders[tx.From] + 1
@@ -715,7 +757,7 @@ func searchTransactionsInHistoricBlocks(searchAddressSender [32]byte, searchAddr
 			if tx != nil {
 				trx := tx.(*protocol.AggTx)
 				if trx != nil && trx.Aggregated == false && (trx.From[0] == searchAddressSender || trx.To[0] == searchAddressReceiver) {
-					logger.Printf("Found AggTx (%x) in (%x) which can be aggregated now.", trx.Hash(), block.Hash[0:8])
+					logger.Debug("Found aggTx which can be aggregated now", "hash", block.Hash[0:8], "height", block.Height, "tx", trx.Hash())
 					historicTransactions = append(historicTransactions, trx)
 					trx.Aggregated = true
 					storage.WriteClosedTx(trx)
@@ -843,16 +885,18 @@ func AggregateTransactions(SortedAndSelectedFundsTx []protocol.Transaction, bloc
 		)
 
 		if err != nil {
-			logger.Printf("%v\n", err)
+			logger.Warn("Could not create aggTx", "shard", block.ShardId, "height", block.Height, "error", err)
 			return err
 		}
 
 		//Print aggregated Transaction
-		logger.Printf("%v", aggTx)
+		logger.Debug("Created aggTx", "shard", block.ShardId, "height", block.Height, "tx", aggTx.Hash(), "aggregated", len(transactionHashes))
 
 		//Add Aggregated transaction and write to open storage
 		addAggTxFinal(block, aggTx)
 		storage.WriteOpenTx(aggTx)
+		aggregatedTxsMetric.Add(uint64(len(transactionHashes)))
+		aggTxsMetric.Inc()
 
 		//Sett all back to "zero"
 		SortedAndSelectedFundsTx = nil
@@ -909,12 +953,12 @@ func AggregateDataTransactions(SortedAndSelecteDataTx []protocol.Transaction, bl
 		)
 
 		if err != nil {
-			logger.Printf("%v\n", err)
+			logger.Warn("Could not create aggDataTx", "shard", block.ShardId, "height", block.Height, "error", err)
 			return err
 		}
 
 		//Print aggregated Transaction
-		logger.Printf("%v", aggDataTx)
+		logger.Debug("Created aggDataTx", "shard", block.ShardId, "height", block.Height, "tx", aggDataTx.Hash(), "aggregated", len(transactionHashes))
 
 		//Add Aggregated transaction and write to open storage
 		addAggDataTxFinal(block, aggDataTx)
@@ -1063,7 +1107,7 @@ func sortDataTxBeforeAggregation(Slice []*protocol.DataTx) {
 func addConfigTx(b *protocol.Block, tx *protocol.ConfigTx) error {
 	//No further checks needed, static checks were already done with verify().
 	b.ConfigTxData = append(b.ConfigTxData, tx.Hash())
-	logger.Printf("Added tx (%x) to the ConfigTxData slice: %v", tx.Hash(), *tx)
+	logger.Debug("Added configTx", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
 	return nil
 }
 
@@ -1104,7 +1148,7 @@ func addStakeTx(b *protocol.Block, tx *protocol.StakeTx) error {
 
 	//No further checks needed, static checks were already done with verify().
 	b.StakeTxData = append(b.StakeTxData, tx.Hash())
-	logger.Printf("Added tx (%x) to the StakeTxData slice: %v", tx.Hash(), *tx)
+	logger.Debug("Added stakeTx", "shard", b.ShardId, "height", b.Height, "tx", tx.Hash())
 	return nil
 }
 
@@ -1186,7 +1230,7 @@ func fetchFundsTxData(block *protocol.Block, fundsTxSlice []*protocol.FundsTx, i
 				fundsTxSlice[cnt] = fundsTx
 				continue
 			} else {
-				logger.Printf("Block validation had fundsTx (%x) that was already in a previous block.", closedTx.Hash())
+				logger.Debug("Block has a fundsTx of a previous block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height, "tx", closedTx.Hash())
 				errChan <- errors.New("Block validation had fundsTx that was already in a previous block.")
 				return
 			}
@@ -1257,7 +1301,7 @@ func fetchDataTxData(block *protocol.Block, dataTxSlice []*protocol.DataTx, init
 				dataTxSlice[cnt] = dataTx
 				continue
 			} else {
-				logger.Printf("Block validation had dataTx (%x) that was already in a previous block.", closedTx.Hash())
+				logger.Debug("Block has a dataTx of a previous block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height, "tx", closedTx.Hash())
 				errChan <- errors.New("Block validation had dataTx that was already in a previous block.")
 				return
 			}
@@ -1304,7 +1348,7 @@ func fetchFineTx(block *protocol.Block, fineTxSlice []*protocol.FineTx, initialS
 				fineTxSlice[cnt] = fineTx
 				continue
 			} else {
-				logger.Printf("Block validation had fineTx (%x) that was already in a previous block.", closedTx.Hash())
+				logger.Debug("Block has a fineTx of a previous block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height, "tx", closedTx.Hash())
 				errChan <- errors.New("Block validation had fineTx that was already in a previous block.")
 				return
 			}
@@ -1460,7 +1504,7 @@ func fetchCommitteeTxData(block *protocol.Block, committeeTxSlice []*protocol.Co
 		if tx != nil {
 			committeeTx = tx.(*protocol.CommitteeTx)
 		} else {
-			logger.Printf("Could not fetch Committee TX: %x", txHash)
+			logger.Debug("CommitteeTx not in the mempool", "hash", block.Hash[0:8], "height", block.Height, "tx", txHash)
 		}
 
 		committeeTxSlice[cnt] = committeeTx
@@ -1518,7 +1562,7 @@ func fetchFundsTxRecursively(AggregatedTxSlice [][32]byte) (aggregatedFundsTxSli
 					}
 					break
 				} else {
-					logger.Printf("RECURSIVE Fetching (%x) timed out...", txHash)
+					logger.Debug("Timed out fetching aggregated transaction", "tx", txHash)
 					return nil, errors.New(fmt.Sprintf("RECURSIVE UnknownTx fetch timed out"))
 				}
 			}
@@ -1560,7 +1604,7 @@ func fetchAggTxData(block *protocol.Block, aggTxSlice []*protocol.AggTx, initial
 		//Check if transaction was already in another block, expect it is aggregated.
 		if !initialSetup && aggTx != nil && aggTx.(*protocol.AggTx).Aggregated == false{
 			if !aggTx.(*protocol.AggTx).Aggregated {
-				logger.Printf("Block validation had AggTx (%x) that was already in a previous block.", aggTx.Hash())
+				logger.Debug("Block has an aggTx of a previous block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height, "tx", aggTx.Hash())
 				errChan <- errors.New("Block validation had AggTx that was already in a previous block.")
 				return
 			}
@@ -1579,7 +1623,7 @@ func fetchAggTxData(block *protocol.Block, aggTxSlice []*protocol.AggTx, initial
 			//Transaction need to be fetched from the network.
 			cnt := 0
 			HERE:
-			logger.Printf("Request AGGTX: %x for block %x", aggTxHash, block.Hash[0:8])
+			logger.Debug("Requesting aggTx", "hash", block.Hash[0:8], "height", block.Height, "tx", aggTxHash, "attempt", cnt)
 			err := p2p.TxReq(aggTxHash, p2p.AGGTX_REQ)
 			if err != nil {
 				errChan <- errors.New(fmt.Sprintf("AggTx could not be read: %v", err))
@@ -1589,14 +1633,14 @@ func fetchAggTxData(block *protocol.Block, aggTxSlice []*protocol.AggTx, initial
 			select {
 			case aggTx = <-p2p.AggTxChan:
 				storage.WriteOpenTx(aggTx)
-				logger.Printf("  Received AGGTX: %x for block %x", aggTxHash, block.Hash[0:8])
+				logger.Debug("Received aggTx", "hash", block.Hash[0:8], "height", block.Height, "tx", aggTxHash)
 			case <-time.After(TXFETCH_TIMEOUT * time.Second):
 				stash := p2p.ReceivedAggTxStash
 				if p2p.AggTxAlreadyInStash(stash, aggTxHash){
 					for _, tx := range stash {
 						if tx.Hash() == aggTxHash {
 							aggTx = tx
-							logger.Printf("  FOUND: Request AGGTX: %x for block %x in received Stash during timeout", aggTx.Hash(), block.Hash[0:8])
+							logger.Debug("AggTx found in the received stash", "hash", block.Hash[0:8], "height", block.Height, "tx", aggTxHash)
 							break
 						}
 					}
@@ -1606,14 +1650,13 @@ func fetchAggTxData(block *protocol.Block, aggTxSlice []*protocol.AggTx, initial
 					cnt ++
 					goto HERE
 				}
-				logger.Printf("  TIME OUT: Request AGGTX: %x for block %x", aggTxHash, block.Hash[0:8])
+				logger.Warn("Timed out requesting aggTx", "hash", block.Hash[0:8], "height", block.Height, "tx", aggTxHash)
 				errChan <- errors.New("AggTx fetch timed out")
 				return
 			}
 			if aggTx.Hash() != aggTxHash {
 				errChan <- errors.New("Received AggTxHash did not correspond to our request.")
 			}
-			logger.Printf("Received requested AggTX %x", aggTx.Hash())
 		}
 
 		//At this point the aggTx visible in the blocks body should be received.
@@ -1654,7 +1697,7 @@ func fetchAggTxData(block *protocol.Block, aggTxSlice []*protocol.AggTx, initial
 
 				if tx != nil {
 					//Found already closed transaction --> Not needed for further process.
-					logger.Printf("Found Transaction %x which was in previous block.", tx.Hash())
+					logger.Debug("Aggregated transaction of a previous block", "hash", block.Hash[0:8], "height", block.Height, "tx", tx.Hash())
 					continue
 				} else {
 					tx = storage.ReadOpenTx(txHash)
@@ -1721,7 +1764,7 @@ func fetchAggTxData(block *protocol.Block, aggTxSlice []*protocol.AggTx, initial
 									cnt ++
 									goto NEXTTRY
 								}
-								logger.Printf("Fetching UnknownTX %x timed out for block %x", txHash, block.Hash[0:8])
+								logger.Warn("Timed out fetching aggregated transaction", "hash", block.Hash[0:8], "height", block.Height, "tx", txHash)
 								errChan <- errors.New("UnknownTx fetch timed out")
 								return
 							}
@@ -1768,7 +1811,7 @@ func fetchAggDataTxData(block *protocol.Block, aggTxSlice []*protocol.AggDataTx,
 			//Transaction need to be fetched from the network. This can still happen for aggregated transactiosn
 			cnt := 0
 		HERE:
-			logger.Printf("Request AGGDATATX: %x for block %x.", aggDataTxHash, block.Hash[0:8])
+			logger.Debug("Requesting aggDataTx", "hash", block.Hash[0:8], "height", block.Height, "tx", aggDataTxHash, "attempt", cnt)
 			//TODO request structure still needs to be implemented for the IoT project
 			err := p2p.TxReq(aggDataTxHash, p2p.AGGDATATX_REQ)
 			if err != nil {
@@ -1779,14 +1822,14 @@ func fetchAggDataTxData(block *protocol.Block, aggTxSlice []*protocol.AggDataTx,
 			select {
 			case aggDataTx = <-p2p.AggDataTxChan:
 				storage.WriteOpenTx(aggDataTx)
-				logger.Printf("  Received AGGDATATX: %x for block %x", aggDataTxHash, block.Hash[0:8])
+				logger.Debug("Received aggDataTx", "hash", block.Hash[0:8], "height", block.Height, "tx", aggDataTxHash)
 			case <-time.After(TXFETCH_TIMEOUT * time.Second):
 				stash := p2p.ReceivedAggDataTxStash
 				if p2p.AggDataTxAlreadyInStash(stash, aggDataTxHash) {
 					for _, tx := range stash {
 						if tx.Hash() == aggDataTxHash {
 							aggDataTx = tx
-							logger.Printf("  FOUND: Request AGGDATATX: %x for block %x in received Stash during timeout", aggDataTx.Hash(), block.Hash[0:8])
+							logger.Debug("AggDataTx found in the received stash", "hash", block.Hash[0:8], "height", block.Height, "tx", aggDataTxHash)
 							break
 						}
 					}
@@ -1796,14 +1839,13 @@ func fetchAggDataTxData(block *protocol.Block, aggTxSlice []*protocol.AggDataTx,
 					cnt++
 					goto HERE
 				}
-				logger.Printf("  TIME OUT: Request AGGDATATX: %x for block %x", aggDataTxHash, block.Hash[0:8])
+				logger.Warn("Timed out requesting aggDataTx", "hash", block.Hash[0:8], "height", block.Height, "tx", aggDataTxHash)
 				errChan <- errors.New("AggDataTx fetch timed out")
 				return
 			}
 			if aggDataTx.Hash() != aggDataTxHash {
 				errChan <- errors.New("Received AggDataTx did not correspond to our request.")
 			}
-			logger.Printf("Received requested AggDataTx %x", aggDataTx.Hash())
 		}
 
 		//At this point the aggTx visible in the blocks body should be received.
@@ -1829,7 +1871,7 @@ func fetchAggDataTxData(block *protocol.Block, aggTxSlice []*protocol.AggDataTx,
 
 			if tx != nil {
 				//Found already closed transaction --> Not needed for further process.
-				logger.Printf("Found Transaction %x which was in previous block.", tx.Hash())
+				logger.Debug("Aggregated transaction of a previous block", "hash", block.Hash[0:8], "height", block.Height, "tx", tx.Hash())
 				continue
 			} else {
 				tx = storage.ReadOpenTx(txHash)
@@ -1900,33 +1942,28 @@ func validateStateTransition(st *protocol.StateTransition) (err error) 	 {
 	stateTransitionValidation.Lock()
 	defer stateTransitionValidation.Unlock()
 
-	var senderAccAddress [64]byte
-
-	//find the senderAccount Address
+	//every validator of the shard can send the state transition of an agreed block, see bft.go
 	for address, shardID := range ValidatorShardMap.ValMapping {
-		if shardID == st.ShardID {
-			senderAccAddress = address
-			break
+		if shardID != st.ShardID {
+			continue
 		}
-	}
 
-	acc, err := storage.GetAccount(protocol.SerializeHashContent(senderAccAddress))
-	if err != nil {
-		return errors.New("Cannot fetch the sender account")
-	}
-
-	commitmentPubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitmentKey)
-	if err != nil {
-		return  errors.New("Invalid commitment key in account.")
-	}
+		acc, err := storage.GetAccount(protocol.SerializeHashContent(address))
+		if err != nil {
+			continue
+		}
 
+		commitmentPubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitmentKey)
+		if err != nil {
+			continue
+		}
 
-	err = crypto.VerifyMessageWithRSAKey(commitmentPubKey, fmt.Sprint(st.Height), st.CommitmentProof)
-	if err != nil {
-		return errors.New("The submitted commitment proof can not be verified.")
+		if crypto.VerifyMessageWithRSAKey(commitmentPubKey, fmt.Sprint(st.Height), st.CommitmentProof) == nil {
+			return nil
+		}
 	}
 
-	return nil
+	return errors.New("The submitted commitment proof can not be verified.")
 
 
 }
@@ -1961,7 +1998,7 @@ func validateCommitteeCheck(cc *protocol.CommitteeCheck) (err error) {
 
 //This function serves to validate an epoch block
 
-func validateEpochBlock(b *protocol.EpochBlock, relativeStates map[int]*protocol.RelativeState) error {
+func validateEpochBlock(b *protocol.EpochBlock, state map[[32]byte]*protocol.Account, relativeStates map[int]*protocol.RelativeState, receipts []*protocol.Receipt, loads map[int]protocol.ShardLoad) error {
 
 	epochBlockValidation.Lock()
 	defer epochBlockValidation.Unlock()
@@ -1986,10 +2023,10 @@ func validateEpochBlock(b *protocol.EpochBlock, relativeStates map[int]*protocol
 		acc.Balance,
 		b.CommitmentProof,
 		b.Timestamp) {
-		logger.Printf("could not validate the epoch block")
+		logger.Warn("Proof of stake of the epoch block invalid", "hash", b.Hash[0:8], "height", b.Height)
 		ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
 	} else {
-		logger.Printf("the epoch block could be successfully validated (PoS validation)")
+		logger.Debug("Proof of stake of the epoch block valid", "hash", b.Hash[0:8], "height", b.Height)
 	}
 
 	//now validate the state of the epoch block
@@ -1997,7 +2034,7 @@ func validateEpochBlock(b *protocol.EpochBlock, relativeStates map[int]*protocol
 
 	//aggregate relative state to the one which should theoretically be in the epoch block
 	for shardId, relativeState := range relativeStates {
-		logger.Printf("aggregation from shardID: %d", shardId)
+		logger.Debug("Aggregating relative state", "shard", shardId, "height", b.Height)
 		relativeStateCalculated = AggregateRelativeState(relativeStateCalculated, relativeState.RelativeState)
 	}
 
@@ -2005,11 +2042,28 @@ func validateEpochBlock(b *protocol.EpochBlock, relativeStates map[int]*protocol
 	//for this purpose, only the flow of funds has to be analyzed
 	var StateOld = CopyState(storage.State)
 
-
-	relativeStateFromEpochBlock := storage.GetRelativeState(StateOld, b.State)
+	relativeStateFromEpochBlock := storage.GetRelativeState(StateOld, state)
 	
 	if !sameRelativeState(relativeStateCalculated, relativeStateFromEpochBlock) {
-		logger.Printf("FOUND A CHEATER: Shard 1 inside the Epoch Block")
+		logger.Warn("FOUND A CHEATER: epoch block state does not match the state transitions", "hash", b.Hash[0:8], "height", b.Height)
+		ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+	}
+
+	//the epoch block has to deliver exactly the receipts the blocks of the epoch emitted
+	if err := validateEpochReceipts(b); err != nil {
+		logger.Warn("FOUND A CHEATER", "hash", b.Hash[0:8], "height", b.Height, "error", err)
+		ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+	} else if root := protocol.BuildReceiptsMerkleTree(collectEpochReceipts(receipts)).MerkleRoot(); root != b.ReceiptsRoot {
+		logger.Warn("FOUND A CHEATER: epoch block delivers other receipts than the blocks emitted", "hash", b.Hash[0:8], "height", b.Height)
+		ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+	}
+
+	//the number of shards has to follow from the loads the shards reported
+	if err := validateResharding(b, state, NumberOfShards); err != nil {
+		logger.Warn("FOUND A CHEATER", "hash", b.Hash[0:8], "height", b.Height, "error", err)
+		ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+	} else if err := validateShardLoads(b, loads); err != nil {
+		logger.Warn("FOUND A CHEATER", "hash", b.Hash[0:8], "height", b.Height, "error", err)
 		ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
 	}
 
@@ -2030,7 +2084,7 @@ func validate(b *protocol.Block, initialSetup bool) error {
 	block := b
 
 	if storage.ReadClosedBlock(b.Hash) != nil {
-		logger.Printf("Received block (%x) has already been validated.\n", b.Hash[0:8])
+		logger.Debug("Received block already validated", "hash", b.Hash[0:8], "shard", b.ShardId, "height", b.Height)
 		return errors.New("Received Block has already been validated.")
 	}
 
@@ -2076,30 +2130,17 @@ func validate(b *protocol.Block, initialSetup bool) error {
 	//if len(blocksToRollback) == 0 {
 	if true {
 		//for i, block := range blocksToValidate {
-			//Fetching payload data from the txs (if necessary, ask other miners).
-			accTxs, fundsTxs, configTxs, stakeTxs, committeeTxs, aggTxs, aggregatedFundsTxSlice, dataTxSlice, aggregatedDataTxSlice, aggDataTxSlice, fineTxSlice, err := preValidate(block, initialSetup)
-
-			//Check if the validator that added the block has previously voted on different competing chains (find slashing proof).
-			//The proof will be stored in the global slashing dictionary.
-			//not necessary in the IoT case
-			/*if block.Height > 0 {
-				seekSlashingProof(block)
-			}*/
-
+			data, err := checkBlock(block, initialSetup)
 			if err != nil {
 				return err
 			}
 
-			blockDataMap[block.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, committeeTxs, dataTxSlice, aggregatedDataTxSlice, aggDataTxSlice, aggTxs, aggregatedFundsTxSlice, fineTxSlice,block}
+			blockDataMap[block.Hash] = data
 
-			var previousStateCopy = CopyState(storage.State)
-			if err := validateState(blockDataMap[block.Hash], initialSetup); err != nil {
+			if _, err := applyBlock(blockDataMap[block.Hash], initialSetup); err != nil {
 				return err
 			}
 
-
-			storage.RelativeState = storage.GetRelativeState(previousStateCopy,storage.State)
-
 			logger.Printf("before postvalidation")
 			postValidate(blockDataMap[block.Hash], initialSetup)
 			logger.Printf("after postvalidation")
@@ -2148,6 +2189,62 @@ func validate(b *protocol.Block, initialSetup bool) error {
 	return nil
 }
 
+//Fetches the transactions of the block and checks the block and its receipts, without changing the state.
+func checkBlock(block *protocol.Block, initialSetup bool) (blockData, error) {
+	//Fetching payload data from the txs (if necessary, ask other miners).
+	accTxs, fundsTxs, configTxs, stakeTxs, committeeTxs, aggTxs, aggregatedFundsTxSlice, dataTxSlice, aggregatedDataTxSlice, aggDataTxSlice, fineTxSlice, err := preValidate(block, initialSetup)
+
+	//Check if the validator that added the block has previously voted on different competing chains (find slashing proof).
+	//The proof will be stored in the global slashing dictionary.
+	//not necessary in the IoT case
+	/*if block.Height > 0 {
+		seekSlashingProof(block)
+	}*/
+
+	if err != nil {
+		return blockData{}, err
+	}
+
+	receipts, creditedReceipts, err := validateReceipts(block, fundsTxs, aggregatedFundsTxSlice)
+	if err != nil {
+		return blockData{}, err
+	}
+
+	return blockData{accTxs, fundsTxs, configTxs, stakeTxs, committeeTxs, dataTxSlice, aggregatedDataTxSlice, aggDataTxSlice, aggTxs, aggregatedFundsTxSlice, fineTxSlice, receipts, creditedReceipts, block}, nil
+}
+
+//Changes the state with the block and keeps the relative state and the receipts for the state transition. Returns the
+//state before the block, such that it can be reset if the validators of the shard do not agree on the block.
+func applyBlock(data blockData, initialSetup bool) (map[[32]byte]protocol.Account, error) {
+	var previousStateCopy = CopyState(storage.State)
+	if err := validateState(data, initialSetup); err != nil {
+		return nil, err
+	}
+
+	storage.RelativeState = storage.GetRelativeState(previousStateCopy, storage.State)
+	storage.OutboundReceipts = data.receipts
+
+	return previousStateCopy, nil
+}
+
+//Resets the accounts to a copy of the state. They are changed in place, since the state is shared by pointers.
+func resetState(stateCopy map[[32]byte]protocol.Account) {
+	for address := range storage.State {
+		if _, exists := stateCopy[address]; !exists {
+			delete(storage.State, address)
+		}
+	}
+
+	for address, acc := range stateCopy {
+		if current, exists := storage.State[address]; exists {
+			*current = acc
+		} else {
+			restored := acc
+			storage.State[address] = &restored
+		}
+	}
+}
+
 func CopyState(state map[[32]byte]*protocol.Account) map[[32]byte]protocol.Account {
 
 	var copyState = make(map[[32]byte]protocol.Account)
@@ -2268,23 +2365,19 @@ func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protoc
 	}
 
 	if len(aggTxSlice) > 0{
-		logger.Printf("-- Fetch AggTxData - Start")
 		select {
 		case aggregatedFundsTxSlice = <- aggregatedFundsChan:
 		case <-time.After(10 * time.Minute):
 			return nil, nil, nil,nil, nil, nil, nil, nil, nil, nil, nil, errors.New("Fetching FundsTx aggregated in AggTx failed.")
 		}
-		logger.Printf("-- Fetch AggTxData - End")
 	}
 
 	if len(aggDataTxSlice) > 0{
-		logger.Printf("-- Fetch AggDataTxData - Start")
 		select {
 		case aggregatedDataTxSlice = <- aggregatedDataChan:
 		case <-time.After(10 * time.Minute):
 			return nil, nil, nil, nil,nil, nil, nil, nil, nil, nil, nil, errors.New("Fetching DataTx aggregated in AggDataTx failed.")
 		}
-		logger.Printf("-- Fetch AggDataTxData - End")
 	}
 
 	//Check state contains beneficiary.
@@ -2307,7 +2400,6 @@ func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protoc
 	}
 
 	err = crypto.VerifyMessageWithRSAKey(commitmentPubKey, fmt.Sprint(block.Height), block.CommitmentProof)
-	logger.Printf("CommitmentPubKey: %x, --------------- Block Height: %d", commitmentPubKey, block.Height)
 	if err != nil {
 		return nil, nil, nil,nil,nil, nil, nil, nil, nil, nil, nil,  errors.New("The submitted commitment proof can not be verified.")
 	}
@@ -2317,9 +2409,7 @@ func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protoc
 
 	//PoS validation
 	if !initialSetup && !validateProofOfStake(getDifficulty(), prevProofs, block.Height, acc.Balance, block.CommitmentProof, block.Timestamp) {
-		logger.Printf("____________________NONCE (%x) in block %x is problematic", block.Nonce, block.Hash[0:8])
-		logger.Printf("|  block.Height: %d, acc.Address %x, acc.txCount %v, acc.Balance %v, block.CommitmentProf: %x, block.Timestamp %v ", block.Height, acc.Address[0:8], acc.TxCnt,  acc.Balance, block.CommitmentProof[0:8], block.Timestamp)
-		logger.Printf("|_____________________________________________________")
+		logger.Warn("Nonce of the block is incorrect", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height, "beneficiary", acc.Address[0:8], "balance", acc.Balance, "timestamp", block.Timestamp)
 
 		return nil, nil, nil, nil,  nil,nil, nil, nil, nil, nil, nil, errors.New("The nonce is incorrect.")
 	}
@@ -2364,7 +2454,14 @@ func validateState(data blockData, initialSetup bool) error {
 		return err
 	}
 
-	if err := fundsStateChange(data.fundsTxSlice, initialSetup); err != nil {
+	//Receipts are credited first, such that the receivers can spend them in the same block
+	if err := receiptStateChange(data.creditedReceipts); err != nil {
+		accStateChangeRollback(data.accTxSlice)
+		return err
+	}
+
+	if err := fundsStateChange(data.fundsTxSlice, data.receipts, initialSetup); err != nil {
+		receiptStateChangeRollback(data.creditedReceipts)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
@@ -2374,27 +2471,31 @@ func validateState(data blockData, initialSetup bool) error {
 	}
 
 	if err := aggTxStateChange(data.aggregatedFundsTxSlice, initialSetup); err != nil {
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
 	//TODO implement rollbacks in case they will be needed for IoT
 	if err := dataStateChange(data.dataTxSlice, initialSetup); err != nil {
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
 	//TODO implement rollbacks in case they will be needed for IoT
 	if err := aggDataTxStateChange(data.aggregatedDataTxSlice, initialSetup); err != nil {
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
 	if err := stakeStateChange(data.stakeTxSlice, data.block.Height, initialSetup); err != nil {
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 		accStateChangeRollback(data.accTxSlice)
 //		aggregatedStateRollback(data.aggTxSlice, data.block.HashWithoutTx, data.block.Beneficiary)
 		return err
@@ -2402,7 +2503,8 @@ func validateState(data blockData, initialSetup bool) error {
 
 	if err := collectTxFees(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.committeeTxSlice, data.aggTxSlice, data.dataTxSlice, data.aggDataTxSlice, data.fineTxSlice, data.block.Beneficiary, initialSetup); err != nil {
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 //		aggregatedStateRollback(data.aggTxSlice, data.block.HashWithoutTx, data.block.Beneficiary)
 		accStateChangeRollback(data.accTxSlice)
 		return err
@@ -2411,7 +2513,8 @@ func validateState(data blockData, initialSetup bool) error {
 	if err := collectBlockReward(ActiveParameters.Block_reward, data.block.Beneficiary, initialSetup); err != nil {
 		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 //		aggregatedStateRollback(data.aggTxSlice, data.block.HashWithoutTx, data.block.Beneficiary)
 		accStateChangeRollback(data.accTxSlice)
 		return err
@@ -2421,7 +2524,8 @@ func validateState(data blockData, initialSetup bool) error {
 		collectBlockRewardRollback(ActiveParameters.Block_reward, data.block.Beneficiary)
 		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 //		aggregatedStateRollback(data.aggTxSlice, data.block.HashWithoutTx, data.block.Beneficiary)
 		accStateChangeRollback(data.accTxSlice)
 		return err
@@ -2432,7 +2536,8 @@ func validateState(data blockData, initialSetup bool) error {
 		collectBlockRewardRollback(ActiveParameters.Block_reward, data.block.Beneficiary)
 		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
+		receiptStateChangeRollback(data.creditedReceipts)
 //		aggregatedStateRollback(data.aggTxSlice, data.block.HashWithoutTx, data.block.Beneficiary)
 		accStateChangeRollback(data.accTxSlice)
 		return err
@@ -2449,6 +2554,10 @@ func postValidate(data blockData, initialSetup bool) {
 	configStateChange(data.configTxSlice, data.block.Hash)
 	//Collects meta information about the block (and handled difficulty adaption).
 	collectStatistics(data.block)
+	writeReceiptStatuses(data.receipts, protocol.RECEIPT_PENDING, data.block.Hash, protocol.BuildReceiptsMerkleTree(data.receipts))
+	if len(data.creditedReceipts) > 0 {
+		writeReceiptStatuses(data.creditedReceipts, protocol.RECEIPT_CREDITED, data.block.Hash, protocol.BuildMerkleTree(data.block))
+	}
 
 	//-----------------------------------------------------------------------------------------------------------------------//
 	//note how postvalidation leaves out a lot of stuff. This is because transactions dont have to be deleted locally anymore.
@@ -2538,7 +2647,6 @@ func postValidate(data blockData, initialSetup bool) {
 				}
 				if trx == nil {
 					break
-					logger.Printf("trx is nil")
 				}
 
 				//dont delete the individual tx anymore
@@ -2566,12 +2674,12 @@ func postValidate(data blockData, initialSetup bool) {
 
 		//Broadcast AggTx to the neighbors, such that they do not have to request them later.
 		if len(data.aggTxSlice) > 0 {
-			logger.Printf("broadcasting agg tx")
+			logger.Debug("Broadcasting aggTxs", "hash", data.block.Hash[0:8], "height", data.block.Height, "count", len(data.aggTxSlice))
 			broadcastVerifiedAggTxsToOtherMiners(data.aggTxSlice)
 		}
 
 		if len(data.aggDataTxSlice) > 0 {
-			logger.Printf("broadcasting agg data tx")
+			logger.Debug("Broadcasting aggDataTxs", "hash", data.block.Hash[0:8], "height", data.block.Height, "count", len(data.aggDataTxSlice))
 			broadcastVerifiedAggDataTxsToOtherMiners(data.aggDataTxSlice)
 		}
 
@@ -2595,9 +2703,8 @@ func postValidate(data blockData, initialSetup bool) {
 
 
 		// Write last block to db and delete last block's ancestor.
-		logger.Printf("Delete all last closed blocks")
 		storage.DeleteAllLastClosedBlock()
-		logger.Printf("Wrriting last closed block. Height: %d", data.block.Height)
+		logger.Debug("Writing last closed block", "hash", data.block.Hash[0:8], "shard", data.block.ShardId, "height", data.block.Height)
 		storage.WriteLastClosedBlock(data.block)
 	}
 }
@@ -2624,11 +2731,11 @@ func slashingCheck(slashedAddress, conflictingBlockHash1, conflictingBlockHash2
 	prefix := "Invalid slashing proof: "
 
 	if conflictingBlockHash1 == [32]byte{} || conflictingBlockHash2 == [32]byte{} {
-		return false, errors.New(fmt.Sprintf(prefix + "Invalid conflicting block hashes provided."))
+		return false, errors.New(prefix + "Invalid conflicting block hashes provided.")
 	}
 
 	if conflictingBlockHash1 == conflictingBlockHash2 {
-		return false, errors.New(fmt.Sprintf(prefix + "Conflicting block hashes are the same."))
+		return false, errors.New(prefix + "Conflicting block hashes are the same.")
 	}
 
 	//Fetch the blocks for the provided block hashes.
@@ -2637,7 +2744,7 @@ func slashingCheck(slashedAddress, conflictingBlockHash1, conflictingBlockHash2
 
 
 	if IsInSameChain(conflictingBlock1, conflictingBlock2) {
-		return false, errors.New(fmt.Sprintf(prefix + "Conflicting block hashes are on the same chain."))
+		return false, errors.New(prefix + "Conflicting block hashes are on the same chain.")
 	}
 
 	//TODO Optimize code (duplicated)
@@ -2661,16 +2768,16 @@ func slashingCheck(slashedAddress, conflictingBlockHash1, conflictingBlockHash2
 							break
 						}
 					}
-					logger.Printf("Block %x received Before", conflictingBlockHash1)
+					logger.Debug("Block found in the received block stash", "hash", conflictingBlockHash1[0:8])
 					break
 				}
-				return false, errors.New(fmt.Sprintf(prefix + "Could not find a block with the provided conflicting hash (1)."))
+				return false, errors.New(prefix + "Could not find a block with the provided conflicting hash (1).")
 			}
 		}
 
 		ancestor, _ := getNewChain(conflictingBlock1)
 		if ancestor == [32]byte{} {
-			return false, errors.New(fmt.Sprintf(prefix + "Could not find a ancestor for the provided conflicting hash (1)."))
+			return false, errors.New(prefix + "Could not find a ancestor for the provided conflicting hash (1).")
 		}
 	}
 
@@ -2695,23 +2802,23 @@ func slashingCheck(slashedAddress, conflictingBlockHash1, conflictingBlockHash2
 							break
 						}
 					}
-					logger.Printf("Block %x received Before", conflictingBlockHash2)
+					logger.Debug("Block found in the received block stash", "hash", conflictingBlockHash2[0:8])
 					break
 				}
-				return false, errors.New(fmt.Sprintf(prefix + "Could not find a block with the provided conflicting hash (2)."))
+				return false, errors.New(prefix + "Could not find a block with the provided conflicting hash (2).")
 			}
 		}
 
 		ancestorHash, _ := getNewChain(conflictingBlock2)
 		if ancestorHash == [32]byte{} {
-			return false, errors.New(fmt.Sprintf(prefix + "Could not find a ancestor for the provided conflicting hash (2)."))
+			return false, errors.New(prefix + "Could not find a ancestor for the provided conflicting hash (2).")
 		}
 	}
 
 	// We found the height of the blocks and the height of the blocks can be checked.
 	// If the height is not within the active slashing window size, we must throw an error. If not, the proof is valid.
 	if !(conflictingBlock1.Height < uint32(ActiveParameters.Slashing_window_size)+conflictingBlock2.Height) {
-		return false, errors.New(fmt.Sprintf(prefix + "Could not find a ancestor for the provided conflicting hash (2)."))
+		return false, errors.New(prefix + "Could not find a ancestor for the provided conflicting hash (2).")
 	}
 
 	//Delete the proof from local slashing dictionary. If proof has not existed yet, nothing will be deleted.
@@ -2738,6 +2845,10 @@ func AggregateRelativeState(stateRelPrev map[[32]byte]*protocol.RelativeAccount,
 			accRelPrev.Balance = accRelPrev.Balance + accRel.Balance
 			accRelPrev.TxCnt = accRelPrev.TxCnt + accRel.TxCnt
 			accRelPrev.StakingBlockHeight = accRelPrev.StakingBlockHeight + accRel.StakingBlockHeight
+			//Contract variables are absolute values, only sent along if a contract call changed them.
+			if accRel.ContractVariables != nil {
+				accRelPrev.ContractVariables = accRel.ContractVariables
+			}
 			//Staking Tx can only be positive. So only take the info from the relative state if currently not staking (otherwhise we might accidentally change the state back)
 			//Also take over commitment key.
 			if accRelPrev.IsStaking == false {
@@ -6,10 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/logging"
 	"github.com/oigele/bazo-miner/p2p"
 	"github.com/oigele/bazo-miner/protocol"
 	"github.com/oigele/bazo-miner/storage"
-	"log"
 	"math"
 	"math/rand"
 	"sync"
@@ -17,7 +17,7 @@ import (
 )
 
 var (
-	logger                          *log.Logger
+	logger                          *logging.Logger
 	blockValidation                 = &sync.Mutex{}
 	epochBlockValidation            = &sync.Mutex{}
 	stateTransitionValidation       = &sync.Mutex{}
@@ -68,7 +68,7 @@ func InitCommittee(committeeWallet *ecdsa.PublicKey, committeePrivKey *ecdsa.Pri
 
 
 	//Set up logger.
-	logger = storage.InitLogger()
+	logger = logging.New("miner")
 
 	logger.Printf("\n\n\n" +
 		"BBBBBBBBBBBBBBBBB               AAA               ZZZZZZZZZZZZZZZZZZZ     OOOOOOOOO\n" +
@@ -88,11 +88,10 @@ func InitCommittee(committeeWallet *ecdsa.PublicKey, committeePrivKey *ecdsa.Pri
 		"B::::::::::::::::BA:::::A                 A:::::A Z:::::::::::::::::Z   OO:::::::::OO\n" +
 		"BBBBBBBBBBBBBBBBBAAAAAAA                   AAAAAAAZZZZZZZZZZZZZZZZZZZ     OOOOOOOOO\n\n\n")
 
-	logger.Printf("\n\n\n-------------------- START Committee Member ---------------------")
-	logger.Printf("This Miners IP-Address: %v\n\n", p2p.Ipport)
+	logger.Info("Starting committee member", "address", p2p.Ipport)
 
 	currentTargetTime = new(timerange)
-	target = append(target, 13)
+	target = append(target, INITIAL_DIFFICULTY)
 
 	parameterSlice = append(parameterSlice, NewDefaultParameters())
 	ActiveParameters = &parameterSlice[0]
@@ -109,23 +108,34 @@ func InitCommittee(committeeWallet *ecdsa.PublicKey, committeePrivKey *ecdsa.Pri
 	//Listen to incoming fine tx. This is done in this way to make sure that only committee members get the fine tx.
 	//Committee members need the fine tx in order to correctly reconstruct the relative states including fine tx.
 	go incomingFineTx()
+	//The committee does not take part in the agreement of the shards, but drains the proposals and votes
+	go incomingProposals()
+	go incomingVotes()
+	//Listen to the endorsements of the other committee members
+	go incomingEndorsements()
 
 	//wait for the first epoch block
 	for {
 		time.Sleep(time.Second)
 		if lastEpochBlock != nil {
 			if lastEpochBlock.Height >= 2 {
-				logger.Printf("accepting the state of epoch block height: %d", lastEpochBlock.Height)
-				storage.State = lastEpochBlock.State
+				state, err := epochBlockState(lastEpochBlock)
+				if err != nil {
+					logger.Warn("State of the epoch block not available", "hash", lastEpochBlock.Hash[0:8], "height", lastEpochBlock.Height, "error", err)
+					continue
+				}
+				logger.Info("Accepting the state of the epoch block", "height", lastEpochBlock.Height)
+				storage.State = state
 				NumberOfShards = lastEpochBlock.NofShards
 				storage.CommitteeLeader = lastEpochBlock.CommitteeLeader
 				ValidatorShardMap = lastEpochBlock.ValMapping
+				storage.ValShardMapping = ValidatorShardMap
 				//initialize the assignment height
 				storage.AssignmentHeight = int(lastEpochBlock.Height) - 1 - EPOCH_LENGTH
 				//now initiate the committee check for the previous epoch in order to circumvent a NPE
 				committeeProof, err := crypto.SignMessageWithRSAKey(storage.CommitteePrivKey, fmt.Sprint(storage.AssignmentHeight))
 				if err != nil {
-					logger.Printf("Got a problem with creating the committeeProof.")
+					logger.Error("Could not create the committee proof", "height", storage.AssignmentHeight, "error", err)
 					return
 				}
 				cc := protocol.NewCommitteeCheck(storage.AssignmentHeight, protocol.SerializeHashContent(ValidatorAccAddress), [256]byte{}, [][32]byte{}, [][32]byte{})
@@ -146,7 +156,8 @@ func InitCommittee(committeeWallet *ecdsa.PublicKey, committeePrivKey *ecdsa.Pri
 }
 
 func CommitteeMining(height int) {
-	logger.Printf("---------------------------------------- Committee Mining for Epoch Height: %d ----------------------------------------", height)
+	logger.Info("Committee mining", "epochHeight", height)
+	pruneEndorsements(uint32(height))
 
 	//In the beginning of each round, the slashing of the last round is performed. The reason for this is the division of power.
 	//The leader of the new round should be the one who performs the checks for the last height
@@ -161,10 +172,10 @@ func CommitteeMining(height int) {
 		}
 
 
-		logger.Printf("We have %d Committee Nodes in the network. The commitee Leader is %x", DetNumberOfCommittees(), storage.CommitteeLeader[0:8])
+		logger.Debug("Committee members", "members", DetNumberOfCommittees(), "leader", storage.CommitteeLeader[0:8])
 
 		if lastEpochBlock.CommitteeLeader == protocol.SerializeHashContent(ValidatorAccAddress) {
-			logger.Printf("I am the committee leader. Start the committee collection mechanism")
+			logger.Debug("Collecting committee checks as committee leader", "height", height-2)
 
 			//start the mechanism
 			for {
@@ -178,7 +189,7 @@ func CommitteeMining(height int) {
 							//first check the commitment Proof. If it's invalid, continue the search
 							err := validateCommitteeCheck(cc)
 							if err != nil {
-								logger.Printf("Cannot validate committee check")
+								logger.Warn("Invalid committee check", "height", cc.Height, "sender", cc.Sender[0:8], "error", err)
 								continue
 							}
 							committeesStateBoolMap[cc.Sender] = true
@@ -187,11 +198,11 @@ func CommitteeMining(height int) {
 				}
 				//If all committee checks have been received, stop synchronisation.
 				if len(committeeCheckStashForHeight) == DetNumberOfCommittees() -1 {
-					logger.Printf("Received all committee checks. Initiate the byzantine mechanism.")
+					logger.Debug("Received all committee checks", "height", height-2)
 					runByzantineMechanism(committeeCheckStashForHeight)
 					break
 				} else {
-					logger.Printf("Length of committee stash: %d", len(committeeCheckStashForHeight))
+					logger.Debug("Waiting for committee checks", "height", height-2, "received", len(committeeCheckStashForHeight))
 				}
 				//Iterate over shard IDs to check which ones are still missing, and request them from the network
 				for _, address := range committeeMembers {
@@ -200,13 +211,13 @@ func CommitteeMining(height int) {
 						//Maybe the committee check was received in the meantime. Then dont request it again.
 						foundCc := searchCommitteeCheck(address, height)
 						if foundCc != nil {
-							logger.Printf("skip planned request for address %x", address[0:8])
+							logger.Debug("Committee check already received", "height", height-2, "sender", address[0:8])
 							continue
 						}
 
 						var committeeCheck *protocol.CommitteeCheck
 
-						logger.Printf("requesting committeeCheck for lastblock height: %d from address: %x\n", height - 2, address[0:8])
+						logger.Debug("Requesting committee check", "height", height-2, "sender", address[0:8])
 
 						//-2 Because we check for the previous epoch
 						p2p.CommitteeCheckReq(address, height-2)
@@ -220,11 +231,11 @@ func CommitteeMining(height int) {
 								continue
 							}
 
-							logger.Printf("Received the committee check")
+							logger.Debug("Received committee check", "height", committeeCheck.Height, "sender", address[0:8])
 							//first check the commitment Proof. If it's invalid, continue the search
 							err := validateCommitteeCheck(committeeCheck)
 							if err != nil {
-								logger.Printf(err.Error())
+								logger.Warn("Invalid committee check", "height", committeeCheck.Height, "error", err)
 								continue
 							}
 							storage.ReceivedCommitteeCheckStash.Set(committeeCheck.HashCommitteCheck(), committeeCheck)
@@ -233,7 +244,7 @@ func CommitteeMining(height int) {
 
 							//Limit waiting time to 2 seconds seconds before aborting.
 						case <-time.After(2 * time.Second):
-							logger.Printf("have been waiting for 2 seconds for committee check height: %d\n", height-2)
+							logger.Debug("Timed out requesting committee check", "height", height-2, "sender", address[0:8])
 							//It the requested state transition has not been received, then continue with requesting the other missing ones
 							continue
 						}
@@ -252,7 +263,7 @@ func CommitteeMining(height int) {
 	FirstStartCommittee = false
 	//generate sequence of all shard IDs starting from 1
 	shardIDs := makeRange(1, NumberOfShards)
-	logger.Printf("Number of shards: %d\n", NumberOfShards)
+	logger.Info("Assigning transactions", "shards", NumberOfShards)
 	//find out if I am the committee leader. If yes, construct the transaction assignment
 	if lastEpochBlock.CommitteeLeader == protocol.SerializeHashContent(ValidatorAccAddress) {
 		//generating the assignment data
@@ -261,7 +272,7 @@ func CommitteeMining(height int) {
 		storage.AssignedTxMempool = make(map[[32]byte]protocol.Transaction)
 		openTransactions := storage.ReadAllOpenTxs()
 
-		logger.Printf("length of open transactions: %d", len(openTransactions))
+		logger.Debug("Assigning open transactions", "height", height, "txs", len(openTransactions))
 
 		accTxsMap := make(map[int][]*protocol.AccTx)
 		stakeTxsMap := make(map[int][]*protocol.StakeTx)
@@ -270,7 +281,6 @@ func CommitteeMining(height int) {
 		dataTxsMap := make(map[int][]*protocol.DataTx)
 		fineTxsMap := make(map[int][]*protocol.FineTx)
 
-		logger.Printf("before assigning transactions")
 
 		//the transactions are distributed to the shards based on the public address of the sender
 		for _, openTransaction := range openTransactions {
@@ -295,19 +305,19 @@ func CommitteeMining(height int) {
 		for _, shardId := range shardIDs {
 			committeeProof, err := crypto.SignMessageWithRSAKey(storage.CommitteePrivKey, fmt.Sprint(height))
 			if err != nil {
-				logger.Printf("Error with signing the Committee Proof Message")
+				logger.Error("Could not sign the committee proof", "height", height, "error", err)
 				return
 			}
 
 			ta := protocol.NewTransactionAssignment(height, shardId, committeeProof, accTxsMap[shardId], stakeTxsMap[shardId], committeeTxsMap[shardId], fundsTxsMap[shardId], dataTxsMap[shardId], fineTxsMap[shardId])
 
 			storage.AssignedTxMap[shardId] = ta
-			logger.Printf("broadcasting assignment data for ShardId: %d", shardId)
-			logger.Printf("Length of AccTx: %d, StakeTx: %d, CommitteeTx: %d, FundsTx: %d, DataTx: %d, FineTx: %d", len(accTxsMap[shardId]), len(stakeTxsMap[shardId]), len(committeeTxsMap[shardId]), len(fundsTxsMap[shardId]), len(dataTxsMap[shardId]), len(fineTxsMap[shardId]))
+			//the validators only take the assignment once a quorum of the committee endorsed it
+			endorseAssignment(ta)
+			logger.Debug("Broadcasting transaction assignment", "shard", shardId, "height", height, "accTxs", len(accTxsMap[shardId]), "stakeTxs", len(stakeTxsMap[shardId]), "committeeTxs", len(committeeTxsMap[shardId]), "fundsTxs", len(fundsTxsMap[shardId]), "dataTxs", len(dataTxsMap[shardId]), "fineTxs", len(fineTxsMap[shardId]))
 			broadcastAssignmentData(ta)
 		}
 
-		logger.Printf("After assigning transactions")
 		//If I am not the committee leader, wait for the assignment
 	} else {
 		//reset the assigned tx map
@@ -328,10 +338,11 @@ func CommitteeMining(height int) {
 						//first check the commitment Proof. If it's invalid, continue the search
 						err := validateTransactionAssignment(ta)
 						if err != nil {
-							logger.Printf("Cannot validate transaction assignment")
+							logger.Warn("Invalid transaction assignment", "shard", ta.ShardID, "height", ta.Height, "error", err)
 							continue
 						}
 						storage.AssignedTxMap[ta.ShardID]= ta
+						endorseAssignment(ta)
 
 						//overwrite the previous mempool. Take the new transactions
 						//this is thread safe because it's all done sequentially
@@ -360,10 +371,10 @@ func CommitteeMining(height int) {
 			}
 			//If all state transitions have been received, stop synchronisation
 			if len(transactionAssignmentsForHeight) == NumberOfShards {
-				logger.Printf("Received all transaction assignments. Continue")
+				logger.Debug("Received all transaction assignments", "height", height)
 				break
 			} else {
-				logger.Printf("Length of transaction assignment stash: %d", len(transactionAssignmentsForHeight))
+				logger.Debug("Waiting for transaction assignments", "height", height, "received", len(transactionAssignmentsForHeight))
 			}
 			//Iterate over shard IDs to check which ones are still missing, and request them from the network
 			for _, id := range shardIDs {
@@ -372,7 +383,7 @@ func CommitteeMining(height int) {
 					//Maybe the committee check was received in the meantime. Then dont request it again.
 					foundTa := searchTransactionAssignment(id, height)
 					if foundTa != nil {
-						logger.Printf("skip planned request for id %d", id)
+						logger.Debug("Transaction assignment already received", "shard", id, "height", height)
 						continue
 					}
 
@@ -393,11 +404,12 @@ func CommitteeMining(height int) {
 						//first check the commitment Proof. If it's invalid, continue the search
 						err := validateTransactionAssignment(transactionAssignment)
 						if err != nil {
-							logger.Printf(err.Error())
+							logger.Warn("Invalid transaction assignment", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height, "error", err)
 							continue
 						}
 
 						storage.AssignedTxMap[transactionAssignment.ShardID]= transactionAssignment
+						endorseAssignment(transactionAssignment)
 
 						//overwrite the previous mempool. Take the new transactions
 						//this is thread safe because it's all done sequentially
@@ -427,7 +439,7 @@ func CommitteeMining(height int) {
 
 						//Limit waiting time to 2 seconds seconds before aborting.
 					case <-time.After(2 * time.Second):
-						logger.Printf("have been waiting for 2 seconds for transaction assignment height: %d\n", height)
+						logger.Debug("Timed out requesting transaction assignment", "shard", id, "height", height)
 						//It the requested state transition has not been received, then continue with requesting the other missing ones
 						continue
 					}
@@ -445,6 +457,12 @@ func CommitteeMining(height int) {
 
 	//key: shard ID; value: Relative state of the corresponding shard
 	relativeStatesToCheck := make(map[int]*protocol.RelativeState)
+	//receipts emitted by the blocks, the next epoch block has to deliver them
+	var emittedReceipts []*protocol.Receipt
+	//key: shard ID; value: load of the shard, the next epoch block decides the number of shards with them
+	shardLoads := make(map[int]protocol.ShardLoad)
+	//blocks whose relative state is taken from the state transition of their shard
+	var certifiedBlocks []certifiedBlock
 
 	blockIDBoolMap := make(map[int]bool)
 	for k, _ := range blockIDBoolMap {
@@ -453,13 +471,12 @@ func CommitteeMining(height int) {
 
 	//no block validation in the first round to make sure that the genesis block isn't checked
 	if !FirstStartCommittee || DetNumberOfCommittees() > 1 {
-		logger.Printf("before block validation")
+		logger.Debug("Validating shard blocks", "height", height+1)
 		for {
 			//the committee member is now bootstrapped. In an infinite for-loop, perform its task
 			blockStashForHeight := protocol.ReturnBlockStashForHeight(storage.ReceivedShardBlockStash, uint32(height+1))
 			if len(blockStashForHeight) != 0 {
-				logger.Printf("height being inspected: %d", height+1)
-				logger.Printf("length of block stash for height: %d", len(blockStashForHeight))
+				logger.Debug("Shard blocks received", "height", height+1, "received", len(blockStashForHeight))
 				//Iterate through state transitions and apply them to local state, keep track of processed shards
 				//Also perform some verification steps, i.e. proof of stake check
 				for _, b := range blockStashForHeight {
@@ -470,31 +487,46 @@ func CommitteeMining(height int) {
 							continue
 						}
 
-						err := CommitteeValidateBlock(b)
-						if err != nil {
-							ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+						//blocks a quorum of their shard agreed on are not executed again, see bft.go
+						certified := trustsCertificate(b)
+						if !certified {
+							err := CommitteeValidateBlock(b)
+							if err != nil {
+								ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+								//only the beneficiary that signed the block is penalized, not the miner that relayed it
+								if err == errInvalidProofOfStake {
+									p2p.ReportValidator(b.Beneficiary, p2p.MISBEHAVIOR_INVALID_BLOCK)
+								}
+							}
 						}
 
 						//fetch data from the block
 						accTxs, fundsTxs, _, stakeTxs, committeeTxs, aggTxs, aggregatedFundsTxSlice, dataTxs, aggregatedDataTxSlice, aggDataTxs, fineTxs, err := preValidate(b, false)
 
+						emittedReceipts = append(emittedReceipts, blockReceipts(b, fundsTxs)...)
+
 						//append the aggTxs to the normal fundsTxs to delete
 						fundsTxs = append(fundsTxs, aggregatedFundsTxSlice...)
 						dataTxs = append(dataTxs, aggregatedDataTxSlice...)
 
 
 
-						relativeState := ReconstructRelativeState(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs)
-						relativeStatesToCheck[b.ShardId] = relativeState
+						if certified {
+							certifiedBlocks = append(certifiedBlocks, newCertifiedBlock(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs))
+						} else {
+							relativeState := ReconstructRelativeState(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs)
+							relativeStatesToCheck[b.ShardId] = relativeState
+						}
+						shardLoads[b.ShardId] = protocol.NewShardLoad(0, blockFill(b))
 
 						UpdateSummary(dataTxs)
 
-						logger.Printf("In block from shardID: %d, height: %d, deleting accTxs: %d, stakeTxs: %d, committeeTxs: %d, fundsTxs: %d, aggTxs: %d, dataTxs: %d, aggDataTxs: %d, fineTxs: %d", b.ShardId, b.Height, len(accTxs), len(stakeTxs), len(committeeTxs), len(fundsTxs), len(aggTxs), len(dataTxs), len(aggDataTxs), len(fineTxs))
+						logger.Debug("Closing transactions of shard block", "shard", b.ShardId, "height", b.Height, "accTxs", len(accTxs), "stakeTxs", len(stakeTxs), "committeeTxs", len(committeeTxs), "fundsTxs", len(fundsTxs), "aggTxs", len(aggTxs), "dataTxs", len(dataTxs), "aggDataTxs", len(aggDataTxs), "fineTxs", len(fineTxs))
 
 
 						alreadyClosedTxHashes, err := storage.WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs, stakeTxs, committeeTxs, fundsTxs, aggTxs, dataTxs, aggDataTxs, fineTxs)
 						if err != nil {
-							logger.Printf(err.Error())
+							logger.Error("Could not write the closed transactions", "shard", b.ShardId, "height", b.Height, "error", err)
 							return
 						}
 						if len(alreadyClosedTxHashes) > 0{
@@ -513,38 +545,38 @@ func CommitteeMining(height int) {
 						notIncludedTxHashes := storage.DeleteAllOpenTxAndReturnAllNotIncludedTxHashes(accTxs, stakeTxs, committeeTxs, fundsTxs, aggTxs, dataTxs, aggDataTxs, fineTxs)
 						//If this evaluates to true, then the shard created a transaction out of thin air.
 						if len(notIncludedTxHashes) > 0 {
-							logger.Printf("found a shard to be punished")
+							logger.Warn("Shard block contains transactions that were not assigned", "shard", b.ShardId, "height", b.Height, "txs", len(notIncludedTxHashes))
 							ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
 						}
 
 						blockIDBoolMap[b.ShardId] = true
 
-						logger.Printf("Processed block of shard: %d\n", b.ShardId)
+						logger.Debug("Processed shard block", "shard", b.ShardId, "height", b.Height)
 
 					}
 				}
 				//If all blocks have been received, stop synchronisation
 				if len(blockStashForHeight) == NumberOfShards {
-					logger.Printf("received all blocks for height. Break")
+					logger.Debug("Received all shard blocks", "height", height+1)
 					break
 				} else {
-					logger.Printf("height: %d", height+1)
-					logger.Printf("number of shards: %d", NumberOfShards)
+					logger.Debug("Waiting for shard blocks", "height", height+1, "shards", NumberOfShards)
 				}
 			}
 			//for the blocks that haven't been processed yet, introduce request structure
-			//can still accelerate this structure
+			//the blocks of all shards are downloaded at once, the ones still missing are asked for one by one below
+			syncShardBlocks(shardIDs, blockIDBoolMap, height+1)
 			for _, shardIdReq := range shardIDs {
 				if !blockIDBoolMap[shardIdReq] {
 					var b *protocol.Block
 
 					foundBlock := searchBlock(shardIdReq, height + 1)
 					if foundBlock != nil {
-						logger.Printf("skip planned block request for shardID %d", shardIdReq)
+						logger.Debug("Shard block already received", "shard", shardIdReq, "height", height+1)
 						continue
 					}
 
-					logger.Printf("Requesting Block for Height: %d and ShardID %d", int(height)+1, shardIdReq)
+					logger.Debug("Requesting shard block", "shard", shardIdReq, "height", height+1)
 					p2p.ShardBlockReq(int(height)+1, shardIdReq)
 					//blocking wait
 					select {
@@ -553,12 +585,13 @@ func CommitteeMining(height int) {
 						b = b.Decode(encodedBlock)
 
 						if b == nil {
-							logger.Printf("block is nil")
+							logger.Warn("Could not decode the shard block", "shard", shardIdReq, "height", height+1)
 							return
 						}
+						p2p.LinkSender(encodedBlock, b.HashBlock())
 
 						if b.ShardId != shardIdReq {
-							logger.Printf("Shard ID of received block %d vs shard ID of request %d. Continue", b.ShardId, shardIdReq)
+							logger.Debug("Received shard block of another shard", "shard", b.ShardId, "requested", shardIdReq, "height", b.Height)
 							continue
 						}
 
@@ -567,32 +600,46 @@ func CommitteeMining(height int) {
 							continue
 						}
 
-						logger.Printf("Validation of block height: %d, ShardID: %d", b.Height, b.ShardId)
+						logger.Debug("Validating shard block", "shard", b.ShardId, "height", b.Height)
 
-						err := CommitteeValidateBlock(b)
-						if err != nil {
-							ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+						certified := trustsCertificate(b)
+						if !certified {
+							err := CommitteeValidateBlock(b)
+							if err != nil {
+								ShardsToBePunished = append(ShardsToBePunished, b.Beneficiary)
+								//only the beneficiary that signed the block is penalized, not the miner that relayed it
+								if err == errInvalidProofOfStake {
+									p2p.ReportValidator(b.Beneficiary, p2p.MISBEHAVIOR_INVALID_BLOCK)
+								}
+							}
 						}
 
 						//fetch data from the block
 						accTxs, fundsTxs, _, stakeTxs, committeeTxs, aggTxs, aggregatedFundsTxSlice, dataTxs, aggregatedDataTxSlice, aggDataTxs, fineTxs, err := preValidate(b, false)
 
+						emittedReceipts = append(emittedReceipts, blockReceipts(b, fundsTxs)...)
+
 						//append the aggTxs to the normal fundsTxs to delete
 						fundsTxs = append(fundsTxs, aggregatedFundsTxSlice...)
 						dataTxs = append(dataTxs, aggregatedDataTxSlice...)
 
 						UpdateSummary(dataTxs)
 
-						logger.Printf("In block from shardID: %d, height: %d, deleting accTxs: %d, stakeTxs: %d, committeeTxs: %d, fundsTxs: %d, aggTxs: %d, dataTxs: %d, aggDataTxs: %d, fineTxs: %d", b.ShardId, b.Height, len(accTxs), len(stakeTxs), len(committeeTxs), len(fundsTxs), len(aggTxs), len(dataTxs), len(aggDataTxs), len(fineTxs))
+						logger.Debug("Closing transactions of shard block", "shard", b.ShardId, "height", b.Height, "accTxs", len(accTxs), "stakeTxs", len(stakeTxs), "committeeTxs", len(committeeTxs), "fundsTxs", len(fundsTxs), "aggTxs", len(aggTxs), "dataTxs", len(dataTxs), "aggDataTxs", len(aggDataTxs), "fineTxs", len(fineTxs))
 
 
-						relativeState := ReconstructRelativeState(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs)
-						relativeStatesToCheck[b.ShardId] = relativeState
+						if certified {
+							certifiedBlocks = append(certifiedBlocks, newCertifiedBlock(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs))
+						} else {
+							relativeState := ReconstructRelativeState(b, accTxs, stakeTxs, committeeTxs, fundsTxs, dataTxs, fineTxs)
+							relativeStatesToCheck[b.ShardId] = relativeState
+						}
+						shardLoads[b.ShardId] = protocol.NewShardLoad(0, blockFill(b))
 
 
 						alreadyClosedTxHashes, err := storage.WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs, stakeTxs, committeeTxs, fundsTxs, aggTxs, dataTxs, aggDataTxs, fineTxs)
 						if err != nil {
-							logger.Printf(err.Error())
+							logger.Error("Could not write the closed transactions", "shard", b.ShardId, "height", b.Height, "error", err)
 							return
 						}
 						if len(alreadyClosedTxHashes) > 0{
@@ -620,77 +667,99 @@ func CommitteeMining(height int) {
 						//store the block in the received block stash as well
 						blockHash := b.HashBlock()
 						if storage.ReceivedShardBlockStash.BlockIncluded(blockHash) == false {
-							logger.Printf("Writing block to stash Shard ID: %v  - Height: %d - Hash: %x\n", b.ShardId, b.Height, blockHash[0:8])
 							storage.ReceivedShardBlockStash.Set(blockHash, b)
 						}
 
-						logger.Printf("Processed block of shard: %d\n", b.ShardId)
+						logger.Debug("Processed shard block", "shard", b.ShardId, "height", b.Height)
 
 					case <-time.After(2 * time.Second):
-						logger.Printf("waited 2 seconds for lastblock height: %d, shardID: %d", int(height)+1, shardIdReq)
-						logger.Printf("Broadcast Epoch Block to bootstrap new nodes")
+						logger.Debug("Timed out requesting shard block, broadcasting the epoch block to bootstrap new nodes", "shard", shardIdReq, "height", height+1)
 						broadcastEpochBlock(lastEpochBlock)
 					}
 				}
 			}
 		}
-		logger.Printf("end of block validation for height: %d", storage.AssignmentHeight)
+		logger.Debug("Validated shard blocks", "height", height+1)
 	}
 
 	//wait until the state transitions are all in storage.
-	logger.Printf("Waiting for all state transitions to arrive")
+	logger.Debug("Waiting for the state transitions", "height", height+1)
 	waitGroup.Wait()
-	logger.Printf("All state transitions already received")
 
 	//go through all state transitions and compare them with the actual transactions inside the block
 	stateStashForHeight := protocol.ReturnStateTransitionForHeight(storage.ReceivedStateStash, uint32(height+1))
+	adoptCertifiedStates(certifiedBlocks, stateStashForHeight, relativeStatesToCheck)
 	for _, st := range stateStashForHeight {
 		ownRelativeState := relativeStatesToCheck[st.ShardID]
 		if !sameRelativeState(st.RelativeStateChange, ownRelativeState.RelativeState) {
-			logger.Printf("FOUND A CHEATER: Shard %d", st.ShardID)
+			logger.Warn("Relative state of shard does not match", "shard", st.ShardID, "height", st.Height)
 			//in the beneficiary we stored the address of the shard which is responsible for the relative state
 			ShardsToBePunished = append(ShardsToBePunished, ownRelativeState.Beneficiary)
 		} else {
-			logger.Printf("For Shard ID: %d the relative states match", st.ShardID)
+			logger.Debug("Relative states match", "shard", st.ShardID, "height", st.Height)
+		}
+		//the block fill can be checked with the block, the mempool depth is taken as reported
+		if st.Load.BlockFill != shardLoads[st.ShardID].BlockFill {
+			logger.Warn("Block fill of shard does not match", "shard", st.ShardID, "height", st.Height, "reported", st.Load.BlockFill, "block", shardLoads[st.ShardID].BlockFill)
+			ShardsToBePunished = append(ShardsToBePunished, ownRelativeState.Beneficiary)
+			//the load the epoch block carries for the shard can't be checked then
+			delete(shardLoads, st.ShardID)
+		} else {
+			shardLoads[st.ShardID] = st.Load
 		}
 	}
 
 
-	logger.Printf("Wait for next epoch block")
+	logger.Debug("Waiting for the next epoch block")
 	//wait for next epoch block
 	epochBlockReceived := false
 	for !epochBlockReceived {
-		logger.Printf("waiting for epoch block height %d", uint32(storage.AssignmentHeight)+1+EPOCH_LENGTH)
+		logger.Debug("Waiting for epoch block", "height", uint32(storage.AssignmentHeight)+1+EPOCH_LENGTH)
 		newEpochBlock := <-p2p.EpochBlockReceivedChan
-		logger.Printf("received the desired epoch block")
+		logger.Debug("Received the desired epoch block")
 		if newEpochBlock.Height == uint32(storage.AssignmentHeight)+1+EPOCH_LENGTH {
 
-			//check if the sender of the epoch block is legit
-			if !ValidateEpochBlockSender(&newEpochBlock) {
+			//check if the sender of the epoch block is legit, the committee endorses it once it is validated
+			if !validateEpochBlockProducer(&newEpochBlock) {
 				continue
 			}
 
 			//broadcastEpochBlock(storage.ReadLastClosedEpochBlock())
 			epochBlockReceived = true
 
-			//since it's safely not the first step of mining anymore, it's safe to perform proof of stake at this step
-			err := validateEpochBlock(&newEpochBlock, relativeStatesToCheck)
+			//the state of the epoch block follows from the state delta it carries, a delta that does not lead to the
+			//state root it commits to is the producer's fault
+			state, err := epochBlockState(&newEpochBlock)
 			if err != nil {
+				logger.Warn("FOUND A CHEATER", "hash", newEpochBlock.Hash[0:8], "height", newEpochBlock.Height, "error", err)
+				ShardsToBePunished = append(ShardsToBePunished, newEpochBlock.Beneficiary)
+			} else if err := validateEpochBlock(&newEpochBlock, state, relativeStatesToCheck, emittedReceipts, shardLoads); err != nil {
 				//no further actions to be taken because the slashing already happens inside the validation function
-				logger.Printf(err.Error())
+				logger.Warn("Invalid epoch block", "hash", newEpochBlock.Hash[0:8], "height", newEpochBlock.Height, "error", err)
 			} else {
-				logger.Printf("The Epoch Block and its state are valid")
+				logger.Debug("Epoch block and its state are valid", "hash", newEpochBlock.Hash[0:8], "height", newEpochBlock.Height)
+				//the validators only take over the epoch block once a quorum of the committee endorsed it
+				if err := validateEpochBlockContent(&newEpochBlock, state); err != nil {
+					logger.Warn("Epoch block not endorsed", "hash", newEpochBlock.Hash[0:8], "height", newEpochBlock.Height, "error", err)
+				} else {
+					endorseEpochBlock(&newEpochBlock)
+				}
 			}
 
+			deliverReceipts(&newEpochBlock)
+
 			//before being able to validate the proof of stake, the state needs to updated
-			storage.State = newEpochBlock.State
+			if state != nil {
+				storage.State = state
+			}
 			ValidatorShardMap = newEpochBlock.ValMapping
+			storage.ValShardMapping = ValidatorShardMap
 			NumberOfShards = newEpochBlock.NofShards
 		}
 	}
 	committeeProof, err := crypto.SignMessageWithRSAKey(storage.CommitteePrivKey, fmt.Sprint(storage.AssignmentHeight))
 	if err != nil {
-		logger.Printf("Got a problem with creating the committeeProof.")
+		logger.Error("Could not create the committee proof", "height", storage.AssignmentHeight, "error", err)
 		return
 	}
 	//broadcast committee check to the network
@@ -699,14 +768,14 @@ func CommitteeMining(height int) {
 	storage.OwnCommitteeCheck = committeeCheck
 	broadcastCommitteeCheck(committeeCheck)
 
-	logger.Printf("Length of committees to be slashed: %d, length of shards to be slashed: %d", len(CommitteesToBePunished), len(ShardsToBePunished))
+	logger.Debug("Broadcast committee check", "height", storage.AssignmentHeight, "committeesToSlash", len(CommitteesToBePunished), "shardsToSlash", len(ShardsToBePunished))
 
 	//Reset the slices where the slashed addresses are saved
 	CommitteesToBePunished = [][32]byte{}
 	ShardsToBePunished = [][32]byte{}
 
 	FirstStartCommittee = false
-	logger.Printf("Received epoch block. Start next round")
+	logger.Info("Received epoch block, start next round", "height", lastEpochBlock.Height)
 	CommitteeMining(int(lastEpochBlock.Height))
 }
 
@@ -718,13 +787,13 @@ func InitFirstStart(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey
 	}
 	firstCommitteePubKey, err := crypto.ExtractECDSAPublicKeyFromFile("WalletCommitteeA.txt")
 	if err != nil {
-		logger.Printf("%v\n", err)
+		logger.Error("Could not read the wallet of the first committee member", "error", err)
 		return err
 	}
 
 	firstCommitteeComPrivKey, err := crypto.ExtractRSAKeyFromFile("CommitteeA.txt")
 	if err != nil {
-		logger.Printf("%v\n", err)
+		logger.Error("Could not read the committee key of the first committee member", "error", err)
 		return err
 	}
 
@@ -739,19 +808,20 @@ func InitFirstStart(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey
 
 	genesis := protocol.NewGenesis(rootAddress, rootCommitmentKey, firstCommitteeAddress, firstCommitteeKey)
 	storage.WriteGenesis(&genesis)
+	p2p.SetChainID(genesis.Hash())
 
 	/*Write First Epoch block chained to the genesis block*/
 	initialEpochBlock := protocol.NewEpochBlock([][32]byte{genesis.Hash()}, 0)
+	initialEpochBlock.MerklePatriciaRoot = protocol.StateRoot(storage.State)
 	initialEpochBlock.Hash = initialEpochBlock.HashEpochBlock()
 	FirstEpochBlock = initialEpochBlock
-	initialEpochBlock.State = storage.State
 
 	storage.WriteFirstEpochBlock(initialEpochBlock)
 
 	storage.WriteClosedEpochBlock(initialEpochBlock)
 
 	storage.DeleteAllLastClosedEpochBlock()
-	storage.WriteLastClosedEpochBlock(initialEpochBlock)
+	storage.WriteLastClosedEpochBlock(initialEpochBlock, storage.State)
 
 	firstValMapping := protocol.NewMapping()
 	initialEpochBlock.ValMapping = firstValMapping
@@ -768,11 +838,11 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 	commPrivKey = validatorCommitment
 	rootCommPrivKey = rootCommitment
 	storage.IsCommittee = false
+	storage.ValidatorAccAddress = ValidatorAccAddress
 
 	//Set up logger.
-	logger = storage.InitLogger()
+	logger = logging.New("miner")
 	hasher = protocol.SerializeHashContent(ValidatorAccAddress)
-	logger.Printf("Acc hash is (%x)", hasher[0:8])
 	logger.Printf("\n\n\n" +
 		"BBBBBBBBBBBBBBBBB               AAA               ZZZZZZZZZZZZZZZZZZZ     OOOOOOOOO\n" +
 		"B::::::::::::::::B             A:::A              Z:::::::::::::::::Z   OO:::::::::OO\n" +
@@ -791,8 +861,7 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 		"B::::::::::::::::BA:::::A                 A:::::A Z:::::::::::::::::Z   OO:::::::::OO\n" +
 		"BBBBBBBBBBBBBBBBBAAAAAAA                   AAAAAAAZZZZZZZZZZZZZZZZZZZ     OOOOOOOOO\n\n\n")
 
-	logger.Printf("\n\n\n-------------------- START MINER ---------------------")
-	logger.Printf("This Miners IP-Address: %v\n\n", p2p.Ipport)
+	logger.Info("Starting miner", "address", p2p.Ipport, "account", hasher[0:8])
 	time.Sleep(2 * time.Second)
 	parameterSlice = append(parameterSlice, NewDefaultParameters())
 	ActiveParameters = &parameterSlice[0]
@@ -801,13 +870,13 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 	//Initialize root key.
 	initRootKey(rootWallet)
 	if err != nil {
-		logger.Printf("Could not create a root account.\n")
+		logger.Error("Could not create a root account", "error", err)
 	}
 
 	currentTargetTime = new(timerange)
-	target = append(target, 13)
+	target = append(target, INITIAL_DIFFICULTY)
 
-	logger.Printf("ActiveConfigParams: \n%v\n------------------------------------------------------------------------\n\nBAZO is Running\n\n", ActiveParameters)
+	logger.Info("BAZO is running", "parameters", *ActiveParameters)
 
 	//this is used to generate the state with aggregated transactions.
 	for _, tx := range storage.ReadAllBootstrapReceivedTransactions() {
@@ -826,6 +895,11 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 	go incomingTransactionAssignment()
 	//Listen for incoming state transitions from the network
 	go incomingStateData()
+	//Listen for the proposals and votes of the other validators of the shard
+	go incomingProposals()
+	go incomingVotes()
+	//Listen for the endorsements of the committee, epoch blocks and transaction assignments are only accepted with them
+	go incomingEndorsements()
 
 	//Since new validators only join after the currently running epoch ends, they do no need to download the whole shardchain history,
 	//but can continue with their work after the next epoch block and directly set their state to the global state of the first received epoch block
@@ -836,24 +910,48 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 			return err
 		}
 		lastBlock = initialBlock
+		publishBlockHeight(lastBlock)
 	} else {
+		//If no epoch block is received from the network in time, e.g. because the peers are down, the node restarts
+		//from the last closed epoch block on its local disk.
+		persistedEpochBlock := storage.ReadLastClosedEpochBlock()
+		waitingSince := time.Now()
 		for {
 			//As the non-bootstrapping node, wait until I receive the last epoch block as well as the validator assignment
 			// The global variables 'lastEpochBlock' and 'ValidatorShardMap' are being set when they are received by the network
 			//seems the timeout is needed for nodes to be able to access
 			time.Sleep(time.Second)
+			if lastEpochBlock == nil && persistedEpochBlock != nil && time.Since(waitingSince) > EPOCHBLOCKFETCH_TIMEOUT*time.Second {
+				logger.Warn("No epoch block received, restarting from the persisted epoch block", "hash", persistedEpochBlock.Hash[0:8], "height", persistedEpochBlock.Height)
+				lastBlock = dummyLastBlock
+				lastEpochBlock = persistedEpochBlock
+			}
 			if lastEpochBlock != nil {
-				logger.Printf("First statement ok")
+				publishEpochHeight(lastEpochBlock)
 				if lastEpochBlock.Height > 0 {
-					storage.State = lastEpochBlock.State
+					if !restoreState(lastEpochBlock) {
+						state, err := epochBlockState(lastEpochBlock)
+						if err != nil {
+							return err
+						}
+						storage.State = state
+						ValidatorShardMap = lastEpochBlock.ValMapping
+						storage.ValShardMapping = ValidatorShardMap
+						storage.ThisShardID = ValidatorShardMap.ValMapping[ValidatorAccAddress] //Save my ShardID
+					}
 					NumberOfShards = lastEpochBlock.NofShards
-					ValidatorShardMap = lastEpochBlock.ValMapping
-					storage.ThisShardID = ValidatorShardMap.ValMapping[ValidatorAccAddress] //Save my ShardID
 					storage.ThisShardMap[int(lastEpochBlock.Height)] = storage.ThisShardID
 					FirstStartAfterEpoch = true
 					storage.CommitteeLeader = lastEpochBlock.CommitteeLeader
 					lastBlock = dummyLastBlock
-					epochMining(lastEpochBlock.Hash, lastEpochBlock.Height) //start mining based on the received Epoch Block
+					hashPrevBlock, heightPrevBlock := lastEpochBlock.Hash, lastEpochBlock.Height
+					//A node restarted in the middle of the epoch continues after the last block it closed
+					if block := restoreBlockState(lastEpochBlock); block != nil {
+						lastBlock = block
+						publishBlockHeight(lastBlock)
+						hashPrevBlock, heightPrevBlock = block.Hash, block.Height
+					}
+					epochMining(hashPrevBlock, heightPrevBlock) //start mining based on the received Epoch Block
 					//set the ID to 0 such that there wont be any answers to requests that shouldnt be answered
 					storage.ThisShardIDDelayed = 0
 				}
@@ -861,21 +959,24 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 		}
 	}
 
-	logger.Printf("Active config params:%v\n", ActiveParameters)
+	logger.Info("Active config parameters", "parameters", *ActiveParameters)
 
 	//Define number of shards based on the validators in the network
 	NumberOfShards = DetNumberOfShards()
-	logger.Printf("Number of Shards: %v", NumberOfShards)
+	logger.Info("Number of shards", "shards", NumberOfShards)
 
 	/*First validator assignment is done by the bootstrapping node, the others will be done based on PoS at the end of each epoch*/
 	if p2p.IsBootstrap() {
-		var validatorShardMapping = protocol.NewMapping()
-		validatorShardMapping.ValMapping = AssignValidatorsToShards()
-		validatorShardMapping.EpochHeight = int(lastEpochBlock.Height)
-		ValidatorShardMap = validatorShardMapping
+		//A restarted bootstrap node keeps the validator assignment it persisted for the current epoch.
+		if ValidatorShardMap == nil || ValidatorShardMap.EpochHeight != int(lastEpochBlock.Height) || len(ValidatorShardMap.ValMapping) == 0 {
+			var validatorShardMapping = protocol.NewMapping()
+			validatorShardMapping.ValMapping = AssignValidatorsToShards()
+			validatorShardMapping.EpochHeight = int(lastEpochBlock.Height)
+			ValidatorShardMap = validatorShardMapping
+			storage.ValShardMapping = ValidatorShardMap
+		}
 		storage.CommitteeLeader = ChooseCommitteeLeader()
-		logger.Printf("Validator Shard Mapping:\n")
-		logger.Printf(validatorShardMapping.String())
+		logger.Debug("Validator shard mapping", "mapping", ValidatorShardMap)
 	}
 
 	storage.ThisShardID = ValidatorShardMap.ValMapping[ValidatorAccAddress]
@@ -896,12 +997,18 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 		//Indicates that a validator newly joined Bazo after the current epoch, thus his 'lastBlock' variable is nil
 		//and he continues directly with the mining of the first shard block
 		if FirstStartAfterEpoch {
-			logger.Printf("First start after Epoch. New miner successfully introduced to Bazo network")
+			logger.Info("First start after epoch, new miner successfully introduced to the network", "shard", storage.ThisShardID)
+			if storage.ThisShardID == 0 {
+				standby()
+				hashPrevBlock, heightPrevBlock = lastEpochBlock.Hash, lastEpochBlock.Height
+				prevBlockIsEpochBlock = true
+			}
 			mining(hashPrevBlock, heightPrevBlock)
 		}
 
 		if lastBlock.Height == uint32(lastEpochBlock.Height)+uint32(ActiveParameters.Epoch_length) {
-			if storage.ThisShardID == 1 {
+			//the validator of shard 1 that created the last block of the epoch creates the epoch block
+			if storage.ThisShardID == 1 && lastBlock.Beneficiary == protocol.SerializeHashContent(ValidatorAccAddress) {
 
 				shardIDs := makeRange(1, NumberOfShards)
 
@@ -910,6 +1017,12 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 					shardIDStateBoolMap[k] = false
 				}
 
+				//the epoch block delivers the receipts of all shards, starting with the ones of this shard
+				epochReceipts := append([]*protocol.Receipt{}, storage.OutboundReceipts...)
+				//the number of shards of the next epoch is decided with the loads of all shards, see resharding.go
+				shardLoads := make([]protocol.ShardLoad, NumberOfShards)
+				shardLoads[0] = ownShardLoad(lastBlock)
+
 				for {
 					//If there is only one shard, then skip synchronisation mechanism
 					if NumberOfShards == 1 {
@@ -927,22 +1040,28 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 								//first check the commitment Proof. If it's invalid, continue the search
 								err := validateStateTransition(st)
 								if err != nil {
-									logger.Printf(err.Error())
+									logger.Warn("Invalid state transition", "shard", st.ShardID, "height", st.Height, "error", err)
+									p2p.ReportInvalid(st.HashTransition(), p2p.MISBEHAVIOR_INVALID_STATE_TRANSITION)
 									continue
 								}
 
 								//Apply all relative account changes to my local state
 								storage.State = storage.ApplyRelativeState(storage.State, st.RelativeStateChange)
+								epochReceipts = append(epochReceipts, st.Receipts...)
+								if st.ShardID >= 1 && st.ShardID <= NumberOfShards {
+									shardLoads[st.ShardID-1] = st.Load
+								}
 								shardIDStateBoolMap[st.ShardID] = true
-								logger.Printf("Processed state transition of shard: %d\n", st.ShardID)
+								logger.Debug("Processed state transition", "shard", st.ShardID, "height", st.Height)
 							}
 						}
-						//If all state transitions have been received, stop synchronisation
-						if len(stateStashForHeight) == NumberOfShards-1 {
-							logger.Printf("Received all transitions. Continue.")
+						//If all state transitions have been received, stop synchronisation. Several validators of a shard
+						//can send its state transition.
+						if len(shardIDStateBoolMap) == NumberOfShards-1 {
+							logger.Debug("Received all state transitions", "height", lastBlock.Height)
 							break
 						} else {
-							logger.Printf("Length of state stash: %d", len(stateStashForHeight))
+							logger.Debug("Waiting for state transitions", "height", lastBlock.Height, "received", len(stateStashForHeight))
 						}
 					}
 					//Iterate over shard IDs to check which ones are still missing, and request them from the network
@@ -952,13 +1071,13 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 							//Maybe the transition was received in the meantime. Then dont request it again.
 							foundSt := searchStateTransition(id, int(lastBlock.Height))
 							if foundSt != nil {
-								logger.Printf("skip planned request for shardID %d", id)
+								logger.Debug("State transition already received", "shard", id, "height", lastBlock.Height)
 								continue
 							}
 
 							var stateTransition *protocol.StateTransition
 
-							logger.Printf("requesting state transition for lastblock height: %d\n", lastBlock.Height)
+							logger.Debug("Requesting state transition", "shard", id, "height", lastBlock.Height)
 
 							p2p.StateTransitionReqShard(id, int(lastBlock.Height))
 							//Blocking wait
@@ -966,26 +1085,35 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 							case encodedStateTransition := <-p2p.StateTransitionShardReqChan:
 								stateTransition = stateTransition.DecodeTransition(encodedStateTransition)
 
+								//the state transition of a shard is only applied once
+								if stateTransition.Height != int(lastBlock.Height) || shardIDStateBoolMap[stateTransition.ShardID] {
+									continue
+								}
+
 								//first check the commitment Proof. If it's invalid, continue the search
 								err := validateStateTransition(stateTransition)
 								if err != nil {
-									logger.Printf(err.Error())
+									logger.Warn("Invalid state transition", "shard", stateTransition.ShardID, "height", stateTransition.Height, "error", err)
+									p2p.ReportInvalidPayload(encodedStateTransition, p2p.MISBEHAVIOR_INVALID_STATE_TRANSITION)
 									continue
 								}
 
 								//Apply state transition to my local state
 								storage.State = storage.ApplyRelativeState(storage.State, stateTransition.RelativeStateChange)
+								epochReceipts = append(epochReceipts, stateTransition.Receipts...)
+								if stateTransition.ShardID >= 1 && stateTransition.ShardID <= NumberOfShards {
+									shardLoads[stateTransition.ShardID-1] = stateTransition.Load
+								}
 
-								logger.Printf("Writing state back to stash Shard ID: %v  VS my shard ID: %v - Height: %d\n", stateTransition.ShardID, storage.ThisShardID, stateTransition.Height)
 								storage.ReceivedStateStash.Set(stateTransition.HashTransition(), stateTransition)
 
 								shardIDStateBoolMap[stateTransition.ShardID] = true
 
-								logger.Printf("Processed state transition of shard: %d\n", stateTransition.ShardID)
+								logger.Debug("Processed state transition", "shard", stateTransition.ShardID, "height", stateTransition.Height)
 
 								//Limit waiting time to 5 seconds seconds before aborting.
 							case <-time.After(2 * time.Second):
-								logger.Printf("have been waiting for 5 seconds for lastblock height: %d\n", lastBlock.Height)
+								logger.Debug("Timed out requesting state transition", "shard", id, "height", lastBlock.Height)
 								//It the requested state transition has not been received, then continue with requesting the other missing ones
 								continue
 							}
@@ -996,55 +1124,58 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 				//After the state transition mechanism is finished, perform the epoch block creation
 
 				epochBlock = protocol.NewEpochBlock([][32]byte{lastBlock.Hash}, lastBlock.Height+1)
-				logger.Printf("epochblock beingprocessed height: %d\n", epochBlock.Height)
+				logger.Debug("Epoch block being processed", "height", epochBlock.Height)
 
-				logger.Printf("Before finalizeEpochBlock() ---- Height: %d\n", epochBlock.Height)
+				logger.Debug("Finalizing epoch block", "height", epochBlock.Height)
 				//Finalize creation of the epoch block. In case another epoch block was mined in the meantime, abort PoS here
 
 				//add the beneficiary to the epoch block
 				validatorAcc, err := storage.GetAccount(protocol.SerializeHashContent(ValidatorAccAddress))
 				if err != nil {
-					logger.Printf("problem with getting the validator acc")
+					logger.Warn("Validator account not in the state", "error", err)
 				}
 
 				validatorAccHash := validatorAcc.Hash()
 
 				copy(epochBlock.Beneficiary[:], validatorAccHash[:])
 
+				epochBlock.Receipts = collectEpochReceipts(epochReceipts)
+				epochBlock.ReceiptsRoot = protocol.BuildReceiptsMerkleTree(epochBlock.Receipts).MerkleRoot()
+				epochBlock.ShardLoads = shardLoads
+
 				err = finalizeEpochBlock(epochBlock)
 
-				logger.Printf("After finalizeEpochBlock() ---- Height: %d\n", epochBlock.Height)
+				logger.Debug("Finalized epoch block", "height", epochBlock.Height)
 
 				if err != nil {
-					logger.Printf("%v\n", err)
+					logger.Debug("Epoch block not mined", "height", epochBlock.Height, "error", err)
 				} else {
-					logger.Printf("EPOCH BLOCK mined (%x)\n", epochBlock.Hash[0:8])
+					logger.Info("Epoch block mined", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height)
 				}
 
 				//Successfully mined epoch block
 				if err == nil {
-					logger.Printf("Broadcast epoch block (%x)\n", epochBlock.Hash[0:8])
+					logger.Info("Broadcast epoch block", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height)
 					//Broadcast epoch block to other nodes such that they can update their validator-shard assignment
 					broadcastEpochBlock(epochBlock)
 					storage.WriteClosedEpochBlock(epochBlock)
 					storage.DeleteAllLastClosedEpochBlock()
-					storage.WriteLastClosedEpochBlock(epochBlock)
+					storage.WriteLastClosedEpochBlock(epochBlock, storage.State)
 					lastEpochBlock = epochBlock
+					publishEpochHeight(lastEpochBlock)
+					pruneEndorsements(epochBlock.Height)
+					deliverReceipts(epochBlock)
 
-					logger.Printf("Created Validator Shard Mapping :\n")
-					logger.Printf(ValidatorShardMap.String())
-					logger.Printf("Inserting EPOCH BLOCK: %v\n", epochBlock.String())
-					logger.Printf("Created Validator Shard Mapping :\n")
-					logger.Printf(ValidatorShardMap.String() + "\n")
+					logger.Info("Created epoch block", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "shards", epochBlock.NofShards, "mpt", epochBlock.MerklePatriciaRoot[0:8])
+					logger.Debug("Validator shard mapping", "mapping", ValidatorShardMap)
 
 					for _, prevHash := range epochBlock.PrevShardHashes {
 						//FileConnections.WriteString(fmt.Sprintf("'%x' -> 'EPOCH BLOCK: %x'\n", prevHash[0:15], epochBlock.Hash[0:15]))
-						logger.Printf(`"Hash : %x \n Height : %d" -> "EPOCH BLOCK: \n Hash : %x \n Height : %d \nMPT : %x"`+"\n", prevHash[0:8], epochBlock.Height-1, epochBlock.Hash[0:8], epochBlock.Height, epochBlock.MerklePatriciaRoot[0:8])
-						logger.Printf(`"EPOCH BLOCK: \n Hash : %x \n Height : %d \nMPT : %x"`+`[color = red, shape = box]`+"\n", epochBlock.Hash[0:8], epochBlock.Height, epochBlock.MerklePatriciaRoot[0:8])
+						logger.Debug("Epoch block follows shard block", "prev", prevHash[0:8], "hash", epochBlock.Hash[0:8], "height", epochBlock.Height)
 					}
 				}
 
-				// I'm not shard number one so I just wait until I receive the next epoch block
+				// I'm not creating the epoch block so I just wait until I receive the next epoch block
 			} else {
 				//wait until epoch block is received
 				epochBlockReceived := false
@@ -1052,30 +1183,31 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 					newEpochBlock := <-p2p.EpochBlockReceivedChan
 					//the new epoch block from the channel is the epoch block that i need at the moment
 					if newEpochBlock.Height == lastBlock.Height+1 {
-						//check if the sender of the epoch block is legit
-						if !ValidateEpochBlockSender(&newEpochBlock) {
+						//check if the sender of the epoch block is legit and the epoch block is consistent
+						state, err := validateReceivedEpochBlock(&newEpochBlock)
+						if err != nil {
+							logger.Warn("Invalid epoch block", "hash", newEpochBlock.Hash[0:8], "height", newEpochBlock.Height, "error", err)
 							continue
 						}
 						epochBlockReceived = true
+						deliverReceipts(&newEpochBlock)
 						// take over state
-						storage.State = newEpochBlock.State
-						ValidatorShardMap = newEpochBlock.ValMapping
-						NumberOfShards = newEpochBlock.NofShards
-						storage.CommitteeLeader = newEpochBlock.CommitteeLeader
-						storage.ThisShardID = ValidatorShardMap.ValMapping[ValidatorAccAddress]
-						storage.ThisShardMap[int(newEpochBlock.Height)] = storage.ThisShardID
-						lastEpochBlock = &newEpochBlock
-						logger.Printf("Received  last epoch block with height %d. Continue mining", lastEpochBlock.Height)
+						takeOverEpochBlock(&newEpochBlock, state)
+						logger.Info("Received last epoch block, continue mining", "hash", lastEpochBlock.Hash[0:8], "height", lastEpochBlock.Height, "shard", storage.ThisShardID)
 					}
 				}
 			}
+			//validators the epoch block did not assign a shard to wait for one that does
+			if storage.ThisShardID == 0 {
+				standby()
+			}
 			prevBlockIsEpochBlock = true
 			firstEpochOver = true
 			received := false
 			//now delete old assignment and wait to receive the assignment from the committee
 			storage.AssignedTxMempool = make(map[[32]byte]protocol.Transaction)
 			//Blocking wait
-			logger.Printf("Wait for transaction assignment")
+			logger.Debug("Waiting for the transaction assignment", "shard", storage.ThisShardID, "height", lastEpochBlock.Height)
 			for {
 				select {
 				case encodedTransactionAssignment := <-p2p.TransactionAssignmentReqChan:
@@ -1086,17 +1218,20 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 					if transactionAssignment.Height != int(lastEpochBlock.Height) {
 						time.Sleep(2 * time.Second)
 						p2p.TransactionAssignmentReq(int(lastEpochBlock.Height), storage.ThisShardID)
-						logger.Printf("Assignment height: %d vs epoch height %d", transactionAssignment.Height, epochBlock.Height)
+						logger.Debug("Transaction assignment of another height", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height, "epochHeight", epochBlock.Height)
 						continue
 					}
 
 					//Check the signature inside the assignment.
 					err := validateTransactionAssignment(transactionAssignment)
 					if err != nil {
-						logger.Printf(err.Error())
+						logger.Warn("Invalid transaction assignment", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height, "error", err)
+						continue
+					}
+					//the assignment is requested again until a quorum of the committee endorsed it
+					if err := validateAssignmentEndorsements(transactionAssignment); err != nil {
+						logger.Warn("Transaction assignment not endorsed yet", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height, "error", err)
 						continue
-					} else {
-						logger.Printf("The received transaction assignment is valid")
 					}
 
 					//overwrite the previous mempool. Take the new transactions
@@ -1119,10 +1254,10 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 					for _, transaction := range transactionAssignment.FineTxs {
 						storage.AssignedTxMempool[transaction.Hash()] = transaction
 					}
-					logger.Printf("Success. Received assignment for height: %d", transactionAssignment.Height)
+					logger.Debug("Received transaction assignment", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height)
 					received = true
 				case <-time.After(2 * time.Second):
-					logger.Printf("Requesting transaction assignment for shard ID: %d with height: %d", storage.ThisShardID, lastEpochBlock.Height)
+					logger.Debug("Requesting transaction assignment", "shard", storage.ThisShardID, "height", lastEpochBlock.Height)
 					p2p.TransactionAssignmentReq(int(lastEpochBlock.Height), storage.ThisShardID)
 					//this is used to bootstrap the committee.
 					broadcastEpochBlock(lastEpochBlock)
@@ -1132,7 +1267,7 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 				}
 			}
 
-			logger.Printf("received both my transaction assignment and the epoch block. can continue now")
+			logger.Debug("Received the transaction assignment and the epoch block", "shard", storage.ThisShardID, "height", lastEpochBlock.Height)
 
 			//Continue mining with the hash of the last epoch block
 			mining(lastEpochBlock.Hash, lastEpochBlock.Height)
@@ -1148,55 +1283,9 @@ func epochMining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 //Mining is a constant process, trying to come up with a successful PoW.
 func mining(hashPrevBlock [32]byte, heightPrevBlock uint32) {
 
-	logger.Printf("\n\n __________________________________________________ New Mining Round __________________________________________________")
-	logger.Printf("Create Next Block")
-	//This is the same mutex that is claimed at the beginning of a block validation. The reason we do this is
-	//that before start mining a new block we empty the mempool which contains tx data that is likely to be
-	//validated with block validation, so we wait in order to not work on tx data that is already validated
-	//when we finish the block.
-	blockValidation.Lock()
-	currentBlock := newBlock(hashPrevBlock, [crypto.COMM_PROOF_LENGTH]byte{}, heightPrevBlock+1)
-
-	//Set shard identifier in block (not necessary? It's already written inside the block)
-	currentBlock.ShardId = storage.ThisShardID
-	logger.Printf("This shard ID: %d", storage.ThisShardID)
-
-	logger.Printf("Prepare Next Block")
-	prepareBlock(currentBlock)
-	blockValidation.Unlock()
-	logger.Printf("Prepare Next Block --> Done")
-	blockBeingProcessed = currentBlock
-	logger.Printf("Finalize Next Block")
-	err := finalizeBlock(currentBlock)
-
-	logger.Printf("Finalize Next Block -> Done. Block height: %d", blockBeingProcessed.Height)
-	if err != nil {
-		logger.Printf("%v\n", err)
-	} else {
-		logger.Printf("Block mined (%x)\n", currentBlock.Hash[0:8])
-	}
-
-	if err == nil {
-		err := validate(currentBlock, false)
-		if err == nil {
-			//only the shards which do not create the epoch block need to send out a state transition
-			if storage.ThisShardID != 1 {
-				commitmentProof, err := crypto.SignMessageWithRSAKey(commPrivKey, fmt.Sprint(currentBlock.Height))
-				if err != nil {
-					logger.Printf("Got a problem with creating the commimentProof.")
-					return
-				}
-				stateTransition := protocol.NewStateTransition(storage.RelativeState, int(currentBlock.Height), storage.ThisShardID, commitmentProof)
-				copy(stateTransition.CommitmentProof[0:crypto.COMM_PROOF_LENGTH], commitmentProof[:])
-				storage.WriteToOwnStateTransitionkStash(stateTransition)
-				broadcastStateTransition(stateTransition)
-			}
-			broadcastBlock(currentBlock)
-			logger.Printf("Validated block (mined): %vState:\n%v", currentBlock, getState())
-		} else {
-			logger.Printf("Mined block (%x) could not be validated: %v\n", currentBlock.Hash[0:8], err)
-		}
-	}
+	logger.Debug("New mining round", "shard", storage.ThisShardID, "height", heightPrevBlock+1)
+	//The validators of the shard agree on the block, see bft.go
+	agreeOnBlock(hashPrevBlock, heightPrevBlock)
 
 	//Prints miner connections
 	p2p.EmptyingiplistChan()
@@ -1236,7 +1325,7 @@ func getOtherCommitteeMemberAddresses() (committeeMembers [][32]byte) {
 		}
 	}
 	if len(committeeMembers) != DetNumberOfCommittees() - 1 {
-		logger.Printf("Error in this function")
+		logger.Warn("Number of other committee members does not match", "found", len(committeeMembers), "expected", DetNumberOfCommittees()-1)
 	}
 
 	return committeeMembers
@@ -1264,19 +1353,20 @@ func ChooseCommitteeLeader() (committeeLeader [32]byte) {
 
 /**
 Number of Shards is determined based on the total number of validators in the network. Currently, the system supports only
-one validator per shard, thus Number of Shards = Number of Validators.
+one validator per shard, thus Number of Shards = Number of Validators. It is the number of shards of the first epoch,
+afterwards the epoch blocks take the load of the shards into account, see resharding.go.
 */
 func DetNumberOfShards() (numberOfShards int) {
-	return int(math.Ceil(float64(GetValidatorsCount()) / float64(ActiveParameters.validators_per_shard)))
+	return shardCapacity(storage.State)
 }
 
 /**
 This function assigns the validators to the single shards in a random fashion. In case multiple validators per shard are supported,
-they would be assigned to the shards uniformly.
+they would be assigned to the shards uniformly. Validators left over when the load needs fewer shards than the validators
+can run stay without shard (ID 0) and stand by until an epoch block assigns them a shard again.
 */
 func AssignValidatorsToShards() map[[64]byte]int {
 
-	logger.Printf("Assign validators to shards start")
 	/*This map denotes which validator is assigned to which shard index*/
 	validatorShardAssignment := make(map[[64]byte]int)
 
@@ -1337,6 +1427,28 @@ func searchBlock(shardID int, height int) *protocol.Block {
 	return nil
 }
 
+//Downloads the blocks of the given height of all shards that were not processed yet into the received block stash.
+func syncShardBlocks(shardIDs []int, processed map[int]bool, height int) {
+	var ranges []blockRange
+	for _, shardID := range shardIDs {
+		if !processed[shardID] && searchBlock(shardID, height) == nil {
+			ranges = append(ranges, blockRange{shardID, uint32(height), 1})
+		}
+	}
+	if len(ranges) == 0 {
+		return
+	}
+
+	for _, blocks := range syncBlocks(ranges) {
+		for _, b := range blocks {
+			blockHash := b.HashBlock()
+			if storage.ReceivedShardBlockStash.BlockIncluded(blockHash) == false {
+				storage.ReceivedShardBlockStash.Set(blockHash, b)
+			}
+		}
+	}
+}
+
 func searchCommitteeCheck(address [32]byte, height int) *protocol.CommitteeCheck {
 	committeeStash := protocol.ReturnCommitteeCheckForHeight(storage.ReceivedCommitteeCheckStash, uint32(height))
 	for _,cc := range committeeStash {
@@ -1362,7 +1474,7 @@ func fetchStateTransitionsForHeight(height int, group *sync.WaitGroup) {
 	group.Add(1)
 	defer group.Done()
 	// if there is only one, shard, then no state transitions will be in the system to be fetched
-	logger.Printf("Start fetch state transitions for height: %d. Number of Shards: %d", height, NumberOfShards)
+	logger.Debug("Fetching state transitions", "height", height, "shards", NumberOfShards)
 	if NumberOfShards == 1 {
 		return
 	} else {
@@ -1383,7 +1495,8 @@ func fetchStateTransitionsForHeight(height int, group *sync.WaitGroup) {
 						//first check the commitment Proof. If it's invalid, continue the search
 						err := validateStateTransition(st)
 						if err != nil {
-							logger.Printf("Cannot validate state transition")
+							logger.Warn("Invalid state transition", "shard", st.ShardID, "height", st.Height, "error", err)
+							p2p.ReportInvalid(st.HashTransition(), p2p.MISBEHAVIOR_INVALID_STATE_TRANSITION)
 							continue
 						}
 						//Apply all relative account changes to my local state
@@ -1391,12 +1504,13 @@ func fetchStateTransitionsForHeight(height int, group *sync.WaitGroup) {
 					}
 				}
 			}
-			//If all state transitions have been received, stop synchronisation
-			if len(stateStashForHeight) == NumberOfShards-1 {
-				logger.Printf("Received all transitions. Continue.")
+			//If all state transitions have been received, stop synchronisation. Several validators of a shard can send
+			//its state transition.
+			if len(shardIDStateBoolMap) == NumberOfShards-1 {
+				logger.Debug("Received all state transitions", "height", height)
 				return
 			} else {
-				logger.Printf("Length of state stash: %d", len(stateStashForHeight))
+				logger.Debug("Waiting for state transitions", "height", height, "received", len(stateStashForHeight))
 			}
 			//Iterate over shard IDs to check which ones are still missing, and request them from the network
 			for _, id := range shardIDs {
@@ -1405,13 +1519,13 @@ func fetchStateTransitionsForHeight(height int, group *sync.WaitGroup) {
 					//Maybe the transition was received in the meantime. Then dont request it again.
 					foundSt := searchStateTransition(id, height)
 					if foundSt != nil {
-						logger.Printf("skip planned request for shardID %d", id)
+						logger.Debug("State transition already received", "shard", id, "height", height)
 						continue
 					}
 
 					var stateTransition *protocol.StateTransition
 
-					logger.Printf("requesting state transition for lastblock height: %d\n", height)
+					logger.Debug("Requesting state transition", "shard", id, "height", height)
 
 					p2p.StateTransitionReqShard(id, height)
 					//Blocking wait
@@ -1419,10 +1533,15 @@ func fetchStateTransitionsForHeight(height int, group *sync.WaitGroup) {
 					case encodedStateTransition := <-p2p.StateTransitionShardReqChan:
 						stateTransition = stateTransition.DecodeTransition(encodedStateTransition)
 
+						if stateTransition.Height != height {
+							continue
+						}
+
 						//first check the commitment Proof. If it's invalid, continue the search
 						err := validateStateTransition(stateTransition)
 						if err != nil {
-							logger.Printf(err.Error())
+							logger.Warn("Invalid state transition", "shard", stateTransition.ShardID, "height", stateTransition.Height, "error", err)
+							p2p.ReportInvalidPayload(encodedStateTransition, p2p.MISBEHAVIOR_INVALID_STATE_TRANSITION)
 							continue
 						}
 
@@ -1432,7 +1551,7 @@ func fetchStateTransitionsForHeight(height int, group *sync.WaitGroup) {
 
 						//Limit waiting time to 5 seconds seconds before aborting.
 					case <-time.After(2 * time.Second):
-						logger.Printf("have been waiting for 2 seconds for lastblock height: %d\n", height)
+						logger.Debug("Timed out requesting state transition", "shard", id, "height", height)
 						//It the requested state transition has not been received, then continue with requesting the other missing ones
 						continue
 					}
@@ -1545,8 +1664,33 @@ func applyFundsTxFeesFundsMovement(state map[[32]byte]protocol.Account, benefici
 		//first handle amount
 		senderAcc := state[tx.From]
 		receiverAcc := state[tx.To]
+		//Contract calls are executed before the funds are moved, the same way as during block preparation
+		if isContractCall(tx, &receiverAcc) {
+			variables, execErr := execContract(&receiverAcc, tx, func(address [32]byte) (*protocol.Account, error) {
+				if acc, exists := state[address]; exists {
+					return &acc, nil
+				}
+				return nil, errors.New(fmt.Sprintf("Acc (%x) not in the state.", address[0:8]))
+			})
+			if execErr != nil {
+				err = execErr
+			} else {
+				for address, contractVariables := range variables {
+					if address == tx.To {
+						receiverAcc.ContractVariables = contractVariables
+					} else {
+						externalAcc := state[address]
+						externalAcc.ContractVariables = contractVariables
+						state[address] = externalAcc
+					}
+				}
+			}
+		}
 		senderAcc.Balance -= tx.Amount
-		receiverAcc.Balance += tx.Amount
+		//The receiver of a cross-shard transfer is credited by its own shard, see receipts.go
+		if !isCrossShard(tx) {
+			receiverAcc.Balance += tx.Amount
+		}
 		state[tx.To] = receiverAcc
 		state[tx.From] = senderAcc
 		//now handle the fee
@@ -1583,10 +1727,14 @@ func applyFineTxFeesFundsMovement(state map[[32]byte]protocol.Account, beneficia
 }
 
 func sameRelativeState(calculatedMap map[[32]byte]*protocol.RelativeAccount, receivedMap map[[32]byte]*protocol.RelativeAccount) bool {
-	//at the moment, we only care about funds. This, however could be extended in the future
+	//at the moment, we only care about funds and contract variables. This, however could be extended in the future
 	for account, _ := range calculatedMap {
 		if calculatedMap[account].Balance != receivedMap[account].Balance {
-			logger.Printf("Calculated MAP: Account %x has balance %d ----- Received MAP has balance %d", account[0:8], calculatedMap[account].Balance, receivedMap[account].Balance)
+			logger.Debug("Relative state differs in the balance", "account", account[0:8], "calculated", calculatedMap[account].Balance, "received", receivedMap[account].Balance)
+			return false
+		}
+		if !protocol.ContractVariablesEqual(calculatedMap[account].ContractVariables, receivedMap[account].ContractVariables) {
+			logger.Debug("Relative state differs in the contract variables", "account", account[0:8])
 			return false
 		}
 	}
@@ -1598,13 +1746,13 @@ func UpdateSummary(dataTxs []*protocol.DataTx) {
 	if len(dataTxs) > 0 {
 		err := storage.UpdateDataSummary(dataTxs)
 		if err != nil {
-			logger.Printf("Error when updating the data summary")
+			logger.Warn("Could not update the data summary", "error", err)
 			return
 		} else {
-			logger.Printf("Data Summary Updated")
+			logger.Debug("Data summary updated", "dataTxs", len(dataTxs))
 			newDataSummarySlice := storage.ReadAllDataSummary()
 			if len(newDataSummarySlice) == 0 {
-				logger.Printf("got a problem!!")
+				logger.Warn("Data summary empty after the update")
 				return
 			}
 			//logger.Printf("Start Print data summary")
@@ -1626,6 +1774,10 @@ func ReconstructRelativeState(b *protocol.Block, accTxs []*protocol.AccTx, stake
 	StateCopy, _ = applyCommitteeTxFeesAndCreateAcc(StateCopy, b.Beneficiary, committeeTxs)
 	StateCopy, _ = applyStakeTxFees(StateCopy, b.Beneficiary, stakeTxs)
 	StateCopy, _ = applyFundsTxFeesFundsMovement(StateCopy, b.Beneficiary, fundsTxs)
+	//Invalid credits are detected when the block is validated, the relative state only contains valid ones
+	if receipts, err := creditedReceipts(b); err == nil {
+		StateCopy, _ = applyReceipts(StateCopy, receipts)
+	}
 	StateCopy, _ = applyDataTxFees(StateCopy, b.Beneficiary, dataTxs)
 	StateCopy, _ = applyFineTxFeesFundsMovement(StateCopy, b.Beneficiary, fineTxs)
 	StateCopy, _ = applyBlockReward(StateCopy, b.Beneficiary)
@@ -1635,7 +1787,22 @@ func ReconstructRelativeState(b *protocol.Block, accTxs []*protocol.AccTx, stake
 	return protocol.NewRelativeState(relativeStateProvisory, b.ShardId, b.Beneficiary)
 }
 
+//An epoch block is only accepted from a validator of shard 1 and once a quorum of the committee endorsed it, see
+//endorsement.go.
 func ValidateEpochBlockSender(b *protocol.EpochBlock) bool {
+	if !validateEpochBlockProducer(b) {
+		return false
+	}
+	if err := validateEpochEndorsements(b); err != nil {
+		logger.Debug("Epoch block not endorsed", "hash", b.Hash[0:8], "height", b.Height, "error", err)
+		return false
+	}
+
+	return true
+}
+
+//The committee endorses the epoch blocks itself, it only checks that a validator of shard 1 created them.
+func validateEpochBlockProducer(b *protocol.EpochBlock) bool {
 	//Check state contains beneficiary.
 	acc, err := storage.GetAccount(b.Beneficiary)
 	if err != nil {
@@ -1705,7 +1872,7 @@ func runByzantineMechanism(receivedCC []*protocol.CommitteeCheck) {
 	fineMapCommittees := make(map[[32]byte]int)
 	//add own committee check to the slice
 	receivedCC = append(receivedCC, storage.OwnCommitteeCheck)
-	logger.Printf("Amount of Committee members: %d", numberOfCommittees)
+	logger.Debug("Running the byzantine slashing mechanism", "committeeMembers", numberOfCommittees)
 	for _, account := range storage.State {
 		if account.IsStaking {
 			//iterate through the other committee checks
@@ -1729,27 +1896,26 @@ func runByzantineMechanism(receivedCC []*protocol.CommitteeCheck) {
 	//now the maps contain the desired information
 	for address, votes := range fineMapShards {
 		if votes >= int(numberOfVotesForSlashing) {
-			logger.Printf("The committee decided to slash %x with %d votes in favor of slashing", address[0:8], votes)
+			logger.Info("Committee slashes shard validator", "address", address[0:8], "votes", votes)
 			SlashShard(address)
 		} else {
-			logger.Printf("The committee decided not to slash %x because there weren't enough votes: %d.", address[0:8], votes)
+			logger.Info("Committee does not slash shard validator, not enough votes", "address", address[0:8], "votes", votes)
 		}
 	}
 	for address, votes := range fineMapCommittees {
 		if votes >= int(numberOfVotesForSlashing) {
-			logger.Printf("The committee decided to slash %x with %d votes in favor of slashing", address[0:8], votes)
+			logger.Info("Committee slashes committee member", "address", address[0:8], "votes", votes)
 			SlashCommittee(address)
 		} else {
-			logger.Printf("The committee decided not to slash %x because there weren't enough votes: %d", address[0:8], votes)
+			logger.Info("Committee does not slash committee member, not enough votes", "address", address[0:8], "votes", votes)
 		}
 	}
-	logger.Printf("End of Byzantine slashing mechanism")
 }
 
 func SlashShard(address [32]byte) {
 	fineTx, err := protocol.ConstrFineTx(byte(0), uint64(1), DEFAULT_FINE_SHARD, protocol.SerializeHashContent(ValidatorAccAddress), address, storage.CommitteeWalletPrivKey)
 	if err != nil {
-		logger.Printf("Got an error")
+		logger.Warn("Could not create the fine transaction", "address", address[0:8], "error", err)
 		return
 	}
 	storage.WriteOpenTx(fineTx)
@@ -1759,7 +1925,7 @@ func SlashShard(address [32]byte) {
 func SlashCommittee(address [32]byte) {
 	fineTx, err := protocol.ConstrFineTx(byte(0), uint64(1), DEFAULT_FINE_COMMITTEE, protocol.SerializeHashContent(ValidatorAccAddress), address, storage.CommitteeWalletPrivKey)
 	if err != nil {
-		logger.Printf("Got an error")
+		logger.Warn("Could not create the fine transaction", "address", address[0:8], "error", err)
 		return
 	}
 	storage.WriteOpenTx(fineTx)
@@ -1770,8 +1936,12 @@ func DetNumberOfVotersForSlashing(numberOfCommittees int) int {
 	return int(math.Ceil(float64(numberOfCommittees) * PERCENTAGE_NEEDED_FOR_SLASHING))
 }
 
+//A proof of stake that does not hold is proven by the block itself, as the beneficiary signed the commitment proof. The
+//other errors may as well be caused by a state this node has not caught up with.
+var errInvalidProofOfStake = errors.New("proof of stake is invalid")
+
 func CommitteeValidateBlock(b *protocol.Block) (err error) {
-	logger.Printf("Validation of block height: %d, ShardID: %d", b.Height, b.ShardId)
+	logger.Debug("Validating shard block", "hash", b.Hash[0:8], "shard", b.ShardId, "height", b.Height)
 
 	//Check state contains beneficiary.
 	acc, err := storage.GetAccount(b.Beneficiary)
@@ -1793,7 +1963,6 @@ func CommitteeValidateBlock(b *protocol.Block) (err error) {
 	}
 
 	err = crypto.VerifyMessageWithRSAKey(commitmentPubKey, fmt.Sprint(b.Height), b.CommitmentProof)
-	logger.Printf("CommitmentPubKey: %x, --------------- Block Height: %d", commitmentPubKey, b.Height)
 	if err != nil {
 		return errors.New("The submitted commitment proof can not be verified.")
 	}
@@ -1801,9 +1970,9 @@ func CommitteeValidateBlock(b *protocol.Block) (err error) {
 	//Invalid if PoS calculation is not correct.
 	prevProofs := GetLatestProofs(ActiveParameters.num_included_prev_proofs, b)
 	if validateProofOfStake(getDifficulty(), prevProofs, b.Height, acc.Balance, b.CommitmentProof, b.Timestamp) {
-		logger.Printf("proof of stake is valid")
+		logger.Debug("Proof of stake of the shard block valid", "hash", b.Hash[0:8], "shard", b.ShardId, "height", b.Height)
 	} else {
-		return errors.New("proof of stake is invalid")
+		return errInvalidProofOfStake
 	}
 	return nil
 }
@@ -88,13 +88,14 @@ func collectStatistics(b *protocol.Block) {
 
 		targetTimes = append(targetTimes, *currentTargetTime)
 
-		logger.Printf("TARGET_CHECK: Target changed, new target: %v", target[len(target)-1])
+		logger.Debug("Target changed", "height", b.Height, "target", target[len(target)-1])
 		localBlockCount = 0
 		currentTargetTime = new(timerange)
 		currentTargetTime.first = b.Timestamp
 	}
 
 	lastBlock = b
+	publishBlockHeight(lastBlock)
 }
 
 func collectStatisticsRollback(b *protocol.Block) {
@@ -112,9 +113,15 @@ func collectStatisticsRollback(b *protocol.Block) {
 	}
 
 	lastBlock = storage.ReadClosedBlock(b.PrevHash)
+	publishBlockHeight(lastBlock)
 }
 
 func calculateNewDifficulty(t *timerange) uint8 {
+	return adjustDifficulty(t, getDifficulty())
+}
+
+//Returns the target following the current one, given the time the last DIFF_INTERVAL blocks took.
+func adjustDifficulty(t *timerange, current uint8) uint8 {
 	//Time difference between the first and last block in the measured range.
 	diff_now := t.last - t.first
 
@@ -127,7 +134,7 @@ func calculateNewDifficulty(t *timerange) uint8 {
 	//This precipitates that reasonable parameter should be chosen for block-/diff interval
 	//such that this case does not happen. In case it still does, we give the current difficulty back.
 	if diff_ratio < 0 {
-		return getDifficulty()
+		return current
 	}
 
 	//Take the log2 from the diff_ratio, because adding a zero makes it twice as hard, adding two zeros four times as
@@ -152,7 +159,7 @@ func calculateNewDifficulty(t *timerange) uint8 {
 	target_change_rounded := uint8(target_change)
 
 	//Return the new target based on the calculation and the current target.
-	return target_change_rounded + target[len(target)-1]
+	return target_change_rounded + current
 }
 
 func getDifficulty() uint8 {
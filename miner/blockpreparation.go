@@ -29,7 +29,7 @@ func prepareBlock(block *protocol.Block) {
 	//openTxs are all the transactions which were assigned to this particular shard
 	opentxs := storage.ReadAllAssignedTx()
 	//opentxs = append(opentxs, storage.ReadAllINVALIDOpenTx()...)
-	logger.Printf("Number of OpenTxs: %d", len(opentxs))
+	logger.Debug("Preparing block", "shard", storage.ThisShardID, "height", block.Height, "assignedTxs", len(opentxs))
 
 
 	var opentxToAdd []protocol.Transaction
@@ -44,7 +44,6 @@ func prepareBlock(block *protocol.Block) {
 
 	nonAggregatableTxCounter = 0                                     //Counter for all transactions which will not be aggregated. (Stake-, config-, acctx)
 	blockSize = int(ActiveParameters.Block_size) - (650 + 8) //Set blocksize - (fixed space + Bloomfiltersize
-	logger.Printf("block.GetBloomFilterSize() %v", block.GetBloomFilterSize())
 	transactionHashSize = 32 //It is 32 bytes
 
 	//map where all senders from FundsTx are added to. --> this ensures that tx with same sender are only counted once.
@@ -55,6 +54,11 @@ func prepareBlock(block *protocol.Block) {
 	storage.DifferentSendersData = map[[32]byte]uint32{}
 	storage.DataTxBeforeAggregation = nil
 
+	//The receipts delivered to this shard are credited before any transaction is added, see receipts.go
+	if err := addReceipts(block); err != nil {
+		logger.Error("Receipts delivered to the shard not credited", "error", err)
+	}
+
 	/*type senderTxCounterForMissingTransactions struct {
 		senderAddress       [32]byte
 		txcnt               uint32
@@ -79,11 +83,13 @@ func prepareBlock(block *protocol.Block) {
 
 	openTxsOfShard := opentxs
 
-	logger.Printf("length of tx assigned to shard: %d", len(openTxsOfShard))
 
 	opentxToAdd = checkBestCombination(openTxsOfShard)
 
-	logger.Printf("length of open tx to add with best combination: %d", len(opentxToAdd))
+	logger.Debug("Transactions selected", "shard", storage.ThisShardID, "height", block.Height, "selected", len(opentxToAdd), "assigned", len(openTxsOfShard))
+
+	//the transactions that do not fit into the block are reported as load of the shard, see resharding.go
+	mempoolDepth = uint32(len(openTxsOfShard) - len(opentxToAdd))
 
 	/* START OF THE SEARCH ALGORITHM
 
@@ -233,7 +239,6 @@ func prepareBlock(block *protocol.Block) {
 
 
 
-	logger.Printf("Number of OpenTxs to add right before they get added: %d", len(opentxToAdd))
 
 	newCommitteeNode = [64]byte{}
 	//Add previous selected transactions.
@@ -250,18 +255,17 @@ func prepareBlock(block *protocol.Block) {
 		default:
 			err := addTx(block, tx)
 			if err != nil {
-				logger.Printf("Error in add tx routine: %s", err)
+				logger.Debug("Transaction not added to the block", "shard", storage.ThisShardID, "height", block.Height, "tx", tx.Hash(), "error", err)
 				//If the tx is invalid, we remove it completely, prevents starvation in the mempool.
 				storage.DeleteOpenTx(tx)
 			}
 		}
 	}
 
-	logger.Printf("Stuff added. Transactions validated")
+	logger.Debug("Transactions added to the block", "shard", storage.ThisShardID, "height", block.Height)
 
 		// In miner\block.go --> AddFundsTx the transactions get added into storage.TxBeforeAggregation.
 		if (len(storage.ReadFundsTxBeforeAggregation()) > 0) || (len(storage.ReadDataTxBeforeAggregation()) > 0) {
-			logger.Printf("Adding funds tx or data tx before aggregation")
 			splitSortedAggregatableTransactions(block)
 		}
 
@@ -395,45 +399,33 @@ func (R *specialTxRequest) Encoding() (encodedTx []byte) {
 
 //Begin Code from Kürsat
 /**
-Transactions are sharded based on the public address of the sender
+Transactions are sharded based on the public address of the sender, see shardassignment.go
+FundsTx sent to a contract account go to the shard of the sender as well. execContract rejects calls of contracts that
+are assigned to another shard, such that the contract variables are never changed by two shards at the same time.
 */
 func assignTransactionToShard(transaction protocol.Transaction) (shardNr int) {
-	//Convert Address/Issuer ([64]bytes) included in TX to bigInt for the modulo operation to determine the assigned shard ID.
 	switch transaction.(type) {
 	case *protocol.FundsTx:
-		var byteToConvert [32]byte
-		byteToConvert = transaction.(*protocol.FundsTx).From
-		var calculatedInt int
-		calculatedInt = int(binary.BigEndian.Uint64(byteToConvert[:8]))
-		return int((Abs(int32(calculatedInt)) % int32(NumberOfShards)) + 1)
-	case *protocol.ConfigTx:
-		var byteToConvert [64]byte
-		byteToConvert = transaction.(*protocol.ConfigTx).Sig
-		var calculatedInt int
-		calculatedInt = int(binary.BigEndian.Uint64(byteToConvert[:8]))
-		return int((Abs(int32(calculatedInt)) % int32(NumberOfShards)) + 1)
+		//Contract calls are assigned to the shard of the sender as well, such that all transactions of an account are
+		//checked against its balance and transaction count by a single shard. See execContract.
+		return assignAddressToShard(transaction.(*protocol.FundsTx).From)
 	case *protocol.StakeTx:
-		var byteToConvert [32]byte
-		byteToConvert = transaction.(*protocol.StakeTx).Account
-		var calculatedInt int
-		calculatedInt = int(binary.BigEndian.Uint64(byteToConvert[:8]))
-		return int((Abs(int32(calculatedInt)) % int32(NumberOfShards)) + 1)
+		return assignAddressToShard(transaction.(*protocol.StakeTx).Account)
 	case *protocol.DataTx:
-		var byteToConvert [32]byte
-		byteToConvert = transaction.(*protocol.DataTx).From
-		var calculatedInt int
-		calculatedInt = int(binary.BigEndian.Uint64(byteToConvert[:8]))
-		return int((Abs(int32(calculatedInt)) % int32(NumberOfShards)) + 1)
+		return assignAddressToShard(transaction.(*protocol.DataTx).From)
 	default:
+		//Config transactions are not tied to an account and go to shard 1, like account, committee and fine transactions
 		return 1 // default shard ID
 	}
 }
 
-func Abs(x int32) int32 {
-	if x < 0 {
-		return -x
-	}
-	return x
+func assignAddressToShard(address [32]byte) (shardNr int) {
+	return assignAddressToShardOf(address, NumberOfShards)
+}
+
+//Same as assignAddressToShard for the number of shards of another epoch.
+func assignAddressToShardOf(address [32]byte, numberOfShards int) (shardNr int) {
+	return shardAssignment.Shard(address, numberOfShards)
 }
 
 /**
@@ -447,7 +439,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 		if(storage.ReadOpenTx(accTx) != nil){
 			storage.WriteClosedTx(storage.ReadOpenTx(accTx))
 			storage.DeleteOpenTx(storage.ReadOpenTx(accTx))
-			logger.Printf("Deleted transaction (%x) from the MemPool.\n",accTx)
+			logger.Debug("Deleted transaction from the mempool", "tx", accTx)
 		}
 	}
 
@@ -455,7 +447,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 		if(storage.ReadOpenTx(fundsTX) != nil){
 			storage.WriteClosedTx(storage.ReadOpenTx(fundsTX))
 			storage.DeleteOpenTx(storage.ReadOpenTx(fundsTX))
-			logger.Printf("Deleted transaction (%x) from the MemPool.\n",fundsTX)
+			logger.Debug("Deleted transaction from the mempool", "tx", fundsTX)
 		}
 	}
 
@@ -463,7 +455,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 		if(storage.ReadOpenTx(configTX) != nil){
 			storage.WriteClosedTx(storage.ReadOpenTx(configTX))
 			storage.DeleteOpenTx(storage.ReadOpenTx(configTX))
-			logger.Printf("Deleted transaction (%x) from the MemPool.\n",configTX)
+			logger.Debug("Deleted transaction from the mempool", "tx", configTX)
 		}
 	}
 
@@ -471,7 +463,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 		if(storage.ReadOpenTx(stakeTX) != nil){
 			storage.WriteClosedTx(storage.ReadOpenTx(stakeTX))
 			storage.DeleteOpenTx(storage.ReadOpenTx(stakeTX))
-			logger.Printf("Deleted transaction (%x) from the MemPool.\n",stakeTX)
+			logger.Debug("Deleted transaction from the mempool", "tx", stakeTX)
 		}
 	}
 
@@ -479,7 +471,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 		if(storage.ReadOpenTx(contractTX) != nil){
 			storage.WriteClosedTx(storage.ReadOpenTx(contractTX))
 			storage.DeleteOpenTx(storage.ReadOpenTx(contractTX))
-			logger.Printf("Deleted transaction (%x) from the MemPool.\n",contractTX)
+			logger.Debug("Deleted transaction from the mempool", "tx", contractTX)
 		}
 	}
 
@@ -492,7 +484,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 			aggTx := storage.ReadOpenTx(TX)
 			storage.WriteClosedTx(storage.ReadOpenTx(TX))
 			storage.DeleteOpenTx(storage.ReadOpenTx(TX))
-			logger.Printf("Deleted transaction (%x) from the MemPool. \n",TX)
+			logger.Debug("Deleted transaction from the mempool", "tx", TX)
 			for _,fundsTX := range aggTx.(*protocol.AggTx).AggregatedTxSlice {
 				if(storage.ReadOpenTx(fundsTX) != nil){
 					//asserting that we don't put aggTx into another aggTx
@@ -500,7 +492,7 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 					//storage.WriteClosedTx(storage.ReadOpenTx(fundsTX))
 					storage.DeleteOpenTx(storage.ReadOpenTx(fundsTX))
 				} else {
-					logger.Printf("Got a problem. The TX is not in the open tx space yet")
+					logger.Debug("Aggregated transaction not in the mempool yet", "tx", fundsTX, "aggTx", TX)
 					storage.WriteOpenTxHashToDelete(fundsTX)
 				}
 			}
@@ -511,24 +503,23 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 			//Aggregated Transaction need to be fetched from the network.
 			cnt := 0
 			HERE:
-			logger.Printf("Request AGGTX: %x", TX)
+			logger.Debug("Requesting aggregated transaction", "tx", TX, "attempt", cnt)
 			err := p2p.TxReq(TX, p2p.AGGTX_REQ)
 			if err != nil {
-				logger.Printf("Could not fetch AggTX")
+				logger.Warn("Could not request aggregated transaction", "tx", TX, "error", err)
 				return
 			}
 
 			select {
 			case aggTx = <-p2p.AggTxChan:
 				storage.WriteOpenTx(aggTx)
-				logger.Printf("  Received AGGTX: %x", TX)
 			case <-time.After(TXFETCH_TIMEOUT * time.Second):
 				stash := p2p.ReceivedAggTxStash
 				if p2p.AggTxAlreadyInStash(stash, TX){
 					for _, tx := range stash {
 						if tx.Hash() == TX {
 							aggTx = tx
-							logger.Printf("  FOUND: Request AGGTX: %x", aggTx.Hash())
+							logger.Debug("Aggregated transaction found in the stash", "tx", TX)
 							break
 						}
 					}
@@ -538,18 +529,18 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 					cnt ++
 					goto HERE
 				}
-				logger.Printf("TIME OUT: Request AGGTX: %x", TX)
+				logger.Warn("Timed out requesting aggregated transaction", "tx", TX)
 				return
 			}
 			if aggTx.Hash() != TX {
-				logger.Printf("Received AggTxHash did not correspond to our request.")
+				logger.Warn("Received aggregated transaction does not match the request", "tx", TX, "received", aggTx.Hash())
 				return
 			}
-			logger.Printf("Received requested AggTX %x", aggTx.Hash())
+			logger.Debug("Received aggregated transaction", "tx", TX)
 			//now delete
 			storage.WriteClosedTx(storage.ReadOpenTx(TX))
 			storage.DeleteOpenTx(storage.ReadOpenTx(TX))
-			logger.Printf("Deleted transaction (%x) from the MemPool. \n",TX)
+			logger.Debug("Deleted transaction from the mempool", "tx", TX)
 			var fundsTxToDelete []protocol.FundsTx
 			//make a new one to make sure it's empty at the beginning of the loop
 			fundsTxToDelete = make([]protocol.FundsTx, 0)
@@ -561,14 +552,14 @@ func DeleteTransactionFromMempool(acctTxData [][32]byte, contractData [][32]byte
 					storage.DeleteOpenTx(storage.ReadOpenTx(fundsTX))
 				} else {
 					storage.WriteOpenTxHashToDelete(fundsTX)
-					logger.Printf("Got a problem. The TX is not in the open tx space yet after request")
+					logger.Debug("Aggregated transaction not in the mempool yet", "tx", fundsTX, "aggTx", TX)
 				}
 			}
 			//delete all at once
 			storage.WriteClosedFundsTxFromAggTxSlice(fundsTxToDelete)
 		}
 	}
-	logger.Printf("Deleted transaction count: %d - New Mempool Size: %d\n",len(contractData)+len(fundsData)+len(configData)+ len(stakeData) + len(aggTxData),storage.GetMemPoolSize())
+	logger.Debug("Deleted transactions from the mempool", "deleted", len(contractData)+len(fundsData)+len(configData)+len(stakeData)+len(aggTxData), "mempool", storage.GetMemPoolSize())
 }
 
 //End code from Kürsat
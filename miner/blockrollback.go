@@ -93,7 +93,7 @@ func validateStateRollback(data blockData) {
 	collectBlockRewardRollback(ActiveParameters.Block_reward, data.block.Beneficiary)
 	collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
 	stakeStateChangeRollback(data.stakeTxSlice)
-	fundsStateChangeRollback(data.fundsTxSlice)
+	fundsStateChangeRollback(data.fundsTxSlice, data.receipts)
 //	aggregatedStateRollback(data.aggTxSlice, data.block.HashWithoutTx,  data.block.Beneficiary)
 	accStateChangeRollback(data.accTxSlice)
 }
@@ -154,7 +154,7 @@ func postValidateRollback(data blockData) {
 	storage.WriteToReceivedStash(data.block) //Write it to received stash, it will be deleted after X new blocks.
 
 	//Save the previous block as the last closed block.
-	logger.Printf("Rolling back. Deleting all last closed block. This should not happen")
+	logger.Warn("Rolling back the last closed block", "hash", data.block.Hash[0:8], "shard", data.block.ShardId, "height", data.block.Height)
 	storage.DeleteAllLastClosedBlock()
 	prevBlock := storage.ReadClosedBlock(data.block.PrevHash)
 	if prevBlock == nil {
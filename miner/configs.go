@@ -8,6 +8,14 @@ const (
 	TXFETCH_TIMEOUT    = 2 //Sec
 	BLOCKFETCH_TIMEOUT = 40 //Sec
 	GENESISFETCH_TIMEOUT 	= 40 //Sec
+	SYNC_CHUNK_SIZE			= 50 //Blocks requested from one miner at a time, see sync.go
+	SYNC_TIMEOUT			= 10 //Sec
+	LIGHT_SYNC_INTERVAL		= 15 //Sec between syncs of a light client without new headers, see light.go
+	LIGHT_HEADER_RANGE		= 500 //Headers per shard a light client requests in one sync
+	BFT_PROPOSAL_TIMEOUT	= 60 //Sec a validator waits for the proposal of a round, see bft.go
+	BFT_VOTE_TIMEOUT		= 10 //Sec a validator waits for the votes of a round
+	BFT_MIN_VALIDATORS		= 4 //Validators of a shard needed such that the committee trusts its certificates
+	BFT_STASHED_ROUNDS		= 16 //Latest rounds of a height whose proposals and votes are kept per validator
 
 
 	//Some prominent programming languages (e.g., Java) have not unsigned integer types
@@ -19,6 +27,7 @@ const (
 	FEE_MINIMUM          	= 1       //Coins
 	BLOCK_SIZE           	= 800 	  //Byte
 	DIFF_INTERVAL        	= 10      //Blocks
+	INITIAL_DIFFICULTY		= 13	  //Target miners start with, adjusted every DIFF_INTERVAL blocks
 	BLOCK_INTERVAL       	= 15      //Sec
 	BLOCK_REWARD         	= 0       //Coins
 	STAKING_MINIMUM      	= 100    //Coins
@@ -30,8 +39,12 @@ const (
 	NUM_INCL_PREV_PROOFS 	= 5       //Number of previous proofs included in the PoS condition
 	NO_EMPTYING_LENGTH		= 100	  //Number of blocks after the newest block which are not moved to the empty block bucket
 	EPOCH_LENGTH         = 1 //blocks
-	VALIDATORS_PER_SHARD = 1 //validators
+	VALIDATORS_PER_SHARD = 4 //validators, they agree on the blocks of the shard, see bft.go
+	RESHARD_MAX_FILL		= 1000 //Block fill of a full block, in per mille
+	RESHARD_SPLIT_FILL		= 900 //Average block fill from which a shard is added, see resharding.go
+	RESHARD_MERGE_FILL		= 250 //Average block fill up to which a shard is removed
 	EPOCHBLOCKFETCH_TIMEOUT 	= 20 //Sec
+	STATEFETCH_TIMEOUT			= 5 //Sec, per peer asked for the state of an epoch block
 	PERCENTAGE_NEEDED_FOR_SLASHING = 0.6667  //use a number between 0 and 1 as percentage, where 0 is 0% and 1 is 100%. 0.6667 stands for 66.67%
 	DEFAULT_FINE_SHARD 			=  10 //standard fine if a shard is fined
 	DEFAULT_FINE_COMMITTEE      =  25 //standard fine if a committee is fined
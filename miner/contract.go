@@ -0,0 +1,91 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/vm"
+)
+
+//A contract call is a FundsTx with data that is sent to an account holding a contract. The fee of the transaction is
+//the gas limit of the execution. Gas that is left over after the execution is not refunded, the whole fee is charged
+//and collected by the beneficiary like for every other FundsTx. Like this, fee collection and its rollback do not
+//depend on the outcome of the execution.
+
+func isContractAccount(acc *protocol.Account) bool {
+	return acc != nil && acc.Contract != nil
+}
+
+func isContractCall(tx *protocol.FundsTx, receiver *protocol.Account) bool {
+	return tx.Data != nil && isContractAccount(receiver)
+}
+
+//Hands the protocol context to the vm. External contexts are wrapped as well, such that the vm only deals with the
+//vm.Context interface.
+type vmContext struct {
+	*protocol.Context
+}
+
+func (c vmContext) NewExternalContext(address [32]byte, data []byte, fee uint64) (vm.Context, error) {
+	externalContext, err := c.Context.NewExternalContext(address, data, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	return vmContext{externalContext}, nil
+}
+
+func (c vmContext) CommitExternalContext(externalContext vm.Context) error {
+	external, ok := externalContext.(vmContext)
+	if !ok {
+		return errors.New("External context was not created by this context")
+	}
+
+	c.Context.CommitExternalContext(external.Context)
+	return nil
+}
+
+//Executes the contract of the receiver with the given transaction. External contracts called with CALLEXT are looked
+//up with getAccount. Returns the contract variables after the execution of all contracts whose variables changed,
+//keyed by their address hash. No account is changed, the caller decides whether the new variables are taken over.
+func execContract(receiver *protocol.Account, tx *protocol.FundsTx, getAccount func(address [32]byte) (*protocol.Account, error)) (map[[32]byte][]protocol.ByteArray, error) {
+	//A call is executed by the shard of the sender, which can only change the contracts assigned to it. Calls of
+	//contracts of another shard are rejected, there is no locking across shards.
+	if NumberOfShards > 1 && assignAddressToShard(tx.To) != assignAddressToShard(tx.From) {
+		return nil, errors.New(fmt.Sprintf("Contract %x is assigned to another shard than the sender %x.", tx.To[0:8], tx.From[0:8]))
+	}
+
+	context := protocol.NewContext(*receiver, *tx)
+	context.AccountLookup = getAccount
+	virtualMachine := vm.NewVM(vmContext{context})
+
+	if !virtualMachine.Exec(false) {
+		return nil, errors.New(virtualMachine.GetErrorMsg())
+	}
+
+	//Update changes vm has made to the contract variables
+	context.PersistChanges()
+
+	variables := context.GetExternalContractVariables()
+	for address, externalVariables := range variables {
+		externalAcc, err := getAccount(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if protocol.ContractVariablesEqual(externalAcc.ContractVariables, externalVariables) {
+			delete(variables, address)
+			continue
+		}
+
+		//Contracts are only changed by the shard they are assigned to. An external contract of another shard can
+		//therefore be read, but not changed.
+		if NumberOfShards > 1 && assignAddressToShard(address) != assignAddressToShard(tx.From) {
+			return nil, errors.New(fmt.Sprintf("External contract %x is assigned to another shard and can't be changed.", address[0:8]))
+		}
+	}
+	variables[tx.To] = context.ContractVariables
+
+	return variables, nil
+}
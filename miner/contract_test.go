@@ -0,0 +1,151 @@
+package miner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"github.com/oigele/bazo-miner/vm"
+)
+
+//Stores the value 5 in the first contract variable.
+var testContract = []byte{
+	vm.PUSH, 0, 5,
+	vm.SSTORE, 0,
+	vm.HALT,
+}
+
+func TestContractCallStateChangeAndRollback(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	accA.Balance = 10000
+	accB.Contract = testContract
+	accB.ContractVariables = []protocol.ByteArray{{0}}
+
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+	hashAccB := protocol.SerializeHashContent(accB.Address)
+
+	tx, err := protocol.ConstrFundsTx(0x01, 10, 2000, 0, hashAccA, hashAccB, PrivKeyAccA, nil, []byte{1})
+	if err != nil {
+		t.Fatalf("Could not create funds tx: %v\n", err)
+	}
+
+	if err := fundsStateChange([]*protocol.FundsTx{tx}, nil, false); err != nil {
+		t.Fatalf("Contract call failed: %v\n", err)
+	}
+
+	if !bytes.Equal(accB.ContractVariables[0], []byte{5}) {
+		t.Errorf("Contract variable was not updated: %v\n", accB.ContractVariables)
+	}
+	if accB.Balance != 10 {
+		t.Errorf("Amount was not transferred to the contract account: %v\n", accB.Balance)
+	}
+
+	fundsStateChangeRollback([]*protocol.FundsTx{tx}, nil)
+
+	if !bytes.Equal(accB.ContractVariables[0], []byte{0}) {
+		t.Errorf("Contract variable was not reverted on rollback: %v\n", accB.ContractVariables)
+	}
+	if _, exists := storage.ReadContractVariablesBeforeTx(tx.Hash()); exists {
+		t.Error("Contract variables before the call were not deleted after the rollback.")
+	}
+}
+
+func TestContractCallOutOfGas(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	accA.Balance = 10000
+	accB.Contract = testContract
+	accB.ContractVariables = []protocol.ByteArray{{0}}
+
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+	hashAccB := protocol.SerializeHashContent(accB.Address)
+
+	validTx, _ := protocol.ConstrFundsTx(0x01, 10, 2000, 0, hashAccA, hashAccB, PrivKeyAccA, nil, []byte{1})
+	//The fee is the gas limit of the execution, SSTORE alone costs more than that.
+	outOfGasTx, _ := protocol.ConstrFundsTx(0x01, 10, 10, 1, hashAccA, hashAccB, PrivKeyAccA, nil, []byte{1})
+
+	if err := fundsStateChange([]*protocol.FundsTx{validTx, outOfGasTx}, nil, false); err == nil {
+		t.Fatal("Contract call without enough gas was accepted.")
+	}
+
+	//The state change of the valid call has to be reverted as well.
+	if !bytes.Equal(accB.ContractVariables[0], []byte{0}) {
+		t.Errorf("Contract variable was not reverted after the failed call: %v\n", accB.ContractVariables)
+	}
+	if accA.Balance != 10000 || accA.TxCnt != 0 || accB.Balance != 0 {
+		t.Errorf("Balances were not reverted after the failed call: %v, %v\n", accA.Balance, accB.Balance)
+	}
+}
+
+func TestContractCallExternalRollback(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	//The multisig account is used as external contract, accB calls it.
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+	hashAccB := protocol.SerializeHashContent(accB.Address)
+	hashExternal := protocol.SerializeHashContent(multiSigAcc.Address)
+
+	accA.Balance = 10000
+	accB.Contract = append([]byte{vm.CALLEXT}, hashExternal[:]...)
+	accB.Contract = append(accB.Contract, 0, 0, 0, 1, 0, vm.HALT)
+	multiSigAcc.Contract = testContract
+	multiSigAcc.ContractVariables = []protocol.ByteArray{{0}}
+
+	tx, _ := protocol.ConstrFundsTx(0x01, 0, 5000, 0, hashAccA, hashAccB, PrivKeyAccA, nil, []byte{1})
+
+	if err := fundsStateChange([]*protocol.FundsTx{tx}, nil, false); err != nil {
+		t.Fatalf("Contract call failed: %v\n", err)
+	}
+
+	if !bytes.Equal(multiSigAcc.ContractVariables[0], []byte{5}) {
+		t.Errorf("External contract variable was not updated: %v\n", multiSigAcc.ContractVariables)
+	}
+
+	fundsStateChangeRollback([]*protocol.FundsTx{tx}, nil)
+
+	if !bytes.Equal(multiSigAcc.ContractVariables[0], []byte{0}) {
+		t.Errorf("External contract variable was not reverted on rollback: %v\n", multiSigAcc.ContractVariables)
+	}
+}
+
+func TestContractCallAcrossShards(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	accA.Balance = 10000
+	accB.Contract = testContract
+	accB.ContractVariables = []protocol.ByteArray{{0}}
+
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+	hashAccB := protocol.SerializeHashContent(accB.Address)
+
+	numberOfShardsBefore, assignmentBefore := NumberOfShards, shardAssignment
+	defer func() {
+		NumberOfShards, shardAssignment = numberOfShardsBefore, assignmentBefore
+	}()
+	NumberOfShards = 2
+	shardAssignment = NewPinnedAssignment(map[[32]byte]int{hashAccA: 1, hashAccB: 2}, HashRangeAssignment{})
+
+	tx, _ := protocol.ConstrFundsTx(0x01, 10, 2000, 0, hashAccA, hashAccB, PrivKeyAccA, nil, []byte{1})
+
+	//The call is assigned to the shard of the sender, not to the one of the contract
+	if shard := assignTransactionToShard(tx); shard != 1 {
+		t.Errorf("Contract call assigned to shard %v instead of the shard of the sender\n", shard)
+	}
+
+	if err := fundsStateChange([]*protocol.FundsTx{tx}, nil, false); err == nil {
+		t.Fatal("Call of a contract of another shard was executed.")
+	}
+	if !bytes.Equal(accB.ContractVariables[0], []byte{0}) {
+		t.Errorf("Contract of another shard was changed: %v\n", accB.ContractVariables)
+	}
+}
@@ -0,0 +1,369 @@
+package miner
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"sync"
+)
+
+//The committee members endorse every epoch block they validated and every transaction assignment they checked, see
+//protocol/endorsement.go. Validators only take over an epoch block or an assignment once a quorum of 2n/3+1 of the n
+//committee members endorsed it, instead of trusting the validator of shard 1 that built the epoch block or the
+//committee leader that assigned the transactions. The endorsements of a quorum are kept with the epoch block or
+//assignment as its certificate, such that miners that fetch it later can check it without the endorsements. The
+//certificate is the list of the RSA signatures of the quorum, it is not aggregated into a single signature.
+//Like votes, endorsements are not relayed, the committee is connected to the validators.
+
+var (
+	//key: height, value: verified endorsements of the epoch block and the assignments of this height, by the hash of the
+	//whole message
+	endorsementStash = make(map[uint32]map[[32]byte]*protocol.Endorsement)
+	//Endorsements below this height are dropped
+	endorsementFloor uint32
+	endorsementMutex = &sync.Mutex{}
+
+	//Epoch block a validator received before a quorum endorsed it, it is handed to the mining routine again once the
+	//endorsements arrived
+	pendingEpochBlock *protocol.EpochBlock
+	pendingEpochHash  [32]byte
+
+	//Assignments the committee member endorsed, they get their certificate once a quorum endorsed them
+	endorsedAssignments = make(map[[32]byte]*protocol.TransactionAssignment)
+)
+
+//Accounts of the committee members by their hash. Endorsements are processed outside of the miner's goroutine, so the
+//committee is taken from the state of the last closed (epoch) block instead of the state the miner changes.
+func committeeMembers() map[[32]byte]*protocol.Account {
+	state, _ := storage.ReadStateSnapshot()
+	members := make(map[[32]byte]*protocol.Account)
+	for address, acc := range state {
+		if acc.IsCommittee {
+			members[address] = acc
+		}
+	}
+
+	return members
+}
+
+//The committee only starts with the first epoch block, see InitCommittee, so it can't endorse the epoch blocks up to it.
+func endorsementRequired(b *protocol.EpochBlock) bool {
+	return b.Height > uint32(EPOCH_LENGTH)+1
+}
+
+//Endorses an epoch block or an assignment with the committee key and broadcasts the endorsement.
+func endorse(kind uint8, height uint32, shardID int, hash [32]byte) error {
+	endorsement := protocol.NewEndorsement(kind, height, shardID, hash, protocol.SerializeHashContent(ValidatorAccAddress))
+	signature, err := crypto.SignMessageWithRSAKey(storage.CommitteePrivKey, endorsement.Message())
+	if err != nil {
+		return err
+	}
+	endorsement.Signature = signature
+
+	stashEndorsement(endorsement)
+	broadcastEndorsement(endorsement)
+	return nil
+}
+
+//The committee endorses the epoch block by its full hash, which unlike the block hash also covers the validator mapping
+//and the committee leader.
+func endorseEpochBlock(b *protocol.EpochBlock) {
+	if err := endorse(protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, b.HashEpochBlock()); err != nil {
+		logger.Warn("Could not endorse the epoch block", "hash", b.Hash[0:8], "height", b.Height, "error", err)
+		return
+	}
+
+	logger.Info("Endorsed the epoch block", "hash", b.Hash[0:8], "height", b.Height)
+}
+
+//Endorses an assignment of the committee leader once its transactions are assigned to the right shard.
+func endorseAssignment(ta *protocol.TransactionAssignment) {
+	if err := validateAssignmentShards(ta); err != nil {
+		logger.Warn("Transaction assignment not endorsed", "shard", ta.ShardID, "height", ta.Height, "error", err)
+		return
+	}
+
+	hash := ta.HashTransactionAssignment()
+	if err := endorse(protocol.ENDORSE_ASSIGNMENT, uint32(ta.Height), ta.ShardID, hash); err != nil {
+		logger.Warn("Could not endorse the transaction assignment", "shard", ta.ShardID, "height", ta.Height, "error", err)
+		return
+	}
+
+	endorsementMutex.Lock()
+	endorsedAssignments[hash] = ta
+	endorsementMutex.Unlock()
+	certifyEndorsedAssignments()
+}
+
+func validateAssignmentShards(ta *protocol.TransactionAssignment) error {
+	var transactions []protocol.Transaction
+	for _, tx := range ta.AccTxs {
+		transactions = append(transactions, tx)
+	}
+	for _, tx := range ta.StakeTxs {
+		transactions = append(transactions, tx)
+	}
+	for _, tx := range ta.CommitteeTxs {
+		transactions = append(transactions, tx)
+	}
+	for _, tx := range ta.FundsTxs {
+		transactions = append(transactions, tx)
+	}
+	for _, tx := range ta.DataTxs {
+		transactions = append(transactions, tx)
+	}
+	for _, tx := range ta.FineTxs {
+		transactions = append(transactions, tx)
+	}
+
+	for _, tx := range transactions {
+		if shardID := assignTransactionToShard(tx); shardID != ta.ShardID {
+			txHash := tx.Hash()
+			return errors.New(fmt.Sprintf("Transaction %x is assigned to shard %d, but belongs to shard %d.", txHash[0:8], ta.ShardID, shardID))
+		}
+	}
+
+	return nil
+}
+
+//Checks the signature of a committee member over an endorsement.
+func verifyEndorsement(members map[[32]byte]*protocol.Account, endorsement *protocol.Endorsement) error {
+	acc := members[endorsement.Member]
+	if acc == nil {
+		return errors.New(fmt.Sprintf("%x is not a committee member.", endorsement.Member[0:8]))
+	}
+
+	committeePubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitteeKey)
+	if err != nil {
+		return errors.New("Invalid committee key in account.")
+	}
+
+	return crypto.VerifyMessageWithRSAKey(committeePubKey, endorsement.Message(), endorsement.Signature)
+}
+
+//Endorsements of distinct committee members for the epoch block or assignment.
+func committeeEndorsements(members map[[32]byte]*protocol.Account, kind uint8, height uint32, shardID int, hash [32]byte) []*protocol.Endorsement {
+	endorsementMutex.Lock()
+	defer endorsementMutex.Unlock()
+
+	var endorsements []*protocol.Endorsement
+	counted := make(map[[32]byte]bool)
+	for _, endorsement := range endorsementStash[height] {
+		if endorsement.Kind != kind || endorsement.ShardID != shardID || endorsement.EndorsedHash != hash {
+			continue
+		}
+		//members may have left the committee since the endorsement was stashed
+		if counted[endorsement.Member] || members[endorsement.Member] == nil {
+			continue
+		}
+		counted[endorsement.Member] = true
+		endorsements = append(endorsements, endorsement)
+	}
+
+	return endorsements
+}
+
+//Certificate of the endorsements of a quorum of the committee received so far, nil if there is none.
+func committeeCertificateFor(kind uint8, height uint32, shardID int, hash [32]byte) *protocol.CommitteeCertificate {
+	members := committeeMembers()
+	endorsements := committeeEndorsements(members, kind, height, shardID, hash)
+	if len(members) == 0 || len(endorsements) < quorum(len(members)) {
+		return nil
+	}
+
+	return protocol.NewCommitteeCertificate(endorsements)
+}
+
+//A certificate holds the endorsements of a quorum of the committee for the same epoch block or assignment.
+func validateCommitteeCertificate(certificate *protocol.CommitteeCertificate, kind uint8, height uint32, shardID int, hash [32]byte) error {
+	if certificate == nil {
+		return errors.New(fmt.Sprintf("%x has no certificate of the committee.", hash[0:8]))
+	}
+	if certificate.Kind != kind || certificate.Height != height || certificate.ShardID != shardID || certificate.EndorsedHash != hash {
+		return errors.New(fmt.Sprintf("Certificate of %x certifies %x of shard %d at height %d.", hash[0:8], certificate.EndorsedHash[0:8], certificate.ShardID, certificate.Height))
+	}
+
+	members := committeeMembers()
+	signers := make(map[[32]byte]bool)
+	for _, endorsement := range certificate.Endorsements {
+		if endorsement.Kind != certificate.Kind || endorsement.Height != certificate.Height || endorsement.ShardID != certificate.ShardID || endorsement.EndorsedHash != certificate.EndorsedHash {
+			return errors.New(fmt.Sprintf("Certificate of %x contains an endorsement of something else: %v", hash[0:8], endorsement))
+		}
+		if signers[endorsement.Member] {
+			return errors.New(fmt.Sprintf("Certificate of %x contains two endorsements of %x.", hash[0:8], endorsement.Member[0:8]))
+		}
+		if err := verifyEndorsement(members, endorsement); err != nil {
+			return errors.New(fmt.Sprintf("Certificate of %x contains an invalid endorsement: %v", hash[0:8], err))
+		}
+		signers[endorsement.Member] = true
+	}
+
+	if len(members) == 0 || len(signers) < quorum(len(members)) {
+		return errors.New(fmt.Sprintf("Certificate of %x has %d endorsements, but %d of %d committee members are needed.", hash[0:8], len(signers), quorum(len(members)), len(members)))
+	}
+
+	return nil
+}
+
+//An epoch block is endorsed with the certificate it carries or with the endorsements received so far, which then
+//become its certificate.
+func validateEpochEndorsements(b *protocol.EpochBlock) error {
+	if !endorsementRequired(b) {
+		return nil
+	}
+
+	hash := b.HashEpochBlock()
+	if b.Certificate != nil && validateCommitteeCertificate(b.Certificate, protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, hash) == nil {
+		return nil
+	}
+
+	certificate := committeeCertificateFor(protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, hash)
+	if certificate == nil {
+		return errors.New(fmt.Sprintf("Epoch block (%x) is not endorsed by a quorum of the committee yet.", b.Hash[0:8]))
+	}
+	b.Certificate = certificate
+
+	return nil
+}
+
+//Same for the transaction assignment of a shard.
+func validateAssignmentEndorsements(ta *protocol.TransactionAssignment) error {
+	hash := ta.HashTransactionAssignment()
+	if ta.Certificate != nil && validateCommitteeCertificate(ta.Certificate, protocol.ENDORSE_ASSIGNMENT, uint32(ta.Height), ta.ShardID, hash) == nil {
+		return nil
+	}
+
+	certificate := committeeCertificateFor(protocol.ENDORSE_ASSIGNMENT, uint32(ta.Height), ta.ShardID, hash)
+	if certificate == nil {
+		return errors.New(fmt.Sprintf("Transaction assignment of shard %d at height %d is not endorsed by a quorum of the committee yet.", ta.ShardID, ta.Height))
+	}
+	ta.Certificate = certificate
+
+	return nil
+}
+
+//Keeps an epoch block that is not endorsed yet until the endorsements arrived, see releaseEndorsedEpochBlock.
+func awaitEndorsements(b *protocol.EpochBlock) {
+	pending := *b
+	hash := pending.HashEpochBlock()
+
+	endorsementMutex.Lock()
+	pendingEpochBlock = &pending
+	pendingEpochHash = hash
+	endorsementMutex.Unlock()
+
+	logger.Info("Waiting for the endorsements of the committee", "hash", b.Hash[0:8], "height", b.Height)
+	//the last endorsement may have arrived since the epoch block was checked
+	releaseEndorsedEpochBlock()
+}
+
+//Hands the pending epoch block to the mining routine again once a quorum endorsed it.
+func releaseEndorsedEpochBlock() {
+	endorsementMutex.Lock()
+	b, hash := pendingEpochBlock, pendingEpochHash
+	endorsementMutex.Unlock()
+	if b == nil || committeeCertificateFor(protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, hash) == nil {
+		return
+	}
+
+	endorsementMutex.Lock()
+	if pendingEpochBlock != b {
+		endorsementMutex.Unlock()
+		return
+	}
+	pendingEpochBlock = nil
+	endorsementMutex.Unlock()
+
+	go func() {
+		p2p.EpochBlockReceivedChan <- *b
+	}()
+}
+
+//Attaches the certificate to the assignments a quorum endorsed, such that it is sent along when they are requested.
+func certifyEndorsedAssignments() {
+	endorsementMutex.Lock()
+	var uncertified []*protocol.TransactionAssignment
+	for _, ta := range endorsedAssignments {
+		if ta.Certificate == nil {
+			uncertified = append(uncertified, ta)
+		}
+	}
+	endorsementMutex.Unlock()
+
+	for _, ta := range uncertified {
+		if certificate := committeeCertificateFor(protocol.ENDORSE_ASSIGNMENT, uint32(ta.Height), ta.ShardID, ta.HashTransactionAssignment()); certificate != nil {
+			endorsementMutex.Lock()
+			ta.Certificate = certificate
+			endorsementMutex.Unlock()
+		}
+	}
+}
+
+//Stashes a verified endorsement. Only the first endorsement of a member for the epoch block or the assignment of a
+//shard at a height is kept, such that a member can't fill the stash.
+func stashEndorsement(endorsement *protocol.Endorsement) {
+	hash := protocol.SerializeHashContent(endorsement.Encode())
+
+	endorsementMutex.Lock()
+	defer endorsementMutex.Unlock()
+
+	height := endorsement.Height
+	if height < endorsementFloor || (endorsementFloor != 0 && height > endorsementFloor+2*(EPOCH_LENGTH+1)) {
+		return
+	}
+	if endorsementStash[height] == nil {
+		endorsementStash[height] = make(map[[32]byte]*protocol.Endorsement)
+	}
+	for _, stashed := range endorsementStash[height] {
+		if stashed.Member == endorsement.Member && stashed.Kind == endorsement.Kind && stashed.ShardID == endorsement.ShardID {
+			return
+		}
+	}
+	endorsementStash[height][hash] = endorsement
+}
+
+//Drops the endorsements and endorsed assignments below the height of the epoch block taken over.
+func pruneEndorsements(height uint32) {
+	endorsementMutex.Lock()
+	defer endorsementMutex.Unlock()
+
+	endorsementFloor = height
+	for stashedHeight := range endorsementStash {
+		if stashedHeight < height {
+			delete(endorsementStash, stashedHeight)
+		}
+	}
+	for hash, ta := range endorsedAssignments {
+		if uint32(ta.Height) < height {
+			delete(endorsedAssignments, hash)
+		}
+	}
+}
+
+func processEndorsement(payload []byte) {
+	var endorsement *protocol.Endorsement
+	if endorsement = endorsement.Decode(payload); endorsement == nil {
+		p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	//Endorsements are only stashed once they are signed by a committee member
+	if err := verifyEndorsement(committeeMembers(), endorsement); err != nil {
+		logger.Debug("Endorsement not verified", "member", endorsement.Member[0:8], "height", endorsement.Height, "error", err)
+		if err == rsa.ErrVerification {
+			p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_PROTOCOL_VIOLATION)
+		}
+		return
+	}
+
+	stashEndorsement(endorsement)
+	if storage.IsCommittee {
+		certifyEndorsedAssignments()
+	} else {
+		releaseEndorsedEpochBlock()
+	}
+}
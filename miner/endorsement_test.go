@@ -0,0 +1,222 @@
+package miner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"sort"
+	"testing"
+	"time"
+)
+
+//Adds committee members with fresh committee keys to the state and closes a block with it. Returns the members sorted
+//by their hash.
+func addCommitteeMembers(t *testing.T, n int) (members [][32]byte, keys map[[32]byte]*rsa.PrivateKey) {
+	keys = make(map[[32]byte]*rsa.PrivateKey)
+	for i := 0; i < n; i++ {
+		key, err := rsa.GenerateKey(rand.Reader, crypto.COMM_KEY_LENGTH*8)
+		if err != nil {
+			t.Fatalf("Could not create committee key: %v\n", err)
+		}
+
+		acc := &protocol.Account{Address: [64]byte{byte(i + 1), 0xce}, IsCommittee: true}
+		copy(acc.CommitteeKey[:], key.N.Bytes())
+		storage.State[acc.Hash()] = acc
+		keys[acc.Hash()] = key
+		members = append(members, acc.Hash())
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i][:], members[j][:]) < 0
+	})
+	storage.WriteLastClosedBlock(genesisBlock)
+
+	return members, keys
+}
+
+func signedEndorsement(t *testing.T, key *rsa.PrivateKey, kind uint8, height uint32, shardID int, hash [32]byte, member [32]byte) *protocol.Endorsement {
+	endorsement := protocol.NewEndorsement(kind, height, shardID, hash, member)
+	signature, err := crypto.SignMessageWithRSAKey(key, endorsement.Message())
+	if err != nil {
+		t.Fatalf("Could not sign endorsement: %v\n", err)
+	}
+	endorsement.Signature = signature
+
+	return endorsement
+}
+
+func TestValidateCommitteeCertificate(t *testing.T) {
+	cleanAndPrepare()
+	members, keys := addCommitteeMembers(t, 4)
+
+	hash := [32]byte{7}
+	var endorsements []*protocol.Endorsement
+	for _, member := range members {
+		endorsements = append(endorsements, signedEndorsement(t, keys[member], protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash, member))
+	}
+
+	if err := validateCommitteeCertificate(nil, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err == nil {
+		t.Errorf("Missing certificate accepted\n")
+	}
+
+	certificate := protocol.NewCommitteeCertificate(endorsements[:3])
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err != nil {
+		t.Errorf("Certificate of a quorum rejected: %v\n", err)
+	}
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_ASSIGNMENT, 8, 0, hash); err == nil {
+		t.Errorf("Certificate of an epoch block accepted for an assignment\n")
+	}
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, [32]byte{6}); err == nil {
+		t.Errorf("Certificate of another epoch block accepted\n")
+	}
+
+	certificate = protocol.NewCommitteeCertificate(endorsements[:2])
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err == nil {
+		t.Errorf("Certificate without quorum accepted\n")
+	}
+
+	certificate = protocol.NewCommitteeCertificate([]*protocol.Endorsement{endorsements[0], endorsements[1], endorsements[1]})
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err == nil {
+		t.Errorf("Certificate counting a member twice accepted\n")
+	}
+
+	other := signedEndorsement(t, keys[members[2]], protocol.ENDORSE_EPOCH_BLOCK, 8, 0, [32]byte{6}, members[2])
+	certificate = protocol.NewCommitteeCertificate([]*protocol.Endorsement{endorsements[0], endorsements[1], other})
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err == nil {
+		t.Errorf("Certificate with endorsements of different epoch blocks accepted\n")
+	}
+
+	forged := *endorsements[2]
+	forged.Member = members[3]
+	certificate = protocol.NewCommitteeCertificate([]*protocol.Endorsement{endorsements[0], endorsements[1], &forged})
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err == nil {
+		t.Errorf("Certificate with a forged endorsement accepted\n")
+	}
+
+	//Members that left the committee can't endorse anymore
+	storage.State[members[2]].IsCommittee = false
+	storage.WriteLastClosedBlock(genesisBlock)
+	certificate = protocol.NewCommitteeCertificate(endorsements[:3])
+	if err := validateCommitteeCertificate(certificate, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, hash); err == nil {
+		t.Errorf("Certificate with the endorsement of a former member accepted\n")
+	}
+}
+
+func TestEpochEndorsements(t *testing.T) {
+	cleanAndPrepare()
+	defer pruneEndorsements(0)
+	members, keys := addCommitteeMembers(t, 4)
+
+	//The committee starts with the first epoch block
+	first := protocol.NewEpochBlock([][32]byte{{1}}, uint32(EPOCH_LENGTH)+1)
+	if err := validateEpochEndorsements(first); err != nil {
+		t.Errorf("First epoch block needs endorsements: %v\n", err)
+	}
+
+	b := protocol.NewEpochBlock([][32]byte{{2}}, 2*uint32(EPOCH_LENGTH)+2)
+	b.NofShards = 2
+	b.Hash = [32]byte{3}
+	hash := b.HashEpochBlock()
+	pruneEndorsements(b.Height)
+
+	processEndorsement(signedEndorsement(t, keys[members[0]], protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, hash, members[0]).Encode())
+	processEndorsement(signedEndorsement(t, keys[members[1]], protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, hash, members[1]).Encode())
+	//an endorsement of another epoch block of the height does not count
+	processEndorsement(signedEndorsement(t, keys[members[2]], protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, [32]byte{4}, members[2]).Encode())
+	if err := validateEpochEndorsements(b); err == nil {
+		t.Errorf("Epoch block without quorum accepted\n")
+	}
+
+	//The epoch block is handed to the mining routine again once a quorum endorsed it
+	awaitEndorsements(b)
+	processEndorsement(signedEndorsement(t, keys[members[3]], protocol.ENDORSE_EPOCH_BLOCK, b.Height, 0, hash, members[3]).Encode())
+	releaseEndorsedEpochBlock()
+	select {
+	case released := <-p2p.EpochBlockReceivedChan:
+		if released.Hash != b.Hash {
+			t.Errorf("Other epoch block released: %x\n", released.Hash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Endorsed epoch block not released\n")
+	}
+
+	if err := validateEpochEndorsements(b); err != nil || b.Certificate == nil || len(b.Certificate.Endorsements) != 3 {
+		t.Fatalf("Endorsed epoch block rejected (%v): %v\n", err, b.Certificate)
+	}
+
+	//The certificate is checked without the endorsements
+	pruneEndorsements(b.Height + 1)
+	if err := validateEpochEndorsements(b); err != nil {
+		t.Errorf("Certificate of the epoch block rejected: %v\n", err)
+	}
+
+	//The certificate covers the validator mapping, which the block hash does not
+	b.ValMapping = protocol.NewMapping()
+	b.ValMapping.ValMapping[accA.Address] = 2
+	if err := validateEpochEndorsements(b); err == nil {
+		t.Errorf("Certificate of the epoch block accepted for another validator mapping\n")
+	}
+}
+
+func TestAssignmentEndorsements(t *testing.T) {
+	cleanAndPrepare()
+	defer pruneEndorsements(0)
+	numberOfShards := NumberOfShards
+	NumberOfShards = 2
+	defer func() { NumberOfShards = numberOfShards }()
+	members, keys := addCommitteeMembers(t, 1)
+
+	tx := &protocol.FundsTx{Amount: 1, From: accA.Hash(), To: accB.Hash()}
+	shardID := assignTransactionToShard(tx)
+	ta := protocol.NewTransactionAssignment(4, shardID, [256]byte{}, nil, nil, nil, []*protocol.FundsTx{tx}, nil, nil)
+	if err := validateAssignmentShards(ta); err != nil {
+		t.Errorf("Transactions of the shard rejected: %v\n", err)
+	}
+	if err := validateAssignmentShards(protocol.NewTransactionAssignment(4, 3-shardID, [256]byte{}, nil, nil, nil, []*protocol.FundsTx{tx}, nil, nil)); err == nil {
+		t.Errorf("Transaction of another shard accepted\n")
+	}
+
+	if err := validateAssignmentEndorsements(ta); err == nil {
+		t.Errorf("Assignment without endorsement accepted\n")
+	}
+
+	//A committee of one member is a quorum on its own
+	processEndorsement(signedEndorsement(t, keys[members[0]], protocol.ENDORSE_ASSIGNMENT, 4, shardID, ta.HashTransactionAssignment(), members[0]).Encode())
+	if err := validateAssignmentEndorsements(ta); err != nil || ta.Certificate == nil {
+		t.Errorf("Endorsed assignment rejected: %v\n", err)
+	}
+
+	//The endorsement covers the transactions
+	ta.Certificate = nil
+	ta.FundsTxs = nil
+	if err := validateAssignmentEndorsements(ta); err == nil {
+		t.Errorf("Assignment with other transactions accepted\n")
+	}
+}
+
+func TestProcessEndorsement(t *testing.T) {
+	cleanAndPrepare()
+	defer pruneEndorsements(0)
+	members, keys := addCommitteeMembers(t, 2)
+	pruneEndorsements(8)
+
+	//Endorsements of other nodes than the committee members and forged endorsements are not stashed
+	outsider, _ := rsa.GenerateKey(rand.Reader, crypto.COMM_KEY_LENGTH*8)
+	processEndorsement(signedEndorsement(t, outsider, protocol.ENDORSE_EPOCH_BLOCK, 8, 0, [32]byte{7}, accA.Hash()).Encode())
+	forged := signedEndorsement(t, keys[members[0]], protocol.ENDORSE_EPOCH_BLOCK, 8, 0, [32]byte{7}, members[0])
+	forged.Member = members[1]
+	processEndorsement(forged.Encode())
+	if len(endorsementStash[8]) != 0 {
+		t.Errorf("Unverified endorsements stashed: %v\n", endorsementStash[8])
+	}
+
+	//A member is only counted with its first endorsement of the height
+	processEndorsement(signedEndorsement(t, keys[members[0]], protocol.ENDORSE_EPOCH_BLOCK, 8, 0, [32]byte{7}, members[0]).Encode())
+	processEndorsement(signedEndorsement(t, keys[members[0]], protocol.ENDORSE_EPOCH_BLOCK, 8, 0, [32]byte{6}, members[0]).Encode())
+	if len(endorsementStash[8]) != 1 {
+		t.Errorf("Endorsements of a member not limited per height: %v\n", endorsementStash[8])
+	}
+}
@@ -0,0 +1,435 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"sort"
+	"time"
+)
+
+//A light client follows all shards by their block headers and the epoch block headers, without the transactions and
+//the state. The accounts of the validators and the committee leader of an epoch are proven against the
+//MerklePatriciaRoot of its epoch block. A block header is accepted if it links to the last accepted header of its shard
+//or to the epoch block, if its hash matches, and if its beneficiary is assigned to the shard, signed the height with its
+//commitment key and satisfies the proof of stake. The next epoch block is checked the same way against the validators
+//of shard 1, and its committee leader has to be a committee member. Only blocks whose bloom filter matches one of the
+//wallet's accounts are downloaded in full.
+type lightChain struct {
+	epoch *protocol.EpochBlock
+	//Accounts of the validators and the committee leader of the epoch
+	accounts map[[32]byte]*protocol.Account
+	//Last accepted header per shard
+	heads map[int]*protocol.Block
+	//Difficulty per shard, adjusted like a miner that started with the light client would
+	targets map[int]*lightTarget
+	//Hashes of the wallet's addresses
+	wallet [][32]byte
+}
+
+type lightTarget struct {
+	difficulty uint8
+	count      int64
+	timerange
+}
+
+var (
+	errNotLinked = errors.New("header does not link to an accepted header")
+)
+
+//Light client entry point, the p2p package has to be initialized with p2p.InitLight.
+func InitLight(addresses [][64]byte) {
+	logger = logging.New("miner")
+
+	parameterSlice = append(parameterSlice, NewDefaultParameters())
+	ActiveParameters = &parameterSlice[0]
+
+	chain := newLightChain(addresses)
+	//The last accepted epoch block is trusted after a restart, the headers after it are checked again
+	if epochBlock := storage.ReadLastClosedEpochBlock(); epochBlock != nil {
+		chain.epoch = epochBlock
+	}
+
+	for {
+		chain.sync()
+
+		//Miners push the headers of the blocks they mine, which is the time to look for new ones
+		select {
+		case <-p2p.BlockHeaderIn:
+		case <-time.After(LIGHT_SYNC_INTERVAL * time.Second):
+		}
+	}
+}
+
+func newLightChain(addresses [][64]byte) *lightChain {
+	chain := &lightChain{
+		accounts: make(map[[32]byte]*protocol.Account),
+		heads:    make(map[int]*protocol.Block),
+		targets:  make(map[int]*lightTarget),
+	}
+	for _, address := range addresses {
+		chain.wallet = append(chain.wallet, protocol.SerializeHashContent(address))
+	}
+
+	return chain
+}
+
+func (chain *lightChain) sync() {
+	miners := p2p.HeaderRangePeers()
+	if len(miners) == 0 {
+		logger.Debug("No miner to sync headers from")
+		return
+	}
+
+	epochBlocks := requestEpochHeaders(miners, nil)
+	sort.Slice(epochBlocks, func(i, j int) bool {
+		return epochBlocks[i].Height > epochBlocks[j].Height
+	})
+
+	for _, epochBlock := range epochBlocks {
+		if chain.epoch != nil && epochBlock.Height <= chain.epoch.Height {
+			break
+		}
+		if err := chain.advanceEpoch(miners, epochBlock); err != nil {
+			logger.Warn("Epoch block header rejected", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "error", err)
+			continue
+		}
+		break
+	}
+
+	if chain.epoch == nil {
+		return
+	}
+
+	//Validators are proven after a restart or if no miner could prove them before
+	if len(chain.accounts) == 0 {
+		accounts, err := proveAccounts(miners, chain.epoch)
+		if err != nil {
+			logger.Warn("Validators of the epoch not proven", "height", chain.epoch.Height, "error", err)
+			return
+		}
+		chain.accounts = accounts
+	}
+
+	chain.fetchBlocks(chain.syncHeaders(0))
+}
+
+//Accepts the epoch block header that follows the accepted one. The shard headers up to the epoch block are synced
+//first, since it links to the last header of shard 1. Without an accepted epoch block, or if the client fell behind
+//by more than an epoch, the validators of the epochs in between are not known and the epoch block is only checked
+//against its own state.
+func (chain *lightChain) advanceEpoch(miners []string, epochBlock *protocol.EpochBlock) error {
+	if epochBlock.HashEpochBlockHeader() != epochBlock.Hash {
+		p2p.ReportInvalidPayload(epochBlock.EncodeHeader(), p2p.MISBEHAVIOR_INVALID_BLOCK)
+		return errors.New("hash does not match")
+	}
+
+	follows := false
+	if chain.epoch != nil && len(chain.accounts) > 0 {
+		chain.syncHeaders(epochBlock.Height)
+		if head := chain.heads[1]; head != nil && len(epochBlock.PrevShardHashes) > 0 && epochBlock.PrevShardHashes[0] == head.Hash {
+			follows = true
+			if err := chain.verifyEpochHeader(epochBlock); err != nil {
+				p2p.ReportInvalidPayload(epochBlock.EncodeHeader(), p2p.MISBEHAVIOR_INVALID_BLOCK)
+				return err
+			}
+		}
+	}
+
+	accounts, err := proveAccounts(miners, epochBlock)
+	if err != nil {
+		return err
+	}
+
+	if !follows {
+		logger.Warn("Following epoch block without checking it against the previous epoch", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height)
+		if err := verifyEpochSender(epochBlock, epochBlock.ValMapping, accounts, chain.target(1).difficulty); err != nil {
+			return err
+		}
+	}
+
+	//The committee signs the transaction assignments, its leader has to be able to
+	leader := accounts[epochBlock.CommitteeLeader]
+	if leader == nil || !leader.IsCommittee {
+		return errors.New(fmt.Sprintf("committee leader %x is not a committee member", epochBlock.CommitteeLeader[0:8]))
+	}
+	if _, err := crypto.CreateRSAPubKeyFromBytes(leader.CommitteeKey); err != nil {
+		return errors.New(fmt.Sprintf("committee leader %x has no valid committee key", epochBlock.CommitteeLeader[0:8]))
+	}
+
+	chain.epoch = epochBlock
+	chain.accounts = accounts
+	storage.WriteClosedEpochBlock(epochBlock)
+	storage.DeleteAllLastClosedEpochBlock()
+	//Light clients follow the headers only and have no state
+	storage.WriteLastClosedEpochBlock(epochBlock, storage.State)
+	logger.Info("Accepted epoch block header", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "shards", epochBlock.NofShards)
+
+	return nil
+}
+
+func (chain *lightChain) verifyEpochHeader(epochBlock *protocol.EpochBlock) error {
+	if epochBlock.Height <= chain.epoch.Height {
+		return errors.New(fmt.Sprintf("height %v not above the accepted epoch block", epochBlock.Height))
+	}
+
+	//Shard 1 creates the epoch blocks
+	return verifyEpochSender(epochBlock, chain.epoch.ValMapping, chain.accounts, chain.target(1).difficulty)
+}
+
+func verifyEpochSender(epochBlock *protocol.EpochBlock, mapping *protocol.ValShardMapping, accounts map[[32]byte]*protocol.Account, difficulty uint8) error {
+	acc, err := lightValidator(mapping, accounts, 1, epochBlock.Beneficiary, epochBlock.Height, epochBlock.CommitmentProof)
+	if err != nil {
+		return err
+	}
+
+	if !validateProofOfStakeEpoch(difficulty, epochBlock.Height, acc.Balance, epochBlock.CommitmentProof, epochBlock.Timestamp) {
+		return errors.New("proof of stake not valid")
+	}
+
+	return nil
+}
+
+//Downloads and checks the headers of all shards above the last accepted ones, up to the given height if it is not 0.
+//Returns the accepted headers whose bloom filter matches the wallet.
+func (chain *lightChain) syncHeaders(upTo uint32) (matches []*protocol.Block) {
+	var ranges []blockRange
+	for shardID := 1; shardID <= chain.epoch.NofShards; shardID++ {
+		from := chain.epoch.Height + 1
+		if head := chain.heads[shardID]; head != nil && head.Height >= from {
+			from = head.Height + 1
+		}
+		count := uint32(LIGHT_HEADER_RANGE)
+		if upTo > 0 {
+			if upTo <= from {
+				continue
+			}
+			count = upTo - from
+		}
+		ranges = append(ranges, blockRange{shardID, from, count})
+	}
+
+	for _, headers := range headerSource.sync(ranges) {
+		for _, header := range headers {
+			if err := chain.verifyHeader(header); err != nil {
+				//Headers above the next epoch block link to it, they are accepted once it is
+				if err != errNotLinked {
+					logger.Warn("Block header rejected", "hash", header.Hash[0:8], "height", header.Height, "shard", header.ShardId, "error", err)
+					p2p.ReportInvalid(header.HashBlock(), p2p.MISBEHAVIOR_INVALID_BLOCK)
+				}
+				break
+			}
+
+			chain.accept(header)
+			if header.MayContain(chain.wallet) {
+				matches = append(matches, header)
+			}
+		}
+	}
+
+	return matches
+}
+
+func (chain *lightChain) verifyHeader(header *protocol.Block) error {
+	head := chain.heads[header.ShardId]
+	if header.Height <= chain.epoch.Height || header.PrevHash != chain.epoch.Hash && (head == nil || header.PrevHash != head.Hash) {
+		return errNotLinked
+	}
+
+	if header.HashBlockHeader() != header.Hash {
+		return errors.New("hash does not match")
+	}
+
+	acc, err := lightValidator(chain.epoch.ValMapping, chain.accounts, header.ShardId, header.Beneficiary, header.Height, header.CommitmentProof)
+	if err != nil {
+		return err
+	}
+
+	//Accepted headers are stored as closed blocks, the previous proofs are found like on a miner
+	prevProofs := GetLatestProofs(ActiveParameters.num_included_prev_proofs, header)
+	if !validateProofOfStake(chain.target(header.ShardId).difficulty, prevProofs, header.Height, acc.Balance, header.CommitmentProof, header.Timestamp) {
+		return errors.New("proof of stake not valid")
+	}
+
+	return nil
+}
+
+func (chain *lightChain) accept(header *protocol.Block) {
+	chain.heads[header.ShardId] = header
+	chain.target(header.ShardId).collect(header.Timestamp)
+	storage.WriteClosedBlock(header)
+	logger.Debug("Accepted block header", "hash", header.Hash[0:8], "height", header.Height, "shard", header.ShardId)
+}
+
+func (chain *lightChain) target(shardID int) *lightTarget {
+	if chain.targets[shardID] == nil {
+		chain.targets[shardID] = &lightTarget{difficulty: INITIAL_DIFFICULTY, count: -1}
+	}
+
+	return chain.targets[shardID]
+}
+
+//Same as collectStatistics, for the headers of a shard.
+func (target *lightTarget) collect(timestamp int64) {
+	target.count++
+	if target.count < int64(ActiveParameters.Diff_interval) {
+		return
+	}
+
+	target.last = timestamp
+	if target.first != 0 {
+		target.difficulty = adjustDifficulty(&target.timerange, target.difficulty)
+	}
+	target.count = 0
+	target.first = timestamp
+}
+
+//Downloads the blocks of the given headers. A block is only kept if it hashes to its header and its transactions to
+//its Merkle root.
+func (chain *lightChain) fetchBlocks(headers []*protocol.Block) {
+	if len(headers) == 0 {
+		return
+	}
+
+	var ranges []blockRange
+	for _, header := range headers {
+		ranges = append(ranges, blockRange{header.ShardId, header.Height, 1})
+	}
+
+	for i, blocks := range blockSource.sync(ranges) {
+		header := headers[i]
+		if len(blocks) == 0 {
+			logger.Warn("Block of the wallet not found", "hash", header.Hash[0:8], "height", header.Height, "shard", header.ShardId)
+			continue
+		}
+
+		block := blocks[0]
+		if block.Hash != header.Hash || block.HashBlockHeader() != header.Hash || protocol.BuildMerkleTree(block).MerkleRoot() != block.MerkleRoot {
+			logger.Warn("Block does not match its header", "hash", header.Hash[0:8], "height", header.Height, "shard", header.ShardId)
+			p2p.ReportInvalid(block.HashBlock(), p2p.MISBEHAVIOR_INVALID_BLOCK)
+			continue
+		}
+
+		storage.WriteClosedBlock(block)
+		logger.Info("Fetched block of the wallet", "hash", block.Hash[0:8], "height", block.Height, "shard", block.ShardId)
+	}
+}
+
+//Returns the account of the beneficiary if it is a validator of the shard that signed the height with its commitment
+//key, like ValidateBlockSender.
+func lightValidator(mapping *protocol.ValShardMapping, accounts map[[32]byte]*protocol.Account, shardID int, beneficiary [32]byte, height uint32, commitmentProof [crypto.COMM_PROOF_LENGTH]byte) (*protocol.Account, error) {
+	assigned := false
+	if mapping != nil {
+		for address, shard := range mapping.ValMapping {
+			if shard == shardID && protocol.SerializeHashContent(address) == beneficiary {
+				assigned = true
+				break
+			}
+		}
+	}
+	if !assigned {
+		return nil, errors.New(fmt.Sprintf("beneficiary %x is not a validator of shard %v", beneficiary[0:8], shardID))
+	}
+
+	acc := accounts[beneficiary]
+	if acc == nil || !acc.IsStaking {
+		return nil, errors.New(fmt.Sprintf("beneficiary %x is not staking", beneficiary[0:8]))
+	}
+
+	commitmentPubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitmentKey)
+	if err != nil {
+		return nil, errors.New("Invalid commitment key in account.")
+	}
+
+	if err := crypto.VerifyMessageWithRSAKey(commitmentPubKey, fmt.Sprint(height), commitmentProof); err != nil {
+		return nil, errors.New("The submitted commitment proof can not be verified.")
+	}
+
+	return acc, nil
+}
+
+//Asks every miner for the epoch block header with the given hash, or for its last one if the hash is nil.
+func requestEpochHeaders(miners []string, hash []byte) (epochBlocks []*protocol.EpochBlock) {
+	//Drop answers to an earlier request
+	for len(p2p.EpochBlockHeaderChan) > 0 {
+		<-p2p.EpochBlockHeaderChan
+	}
+
+	requested := 0
+	for _, miner := range miners {
+		if p2p.EpochBlockHeaderReq(miner, hash) == nil {
+			requested++
+		}
+	}
+
+	timeout := time.After(SYNC_TIMEOUT * time.Second)
+	for len(epochBlocks) < requested {
+		select {
+		case encoded := <-p2p.EpochBlockHeaderChan:
+			var epochBlock *protocol.EpochBlock
+			if epochBlock = epochBlock.Decode(encoded); epochBlock != nil {
+				epochBlocks = append(epochBlocks, epochBlock)
+			}
+		case <-timeout:
+			return epochBlocks
+		}
+	}
+
+	return epochBlocks
+}
+
+//Fetches the accounts of the validators and the committee leader of the epoch block with account proofs. Miners only
+//prove accounts of their last closed epoch block, proofs of other epoch blocks are ignored.
+func proveAccounts(miners []string, epochBlock *protocol.EpochBlock) (map[[32]byte]*protocol.Account, error) {
+	missing := map[[32]byte]bool{epochBlock.CommitteeLeader: true}
+	if epochBlock.ValMapping != nil {
+		for address := range epochBlock.ValMapping.ValMapping {
+			missing[protocol.SerializeHashContent(address)] = true
+		}
+	}
+
+	//Drop answers to an earlier request
+	for len(p2p.AccProofChan) > 0 {
+		<-p2p.AccProofChan
+	}
+
+	accounts := make(map[[32]byte]*protocol.Account)
+	for _, miner := range miners {
+		for hash := range missing {
+			p2p.AccProofReq(miner, hash)
+		}
+
+		timeout := time.After(SYNC_TIMEOUT * time.Second)
+	WAIT:
+		for len(missing) > 0 {
+			select {
+			case encoded := <-p2p.AccProofChan:
+				var proof *protocol.AccountProof
+				if proof = proof.Decode(encoded); proof == nil || proof.EpochBlockHash != epochBlock.Hash {
+					continue
+				}
+				if !protocol.VerifyAccountProof(epochBlock.MerklePatriciaRoot, proof) {
+					p2p.ReportInvalidPayload(encoded, p2p.MISBEHAVIOR_INVALID_STATE_TRANSITION)
+					continue
+				}
+				hash := proof.Account.Hash()
+				if missing[hash] {
+					accounts[hash] = &proof.Account
+					delete(missing, hash)
+				}
+			case <-timeout:
+				break WAIT
+			}
+		}
+
+		if len(missing) == 0 {
+			return accounts, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("%v accounts could not be proven", len(missing)))
+}
@@ -0,0 +1,66 @@
+package miner
+
+import (
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"testing"
+)
+
+func TestLightVerifyHeader(t *testing.T) {
+	validator := *accA
+	validator.IsStaking = true
+	hashValidator := protocol.SerializeHashContent(validator.Address)
+
+	epochBlock := protocol.NewEpochBlock(nil, 10)
+	epochBlock.Hash = [32]byte{10}
+	epochBlock.NofShards = 1
+	epochBlock.ValMapping = protocol.NewMapping()
+	epochBlock.ValMapping.ValMapping[validator.Address] = 1
+
+	chain := newLightChain(nil)
+	chain.epoch = epochBlock
+	chain.accounts[hashValidator] = &validator
+	//Any proof of stake is valid
+	chain.target(1).difficulty = 0
+
+	header := protocol.NewBlock(epochBlock.Hash, 11)
+	header.ShardId = 1
+	header.Beneficiary = hashValidator
+	header.CommitmentProof, _ = crypto.SignMessageWithRSAKey(CommPrivKeyAccA, "11")
+	header.Hash = header.HashBlockHeader()
+	if err := chain.verifyHeader(header); err != nil {
+		t.Fatalf("Valid header rejected: %v\n", err)
+	}
+	chain.accept(header)
+	defer storage.DeleteClosedBlock(header.Hash)
+
+	//Headers have to link to the accepted ones
+	next := protocol.NewBlock([32]byte{0xff}, 12)
+	next.ShardId = 1
+	if err := chain.verifyHeader(next); err != errNotLinked {
+		t.Errorf("Unlinked header not detected: %v\n", err)
+	}
+
+	next.PrevHash = header.Hash
+	next.Beneficiary = hashValidator
+	next.CommitmentProof = header.CommitmentProof
+	next.Hash = next.HashBlockHeader()
+	if err := chain.verifyHeader(next); err == nil {
+		t.Errorf("Header with commitment proof of another height accepted\n")
+	}
+
+	next.CommitmentProof, _ = crypto.SignMessageWithRSAKey(CommPrivKeyAccA, "12")
+	next.MerkleRoot = [32]byte{12}
+	if err := chain.verifyHeader(next); err == nil {
+		t.Errorf("Header with wrong hash accepted\n")
+	}
+
+	//Shard 2 starts after the epoch block
+	next.ShardId = 2
+	next.PrevHash = epochBlock.Hash
+	next.Hash = next.HashBlockHeader()
+	if err := chain.verifyHeader(next); err == nil || err == errNotLinked {
+		t.Errorf("Header of a shard the validator is not assigned to accepted\n")
+	}
+}
@@ -66,14 +66,14 @@ func getBlockSequences(newBlock *protocol.Block) (blocksToRollback, blocksToVali
 			break
 		}
 		blocksToRollback = append(blocksToRollback, tmpBlock)
-		logger.Printf("Added block (%x) to rollback blocks\n",tmpBlock.Hash[0:8])
+		logger.Debug("Block to roll back", "hash", tmpBlock.Hash[0:8], "height", tmpBlock.Height)
 		//The block needs to be in closed storage.
 		tmpBlockNewHash := tmpBlock.PrevHash
 		tmpBlock = storage.ReadClosedBlock(tmpBlockNewHash)
 		if(tmpBlock != nil){
-			logger.Printf("New tmpBlock: (%x)\n",tmpBlock.Hash[0:8])
+			logger.Debug("Previous block found", "hash", tmpBlock.Hash[0:8], "height", tmpBlock.Height)
 		} else {
-			logger.Printf("tmpBlock is nil. No Block found in closed storage for hash: (%x)\n",tmpBlockNewHash[0:8])
+			logger.Debug("Previous block not in closed storage", "hash", tmpBlockNewHash[0:8])
 			if(ancestorHash == storage.ReadLastClosedEpochBlock().Hash){
 				break
 			}
@@ -88,8 +88,7 @@ func getBlockSequences(newBlock *protocol.Block) (blocksToRollback, blocksToVali
 		//New chain is longer, rollback and validate new chain.
 		if len(blocksToRollback) != 0 {
 
-			logger.Printf("Rollback (blocks to rollback %d vs block of new chain %d)", len(blocksToRollback), len(newChain))
-			logger.Printf("ANCESTOR: %x", ancestorHash[0:8])
+			logger.Info("Rolling back to a longer chain", "rollback", len(blocksToRollback), "newChain", len(newChain), "ancestor", ancestorHash[0:8])
 
 		}
 		return blocksToRollback, newChain, nil
@@ -161,12 +160,18 @@ func getNewChain(newBlock *protocol.Block) (ancestor [32]byte, newChain []*proto
 			continue
 		}
 
+		//Fetch all blocks we missed at once, the loop continues with them from the received stash
+		if prevBlock := syncMissingBlocks(newBlock); prevBlock != nil {
+			newBlock = prevBlock
+			continue
+		}
+
 		//Fetch the block we apparently missed from the network.
 		//p2p.BlockReq(newBlock.PrevHash, newBlock.PrevHashWithoutTx)
 		requestHash := newBlock.PrevHash
 		//Todo change the call back to request both blocks at once
 //		requestHashWithoutTx := newBlock.PrevHashWithoutTx
-		logger.Printf("Getting previous block. But I think the previous block is an Epoch Block.")
+		logger.Debug("Requesting previous block", "hash", requestHash[0:8], "height", newBlock.Height-1)
 		p2p.BlockReq(requestHash, requestHash)
 
 		//Blocking wait
@@ -176,12 +181,12 @@ func getNewChain(newBlock *protocol.Block) (ancestor [32]byte, newChain []*proto
 			storage.WriteToReceivedStash(newBlock)
 		//Limit waiting time to BLOCKFETCH_TIMEOUT seconds before aborting.
 		case <-time.After(BLOCKFETCH_TIMEOUT * time.Second):
-			logger.Printf("Timed Out fetching %x in longestChain -> Search in received Block stash", requestHash)
+			logger.Debug("Timed out fetching block, searching the received block stash", "hash", requestHash[0:8])
 			if p2p.BlockAlreadyReceived(storage.ReadReceivedBlockStash(), requestHash) {
 				for _, block := range storage.ReadReceivedBlockStash() {
 					if block.Hash == requestHash {
 						newBlock = block
-						logger.Printf("Block %x was in Received Block Stash", requestHash)
+						logger.Debug("Block found in the received block stash", "hash", requestHash[0:8])
 						break
 					}
 				}
@@ -193,3 +198,25 @@ func getNewChain(newBlock *protocol.Block) (ancestor [32]byte, newChain []*proto
 	return [32]byte{}, nil
 
 }
+
+//Downloads the blocks between our last closed block and the new block and writes them to the received stash. Returns
+//the block the new block builds on, nil if no miner sent it.
+func syncMissingBlocks(newBlock *protocol.Block) *protocol.Block {
+	from := lastEpochBlock.Height + 1
+	if lastClosedBlock := storage.ReadLastClosedBlock(); lastClosedBlock != nil && lastClosedBlock.Height >= from {
+		from = lastClosedBlock.Height + 1
+	}
+	if newBlock.Height <= from {
+		return nil
+	}
+
+	var prevBlock *protocol.Block
+	for _, block := range syncBlocks([]blockRange{{newBlock.ShardId, from, newBlock.Height - from}})[0] {
+		storage.WriteToReceivedStash(block)
+		if block.Hash == newBlock.PrevHash {
+			prevBlock = block
+		}
+	}
+
+	return prevBlock
+}
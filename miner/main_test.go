@@ -8,11 +8,11 @@ import (
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
 	"io/ioutil"
-	"log"
 	"math/big"
 	"os"
 	"testing"
 
+	"github.com/oigele/bazo-miner/logging"
 	"github.com/oigele/bazo-miner/p2p"
 	"github.com/oigele/bazo-miner/protocol"
 	"github.com/oigele/bazo-miner/storage"
@@ -249,8 +249,8 @@ func TestMain(m *testing.M) {
 	addTestingAccounts()
 	addRootAccounts()
 	//We don't want logging msgs when testing, we have designated messages
-	logger = log.New(nil, "", 0)
-	logger.SetOutput(ioutil.Discard)
+	logging.SetOutput(ioutil.Discard)
+	logger = logging.New("miner")
 	retCode := m.Run()
 
 	//Teardown
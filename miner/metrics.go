@@ -0,0 +1,91 @@
+package miner
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/oigele/bazo-miner/metrics"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+//Heights of the last closed block and epoch block, the miner publishes them when it closes a block or takes over an
+//epoch block. The gauges are read by the metrics server, which must not read lastBlock and lastEpochBlock.
+var (
+	publishedBlockHeight uint32
+	publishedEpochHeight uint32
+	publishedShardID     int32
+	//0 until the miner closed a block of its shard
+	publishedBlockSet uint32
+)
+
+var (
+	aggregatedTxsMetric = metrics.NewCounter("miner_aggregated_txs_total", "Number of funds transactions aggregated into an AggTx.")
+	aggTxsMetric        = metrics.NewCounter("miner_aggtxs_total", "Number of AggTx created.")
+
+	aggregationRatioMetric = metrics.NewGaugeFunc("miner_aggregation_ratio", "Average number of funds transactions per AggTx.", func() float64 {
+		if aggTxs := aggTxsMetric.Value(); aggTxs > 0 {
+			return float64(aggregatedTxsMetric.Value()) / float64(aggTxs)
+		}
+		return 0
+	})
+
+	blockHeightMetric = metrics.NewGaugeVecFunc("block_height", "Height of the last block seen per shard.", "shard", blockHeightPerShard)
+
+	epochHeightMetric = metrics.NewGaugeFunc("epoch_height", "Height of the last epoch block.", func() float64 {
+		return float64(atomic.LoadUint32(&publishedEpochHeight))
+	})
+
+	mempoolSizeMetric = metrics.NewGaugeVecFunc("mempool_size", "Number of transactions in the mempools.", "pool", func() map[string]float64 {
+		return map[string]float64{
+			"open":     float64(storage.GetMemPoolSize()),
+			"assigned": float64(storage.GetAssignedMemPoolSize()),
+			"invalid":  float64(storage.GetINVALIDMemPoolSize()),
+		}
+	})
+
+	stateStashSizeMetric = metrics.NewGaugeFunc("received_state_stash_size", "Number of state transitions in the received state stash.", func() float64 {
+		return float64(storage.ReceivedStateStash.Len())
+	})
+
+	shardBlockStashSizeMetric = metrics.NewGaugeFunc("received_shard_block_stash_size", "Number of blocks in the received shard block stash.", func() float64 {
+		return float64(storage.ReceivedShardBlockStash.Len())
+	})
+)
+
+//Validators know the height of their own shard, the committee the heights of the shard blocks it received.
+func blockHeightPerShard() map[string]float64 {
+	heights := make(map[string]float64)
+	for shardID, height := range protocol.ReturnHeightPerShard(storage.ReceivedShardBlockStash) {
+		heights[strconv.Itoa(shardID)] = float64(height)
+	}
+
+	if atomic.LoadUint32(&publishedBlockSet) == 1 {
+		shard := strconv.Itoa(int(atomic.LoadInt32(&publishedShardID)))
+		if height := float64(atomic.LoadUint32(&publishedBlockHeight)); height > heights[shard] {
+			heights[shard] = height
+		}
+	}
+
+	return heights
+}
+
+//Called with the new last block whenever the miner closes or rolls back a block.
+func publishBlockHeight(b *protocol.Block) {
+	if b == nil || b == dummyLastBlock {
+		return
+	}
+
+	atomic.StoreUint32(&publishedBlockHeight, b.Height)
+	atomic.StoreInt32(&publishedShardID, int32(storage.ThisShardID))
+	atomic.StoreUint32(&publishedBlockSet, 1)
+}
+
+//Called with the new last epoch block whenever the miner closes or takes over an epoch block.
+func publishEpochHeight(b *protocol.EpochBlock) {
+	if b == nil {
+		return
+	}
+
+	atomic.StoreUint32(&publishedEpochHeight, b.Height)
+}
@@ -21,9 +21,8 @@ func incomingData() {
 func incomingEpochData() {
 	for {
 		//receive Epoch Block
-		logger.Printf("Listening to incoming epoch blocks...")
+		logger.Debug("Listening to incoming epoch blocks")
 		epochBlock := <-p2p.EpochBlockIn
-		logger.Printf("Retrieved Epoch block from channel EpochBlockIn.\n")
 		processEpochBlock(epochBlock)
 	}
 }
@@ -51,6 +50,29 @@ func incomingCommitteeCheck() {
 	}
 }
 
+//Constantly listen to the proposals and votes of the validators of the shard, see bft.go
+func incomingProposals() {
+	for {
+		proposal := <- p2p.ProposalIn
+		processProposal(proposal)
+	}
+}
+
+func incomingVotes() {
+	for {
+		vote := <- p2p.VoteIn
+		processVote(vote)
+	}
+}
+
+//Constantly listen to the endorsements of the committee, see endorsement.go
+func incomingEndorsements() {
+	for {
+		endorsement := <- p2p.EndorsementIn
+		processEndorsement(endorsement)
+	}
+}
+
 func incomingFineTx() {
 	for {
 		fineTx := <- p2p.FineTxIn
@@ -63,20 +85,29 @@ func processEpochBlock(eb []byte) {
 	epochBlock = epochBlock.Decode(eb)
 
 	if(storage.ReadClosedEpochBlock(epochBlock.Hash) != nil){
-		logger.Printf("Received Epoch Block (%x) already in storage\n", epochBlock.Hash[0:8])
+		logger.Debug("Received epoch block already in storage", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height)
 		p2p.EpochBlockReceivedChan <- *epochBlock
 		return
 	} else {
 		if !storage.IsCommittee {
 			//only take the epoch block if it's actually the following epoch block. If not, dont take it yet. It will be rebroadcasted later anyways
-			if lastEpochBlock == nil || epochBlock.Height == lastBlock.Height + 1 {
-				logger.Printf("Received Epoch Block: %v\n", epochBlock.String())
+			//Validators on standby mine no blocks and wait for the epoch block after the last one, see resharding.go
+			if lastEpochBlock == nil || epochBlock.Height == lastBlock.Height + 1 ||
+				(storage.ThisShardID == 0 && epochBlock.Height == lastEpochBlock.Height+uint32(ActiveParameters.Epoch_length)+1) {
+				logger.Info("Received epoch block", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "shards", epochBlock.NofShards)
+				//The state is persisted with the epoch block, it is derived before the previous one is replaced
+				state, err := epochBlockState(epochBlock)
+				if err != nil {
+					logger.Warn("State of received epoch block not available", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "error", err)
+					return
+				}
 				storage.WriteClosedEpochBlock(epochBlock)
 
 				storage.DeleteAllLastClosedEpochBlock()
-				storage.WriteLastClosedEpochBlock(epochBlock)
+				storage.WriteLastClosedEpochBlock(epochBlock, state)
 
 				lastEpochBlock = epochBlock
+				publishEpochHeight(lastEpochBlock)
 
 				p2p.EpochBlockReceivedChan <- *lastEpochBlock
 
@@ -84,11 +115,17 @@ func processEpochBlock(eb []byte) {
 			}
 		} else {
 			//dont immediately take all attributes from the epoch block to local memory
-			logger.Printf("Received Epoch Block: %v\n", epochBlock.String())
+			logger.Info("Received epoch block", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "shards", epochBlock.NofShards)
+			state, err := epochBlockState(epochBlock)
+			if err != nil {
+				logger.Warn("State of received epoch block not available", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "error", err)
+				return
+			}
 			lastEpochBlock = epochBlock
+			publishEpochHeight(lastEpochBlock)
 			storage.WriteClosedEpochBlock(epochBlock)
 			storage.DeleteAllLastClosedEpochBlock()
-			storage.WriteLastClosedEpochBlock(epochBlock)
+			storage.WriteLastClosedEpochBlock(epochBlock, state)
 			broadcastEpochBlock(lastEpochBlock)
 		}
 	}
@@ -97,16 +134,15 @@ func processEpochBlock(eb []byte) {
 func processStateData(payload []byte) {
 	var stateTransition *protocol.StateTransition
 	stateTransition = stateTransition.DecodeTransition(payload)
+	p2p.LinkSender(payload, stateTransition.HashTransition())
 	if(lastEpochBlock != nil){
 		//removed the check whether the shard id is the same as the id now. This will never lead to any inconsistencies and makes it easier to handle state transitions which reach over an epoch block.
 			stateHash := stateTransition.HashTransition()
 			if (storage.ReceivedStateStash.StateTransitionIncluded(stateHash) == false){
-				logger.Printf("Writing state to stash Shard ID: %v  VS my shard ID: %v - Height: %d - Hash: %x\n",stateTransition.ShardID,storage.ThisShardID,stateTransition.Height,stateHash[0:8])
+				logger.Debug("Received state transition", "hash", stateHash[0:8], "shard", stateTransition.ShardID, "height", stateTransition.Height)
 				storage.ReceivedStateStash.Set(stateHash,stateTransition)
-				logger.Printf("Length state stash map: %d\n",len(storage.ReceivedStateStash.M))
-				logger.Printf("Length state stash keys: %d\n",len(storage.ReceivedStateStash.Keys))
 			} else {
-				logger.Printf("Received state transition already included: Shard ID: %v  VS my shard ID: %v - Height: %d - Hash: %x\n",stateTransition.ShardID,storage.ThisShardID,stateTransition.Height,stateHash[0:8])
+				logger.Debug("Received state transition already in the stash", "hash", stateHash[0:8], "shard", stateTransition.ShardID, "height", stateTransition.Height)
 			}
 	}
 }
@@ -118,10 +154,10 @@ func processCommitteeCheck(payload []byte) {
 	if lastEpochBlock != nil {
 		checkHash := committeeCheck.HashCommitteCheck()
 		if storage.ReceivedCommitteeCheckStash.CommitteeCheckIncluded(checkHash) == false {
-			logger.Printf("Writing committee check to stash. Height: %d, Sender: %x", committeeCheck.Height, committeeCheck.Sender[0:8])
+			logger.Debug("Received committee check", "height", committeeCheck.Height, "sender", committeeCheck.Sender[0:8])
 			storage.ReceivedCommitteeCheckStash.Set(checkHash, committeeCheck)
 		} else {
-			logger.Printf("Received committee check already included")
+			logger.Debug("Received committee check already in the stash", "height", committeeCheck.Height, "sender", committeeCheck.Sender[0:8])
 		}
 	}
 }
@@ -142,17 +178,17 @@ func processAssignmentData(payload []byte) {
 	if !storage.IsCommittee {
 		if lastEpochBlock != nil && transactionAssignment.ShardID == storage.ThisShardID {
 			//got the desired transaction assignment. write it to the channel which will be consumed after epoch block reception
-			logger.Printf("received the transaction assignment from a broadcast. writing to request channel")
+			logger.Debug("Received transaction assignment", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height)
 			p2p.TransactionAssignmentReqChan <- payload
 		}
 		//is committee. Store all assignments
 	} else {
 		if lastEpochBlock != nil {
 			if !storage.ReceivedTransactionAssignmentStash.TransactionAssignmentIncluded(transactionAssignment.HashTransactionAssignment()) {
-				logger.Printf("Writing transaction assignment to stash. Height: %d, ShardID: %d", transactionAssignment.Height, transactionAssignment.ShardID)
+				logger.Debug("Received transaction assignment", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height)
 				storage.ReceivedTransactionAssignmentStash.Set(transactionAssignment.HashTransactionAssignment(), transactionAssignment)
 			} else {
-				logger.Printf("Received transaction assignment already included")
+				logger.Debug("Received transaction assignment already in the stash", "shard", transactionAssignment.ShardID, "height", transactionAssignment.Height)
 			}
 		}
 	}
@@ -162,25 +198,29 @@ func processAssignmentData(payload []byte) {
 func processBlock(payload []byte) {
 	var block *protocol.Block
 	block = block.Decode(payload)
+	if block == nil || block.Hash == [32]byte{} {
+		p2p.ReportInvalidPayload(payload, p2p.MISBEHAVIOR_UNDECODABLE)
+		return
+	}
 	blockHash := block.HashBlock()
+	p2p.LinkSender(payload, blockHash)
 
 
 	if storage.IsCommittee {
 		if (lastEpochBlock != nil) {
-			logger.Printf("Received block (%x) from shard %d with height: %d\n", block.Hash[0:8], block.ShardId, block.Height)
+			logger.Debug("Received shard block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height)
 			if storage.ReceivedShardBlockStash.BlockIncluded(blockHash) == false {
-				logger.Printf("Writing block to stash Shard ID: %v  - Height: %d - Hash: %x\n", block.ShardId, block.Height, blockHash[0:8])
 				storage.ReceivedShardBlockStash.Set(blockHash, block)
 			}
 		} else {
-			logger.Printf("Received block (%x) already in block stash\n", block.Hash[0:8])
+			logger.Debug("Shard block received before the epoch block", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height)
 		}
 	}
 }
 
 
 func broadcastEpochBlock(epochBlock *protocol.EpochBlock) {
-	logger.Printf("broadcasting an epoch block")
+	logger.Debug("Broadcasting epoch block", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height)
 	p2p.EpochBlockOut <- epochBlock.Encode()
 }
 
@@ -188,6 +228,18 @@ func broadcastStateTransition(st *protocol.StateTransition) {
 	p2p.StateTransitionOut <- st.EncodeTransition()
 }
 
+func broadcastProposal(proposal *protocol.Proposal) {
+	p2p.ProposalOut <- proposal.Encode()
+}
+
+func broadcastVote(vote *protocol.Vote) {
+	p2p.VoteOut <- vote.Encode()
+}
+
+func broadcastEndorsement(endorsement *protocol.Endorsement) {
+	p2p.EndorsementOut <- endorsement.Encode()
+}
+
 
 //here Kürsat's code ends
 
@@ -210,7 +262,14 @@ func broadcastBlock(block *protocol.Block) {
 	//Make a deep copy of the block (since it is a pointer and will be saved to db later).
 	//Otherwise the block's bloom filter is initialized on the original block.
 	var blockCopy = *block
-	//blockCopy.InitBloomFilter(append(storage.GetTxPubKeys(&blockCopy)))
+	txPubKeys := storage.GetTxPubKeys(&blockCopy)
+	//Receivers of cross-shard transfers are credited by the receipts, not by a transaction of the block
+	if receipts, err := creditedReceipts(block); err == nil {
+		for _, receipt := range receipts {
+			txPubKeys = append(txPubKeys, receipt.To)
+		}
+	}
+	blockCopy.InitBloomFilter(txPubKeys)
 	p2p.BlockHeaderOut <- blockCopy.EncodeHeader()
 }
 
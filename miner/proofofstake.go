@@ -128,11 +128,11 @@ func proofOfStake(diff uint8,
 		// lastBlock is a global variable which points to the last block. This check makes sure we abort if another
 		// block has been validated
 		cnt = cnt + 1
-		logger.Printf("Try Block with Time: %v and cnt: %v", time.Now().Format("030405"), cnt)
+		logger.Debug("Trying to mine block", "height", height, "attempt", cnt)
 
 		//If 30 blocks should have been received, break
 		if cnt >= 30 * BLOCK_INTERVAL {
-			logger.Printf("Mined %v sec and no block validated...? --> Strange... ", 30*BLOCK_INTERVAL)
+			logger.Warn("No block validated while mining", "height", height, "seconds", 30*BLOCK_INTERVAL)
 			return -1, errors.New("Abort mining, Mined too long")
 		}
 
@@ -149,13 +149,13 @@ func proofOfStake(diff uint8,
 		/*if (prevBlockIsEpochBlock == true || FirstStartAfterEpoch == true){
 			//if(lastBlock.Height == lastEpochBlock.Height + 1 && lastBlock.ShardId == storage.ThisShardID){
 			if(lastBlock.PrevHash == lastEpochBlock.Hash && lastBlock.ShardId == storage.ThisShardID){
-				logger.Printf("Abort mining after epoch block, another block has been successfully validated in the meantime")
+				logger.Debug("Abort mining after epoch block, another block has been validated in the meantime", "height", height)
 				return -2, errors.New("Abort mining after epoch block, another block has been successfully validated in the meantime")
 			}
 		} else {
 			//if prevHash != lastBlock.Hash && lastBlock.ShardId == storage.ThisShardID{
 			if prevHash != lastBlock.Hash{
-				logger.Printf("Abort mining, another block has been successfully validated in the meantime")
+				logger.Debug("Abort mining, another block has been validated in the meantime", "height", height)
 				return -2, errors.New("Abort mining, another block has been successfully validated in the meantime")
 			}
 		}*/
@@ -313,7 +313,7 @@ func proofOfStakeEpoch(diff uint8,
 		// lastBlock is a global variable which points to the last block. This check makes sure we abort if another
 		// block has been validated
 		if prevHashEpochBlock != lastEpochBlock.Hash {
-			logger.Printf("Abort mining EPOCH BLOCK, another one has been successfully validated in the meantime")
+			logger.Debug("Abort mining epoch block, another one has been validated in the meantime", "height", height)
 			return -1, errors.New("Abort mining EPOCH BLOCK, another one has been successfully validated in the meantime")
 		}
 
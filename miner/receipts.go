@@ -0,0 +1,235 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+//Cross-shard transfers, see protocol/receipt.go. The shard of the sender debits the sender and commits a receipt with
+//the ReceiptsRoot of its block. Shard 1 collects the receipts of all shards from the state transitions into the epoch
+//block. The shard the receiver is assigned to in the next epoch credits them in its first block after the epoch
+//block, which lists their hashes in its ReceiptData. The receiver's balance therefore travels with the state
+//transition of the receiving shard instead of the one of the sending shard.
+//Receipts don't carry the address of the receiver, so its account can't be created when the receipt is credited. The
+//sending shard therefore rejects transfers to accounts that are not in the state, and a receipt to an unknown receiver
+//is invalid wherever it is credited.
+
+//A funds transaction is a cross-shard transfer if its receiver is assigned to another shard than the transaction.
+//Contract calls are only executed if the contract is assigned to the shard of the sender, they are therefore never
+//cross-shard transfers.
+func isCrossShard(tx *protocol.FundsTx) bool {
+	return NumberOfShards > 1 && assignTransactionToShard(tx) != assignAddressToShard(tx.To)
+}
+
+//Hashes of the transactions the receipts were emitted for. The receipts committed in a block record which of its funds
+//transactions are cross-shard transfers, such that the state change and its rollback do not depend on the current
+//number of shards.
+func receiptTxHashes(receipts []*protocol.Receipt) map[[32]byte]bool {
+	hashes := make(map[[32]byte]bool)
+	for _, receipt := range receipts {
+		hashes[receipt.TxHash] = true
+	}
+
+	return hashes
+}
+
+//Receipts of the cross-shard transfers among the funds transactions of the block, in the order of the block.
+func blockReceipts(block *protocol.Block, fundsTxs []*protocol.FundsTx) (receipts []*protocol.Receipt) {
+	for _, tx := range fundsTxs {
+		if isCrossShard(tx) {
+			receipts = append(receipts, protocol.NewReceipt(tx, block.ShardId, block.Height))
+		}
+	}
+
+	return receipts
+}
+
+//The funds transactions of a block being mined are taken from the assignment of the shard.
+func assignedFundsTxs(block *protocol.Block) (fundsTxs []*protocol.FundsTx) {
+	for _, txHash := range block.FundsTxData {
+		if tx, ok := storage.ReadAssignedTx(txHash).(*protocol.FundsTx); ok {
+			fundsTxs = append(fundsTxs, tx)
+		}
+	}
+
+	return fundsTxs
+}
+
+//Receipts the epoch block delivers to the given shard, in the order of the epoch block. The receiving shard is the one
+//the receiver is assigned to with the number of shards of the epoch block, i.e. of the epoch the receipts are credited in.
+func receiptsForShard(epochBlock *protocol.EpochBlock, shardId int) (receipts []*protocol.Receipt) {
+	for _, receipt := range epochBlock.Receipts {
+		if assignAddressToShardOf(receipt.To, epochBlock.NofShards) == shardId {
+			receipts = append(receipts, receipt)
+		}
+	}
+
+	return receipts
+}
+
+//Only the first block after an epoch block credits receipts, and it has to credit all receipts delivered to its shard.
+func expectedCredits(block *protocol.Block) (receipts []*protocol.Receipt, err error) {
+	epochBlock := storage.ReadClosedEpochBlock(block.PrevHash)
+	if epochBlock == nil {
+		if len(block.ReceiptData) > 0 {
+			return nil, errors.New(fmt.Sprintf("Block (%x) credits receipts, but does not follow an epoch block.", block.Hash[0:8]))
+		}
+		return nil, nil
+	}
+
+	return receiptsForShard(epochBlock, block.ShardId), nil
+}
+
+//Returns the receipts the block credits, in the order of its ReceiptData.
+func creditedReceipts(block *protocol.Block) ([]*protocol.Receipt, error) {
+	expected, err := expectedCredits(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(expected) != len(block.ReceiptData) {
+		return nil, errors.New(fmt.Sprintf("Block (%x) credits %v receipts, but %v were delivered to shard %v.", block.Hash[0:8], len(block.ReceiptData), len(expected), block.ShardId))
+	}
+	for i, receipt := range expected {
+		if receipt.Hash() != block.ReceiptData[i] {
+			return nil, errors.New(fmt.Sprintf("Block (%x) credits receipt %x, which was not delivered to shard %v.", block.Hash[0:8], block.ReceiptData[i][0:8], block.ShardId))
+		}
+	}
+
+	return expected, nil
+}
+
+//Checks that the block commits to the receipts of its cross-shard transfers and credits the receipts delivered to its
+//shard. Cross-shard transfers are not aggregated, the receipts are only built from the funds transactions of the block.
+func validateReceipts(block *protocol.Block, fundsTxs []*protocol.FundsTx, aggregatedFundsTxs []*protocol.FundsTx) (receipts []*protocol.Receipt, credited []*protocol.Receipt, err error) {
+	for _, tx := range aggregatedFundsTxs {
+		if isCrossShard(tx) {
+			return nil, nil, errors.New(fmt.Sprintf("Cross-shard transfer %x is aggregated.", tx.Hash()))
+		}
+	}
+
+	receipts = blockReceipts(block, fundsTxs)
+	if root := protocol.BuildReceiptsMerkleTree(receipts).MerkleRoot(); root != block.ReceiptsRoot {
+		return nil, nil, errors.New(fmt.Sprintf("Receipts root of block (%x) is %x, but its receipts have root %x.", block.Hash[0:8], block.ReceiptsRoot[0:8], root[0:8]))
+	}
+
+	if credited, err = creditedReceipts(block); err != nil {
+		return nil, nil, err
+	}
+
+	return receipts, credited, nil
+}
+
+//The epoch block has to commit to the receipts it delivers.
+func validateEpochReceipts(b *protocol.EpochBlock) error {
+	if root := protocol.BuildReceiptsMerkleTree(b.Receipts).MerkleRoot(); root != b.ReceiptsRoot {
+		return errors.New(fmt.Sprintf("Receipts root of epoch block (%x) is %x, but its receipts have root %x.", b.Hash[0:8], b.ReceiptsRoot[0:8], root[0:8]))
+	}
+
+	return nil
+}
+
+//Adds the receipts delivered to the shard by the last epoch block to the first block after it and credits them in
+//the block's state copy, such that the receivers can spend them in the same block. Nothing is credited if a receiver
+//is unknown.
+func addReceipts(block *protocol.Block) error {
+	if lastEpochBlock == nil || block.PrevHash != lastEpochBlock.Hash {
+		return nil
+	}
+
+	receipts := receiptsForShard(lastEpochBlock, block.ShardId)
+	for _, receipt := range receipts {
+		if _, exists := block.StateCopy[receipt.To]; !exists && storage.State[receipt.To] == nil {
+			return errors.New(fmt.Sprintf("Receiver %x of receipt %x is not in the state.", receipt.To[0:8], receipt.TxHash[0:8]))
+		}
+	}
+
+	for _, receipt := range receipts {
+		if _, exists := block.StateCopy[receipt.To]; !exists {
+			newAcc := *storage.State[receipt.To]
+			block.StateCopy[receipt.To] = &newAcc
+		}
+		block.StateCopy[receipt.To].Balance += receipt.Amount
+		block.ReceiptData = append(block.ReceiptData, receipt.Hash())
+	}
+
+	return nil
+}
+
+//Credits the receivers of the receipts. The sender was debited by the shard that emitted the receipt.
+func receiptStateChange(receipts []*protocol.Receipt) error {
+	for i, receipt := range receipts {
+		accReceiver, err := storage.GetAccount(receipt.To)
+		if err == nil && accReceiver.Balance+receipt.Amount > MAX_MONEY {
+			err = errors.New("Receipt amount would lead to balance overflow at the receiver account.")
+		}
+		if err != nil {
+			receiptStateChangeRollback(receipts[:i])
+			return err
+		}
+
+		accReceiver.Balance += receipt.Amount
+	}
+
+	return nil
+}
+
+func receiptStateChangeRollback(receipts []*protocol.Receipt) {
+	for cnt := len(receipts) - 1; cnt >= 0; cnt-- {
+		if accReceiver, _ := storage.GetAccount(receipts[cnt].To); accReceiver != nil {
+			accReceiver.Balance -= receipts[cnt].Amount
+		}
+	}
+}
+
+//Same as receiptStateChange for the state copies the committee reconstructs the relative states with. The state is
+//left unchanged if a receiver is unknown.
+func applyReceipts(state map[[32]byte]protocol.Account, receipts []*protocol.Receipt) (map[[32]byte]protocol.Account, error) {
+	for _, receipt := range receipts {
+		if _, exists := state[receipt.To]; !exists {
+			return state, errors.New(fmt.Sprintf("Receiver %x of receipt %x is not in the state.", receipt.To[0:8], receipt.TxHash[0:8]))
+		}
+	}
+
+	for _, receipt := range receipts {
+		receiverAcc := state[receipt.To]
+		receiverAcc.Balance += receipt.Amount
+		state[receipt.To] = receiverAcc
+	}
+
+	return state, nil
+}
+
+//Receipts of the epoch, ordered by the shard that emitted them. The receipts of a shard keep the order of its block.
+func collectEpochReceipts(receipts []*protocol.Receipt) []*protocol.Receipt {
+	sort.SliceStable(receipts, func(i, j int) bool {
+		return receipts[i].FromShard < receipts[j].FromShard
+	})
+
+	return receipts
+}
+
+//Records the stage of the transfers for clients. The block is the one that emitted, delivered or credited them, the
+//proofs lead to the root of the given tree.
+func writeReceiptStatuses(receipts []*protocol.Receipt, status uint8, block [32]byte, merkleTree *protocol.MerkleTree) {
+	for _, receipt := range receipts {
+		receiptStatus := &protocol.ReceiptStatus{
+			Receipt: *receipt,
+			Status:  status,
+			Block:   block,
+			Proof:   protocol.ReceiptProof(merkleTree, receipt.Hash()),
+		}
+		if err := storage.WriteReceiptStatus(receiptStatus); err != nil {
+			logger.Warn("Could not write receipt status", "tx", receipt.TxHash[0:8], "error", err)
+		}
+	}
+}
+
+//Takes note of the receipts an epoch block delivers.
+func deliverReceipts(epochBlock *protocol.EpochBlock) {
+	writeReceiptStatuses(epochBlock.Receipts, protocol.RECEIPT_DELIVERED, epochBlock.Hash, protocol.BuildReceiptsMerkleTree(epochBlock.Receipts))
+}
@@ -0,0 +1,165 @@
+package miner
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"testing"
+)
+
+func TestReceipts(t *testing.T) {
+	numberOfShards := NumberOfShards
+	NumberOfShards = 2
+	defer func() { NumberOfShards = numberOfShards }()
+
+	//The sender and the local receiver are in the lower half of the hash range and in shard 1, the other receiver in shard 2
+	from, localTo, crossTo := [32]byte{0x10}, [32]byte{0x20}, [32]byte{0x90}
+	local := &protocol.FundsTx{From: from, To: localTo, Amount: 5}
+	cross := &protocol.FundsTx{From: from, To: crossTo, Amount: 10}
+	if isCrossShard(local) || !isCrossShard(cross) {
+		t.Fatalf("Wrong cross-shard transfers: %v, %v\n", isCrossShard(local), isCrossShard(cross))
+	}
+
+	block := protocol.NewBlock([32]byte{}, 5)
+	block.ShardId = 1
+	receipts := blockReceipts(block, []*protocol.FundsTx{local, cross})
+	if len(receipts) != 1 || receipts[0].TxHash != cross.Hash() || receipts[0].FromShard != 1 || receipts[0].Height != 5 {
+		t.Fatalf("Wrong receipts: %v\n", receipts)
+	}
+
+	if _, _, err := validateReceipts(block, []*protocol.FundsTx{local, cross}, nil); err == nil {
+		t.Errorf("Block without receipts root accepted\n")
+	}
+	block.ReceiptsRoot = protocol.BuildReceiptsMerkleTree(receipts).MerkleRoot()
+	if emitted, credited, err := validateReceipts(block, []*protocol.FundsTx{local, cross}, nil); err != nil || len(emitted) != 1 || len(credited) != 0 {
+		t.Errorf("Valid receipts rejected (%v): %v, %v\n", err, emitted, credited)
+	}
+	if _, _, err := validateReceipts(block, []*protocol.FundsTx{local}, []*protocol.FundsTx{cross}); err == nil {
+		t.Errorf("Aggregated cross-shard transfer accepted\n")
+	}
+
+	//The first block of shard 2 after the epoch block has to credit the receipt
+	epochBlock := protocol.NewEpochBlock([][32]byte{block.Hash}, 6)
+	epochBlock.Hash = [32]byte{6}
+	epochBlock.NofShards = 2
+	epochBlock.Receipts = receipts
+	epochBlock.ReceiptsRoot = protocol.BuildReceiptsMerkleTree(receipts).MerkleRoot()
+	if err := validateEpochReceipts(epochBlock); err != nil {
+		t.Errorf("Valid epoch receipts rejected: %v\n", err)
+	}
+	storage.WriteClosedEpochBlock(epochBlock)
+	defer storage.DeleteClosedEpochBlock(epochBlock.Hash)
+
+	next := protocol.NewBlock(epochBlock.Hash, 7)
+	next.ShardId = 2
+	if _, err := creditedReceipts(next); err == nil {
+		t.Errorf("Block without the delivered receipts accepted\n")
+	}
+	next.ReceiptData = [][32]byte{receipts[0].Hash()}
+	if credited, err := creditedReceipts(next); err != nil || len(credited) != 1 {
+		t.Errorf("Valid credits rejected (%v): %v\n", err, credited)
+	}
+	next.ShardId = 1
+	if _, err := creditedReceipts(next); err == nil {
+		t.Errorf("Credit of a receipt delivered to another shard accepted\n")
+	}
+
+	later := protocol.NewBlock(next.Hash, 8)
+	later.ReceiptData = next.ReceiptData
+	if _, err := creditedReceipts(later); err == nil {
+		t.Errorf("Credit outside of the first block after the epoch block accepted\n")
+	}
+}
+
+func TestReceiptStateChange(t *testing.T) {
+	to := [32]byte{7: 1}
+	storage.State[to] = &protocol.Account{Balance: 1}
+	defer delete(storage.State, to)
+
+	receipts := []*protocol.Receipt{{To: to, Amount: 10}, {To: to, Amount: 5}}
+	if err := receiptStateChange(receipts); err != nil || storage.State[to].Balance != 16 {
+		t.Errorf("Receipts not credited (%v): %v\n", err, storage.State[to].Balance)
+	}
+	receiptStateChangeRollback(receipts)
+	if storage.State[to].Balance != 1 {
+		t.Errorf("Receipts not rolled back: %v\n", storage.State[to].Balance)
+	}
+
+	//Earlier receipts are rolled back if one of them can't be credited
+	unknown := append(receipts, &protocol.Receipt{To: [32]byte{7: 3}, Amount: 1})
+	if err := receiptStateChange(unknown); err == nil || storage.State[to].Balance != 1 {
+		t.Errorf("Receipt to unknown account credited (%v): %v\n", err, storage.State[to].Balance)
+	}
+}
+
+func TestFundsStateChangeRollbackAfterResharding(t *testing.T) {
+	numberOfShards := NumberOfShards
+	NumberOfShards = 2
+	defer func() { NumberOfShards = numberOfShards }()
+
+	from, to := [32]byte{0x10}, [32]byte{0x90}
+	storage.State[from] = &protocol.Account{Balance: 100}
+	storage.State[to] = &protocol.Account{Balance: 1}
+	defer delete(storage.State, from)
+	defer delete(storage.State, to)
+
+	tx := &protocol.FundsTx{From: from, To: to, Amount: 10}
+	block := protocol.NewBlock([32]byte{}, 5)
+	block.ShardId = 1
+	receipts := blockReceipts(block, []*protocol.FundsTx{tx})
+	if err := fundsStateChange([]*protocol.FundsTx{tx}, receipts, false); err != nil || storage.State[to].Balance != 1 {
+		t.Fatalf("Receiver of cross-shard transfer credited by the sending shard (%v): %v\n", err, storage.State[to].Balance)
+	}
+
+	//After a resharding the receiver is in the shard of the sender, the rollback still follows the receipts of the block
+	NumberOfShards = 1
+	fundsStateChangeRollback([]*protocol.FundsTx{tx}, receipts)
+	if storage.State[from].Balance != 100 || storage.State[to].Balance != 1 {
+		t.Errorf("Cross-shard transfer not rolled back as applied: sender %v, receiver %v\n", storage.State[from].Balance, storage.State[to].Balance)
+	}
+}
+
+func TestReceiptsToUnknownReceiver(t *testing.T) {
+	numberOfShards := NumberOfShards
+	NumberOfShards = 2
+	defer func() { NumberOfShards = numberOfShards }()
+
+	from, to, unknown := [32]byte{0x10}, [32]byte{0x90}, [32]byte{0xa0}
+	storage.State[from] = &protocol.Account{Balance: 100}
+	storage.State[to] = &protocol.Account{Balance: 1}
+	defer delete(storage.State, from)
+	defer delete(storage.State, to)
+
+	//The sending shard rejects transfers to unknown accounts, also across shards
+	tx := &protocol.FundsTx{From: from, To: unknown, Amount: 10}
+	block := protocol.NewBlock([32]byte{}, 5)
+	block.ShardId = 1
+	if err := fundsStateChange([]*protocol.FundsTx{tx}, blockReceipts(block, []*protocol.FundsTx{tx}), false); err == nil || storage.State[from].Balance != 100 {
+		t.Errorf("Cross-shard transfer to an unknown account accepted (%v): %v\n", err, storage.State[from].Balance)
+	}
+
+	//A receipt to an unknown receiver is not credited anywhere
+	receipts := []*protocol.Receipt{{To: to, Amount: 10, FromShard: 1}, {To: unknown, Amount: 5, FromShard: 1}}
+	epochBlock := protocol.NewEpochBlock([][32]byte{block.Hash}, 6)
+	epochBlock.Hash = [32]byte{6}
+	epochBlock.NofShards = 2
+	epochBlock.Receipts = receipts
+	lastEpochBlockBefore := lastEpochBlock
+	lastEpochBlock = epochBlock
+	defer func() { lastEpochBlock = lastEpochBlockBefore }()
+
+	next := protocol.NewBlock(epochBlock.Hash, 7)
+	next.ShardId = 2
+	next.StateCopy = make(map[[32]byte]*protocol.Account)
+	if err := addReceipts(next); err == nil || len(next.ReceiptData) != 0 || len(next.StateCopy) != 0 {
+		t.Errorf("Receipt to an unknown receiver added (%v): %v\n", err, next.ReceiptData)
+	}
+
+	if err := receiptStateChange(receipts); err == nil || storage.State[to].Balance != 1 {
+		t.Errorf("Receipt to an unknown receiver credited (%v): %v\n", err, storage.State[to].Balance)
+	}
+
+	state := map[[32]byte]protocol.Account{to: {Balance: 1}}
+	if state, err := applyReceipts(state, receipts); err == nil || len(state) != 1 || state[to].Balance != 1 {
+		t.Errorf("Receipt to an unknown receiver applied (%v): %v\n", err, state)
+	}
+}
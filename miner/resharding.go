@@ -0,0 +1,241 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+//Transactions assigned to this shard that did not fit into the last mined block. Reported with the state transition.
+var mempoolDepth uint32
+
+//Transactions in the block in per mille of the transactions that fit into a block, see prepareBlock.
+func blockFill(block *protocol.Block) uint16 {
+	capacity := int(ActiveParameters.Block_size) - (650 + 8)
+	if capacity <= 0 {
+		return RESHARD_MAX_FILL
+	}
+
+	fill := int(block.GetTxDataSize()) * RESHARD_MAX_FILL / capacity
+	if fill > RESHARD_MAX_FILL {
+		return RESHARD_MAX_FILL
+	}
+
+	return uint16(fill)
+}
+
+//Load of this shard after the given block was mined.
+func ownShardLoad(block *protocol.Block) protocol.ShardLoad {
+	return protocol.NewShardLoad(mempoolDepth, blockFill(block))
+}
+
+//Most shards the validators of the state can run, i.e. the number of shards without taking the load into account.
+func shardCapacity(state map[[32]byte]*protocol.Account) int {
+	validators := 0
+	for _, acc := range state {
+		if acc.IsStaking {
+			validators++
+		}
+	}
+
+	capacity := int(math.Ceil(float64(validators) / float64(ActiveParameters.validators_per_shard)))
+	if capacity < 1 {
+		return 1
+	}
+
+	return capacity
+}
+
+//Number of shards of the next epoch. A shard is added if a shard could not include all of its transactions or the
+//blocks were filled to at least RESHARD_SPLIT_FILL on average, and one is removed if all transactions were included
+//and the blocks were filled to at most RESHARD_MERGE_FILL. The number of shards changes by at most one per epoch and
+//is bound by the capacity. Without loads, e.g. for the first epoch, the capacity is used.
+func detNumberOfShardsForLoad(capacity int, loads []protocol.ShardLoad) int {
+	if len(loads) == 0 {
+		return capacity
+	}
+
+	backlog := false
+	fill := 0
+	for _, load := range loads {
+		if load.MempoolDepth > 0 {
+			backlog = true
+		}
+		fill += int(load.BlockFill)
+	}
+	averageFill := fill / len(loads)
+
+	numberOfShards := len(loads)
+	if backlog || averageFill >= RESHARD_SPLIT_FILL {
+		numberOfShards++
+	} else if averageFill <= RESHARD_MERGE_FILL {
+		numberOfShards--
+	}
+
+	if numberOfShards > capacity {
+		numberOfShards = capacity
+	}
+	if numberOfShards < 1 {
+		numberOfShards = 1
+	}
+
+	return numberOfShards
+}
+
+//Accounts of the state whose shard changes when the number of shards changes, ordered by account hash.
+func accountMigrations(state map[[32]byte]*protocol.Account, fromShards int, toShards int) (migrations []*protocol.AccountMigration) {
+	if fromShards == toShards {
+		return nil
+	}
+
+	for hash := range state {
+		from := assignAddressToShardOf(hash, fromShards)
+		to := assignAddressToShardOf(hash, toShards)
+		if from != to {
+			migrations = append(migrations, &protocol.AccountMigration{Account: hash, FromShard: from, ToShard: to})
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		for k := range migrations[i].Account {
+			if migrations[i].Account[k] != migrations[j].Account[k] {
+				return migrations[i].Account[k] < migrations[j].Account[k]
+			}
+		}
+		return false
+	})
+
+	return migrations
+}
+
+//Checks that the epoch block decided the number of shards with the loads of all shards of the previous epoch, that it
+//commits to the account migrations of that decision and that every shard of the next epoch has a validator.
+func validateResharding(b *protocol.EpochBlock, state map[[32]byte]*protocol.Account, previousNumberOfShards int) error {
+	if len(b.ShardLoads) != previousNumberOfShards {
+		return errors.New(fmt.Sprintf("Epoch block (%x) carries the loads of %d shards, but there were %d.", b.Hash[0:8], len(b.ShardLoads), previousNumberOfShards))
+	}
+
+	if numberOfShards := detNumberOfShardsForLoad(shardCapacity(state), b.ShardLoads); numberOfShards != b.NofShards {
+		return errors.New(fmt.Sprintf("Epoch block (%x) has %d shards, but the loads lead to %d.", b.Hash[0:8], b.NofShards, numberOfShards))
+	}
+
+	migrations := accountMigrations(state, previousNumberOfShards, b.NofShards)
+	if root := protocol.BuildMigrationsMerkleTree(migrations).MerkleRoot(); root != b.MigrationsRoot {
+		return errors.New(fmt.Sprintf("Migrations root of epoch block (%x) is %x, but its %d migrations have root %x.", b.Hash[0:8], b.MigrationsRoot[0:8], len(migrations), root[0:8]))
+	}
+
+	if b.ValMapping == nil {
+		return errors.New(fmt.Sprintf("Epoch block (%x) has no validator mapping.", b.Hash[0:8]))
+	}
+	shardsWithValidator := make(map[int]bool)
+	for _, shardId := range b.ValMapping.ValMapping {
+		if shardId < 0 || shardId > b.NofShards {
+			return errors.New(fmt.Sprintf("Epoch block (%x) assigns a validator to shard %d, but has %d shards.", b.Hash[0:8], shardId, b.NofShards))
+		}
+		shardsWithValidator[shardId] = true
+	}
+	for shardId := 1; shardId <= b.NofShards; shardId++ {
+		if !shardsWithValidator[shardId] {
+			return errors.New(fmt.Sprintf("Epoch block (%x) assigns no validator to shard %d.", b.Hash[0:8], shardId))
+		}
+	}
+
+	return nil
+}
+
+//The committee knows the loads of the shards from their blocks and state transitions. The load of shard 1 is not
+//reported in a state transition, only its block fill can be checked.
+func validateShardLoads(b *protocol.EpochBlock, loads map[int]protocol.ShardLoad) error {
+	for i, load := range b.ShardLoads {
+		shardId := i + 1
+		expected, exists := loads[shardId]
+		if !exists {
+			continue
+		}
+		if load.BlockFill != expected.BlockFill || (shardId != 1 && load.MempoolDepth != expected.MempoolDepth) {
+			return errors.New(fmt.Sprintf("Epoch block (%x) reports load %v for shard %d, but the shard reported %v.", b.Hash[0:8], load, shardId, expected))
+		}
+	}
+
+	return nil
+}
+
+//Checks an epoch block received from shard 1 before it is taken over. Returns the state of the epoch block.
+func validateReceivedEpochBlock(b *protocol.EpochBlock) (map[[32]byte]*protocol.Account, error) {
+	if !validateEpochBlockProducer(b) {
+		return nil, errors.New(fmt.Sprintf("Sender of epoch block (%x) is not a validator of shard 1.", b.Hash[0:8]))
+	}
+	state, err := epochBlockState(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEpochBlockContent(b, state); err != nil {
+		return nil, err
+	}
+	if !ValidateEpochBlockSender(b) {
+		awaitEndorsements(b)
+		return nil, errors.New(fmt.Sprintf("Epoch block (%x) is not endorsed by a quorum of the committee yet.", b.Hash[0:8]))
+	}
+
+	return state, nil
+}
+
+//The receipts and the number of shards of an epoch block have to match its roots and the loads. The state is checked
+//against the state root when it is derived, see epochBlockState. The committee only endorses epoch blocks that pass
+//these checks.
+func validateEpochBlockContent(b *protocol.EpochBlock, state map[[32]byte]*protocol.Account) error {
+	if err := validateEpochReceipts(b); err != nil {
+		return err
+	}
+
+	return validateResharding(b, state, NumberOfShards)
+}
+
+//Takes over the state, the validator mapping and the number of shards of the epoch block.
+func takeOverEpochBlock(b *protocol.EpochBlock, state map[[32]byte]*protocol.Account) {
+	storage.State = state
+	//Blocks of the previous epoch can't be rolled back anymore once the epoch state is taken over
+	storage.DeleteAllContractVariablesBeforeTx()
+	ValidatorShardMap = b.ValMapping
+	storage.ValShardMapping = ValidatorShardMap
+	NumberOfShards = b.NofShards
+	storage.CommitteeLeader = b.CommitteeLeader
+	storage.ThisShardID = ValidatorShardMap.ValMapping[ValidatorAccAddress]
+	storage.ThisShardMap[int(b.Height)] = storage.ThisShardID
+	lastEpochBlock = b
+	publishEpochHeight(lastEpochBlock)
+	//The certificate of the committee is kept with the epoch block, such that it is sent along when it is requested
+	storage.WriteClosedEpochBlock(b)
+	storage.DeleteAllLastClosedEpochBlock()
+	storage.WriteLastClosedEpochBlock(b, state)
+	pruneEndorsements(b.Height)
+}
+
+//Validators without a shard do not mine. They follow the epoch blocks until one of them assigns them a shard again,
+//e.g. because the load made the committee add a shard.
+func standby() {
+	//lastEpochBlock already points to an epoch block once it was received, see processEpochBlock
+	epochHeight := lastEpochBlock.Height
+	for storage.ThisShardID == 0 {
+		logger.Info("No shard assigned, standing by", "epoch", epochHeight)
+		newEpochBlock := <-p2p.EpochBlockReceivedChan
+		if newEpochBlock.Height != epochHeight+uint32(ActiveParameters.Epoch_length)+1 {
+			continue
+		}
+		state, err := validateReceivedEpochBlock(&newEpochBlock)
+		if err != nil {
+			logger.Warn("Received invalid epoch block", "hash", newEpochBlock.Hash[0:8], "height", newEpochBlock.Height, "error", err)
+			continue
+		}
+
+		deliverReceipts(&newEpochBlock)
+		takeOverEpochBlock(&newEpochBlock, state)
+		epochHeight = newEpochBlock.Height
+	}
+
+	logger.Info("Shard assigned, leaving standby", "shard", storage.ThisShardID, "epoch", lastEpochBlock.Height)
+}
@@ -0,0 +1,124 @@
+package miner
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"testing"
+)
+
+func TestDetNumberOfShardsForLoad(t *testing.T) {
+	idle, busy := protocol.NewShardLoad(0, 100), protocol.NewShardLoad(0, 950)
+	backlog := protocol.NewShardLoad(3, 600)
+
+	tests := []struct {
+		capacity int
+		loads    []protocol.ShardLoad
+		expected int
+	}{
+		{3, nil, 3},
+		{3, []protocol.ShardLoad{busy, busy}, 3},
+		{3, []protocol.ShardLoad{idle, backlog}, 3},
+		{2, []protocol.ShardLoad{busy, busy}, 2},
+		{3, []protocol.ShardLoad{idle, idle}, 1},
+		{3, []protocol.ShardLoad{idle}, 1},
+		{3, []protocol.ShardLoad{protocol.NewShardLoad(0, 600), protocol.NewShardLoad(0, 600)}, 2},
+		{1, []protocol.ShardLoad{busy, busy, busy}, 1},
+	}
+	for _, test := range tests {
+		if numberOfShards := detNumberOfShardsForLoad(test.capacity, test.loads); numberOfShards != test.expected {
+			t.Errorf("Capacity %d and loads %v lead to %d shards, expected %d\n", test.capacity, test.loads, numberOfShards, test.expected)
+		}
+	}
+}
+
+func TestBlockFill(t *testing.T) {
+	block := protocol.NewBlock([32]byte{}, 1)
+	if fill := blockFill(block); fill != 0 {
+		t.Errorf("Empty block has fill %d\n", fill)
+	}
+
+	//Block_size - (650 + 8) bytes fit into a block
+	capacity := int(ActiveParameters.Block_size) - (650 + 8)
+	block.NrFundsTx = uint16(capacity / protocol.HASH_LEN)
+	if fill := blockFill(block); int(fill) != int(block.NrFundsTx)*protocol.HASH_LEN*RESHARD_MAX_FILL/capacity {
+		t.Errorf("Wrong fill %d\n", fill)
+	}
+	block.NrFundsTx += 10
+	if fill := blockFill(block); fill != RESHARD_MAX_FILL {
+		t.Errorf("Overfull block has fill %d\n", fill)
+	}
+}
+
+func TestValidateResharding(t *testing.T) {
+	//One validator per shard, such that three validators can run three shards
+	validatorsPerShard := ActiveParameters.validators_per_shard
+	ActiveParameters.validators_per_shard = 1
+	defer func() { ActiveParameters.validators_per_shard = validatorsPerShard }()
+
+	validators := [][64]byte{{1}, {2}, {3}}
+	state := make(map[[32]byte]*protocol.Account)
+	for _, address := range validators {
+		state[protocol.SerializeHashContent(address)] = &protocol.Account{Address: address, IsStaking: true}
+	}
+	for i := 0; i < 50; i++ {
+		state[[32]byte{byte(i * 5)}] = &protocol.Account{Address: [64]byte{byte(i), 1}}
+	}
+
+	//Two busy shards are split into three
+	b := protocol.NewEpochBlock([][32]byte{{1}}, 4)
+	b.Hash = [32]byte{4}
+	b.ShardLoads = []protocol.ShardLoad{protocol.NewShardLoad(5, 1000), protocol.NewShardLoad(0, 1000)}
+	b.NofShards = 3
+	migrations := accountMigrations(state, 2, 3)
+	if len(migrations) == 0 {
+		t.Fatalf("No accounts migrated\n")
+	}
+	for _, migration := range migrations {
+		if migration.FromShard != assignAddressToShardOf(migration.Account, 2) || migration.ToShard != assignAddressToShardOf(migration.Account, 3) {
+			t.Errorf("Wrong migration: %v\n", migration)
+		}
+	}
+	b.MigrationsRoot = protocol.BuildMigrationsMerkleTree(migrations).MerkleRoot()
+	b.ValMapping = protocol.NewMapping()
+	for i, address := range validators {
+		b.ValMapping.ValMapping[address] = i + 1
+	}
+	if err := validateResharding(b, state, 2); err != nil {
+		t.Errorf("Valid resharding rejected: %v\n", err)
+	}
+
+	if err := validateResharding(b, state, 3); err == nil {
+		t.Errorf("Loads of the wrong number of shards accepted\n")
+	}
+
+	b.ValMapping.ValMapping[validators[2]] = 0
+	if err := validateResharding(b, state, 2); err == nil {
+		t.Errorf("Shard without validator accepted\n")
+	}
+	b.ValMapping.ValMapping[validators[2]] = 4
+	if err := validateResharding(b, state, 2); err == nil {
+		t.Errorf("Validator outside of the shards accepted\n")
+	}
+	b.ValMapping.ValMapping[validators[2]] = 3
+
+	b.MigrationsRoot = [32]byte{}
+	if err := validateResharding(b, state, 2); err == nil {
+		t.Errorf("Wrong migrations root accepted\n")
+	}
+	b.MigrationsRoot = protocol.BuildMigrationsMerkleTree(migrations).MerkleRoot()
+
+	b.NofShards = 2
+	if err := validateResharding(b, state, 2); err == nil {
+		t.Errorf("Number of shards that does not follow the loads accepted\n")
+	}
+	b.NofShards = 3
+
+	//The committee can check the block fills and the loads reported in the state transitions
+	loads := map[int]protocol.ShardLoad{1: protocol.NewShardLoad(0, 1000), 2: protocol.NewShardLoad(0, 1000)}
+	if err := validateShardLoads(b, loads); err != nil {
+		t.Errorf("Valid loads rejected: %v\n", err)
+	}
+	loads[2] = protocol.NewShardLoad(1, 1000)
+	if err := validateShardLoads(b, loads); err == nil {
+		t.Errorf("Load other than the reported one accepted\n")
+	}
+}
@@ -0,0 +1,131 @@
+package miner
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+)
+
+//Accounts are assigned to shards by a ShardAssignment, see assignTransactionToShard. The assignment decides which shard
+//validates the transactions of an account, so all miners and committee members of a network have to use the same one.
+type ShardAssignment interface {
+	//Shard of the account with the given hash, between 1 and numberOfShards.
+	Shard(address [32]byte, numberOfShards int) int
+}
+
+const (
+	//Points per shard on the ring of ConsistentHashAssignment. More points spread the accounts more evenly.
+	CONSISTENT_HASH_POINTS = 256
+)
+
+var shardAssignment ShardAssignment = HashRangeAssignment{}
+
+//Has to be called before the miner is started.
+func SetShardAssignment(assignment ShardAssignment) {
+	if assignment != nil {
+		shardAssignment = assignment
+	}
+}
+
+//Splits the range of the first 8 bytes of the account hash into numberOfShards ranges of equal size. Account hashes
+//are uniformly distributed, so every shard gets the same share of accounts. Changing the number of shards moves
+//about half of the accounts.
+type HashRangeAssignment struct{}
+
+func (HashRangeAssignment) Shard(address [32]byte, numberOfShards int) int {
+	if numberOfShards <= 1 {
+		return 1
+	}
+
+	//The upper 32 bits are enough to split the range, and their product with the number of shards fits into 64 bits
+	position := binary.BigEndian.Uint64(address[:8]) >> 32
+	return int(position*uint64(numberOfShards)>>32) + 1
+}
+
+//Places CONSISTENT_HASH_POINTS points per shard on a ring of 64 bit positions and assigns an account to the shard of
+//the first point at or after the position of its hash. When a shard is added, only the accounts between its points and
+//their predecessors move, i.e. about 1/numberOfShards of them, and all of them move to the new shard.
+type ConsistentHashAssignment struct {
+	mutex sync.Mutex
+	//Sorted rings by number of shards
+	rings map[int][]ringPoint
+}
+
+type ringPoint struct {
+	position uint64
+	shard    int
+}
+
+func NewConsistentHashAssignment() *ConsistentHashAssignment {
+	return &ConsistentHashAssignment{rings: make(map[int][]ringPoint)}
+}
+
+func (assignment *ConsistentHashAssignment) Shard(address [32]byte, numberOfShards int) int {
+	if numberOfShards <= 1 {
+		return 1
+	}
+
+	ring := assignment.ring(numberOfShards)
+	position := binary.BigEndian.Uint64(address[:8])
+	i := sort.Search(len(ring), func(i int) bool {
+		return ring[i].position >= position
+	})
+	if i == len(ring) {
+		i = 0
+	}
+
+	return ring[i].shard
+}
+
+//The points of a shard do not depend on the number of shards, the ring of n+1 shards is the ring of n shards with the
+//points of shard n+1 added.
+func (assignment *ConsistentHashAssignment) ring(numberOfShards int) []ringPoint {
+	assignment.mutex.Lock()
+	defer assignment.mutex.Unlock()
+
+	if ring, exists := assignment.rings[numberOfShards]; exists {
+		return ring
+	}
+
+	var ring []ringPoint
+	var seed [16]byte
+	for shard := 1; shard <= numberOfShards; shard++ {
+		for point := 0; point < CONSISTENT_HASH_POINTS; point++ {
+			binary.BigEndian.PutUint64(seed[:8], uint64(shard))
+			binary.BigEndian.PutUint64(seed[8:], uint64(point))
+			hash := sha3.Sum256(seed[:])
+			ring = append(ring, ringPoint{binary.BigEndian.Uint64(hash[:8]), shard})
+		}
+	}
+	//Ties are broken by the shard, such that the ring does not depend on the order the points were added in
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].position != ring[j].position {
+			return ring[i].position < ring[j].position
+		}
+		return ring[i].shard < ring[j].shard
+	})
+
+	assignment.rings[numberOfShards] = ring
+	return ring
+}
+
+//Pins hot accounts to a shard, e.g. to give an exchange a shard of its own. All other accounts, and pinned accounts
+//whose shard does not exist with the current number of shards, are assigned by the fallback.
+type PinnedAssignment struct {
+	pins     map[[32]byte]int
+	fallback ShardAssignment
+}
+
+func NewPinnedAssignment(pins map[[32]byte]int, fallback ShardAssignment) *PinnedAssignment {
+	return &PinnedAssignment{pins: pins, fallback: fallback}
+}
+
+func (assignment *PinnedAssignment) Shard(address [32]byte, numberOfShards int) int {
+	if shard, exists := assignment.pins[address]; exists && shard >= 1 && shard <= numberOfShards {
+		return shard
+	}
+
+	return assignment.fallback.Shard(address, numberOfShards)
+}
@@ -0,0 +1,121 @@
+package miner
+
+import (
+	"encoding/binary"
+	"golang.org/x/crypto/sha3"
+	"testing"
+)
+
+//Hashes of accounts are uniformly distributed, the test accounts are hashes of their index.
+func testAccountHashes(n int) (hashes [][32]byte) {
+	var seed [8]byte
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint64(seed[:], uint64(i))
+		hashes = append(hashes, sha3.Sum256(seed[:]))
+	}
+
+	return hashes
+}
+
+func TestShardAssignmentDeterministic(t *testing.T) {
+	hashRange, consistent := HashRangeAssignment{}, NewConsistentHashAssignment()
+
+	//Fixed values, an assignment must not change between versions
+	expected := []struct {
+		assignment     ShardAssignment
+		address        [32]byte
+		numberOfShards int
+		shard          int
+	}{
+		{hashRange, [32]byte{}, 1, 1},
+		{hashRange, [32]byte{0xff, 0xff, 0xff, 0xff}, 1, 1},
+		{hashRange, [32]byte{}, 4, 1},
+		{hashRange, [32]byte{0x3f, 0xff, 0xff, 0xff}, 4, 1},
+		{hashRange, [32]byte{0x40}, 4, 2},
+		{hashRange, [32]byte{0x80}, 4, 3},
+		{hashRange, [32]byte{0xff, 0xff, 0xff, 0xff}, 4, 4},
+		{hashRange, [32]byte{0x80}, 3, 2},
+		{consistent, [32]byte{0x80}, 1, 1},
+	}
+	for _, e := range expected {
+		if shard := e.assignment.Shard(e.address, e.numberOfShards); shard != e.shard {
+			t.Errorf("Account %x assigned to shard %v of %v instead of %v\n", e.address[:4], shard, e.numberOfShards, e.shard)
+		}
+	}
+
+	//A new instance assigns every account to the same shard, for every number of shards
+	other := NewConsistentHashAssignment()
+	for numberOfShards := 1; numberOfShards <= 16; numberOfShards++ {
+		for _, address := range testAccountHashes(1000) {
+			shard := consistent.Shard(address, numberOfShards)
+			if shard < 1 || shard > numberOfShards || other.Shard(address, numberOfShards) != shard {
+				t.Fatalf("Account %x assigned to shard %v of %v\n", address[:4], shard, numberOfShards)
+			}
+			if shard := hashRange.Shard(address, numberOfShards); shard < 1 || shard > numberOfShards {
+				t.Fatalf("Account %x assigned to shard %v of %v\n", address[:4], shard, numberOfShards)
+			}
+		}
+	}
+}
+
+func TestShardAssignmentEven(t *testing.T) {
+	const accounts = 20000
+	for _, assignment := range []ShardAssignment{HashRangeAssignment{}, NewConsistentHashAssignment()} {
+		for _, numberOfShards := range []int{2, 3, 5, 8} {
+			counts := make(map[int]int)
+			for _, address := range testAccountHashes(accounts) {
+				counts[assignment.Shard(address, numberOfShards)]++
+			}
+
+			//Every shard gets its share within 25%
+			share := accounts / numberOfShards
+			for shard := 1; shard <= numberOfShards; shard++ {
+				if counts[shard] < share*3/4 || counts[shard] > share*5/4 {
+					t.Errorf("%T assigned %v of %v accounts to shard %v of %v\n", assignment, counts[shard], accounts, shard, numberOfShards)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistentHashAssignmentMoves(t *testing.T) {
+	assignment := NewConsistentHashAssignment()
+	addresses := testAccountHashes(10000)
+	for numberOfShards := 1; numberOfShards < 8; numberOfShards++ {
+		moved := 0
+		for _, address := range addresses {
+			before, after := assignment.Shard(address, numberOfShards), assignment.Shard(address, numberOfShards+1)
+			if before != after {
+				if after != numberOfShards+1 {
+					t.Fatalf("Account %x moved from shard %v to %v, which is not the new shard\n", address[:4], before, after)
+				}
+				moved++
+			}
+		}
+
+		//About 1/(numberOfShards+1) of the accounts move
+		if expected := len(addresses) / (numberOfShards + 1); moved > expected*5/4 {
+			t.Errorf("%v accounts moved when adding shard %v, %v expected\n", moved, numberOfShards+1, expected)
+		}
+	}
+}
+
+func TestPinnedAssignment(t *testing.T) {
+	pinned := [32]byte{0x80}
+	assignment := NewPinnedAssignment(map[[32]byte]int{pinned: 1}, HashRangeAssignment{})
+	if shard := assignment.Shard(pinned, 4); shard != 1 {
+		t.Errorf("Pinned account assigned to shard %v\n", shard)
+	}
+
+	for _, address := range testAccountHashes(100) {
+		if assignment.Shard(address, 4) != (HashRangeAssignment{}).Shard(address, 4) {
+			t.Errorf("Account %x not assigned by the fallback\n", address[:4])
+		}
+	}
+
+	//Accounts pinned to a shard that does not exist are assigned by the fallback
+	assignment = NewPinnedAssignment(map[[32]byte]int{pinned: 3}, HashRangeAssignment{})
+	if shard := assignment.Shard(pinned, 2); shard != 2 {
+		t.Errorf("Account pinned to a missing shard assigned to shard %v\n", shard)
+	}
+}
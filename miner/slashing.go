@@ -54,8 +54,7 @@ func seekSlashingProof(block *protocol.Block) error {
 //Check if two blocks are part of the same chain or if they appear in two competing chains
 func IsInSameChain(b1, b2 *protocol.Block) bool {
 
-	logger.Printf("Fisrt Block Hash %s", b1.Hash)
-	logger.Printf("Second Block Hash %s", b2.Hash)
+	logger.Debug("Checking if blocks are in the same chain", "first", b1.Hash[0:8], "second", b2.Hash[0:8])
 
 
 	SameChainMutex.Lock()
@@ -75,7 +74,6 @@ func IsInSameChain(b1, b2 *protocol.Block) bool {
 	}
 
 	for higherBlock.Height > 0 {
-		logger.Printf("Infinite loop?")
 		//Todo uncommnt this one too and replace it for the other one
 		//newHigherBlock := storage.ReadClosedBlock(higherBlock.PrevHash)
 		higherBlock := storage.ReadClosedBlock(higherBlock.PrevHash)
@@ -102,7 +100,7 @@ func IsInSameChain(b1, b2 *protocol.Block) bool {
 							break
 						}
 					}
-					logger.Printf("Block %x received Before", higherBlock.PrevHash)
+					logger.Debug("Block found in the received block stash", "hash", higherBlock.PrevHash[0:8])
 					break
 				}
 				//TODO uncomment
@@ -24,7 +24,7 @@ func CheckAndChangeParameters(parameters *Parameters, configTxSlice *[]*protocol
 		case protocol.BLOCK_SIZE_ID:
 			if parameterBoundsChecking(protocol.BLOCK_SIZE_ID, tx.Payload) {
 				parameters.Block_size = tx.Payload
-				logger.Printf("BLOCK_SIZE: %v", parameters.Block_size)
+				logger.Debug("Block size changed", "size", parameters.Block_size)
 				change = true
 			}
 		case protocol.BLOCK_REWARD_ID:
@@ -35,13 +35,13 @@ func CheckAndChangeParameters(parameters *Parameters, configTxSlice *[]*protocol
 		case protocol.DIFF_INTERVAL_ID:
 			if parameterBoundsChecking(protocol.DIFF_INTERVAL_ID, tx.Payload) {
 				parameters.Diff_interval = tx.Payload
-				logger.Printf("BLOCK_DIFF: %v", parameters.Diff_interval)
+				logger.Debug("Difficulty interval changed", "interval", parameters.Diff_interval)
 				change = true
 			}
 		case protocol.BLOCK_INTERVAL_ID:
 			if parameterBoundsChecking(protocol.BLOCK_INTERVAL_ID, tx.Payload) {
 				parameters.Block_interval = tx.Payload
-				logger.Printf("BLOCK_INVTERVAL: %v", parameters.Block_interval)
+				logger.Debug("Block interval changed", "interval", parameters.Block_interval)
 				change = true
 			}
 		case protocol.STAKING_MINIMUM_ID:
@@ -112,7 +112,14 @@ func initState() (initialBlock *protocol.Block, err error) {
 		}
 	}
 
-	storage.State = lastEpochBlock.State
+	publishEpochHeight(lastEpochBlock)
+
+	//A restarted node continues with the state it persisted with the epoch block
+	if !restoreState(lastEpochBlock) {
+		if storage.State, err = epochBlockState(lastEpochBlock); err != nil {
+			return nil, err
+		}
+	}
 
 	initRootAccounts(genesis)
 	initFirstCommittee(genesis)
@@ -172,10 +179,10 @@ func initState() (initialBlock *protocol.Block, err error) {
 							break
 						}
 					}
-					logger.Printf("Block %x received Before", lastBlock.PrevHash[0:8])
+					logger.Debug("Block found in the received block stash", "hash", lastBlock.PrevHash[0:8])
 					break
 				} else {
-					logger.Printf("Timed out while requesting %x", lastBlock.PrevHash[0:8])
+					logger.Debug("Timed out requesting block", "hash", lastBlock.PrevHash[0:8])
 					goto RETRY
 				}
 			}
@@ -258,7 +265,7 @@ func initState() (initialBlock *protocol.Block, err error) {
 			postValidate(blockDataMap[blockToValidate.Hash], true)
 		}
 
-		logger.Printf("Block validated: %d --> %x", blockToValidate.Height, blockToValidate.Hash[0:8])
+		logger.Debug("Block validated", "hash", blockToValidate.Hash[0:8], "shard", blockToValidate.ShardId, "height", blockToValidate.Height)
 	}
 
 	for _, blockToValidate := range allClosedBlocks {
@@ -272,9 +279,9 @@ func initState() (initialBlock *protocol.Block, err error) {
 */
 
 
-	logger.Printf("\n\n%v block(s) validated. Chain good to go.\n------------------------------------------------------------------------\n\n", len(allClosedBlocks))
-	logger.Printf("Last Block: \n%v\n------------------------------------------------------------------------\n\n", lastBlock)
-	logger.Printf("Current STATE: \n%v\n------------------------------------------------------------------------\n\n", getState())
+	logger.Info("Chain validated", "blocks", len(allClosedBlocks))
+	logger.Debug("Initial block", "hash", initialBlock.Hash[0:8], "height", initialBlock.Height)
+	logger.Debug("Current state", "accounts", len(storage.State))
 
 	return initialBlock, nil
 }
@@ -291,16 +298,15 @@ func initEpochBlock() (initialEpochBlock *protocol.EpochBlock, err error) {
 		select {
 		case encodedFirstEpochBlock := <-p2p.FirstEpochBlockReqChan:
 			initialEpochBlock = initialEpochBlock.Decode(encodedFirstEpochBlock)
-			logger.Printf("Received first Epoch Block: %v\n", initialEpochBlock.String())
+			logger.Info("Received first epoch block", "hash", initialEpochBlock.Hash[0:8])
 		case <-time.After(EPOCHBLOCKFETCH_TIMEOUT* time.Second):
 			return nil, errors.New("epoch block fetch timeout")
 		}
 
-		initialEpochBlock.State = storage.State
 		storage.WriteClosedEpochBlock(initialEpochBlock)
 
 		storage.DeleteAllLastClosedEpochBlock()
-		storage.WriteLastClosedEpochBlock(initialEpochBlock)
+		storage.WriteLastClosedEpochBlock(initialEpochBlock, storage.State)
 	}
 	return initialEpochBlock, nil
 }
@@ -340,16 +346,20 @@ func getLastEpochBlock() (lastEpochBlock *protocol.EpochBlock, err error) {
 	select {
 	case encodedLastEpochBlock := <-p2p.LastEpochBlockReqChan:
 		eb = eb.Decode(encodedLastEpochBlock)
-		logger.Printf("Received last Epoch Block: %v\n", eb.String())
+		logger.Info("Received last epoch block", "hash", eb.Hash[0:8], "height", eb.Height)
 	case <-time.After(EPOCHBLOCKFETCH_TIMEOUT* time.Second):
 		return nil, errors.New("epoch block fetch timeout")
 	}
 
+	state, err := epochBlockState(eb)
+	if err != nil {
+		return nil, err
+	}
 
 	storage.WriteClosedEpochBlock(eb)
 
 	storage.DeleteAllLastClosedEpochBlock()
-	storage.WriteLastClosedEpochBlock(eb)
+	storage.WriteLastClosedEpochBlock(eb, state)
 
 	return eb, nil
 }
@@ -361,6 +371,150 @@ func initRootAccounts(genesis *protocol.Genesis) {
 	storage.RootKeys[protocol.SerializeHashContent(genesis.RootAddress)] = &rootAcc
 }
 
+//Restores the state and the validator assignment persisted together with the given epoch block. Returns false if
+//nothing was persisted for this epoch block or the persisted state does not match it.
+func restoreState(epochBlock *protocol.EpochBlock) bool {
+	if epochBlock == nil {
+		return false
+	}
+
+	persisted := storage.ReadLastClosedEpochBlockState()
+	if persisted == nil || persisted.BlockHash != epochBlock.Hash {
+		return false
+	}
+
+	if err := verifyPersistedState(persisted, epochBlock); err != nil {
+		logger.Warn("Persisted state of the epoch block not restored", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "error", err)
+		return false
+	}
+
+	storage.State = persisted.State
+	if storage.State == nil {
+		storage.State = make(map[[32]byte]*protocol.Account)
+	}
+	storage.RelativeState = persisted.RelativeState
+	if storage.RelativeState == nil {
+		storage.RelativeState = make(map[[32]byte]*protocol.RelativeAccount)
+	}
+	storage.OutboundReceipts = persisted.OutboundReceipts
+	storage.ThisShardID = persisted.ThisShardID
+	if persisted.ValShardMapping != nil {
+		ValidatorShardMap = persisted.ValShardMapping
+		storage.ValShardMapping = ValidatorShardMap
+		//A state imported from a snapshot doesn't know the validator it is restored on
+		if shardID, exists := ValidatorShardMap.ValMapping[ValidatorAccAddress]; exists {
+			storage.ThisShardID = shardID
+		}
+	}
+
+	storage.PublishStateSnapshot()
+
+	logger.Info("Restored state of the epoch block from local disk", "hash", epochBlock.Hash[0:8], "height", epochBlock.Height, "accounts", len(storage.State))
+	return true
+}
+
+//Restores the state persisted with the last closed block if that block was closed by this node in the epoch of the
+//given epoch block, such that a node restarted in the middle of an epoch continues after its last block instead of
+//starting over from the epoch state. Returns the restored block, nil if there is nothing to restore.
+func restoreBlockState(epochBlock *protocol.EpochBlock) *protocol.Block {
+	if epochBlock == nil {
+		return nil
+	}
+
+	block := storage.ReadLastClosedBlock()
+	persisted := storage.ReadLastClosedBlockState()
+	if block == nil || persisted == nil || persisted.BlockHash != block.Hash {
+		return nil
+	}
+
+	//The block has to belong to the epoch that follows the epoch block and to the shard this node is assigned to
+	if block.Height <= epochBlock.Height || block.Height > epochBlock.Height+uint32(ActiveParameters.Epoch_length) ||
+		block.ShardId != storage.ThisShardID || persisted.ThisShardID != storage.ThisShardID {
+		return nil
+	}
+
+	storage.State = persisted.State
+	if storage.State == nil {
+		storage.State = make(map[[32]byte]*protocol.Account)
+	}
+	storage.RelativeState = persisted.RelativeState
+	if storage.RelativeState == nil {
+		storage.RelativeState = make(map[[32]byte]*protocol.RelativeAccount)
+	}
+	storage.OutboundReceipts = persisted.OutboundReceipts
+
+	storage.PublishStateSnapshot()
+
+	logger.Info("Restored state of the block from local disk", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height)
+	return block
+}
+
+//The persisted state has to match the state root the epoch block commits to.
+func verifyPersistedState(persisted *storage.PersistedState, epochBlock *protocol.EpochBlock) error {
+	if root := protocol.StateRoot(persisted.State); root != epochBlock.MerklePatriciaRoot {
+		return errors.New(fmt.Sprintf("Persisted state has root %x, epoch block %x.", root[0:8], epochBlock.MerklePatriciaRoot[0:8]))
+	}
+
+	return nil
+}
+
+//Epoch blocks only carry the accounts that changed since the previous epoch block. Their state is derived from the
+//state persisted with the previous epoch block and fetched from the peers if that fails, e.g. because the node just
+//joined. A state is only accepted if it matches the MerklePatriciaRoot of the epoch block.
+func epochBlockState(b *protocol.EpochBlock) (map[[32]byte]*protocol.Account, error) {
+	persisted := storage.ReadLastClosedEpochBlockState()
+	if persisted != nil && persisted.BlockHash == b.Hash {
+		if err := verifyPersistedState(persisted, b); err == nil && persisted.State != nil {
+			return persisted.State, nil
+		}
+	} else if persisted != nil {
+		state := storage.ApplyStateDelta(persisted.State, b.StateDelta)
+		if protocol.StateRoot(state) == b.MerklePatriciaRoot {
+			return state, nil
+		}
+		logger.Warn("State delta does not lead to the state root of the epoch block", "hash", b.Hash[0:8], "height", b.Height)
+	}
+
+	return fetchEpochBlockState(b)
+}
+
+//Asks random peers for the state of the epoch block until one sends the state its MerklePatriciaRoot commits to.
+func fetchEpochBlockState(b *protocol.EpochBlock) (map[[32]byte]*protocol.Account, error) {
+	deadline := time.Now().Add(EPOCHBLOCKFETCH_TIMEOUT * time.Second)
+	for time.Now().Before(deadline) {
+		if err := p2p.StateReq(b.Hash); err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		select {
+		case encodedState := <-p2p.StateReqChan:
+			var persisted *storage.PersistedState
+			persisted = persisted.Decode(encodedState)
+			if persisted == nil {
+				p2p.ReportInvalidPayload(encodedState, p2p.MISBEHAVIOR_UNDECODABLE)
+				continue
+			}
+			//A late response to an earlier request is not a violation
+			if persisted.BlockHash != b.Hash {
+				continue
+			}
+			if err := verifyPersistedState(persisted, b); err != nil {
+				logger.Warn("Received state of epoch block not accepted", "hash", b.Hash[0:8], "height", b.Height, "error", err)
+				p2p.ReportInvalidPayload(encodedState, p2p.MISBEHAVIOR_PROTOCOL_VIOLATION)
+				continue
+			}
+			logger.Info("Fetched state of epoch block", "hash", b.Hash[0:8], "height", b.Height, "accounts", len(persisted.State))
+			if persisted.State == nil {
+				persisted.State = make(map[[32]byte]*protocol.Account)
+			}
+			return persisted.State, nil
+		case <-time.After(STATEFETCH_TIMEOUT * time.Second):
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("State of epoch block (%x) not available.", b.Hash[0:8]))
+}
 
 func initFirstCommittee(genesis *protocol.Genesis) {
 	//rootAcc := protocol.NewAccount(genesis.RootAddress, [64]byte{}, activeParameters.Staking_minimum, true, genesis.RootCommitment, nil, nil)
@@ -382,13 +536,15 @@ func initGenesis() (genesis *protocol.Genesis, err error) {
 		select {
 		case encodedGenesis := <-p2p.GenesisReqChan:
 			genesis = genesis.Decode(encodedGenesis)
-			logger.Printf("Received genesis: %v", genesis.String())
+			logger.Info("Received genesis", "hash", genesis.Hash())
 		case <-time.After(GENESISFETCH_TIMEOUT * time.Second):
 			return nil, errors.New("genesis fetch timeout")
 		}
 
 		storage.WriteGenesis(genesis)
 	}
+
+	p2p.SetChainID(genesis.Hash())
 	return genesis, nil
 }
 
@@ -431,11 +587,11 @@ func accStateChange(txSlice []*protocol.AccTx) error {
 func committeeStateChange(txSlice []*protocol.CommitteeTx) (err error) {
 	for _, tx := range txSlice {
 		if tx == nil {
-			logger.Printf("Tx was nil")
+			logger.Warn("Committee transaction is nil")
 		}
 		newAcc := protocol.NewAccount(tx.Account, tx.Issuer, 0, false, true, [crypto.COMM_KEY_LENGTH]byte{}, tx.CommitteeKey, nil, nil)
 		newAccHash := newAcc.Hash()
-		logger.Printf("Got a committee change to handle")
+		logger.Debug("Adding committee account", "tx", tx.Hash(), "account", newAccHash[0:8])
 		acc, _ := storage.GetAccount(newAccHash)
 		if acc != nil {
 			//Shouldn't happen, because this should have been prevented when adding an accTx to the block
@@ -452,8 +608,8 @@ func committeeStateChange(txSlice []*protocol.CommitteeTx) (err error) {
 func aggTxStateChange(txSlice []*protocol.FundsTx, initialSetup bool) (err error) {
 	sort.Sort(ByTxCount(txSlice))
 
-	if err := fundsStateChange(txSlice, initialSetup); err != nil {
-		logger.Printf("Error in aggregated funds tx state change")
+	//Aggregated transfers are never cross-shard, see validateReceipts
+	if err := fundsStateChange(txSlice, nil, initialSetup); err != nil {
 		return err
 	} else {
 		return nil
@@ -481,7 +637,12 @@ func (a ByTxCountData) Len() int           { return len(a) }
 func (a ByTxCountData) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByTxCountData) Less(i, j int) bool { return a[i].TxCnt <= a[j].TxCnt }
 
-func fundsStateChange(txSlice []*protocol.FundsTx, initialSetup bool) (err error) {
+//The receipts are the ones committed in the block, they tell which transactions are cross-shard transfers.
+func fundsStateChange(txSlice []*protocol.FundsTx, receipts []*protocol.Receipt, initialSetup bool) (err error) {
+	crossShardTxs := receiptTxHashes(receipts)
+	//Transactions whose state change was applied in this call, needed to revert them if a contract call fails.
+	var appliedTxSlice []*protocol.FundsTx
+
 	for _, tx := range txSlice {
 
 		//If transaction is in closed tx, the state was adjusted already.
@@ -511,6 +672,16 @@ func fundsStateChange(txSlice []*protocol.FundsTx, initialSetup bool) (err error
 		accSender, err = storage.GetAccount(tx.From)
 		accReceiver, err = storage.GetAccount(tx.To)
 
+		//The receiver has to be known, also if it is credited by another shard, see receipts.go
+		if accReceiver == nil {
+			if rootAcc != nil {
+				rootAcc.Balance -= tx.Amount
+				rootAcc.Balance -= tx.Fee
+			}
+			fundsStateChangeRollback(appliedTxSlice, receipts)
+			return errors.New(fmt.Sprintf("Receiver %x of transaction %x is not in the state.", tx.To[0:8], tx.Hash()))
+		}
+
 		/* TODO RB: PUT BACK IN
 		//Check transaction counter
 		if !initialSetup && tx.Aggregated == false && tx.TxCnt != accSender.TxCnt {
@@ -534,8 +705,11 @@ func fundsStateChange(txSlice []*protocol.FundsTx, initialSetup bool) (err error
 			err = errors.New("Sender is staking and does not have enough funds in order to fulfill the required staking minimum.")
 		}
 
+		//The receiver of a cross-shard transfer is credited by its own shard, see receipts.go
+		crossShard := crossShardTxs[tx.Hash()]
+
 		//Overflow protection
-		if !initialSetup && tx.Amount+accReceiver.Balance > MAX_MONEY {
+		if !initialSetup && !crossShard && tx.Amount+accReceiver.Balance > MAX_MONEY {
 			err = errors.New("Transaction amount would lead to balance overflow at the receiver account.")
 		}
 
@@ -549,10 +723,35 @@ func fundsStateChange(txSlice []*protocol.FundsTx, initialSetup bool) (err error
 			return err
 		}*/
 
+		//The contract is executed on the state before the funds are moved, the same way as during block preparation.
+		if isContractCall(tx, accReceiver) {
+			variables, execErr := execContract(accReceiver, tx, storage.GetAccount)
+			if execErr != nil {
+				if rootAcc != nil {
+					rootAcc.Balance -= tx.Amount
+					rootAcc.Balance -= tx.Fee
+				}
+				fundsStateChangeRollback(appliedTxSlice, receipts)
+				return errors.New(fmt.Sprintf("Contract call %x failed: %v", tx.Hash(), execErr))
+			}
+
+			variablesBefore := make(map[[32]byte][]protocol.ByteArray)
+			for address, contractVariables := range variables {
+				acc, _ := storage.GetAccount(address)
+				variablesBefore[address] = acc.ContractVariables
+				acc.ContractVariables = contractVariables
+			}
+			storage.WriteContractVariablesBeforeTx(tx.Hash(), variablesBefore)
+		}
+
 		//We're manipulating pointer, no need to write back
 		accSender.TxCnt += 1
 		accSender.Balance -= tx.Amount
-		accReceiver.Balance += tx.Amount
+		if !crossShard {
+			accReceiver.Balance += tx.Amount
+		}
+
+		appliedTxSlice = append(appliedTxSlice, tx)
 	}
 	return nil
 }
@@ -656,7 +855,7 @@ func configStateChange(configTxSlice []*protocol.ConfigTx, blockHash [32]byte) {
 		parameterSlice = append(parameterSlice, newParameters)
 		ActiveParameters = &parameterSlice[len(parameterSlice)-1]
 		storage.EpochLength = ActiveParameters.Epoch_length
-		logger.Printf("Config parameters changed. New configuration: %v", *ActiveParameters)
+		logger.Info("Config parameters changed", "parameters", *ActiveParameters)
 	}
 }
 
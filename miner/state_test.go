@@ -0,0 +1,155 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+func TestRestoreState(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	mappingBefore := ValidatorShardMap
+	defer func() {
+		ValidatorShardMap = mappingBefore
+		storage.ValShardMapping = mappingBefore
+	}()
+
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+
+	epochBlock := protocol.NewEpochBlock([][32]byte{}, 2)
+	epochBlock.Hash = [32]byte{'e'}
+	state := make(map[[32]byte]*protocol.Account)
+	for hash, acc := range storage.State {
+		accCopy := *acc
+		state[hash] = &accCopy
+	}
+	epochBlock.ValMapping = protocol.NewMapping()
+	epochBlock.ValMapping.EpochHeight = 2
+	epochBlock.ValMapping.ValMapping[ValidatorAccAddress] = 1
+	epochBlock.MerklePatriciaRoot = protocol.StateRoot(state)
+	storage.WriteLastClosedEpochBlock(epochBlock, state)
+
+	storage.State = make(map[[32]byte]*protocol.Account)
+	if !restoreState(epochBlock) {
+		t.Fatal("Persisted state not restored.\n")
+	}
+	if acc := storage.State[hashAccA]; acc == nil || acc.Balance != accA.Balance {
+		t.Errorf("Restored state does not contain account A: %v\n", acc)
+	}
+	if ValidatorShardMap == nil || ValidatorShardMap.EpochHeight != 2 {
+		t.Errorf("Validator shard mapping not restored: %v\n", ValidatorShardMap)
+	}
+
+	//The persisted state belongs to another epoch block
+	otherEpochBlock := protocol.NewEpochBlock([][32]byte{}, 3)
+	otherEpochBlock.Hash = [32]byte{'o'}
+	if restoreState(otherEpochBlock) {
+		t.Error("State of another epoch block restored.\n")
+	}
+
+	//The persisted state does not match the state root of the epoch block
+	epochBlock.MerklePatriciaRoot[0]++
+	if restoreState(epochBlock) {
+		t.Error("State not matching the epoch block restored.\n")
+	}
+
+	storage.DeleteAllLastClosedEpochBlock()
+}
+
+func TestEpochBlockState(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+
+	previous := protocol.NewEpochBlock([][32]byte{}, 2)
+	previous.Hash = [32]byte{'p'}
+	previous.MerklePatriciaRoot = protocol.StateRoot(storage.State)
+	storage.WriteLastClosedEpochBlock(previous, storage.State)
+
+	//The epoch block only carries the changed account
+	accACopy := *storage.State[hashAccA]
+	accACopy.Balance += 10
+	epochBlock := protocol.NewEpochBlock([][32]byte{}, 3+uint32(ActiveParameters.Epoch_length))
+	epochBlock.Hash = [32]byte{'e'}
+	epochBlock.StateDelta = map[[32]byte]*protocol.Account{hashAccA: &accACopy}
+	expected := storage.ApplyStateDelta(storage.State, epochBlock.StateDelta)
+	epochBlock.MerklePatriciaRoot = protocol.StateRoot(expected)
+
+	state, err := epochBlockState(epochBlock)
+	if err != nil {
+		t.Fatalf("State not derived from the state delta: %v\n", err)
+	}
+	if len(state) != len(storage.State) || state[hashAccA].Balance != accA.Balance+10 {
+		t.Errorf("Wrong state derived: %v\n", state[hashAccA])
+	}
+	if storage.State[hashAccA].Balance != accA.Balance {
+		t.Errorf("Current state changed by the state delta\n")
+	}
+
+	//Once persisted, the state of the epoch block is read from disk
+	storage.WriteLastClosedEpochBlock(epochBlock, state)
+	if state, err := epochBlockState(epochBlock); err != nil || protocol.StateRoot(state) != epochBlock.MerklePatriciaRoot {
+		t.Errorf("Persisted state of the epoch block not used: %v\n", err)
+	}
+
+	storage.DeleteAllLastClosedEpochBlock()
+}
+
+func TestRestoreBlockState(t *testing.T) {
+	cleanAndPrepare()
+	addTestingAccounts()
+	addRootAccounts()
+
+	shardIDBefore := storage.ThisShardID
+	defer func() {
+		storage.ThisShardID = shardIDBefore
+		storage.OutboundReceipts = nil
+	}()
+
+	hashAccA := protocol.SerializeHashContent(accA.Address)
+	storage.ThisShardID = 1
+
+	epochBlock := protocol.NewEpochBlock([][32]byte{}, 2)
+	epochBlock.Hash = [32]byte{'e'}
+
+	block := protocol.NewBlock(epochBlock.Hash, 3)
+	block.Hash = [32]byte{'b'}
+	block.ShardId = 1
+	storage.State[hashAccA].Balance = 42
+	storage.OutboundReceipts = []*protocol.Receipt{{TxHash: [32]byte{'r'}, From: hashAccA, Amount: 1, FromShard: 1}}
+	storage.DeleteAllLastClosedBlock()
+	storage.WriteLastClosedBlock(block)
+
+	storage.State = make(map[[32]byte]*protocol.Account)
+	storage.OutboundReceipts = nil
+	restored := restoreBlockState(epochBlock)
+	if restored == nil || restored.Hash != block.Hash {
+		t.Fatalf("State of the last closed block not restored: %v\n", restored)
+	}
+	if acc := storage.State[hashAccA]; acc == nil || acc.Balance != 42 {
+		t.Errorf("Restored state does not contain the in-epoch balance of account A: %v\n", acc)
+	}
+	if len(storage.OutboundReceipts) != 1 {
+		t.Errorf("Outbound receipts not restored: %v\n", storage.OutboundReceipts)
+	}
+
+	//The last closed block belongs to an earlier epoch
+	laterEpochBlock := protocol.NewEpochBlock([][32]byte{}, 3+uint32(ActiveParameters.Epoch_length))
+	if restoreBlockState(laterEpochBlock) != nil {
+		t.Error("State of a block of another epoch restored.\n")
+	}
+
+	//The node has been assigned to another shard since
+	storage.ThisShardID = 2
+	if restoreBlockState(epochBlock) != nil {
+		t.Error("State of a block of another shard restored.\n")
+	}
+
+	storage.DeleteAllLastClosedBlock()
+}
@@ -28,7 +28,11 @@ func accStateChangeRollback(txSlice []*protocol.AccTx) {
 	}
 }
 
-func fundsStateChangeRollback(txSlice []*protocol.FundsTx) {
+//The receipts are the ones the state change was applied with, a resharding since then must not change which receivers
+//were credited.
+func fundsStateChangeRollback(txSlice []*protocol.FundsTx, receipts []*protocol.Receipt) {
+	crossShardTxs := receiptTxHashes(receipts)
+
 	//Rollback in reverse order than original state change
 	for cnt := len(txSlice) - 1; cnt >= 0; cnt-- {
 		tx := txSlice[cnt]
@@ -38,7 +42,19 @@ func fundsStateChangeRollback(txSlice []*protocol.FundsTx) {
 
 		accSender.TxCnt -= 1
 		accSender.Balance += tx.Amount
-		accReceiver.Balance -= tx.Amount
+		if !crossShardTxs[tx.Hash()] {
+			accReceiver.Balance -= tx.Amount
+		}
+
+		//Revert the changes a contract call made to the contract variables, including the ones of external contracts
+		if variablesBefore, exists := storage.ReadContractVariablesBeforeTx(tx.Hash()); exists {
+			for address, contractVariables := range variablesBefore {
+				if acc, _ := storage.GetAccount(address); acc != nil {
+					acc.ContractVariables = contractVariables
+				}
+			}
+			storage.DeleteContractVariablesBeforeTx(tx.Hash())
+		}
 
 		//If new coins were issued, revert
 		if rootAcc, _ := storage.GetRootAccount(tx.From); rootAcc != nil {
@@ -140,7 +156,8 @@ func aggregatedStateRollback(txSlice []*protocol.AggTx, blockHash [32]byte, mine
 
 		//do normal rollback for fundsTx And Fees
 		sort.Sort(ByTxCount(fundsTxSlice))
-		fundsStateChangeRollback(fundsTxSlice)
+		//Aggregated transfers are never cross-shard
+		fundsStateChangeRollback(fundsTxSlice, nil)
 		collectTxFeesRollback(nil, fundsTxSlice, nil, nil, minerHash)
 		fundsTxSlice = fundsTxSlice[:0]
 	}
@@ -162,7 +179,7 @@ func configStateChangeRollback(txSlice []*protocol.ConfigTx, blockHash [32]byte)
 	parameterSlice = parameterSlice[:len(parameterSlice)-1]
 	ActiveParameters = &parameterSlice[len(parameterSlice)-1]
 	storage.EpochLength = ActiveParameters.Epoch_length
-	logger.Printf("Config parameters rolled back. New configuration: %v", *ActiveParameters)
+	logger.Info("Config parameters rolled back", "parameters", *ActiveParameters)
 }
 
 func stakeStateChangeRollback(txSlice []*protocol.StakeTx) {
@@ -0,0 +1,189 @@
+package miner
+
+import (
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"sync"
+	"time"
+)
+
+//Missing blocks are downloaded by height range. Every range is split into chunks, which are requested from several
+//miners at the same time. A chunk a miner cannot deliver completely is requested from the next miner. Only one sync
+//runs at a time per source, since all answers arrive on the same channel. Light clients download the headers the
+//same way.
+type syncSource struct {
+	mutex   *sync.Mutex
+	peers   func() []string
+	request func(address string, shardID int, from uint32, count uint32) error
+	answers chan *p2p.BlockRange
+}
+
+var (
+	blockSource  = &syncSource{&sync.Mutex{}, p2p.RangePeers, p2p.BlocksByRangeReq, p2p.BlocksByRangeChan}
+	headerSource = &syncSource{&sync.Mutex{}, p2p.HeaderRangePeers, p2p.BlockHeadersByRangeReq, p2p.BlockHeadersByRangeChan}
+)
+
+//Heights from and up to from+count-1 of a shard.
+type blockRange struct {
+	shardID int
+	from    uint32
+	count   uint32
+}
+
+type syncChunk struct {
+	blockRange
+	sent time.Time
+	//Miners the chunk was requested from
+	tried map[string]bool
+}
+
+func (chunk *syncChunk) contains(block *protocol.Block) bool {
+	return block.ShardId == chunk.shardID && block.Height >= chunk.from && block.Height-chunk.from < chunk.count
+}
+
+//Returns the part of the chunk above the highest received block, nil if the chunk is complete. Heights below the
+//highest received block without a block belong to epoch blocks.
+func (chunk *syncChunk) rest(received map[blockRange]*protocol.Block) *syncChunk {
+	next := chunk.from
+	for height := chunk.from; height-chunk.from < chunk.count; height++ {
+		if received[blockRange{chunk.shardID, height, 1}] != nil {
+			next = height + 1
+		}
+	}
+
+	if next-chunk.from >= chunk.count {
+		return nil
+	}
+
+	return &syncChunk{blockRange{chunk.shardID, next, chunk.count - (next - chunk.from)}, time.Time{}, chunk.tried}
+}
+
+//Downloads the blocks of the given ranges and returns them per range in height order. Blocks that do not link to the
+//block at the height below are left out, as well as everything above them.
+func syncBlocks(ranges []blockRange) [][]*protocol.Block {
+	return blockSource.sync(ranges)
+}
+
+func (source *syncSource) sync(ranges []blockRange) [][]*protocol.Block {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	//Drop answers to an earlier sync
+	for len(source.answers) > 0 {
+		<-source.answers
+	}
+
+	var pending []*syncChunk
+	for _, r := range ranges {
+		for from := r.from; from-r.from < r.count; from += SYNC_CHUNK_SIZE {
+			count := r.count - (from - r.from)
+			if count > SYNC_CHUNK_SIZE {
+				count = SYNC_CHUNK_SIZE
+			}
+			pending = append(pending, &syncChunk{blockRange{r.shardID, from, count}, time.Time{}, make(map[string]bool)})
+		}
+	}
+
+	received := make(map[blockRange]*protocol.Block)
+	assigned := make(map[string]*syncChunk)
+	miners := source.peers()
+	for {
+		pending = source.assignChunks(pending, miners, assigned)
+		if len(assigned) == 0 {
+			//Either all blocks are there or no miner is left to ask
+			break
+		}
+
+		select {
+		case response := <-source.answers:
+			chunk := assigned[response.Peer]
+			if chunk == nil {
+				continue
+			}
+			for _, encodedBlock := range response.Blocks {
+				var block *protocol.Block
+				if block = block.Decode(encodedBlock); block == nil || !chunk.contains(block) {
+					continue
+				}
+				p2p.LinkSender(encodedBlock, block.HashBlock())
+				key := blockRange{block.ShardId, block.Height, 1}
+				if received[key] == nil {
+					received[key] = block
+				}
+			}
+			if response.Last {
+				delete(assigned, response.Peer)
+				if rest := chunk.rest(received); rest != nil {
+					pending = append(pending, rest)
+				}
+			}
+		case <-time.After(time.Second):
+			for miner, chunk := range assigned {
+				if time.Since(chunk.sent) > SYNC_TIMEOUT*time.Second {
+					logger.Warn("Timed out syncing blocks", "shard", chunk.shardID, "from", chunk.from, "count", chunk.count, "peer", miner)
+					delete(assigned, miner)
+					if rest := chunk.rest(received); rest != nil {
+						pending = append(pending, rest)
+					}
+				}
+			}
+		}
+	}
+
+	blocks := make([][]*protocol.Block, len(ranges))
+	for i, r := range ranges {
+		blocks[i] = orderBlocks(r, received)
+	}
+
+	return blocks
+}
+
+//Requests every pending chunk from an idle miner that was not asked for it yet. Chunks no miner is left for are
+//dropped, the others stay pending.
+func (source *syncSource) assignChunks(pending []*syncChunk, miners []string, assigned map[string]*syncChunk) (stillPending []*syncChunk) {
+	for _, chunk := range pending {
+		candidates := 0
+		for _, miner := range miners {
+			if chunk.tried[miner] {
+				continue
+			}
+			candidates++
+			if assigned[miner] != nil {
+				continue
+			}
+			chunk.tried[miner] = true
+			if err := source.request(miner, chunk.shardID, chunk.from, chunk.count); err == nil {
+				chunk.sent = time.Now()
+				assigned[miner] = chunk
+				break
+			}
+		}
+
+		if candidates > 0 && chunk.sent.IsZero() {
+			stillPending = append(stillPending, chunk)
+		} else if candidates == 0 {
+			logger.Debug("No miner has the blocks", "shard", chunk.shardID, "from", chunk.from, "count", chunk.count)
+		}
+	}
+
+	return stillPending
+}
+
+//Blocks of the range in height order, validated against the block at the height below if there is one. At the other
+//heights, the previous block is an epoch block.
+func orderBlocks(r blockRange, received map[blockRange]*protocol.Block) (blocks []*protocol.Block) {
+	for height := r.from; height-r.from < r.count; height++ {
+		if block := received[blockRange{r.shardID, height, 1}]; block != nil {
+			blocks = append(blocks, block)
+		}
+	}
+
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].Height == blocks[i-1].Height+1 && blocks[i].PrevHash != blocks[i-1].Hash {
+			logger.Warn("Synced block does not link to the block below", "shard", r.shardID, "height", blocks[i].Height)
+			return blocks[:i]
+		}
+	}
+
+	return blocks
+}
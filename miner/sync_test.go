@@ -0,0 +1,49 @@
+package miner
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"testing"
+)
+
+func TestSyncChunkRest(t *testing.T) {
+	chunk := &syncChunk{blockRange: blockRange{1, 10, 5}, tried: map[string]bool{"127.0.0.1:8000": true}}
+	received := make(map[blockRange]*protocol.Block)
+
+	if rest := chunk.rest(received); rest == nil || rest.blockRange != chunk.blockRange || !rest.tried["127.0.0.1:8000"] {
+		t.Errorf("Wrong rest of an empty chunk: %v\n", rest)
+	}
+
+	//Heights below the highest received block are not requested again
+	received[blockRange{1, 12, 1}] = protocol.NewBlock([32]byte{}, 12)
+	if rest := chunk.rest(received); rest == nil || rest.blockRange != (blockRange{1, 13, 2}) {
+		t.Errorf("Wrong rest of a partial chunk: %v\n", rest)
+	}
+
+	received[blockRange{1, 14, 1}] = protocol.NewBlock([32]byte{}, 14)
+	if rest := chunk.rest(received); rest != nil {
+		t.Errorf("Rest of a complete chunk: %v\n", rest)
+	}
+}
+
+func TestOrderBlocks(t *testing.T) {
+	b1 := protocol.NewBlock([32]byte{}, 1)
+	b1.Hash = [32]byte{1}
+	b2 := protocol.NewBlock(b1.Hash, 2)
+	b2.Hash = [32]byte{2}
+	//Follows an epoch block at height 3
+	b4 := protocol.NewBlock([32]byte{3}, 4)
+	b4.Hash = [32]byte{4}
+	//Does not link to b4
+	b5 := protocol.NewBlock([32]byte{0xff}, 5)
+	b5.Hash = [32]byte{5}
+
+	received := make(map[blockRange]*protocol.Block)
+	for _, b := range []*protocol.Block{b5, b4, b2, b1} {
+		received[blockRange{b.ShardId, b.Height, 1}] = b
+	}
+
+	blocks := orderBlocks(blockRange{b1.ShardId, 1, 10}, received)
+	if len(blocks) != 3 || blocks[0] != b1 || blocks[1] != b2 || blocks[2] != b4 {
+		t.Errorf("Wrong order of synced blocks: %v\n", blocks)
+	}
+}
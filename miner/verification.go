@@ -14,33 +14,61 @@ import (
 //should only be of concern to the miner, not to the protocol package. However, this has the disadvantage
 //that we have to do case distinction here.
 func verify(tx protocol.Transaction) bool {
+	return verifyAgainst(tx, storage.State, storage.RootKeys)
+}
+
+//Verifies transactions submitted by clients outside of the miner's goroutine, e.g. over rpc. Since the miner changes
+//the state concurrently, the transaction is verified against the state of the last closed block. On top of the
+//signatures, funds transactions are checked against the sender's balance and transaction count.
+func VerifyTx(tx protocol.Transaction) bool {
+	state, rootKeys := storage.ReadStateSnapshot()
+	if !verifyAgainst(tx, state, rootKeys) {
+		return false
+	}
+
+	if fundsTx, ok := tx.(*protocol.FundsTx); ok {
+		accFrom := state[fundsTx.From]
+		if fundsTx.TxCnt < accFrom.TxCnt {
+			logger.Debug("Transaction count of the sender already used", "tx", fundsTx.Hash(), "from", fundsTx.From[0:8], "txCnt", fundsTx.TxCnt)
+			return false
+		}
+		if accFrom.Balance < fundsTx.Amount+fundsTx.Fee {
+			logger.Debug("Sender can't cover amount and fee", "tx", fundsTx.Hash(), "from", fundsTx.From[0:8])
+			return false
+		}
+	}
+
+	return true
+}
+
+func verifyAgainst(tx protocol.Transaction, state, rootKeys map[[32]byte]*protocol.Account) bool {
 	var verified bool
 
 	switch tx.(type) {
 	case *protocol.FundsTx:
-		verified = verifyFundsTx(tx.(*protocol.FundsTx))
+		verified = verifyFundsTx(tx.(*protocol.FundsTx), state)
 	case *protocol.AccTx:
-		verified = verifyAccTx(tx.(*protocol.AccTx))
+		verified = verifyAccTx(tx.(*protocol.AccTx), rootKeys)
 	case *protocol.ConfigTx:
-		verified = verifyConfigTx(tx.(*protocol.ConfigTx))
+		verified = verifyConfigTx(tx.(*protocol.ConfigTx), rootKeys)
 	case *protocol.StakeTx:
-		verified = verifyStakeTx(tx.(*protocol.StakeTx))
+		verified = verifyStakeTx(tx.(*protocol.StakeTx), state)
 	case *protocol.CommitteeTx:
-		verified = verifyCommitteeTx(tx.(*protocol.CommitteeTx))
+		verified = verifyCommitteeTx(tx.(*protocol.CommitteeTx), rootKeys)
 	case *protocol.AggTx:
 		verified = verifyAggTx(tx.(*protocol.AggTx))
 	case *protocol.DataTx:
-		verified = verifyDataTx(tx.(*protocol.DataTx))
+		verified = verifyDataTx(tx.(*protocol.DataTx), state)
 	case *protocol.AggDataTx:
 		verified = verifyAggDataTx(tx.(*protocol.AggDataTx))
 	case *protocol.FineTx:
-		verified = verifyFineTx(tx.(*protocol.FineTx))
+		verified = verifyFineTx(tx.(*protocol.FineTx), state)
 	}
 
 	return verified
 }
 
-func verifyFundsTx(tx *protocol.FundsTx) bool {
+func verifyFundsTx(tx *protocol.FundsTx, state map[[32]byte]*protocol.Account) bool {
 
 
 
@@ -53,17 +81,17 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 
 	//fundsTx only makes sense if amount > 0
 	if tx.Amount == 0 || tx.Amount > MAX_MONEY {
-		logger.Printf("Invalid transaction amount: %v\n", tx.Amount)
+		logger.Debug("Invalid transaction amount", "tx", tx.Hash(), "amount", tx.Amount)
 		return false
 	}
 
 	//Check if accounts are present in the actual state
-	accFrom := storage.State[tx.From]
-	accTo := storage.State[tx.To]
+	accFrom := state[tx.From]
+	accTo := state[tx.To]
 
 	//Accounts non existent
 	if accFrom == nil || accTo == nil {
-		logger.Printf("Account non existent. From: %v\nTo: %v\n", accFrom, accTo)
+		logger.Debug("Account of the transaction does not exist", "tx", tx.Hash(), "from", tx.From[0:8], "to", tx.To[0:8])
 		return false
 	}
 
@@ -89,7 +117,7 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 		tx.To = accToHash
 		validSig1 = true
 	} else {
-		logger.Printf("Sig1 invalid. FromHash: %x\nToHash: %x\n", accFromHash[0:8], accToHash[0:8])
+		logger.Debug("First signature invalid", "tx", txHash, "from", accFromHash[0:8], "to", accToHash[0:8])
 		return false
 	}
 
@@ -99,7 +127,7 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 	if ecdsa.Verify(multisigPubKey, txHash[:], r, s) {
 		validSig2 = true
 	} else {
-		logger.Printf("Sig2 invalid. FromHash: %x\nToHash: %x\n", accFromHash[0:8], accToHash[0:8])
+		logger.Debug("Second signature invalid", "tx", txHash, "from", accFromHash[0:8], "to", accToHash[0:8])
 		return false
 	}
 
@@ -107,9 +135,9 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 
 }
 
-func verifyAccTx(tx *protocol.AccTx) bool {
+func verifyAccTx(tx *protocol.AccTx, rootKeys map[[32]byte]*protocol.Account) bool {
 	if tx == nil {
-		logger.Printf("Acctx is nil")
+		logger.Debug("Account transaction is nil")
 		return false
 	}
 
@@ -119,7 +147,7 @@ func verifyAccTx(tx *protocol.AccTx) bool {
 	r.SetBytes(tx.Sig[:32])
 	s.SetBytes(tx.Sig[32:])
 
-	for _, rootAcc := range storage.RootKeys {
+	for _, rootAcc := range rootKeys {
 		pub1.SetBytes(rootAcc.Address[:32])
 		pub2.SetBytes(rootAcc.Address[32:])
 
@@ -130,14 +158,14 @@ func verifyAccTx(tx *protocol.AccTx) bool {
 		if ecdsa.Verify(&pubKey, txHash[:], r, s) == true {
 			return true
 		} else {
-			logger.Printf("Pubkey cant be verified from the AccTx")
+			logger.Debug("Account transaction not signed by this root key", "tx", txHash)
 		}
 	}
 
 	return false
 }
 
-func verifyConfigTx(tx *protocol.ConfigTx) bool {
+func verifyConfigTx(tx *protocol.ConfigTx, rootKeys map[[32]byte]*protocol.Account) bool {
 	if tx == nil {
 		return false
 	}
@@ -149,7 +177,7 @@ func verifyConfigTx(tx *protocol.ConfigTx) bool {
 	r.SetBytes(tx.Sig[:32])
 	s.SetBytes(tx.Sig[32:])
 
-	for _, rootAcc := range storage.RootKeys {
+	for _, rootAcc := range rootKeys {
 		pub1.SetBytes(rootAcc.Address[:32])
 		pub2.SetBytes(rootAcc.Address[32:])
 
@@ -163,18 +191,18 @@ func verifyConfigTx(tx *protocol.ConfigTx) bool {
 	return false
 }
 
-func verifyStakeTx(tx *protocol.StakeTx) bool {
+func verifyStakeTx(tx *protocol.StakeTx, state map[[32]byte]*protocol.Account) bool {
 	if tx == nil {
-		logger.Println("Transactions does not exist.")
+		logger.Debug("Transaction is nil")
 		return false
 	}
 
 	//Check if account is present in the actual state
-	accFrom := storage.State[tx.Account]
+	accFrom := state[tx.Account]
 
 	//Account non existent
 	if accFrom == nil {
-		logger.Println("Account does not exist.")
+		logger.Debug("Account of the transaction does not exist", "tx", tx.Hash(), "account", tx.Account[0:8])
 		return false
 	}
 
@@ -198,9 +226,9 @@ func verifyStakeTx(tx *protocol.StakeTx) bool {
 	return ecdsa.Verify(&pubKey, txHash[:], r, s)
 }
 
-func verifyCommitteeTx(tx *protocol.CommitteeTx) bool {
+func verifyCommitteeTx(tx *protocol.CommitteeTx, rootKeys map[[32]byte]*protocol.Account) bool {
 	if tx == nil {
-		logger.Printf("CommitteeTx is nil")
+		logger.Debug("Committee transaction is nil")
 		return false
 	}
 
@@ -211,7 +239,7 @@ func verifyCommitteeTx(tx *protocol.CommitteeTx) bool {
 	s.SetBytes(tx.Sig[32:])
 
 
-	for _, rootAcc := range storage.RootKeys {
+	for _, rootAcc := range rootKeys {
 		pub1.SetBytes(rootAcc.Address[:32])
 		pub2.SetBytes(rootAcc.Address[32:])
 
@@ -223,14 +251,14 @@ func verifyCommitteeTx(tx *protocol.CommitteeTx) bool {
 			return true
 		}
 	}
-	logger.Printf("Pubkey cant be verified from the CommitteeTx")
+	logger.Debug("Committee transaction not signed by a root key", "tx", tx.Hash())
 	return false
 }
 
 //TODO Update this function
 func verifyAggTx(tx *protocol.AggTx) bool {
 	if tx == nil {
-		logger.Println("Transactions does not exist.")
+		logger.Debug("Transaction is nil")
 		return false
 	}
 
@@ -239,12 +267,12 @@ func verifyAggTx(tx *protocol.AggTx) bool {
 
 func verifyAggDataTx(tx *protocol.AggDataTx) bool {
 	if tx == nil {
-		logger.Printf("Transaction does not exist")
+		logger.Debug("Transaction is nil")
 	}
 	return true
 }
 
-func verifyFineTx(tx *protocol.FineTx) bool {
+func verifyFineTx(tx *protocol.FineTx, state map[[32]byte]*protocol.Account) bool {
 	if tx == nil {
 		return false
 	}
@@ -254,17 +282,17 @@ func verifyFineTx(tx *protocol.FineTx) bool {
 
 	//fundsTx only makes sense if amount > 0
 	if tx.Amount == 0 || tx.Amount > MAX_MONEY {
-		logger.Printf("Invalid transaction amount: %v\n", tx.Amount)
+		logger.Debug("Invalid transaction amount", "tx", tx.Hash(), "amount", tx.Amount)
 		return false
 	}
 
 	//Check if accounts are present in the actual state
-	accFrom := storage.State[tx.From]
-	accTo := storage.State[tx.To]
+	accFrom := state[tx.From]
+	accTo := state[tx.To]
 
 	//Accounts non existent
 	if accFrom == nil || accTo == nil {
-		logger.Printf("Account non existent. From: %v\nTo: %v\n", accFrom, accTo)
+		logger.Debug("Account of the transaction does not exist", "tx", tx.Hash(), "from", tx.From[0:8], "to", tx.To[0:8])
 		return false
 	}
 
@@ -294,7 +322,7 @@ func verifyFineTx(tx *protocol.FineTx) bool {
 		tx.To = accToHash
 		validSig1 = true
 	} else {
-		logger.Printf("Sig1 invalid. FromHash: %x\nToHash: %x\n", accFromHash[0:8], accToHash[0:8])
+		logger.Debug("First signature invalid", "tx", txHash, "from", accFromHash[0:8], "to", accToHash[0:8])
 		return false
 	}
 
@@ -302,9 +330,9 @@ func verifyFineTx(tx *protocol.FineTx) bool {
 	return validSig1
 }
 
-func verifyDataTx(tx *protocol.DataTx) bool {
+func verifyDataTx(tx *protocol.DataTx, state map[[32]byte]*protocol.Account) bool {
 	if tx == nil {
-		logger.Printf("Transaction does not exist")
+		logger.Debug("Transaction is nil")
 		return false
 	}
 
@@ -313,12 +341,12 @@ func verifyDataTx(tx *protocol.DataTx) bool {
 
 
 	//Check if accounts are present in the actual state
-	accFrom := storage.State[tx.From]
-	accTo := storage.State[tx.To]
+	accFrom := state[tx.From]
+	accTo := state[tx.To]
 
 	//Accounts non existent
 	if accFrom == nil || accTo == nil {
-		logger.Printf("Account non existent. From: %v\nTo: %v\n", accFrom, accTo)
+		logger.Debug("Account of the transaction does not exist", "tx", tx.Hash(), "from", tx.From[0:8], "to", tx.To[0:8])
 		return false
 	}
 
@@ -344,7 +372,7 @@ func verifyDataTx(tx *protocol.DataTx) bool {
 		tx.To = accToHash
 		validSig1 = true
 	} else {
-		logger.Printf("Sig1 invalid. FromHash: %x\nToHash: %x\n", accFromHash[0:8], accToHash[0:8])
+		logger.Debug("First signature invalid", "tx", txHash, "from", accFromHash[0:8], "to", accToHash[0:8])
 		return false
 	}
 
@@ -354,7 +382,7 @@ func verifyDataTx(tx *protocol.DataTx) bool {
 	if ecdsa.Verify(multisigPubKey, txHash[:], r, s) {
 		validSig2 = true
 	} else {
-		logger.Printf("Sig2 invalid. FromHash: %x\nToHash: %x\n", accFromHash[0:8], accToHash[0:8])
+		logger.Debug("Second signature invalid", "tx", txHash, "from", accFromHash[0:8], "to", accToHash[0:8])
 		return false
 	}
 
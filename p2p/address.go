@@ -0,0 +1,224 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+//Addresses are exchanged as type, length, host and port, such that IPv4 and IPv6 addresses as well as hostnames can
+//be advertised.
+const (
+	ADDRESS_TYPE_IPV4     = 1
+	ADDRESS_TYPE_IPV6     = 2
+	ADDRESS_TYPE_HOSTNAME = 3
+
+	MAX_HOSTNAME_LENGTH = 255
+)
+
+var (
+	//Address the listener binds to, all interfaces on the port of the node's own address if empty
+	listenAddress string
+	//Address other nodes can reach this node at, the node's address if empty
+	advertiseAddress string
+	addressMutex     = &sync.RWMutex{}
+)
+
+//Has to be called before Init.
+func SetListenAddress(address string) {
+	addressMutex.Lock()
+	defer addressMutex.Unlock()
+
+	listenAddress = address
+}
+
+func getListenAddress(ipport string) string {
+	addressMutex.RLock()
+	defer addressMutex.RUnlock()
+
+	if listenAddress != "" {
+		return listenAddress
+	}
+
+	_, port := splitAddress(ipport)
+	return ":" + port
+}
+
+//Nodes behind a NAT or in a container advertise the address they are reachable at instead of their own.
+func SetAdvertiseAddress(address string) {
+	addressMutex.Lock()
+	defer addressMutex.Unlock()
+
+	advertiseAddress = address
+}
+
+func getAdvertiseAddress() string {
+	addressMutex.RLock()
+	defer addressMutex.RUnlock()
+
+	if advertiseAddress != "" {
+		return advertiseAddress
+	}
+
+	return Ipport
+}
+
+//Port sent in the handshake, other nodes connect to it.
+func getAdvertisedPort() (int, error) {
+	_, port, err := net.SplitHostPort(getAdvertiseAddress())
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(port)
+}
+
+//Tells the peer the address this node is reachable at.
+func sendAddress(p *peer) {
+	encoded, err := encodeAddress(getAdvertiseAddress())
+	if err != nil {
+		logger.Warn("Cannot advertise address", "address", getAdvertiseAddress(), "error", err)
+		return
+	}
+
+	sendData(p, BuildPacket(ADDR, encoded))
+}
+
+func processAddress(p *peer, payload []byte) {
+	address, size, err := decodeAddress(payload)
+	if err != nil || size != len(payload) {
+		logger.Warn("Invalid address", "peer", p.getIPPort(), "error", err)
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	p.setAdvertisedAddress(address, false)
+	learnAddress(address)
+	go verifyAddress(p, address)
+}
+
+//Dials the advertised address back and checks that the node there proves the same identity as the peer. Peers
+//without an identity can't be recognized at another address, their advertised address stays unverified.
+func verifyAddress(p *peer, address string) {
+	if p.identity == nil || !p.identity.verify() || peerSelfConn(address) {
+		return
+	}
+
+	conn, identity, err := dialSecure(address)
+	if err != nil {
+		logger.Debug("Advertised address not reachable", "peer", p.getIPPort(), "address", address, "error", err)
+		return
+	}
+	conn.Close()
+
+	if identity == nil || identity.Address != p.identity.Address || identity.KeyType != p.identity.KeyType || !identity.verify() {
+		logger.Warn("Advertised address belongs to another node", "peer", p.getIPPort(), "address", address)
+		return
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+	if p.advertisedAddress == address {
+		p.addressVerified = true
+	}
+}
+
+func encodeAddress(address string) ([]byte, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	var addressType uint8
+	var hostBytes []byte
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		addressType, hostBytes = ADDRESS_TYPE_IPV4, ip.To4()
+	} else if ip != nil {
+		addressType, hostBytes = ADDRESS_TYPE_IPV6, ip.To16()
+	} else if len(host) > 0 && len(host) <= MAX_HOSTNAME_LENGTH {
+		addressType, hostBytes = ADDRESS_TYPE_HOSTNAME, []byte(host)
+	} else {
+		return nil, errors.New(fmt.Sprintf("invalid host %q", host))
+	}
+
+	encoded := make([]byte, 2+len(hostBytes)+PORT_SIZE)
+	encoded[0] = addressType
+	encoded[1] = uint8(len(hostBytes))
+	copy(encoded[2:], hostBytes)
+	binary.BigEndian.PutUint16(encoded[2+len(hostBytes):], uint16(port))
+
+	return encoded, nil
+}
+
+//Returns the address and the number of bytes it took up.
+func decodeAddress(encoded []byte) (string, int, error) {
+	if len(encoded) < 2 {
+		return "", 0, errors.New("address truncated")
+	}
+
+	addressType, hostLength := encoded[0], int(encoded[1])
+	size := 2 + hostLength + PORT_SIZE
+	if len(encoded) < size {
+		return "", 0, errors.New("address truncated")
+	}
+
+	hostBytes := encoded[2 : 2+hostLength]
+	var host string
+	switch {
+	case addressType == ADDRESS_TYPE_IPV4 && hostLength == net.IPv4len:
+		host = net.IP(hostBytes).String()
+	case addressType == ADDRESS_TYPE_IPV6 && hostLength == net.IPv6len:
+		host = net.IP(hostBytes).String()
+	case addressType == ADDRESS_TYPE_HOSTNAME && hostLength > 0:
+		host = string(hostBytes)
+	default:
+		return "", 0, errors.New(fmt.Sprintf("invalid address of type %v and length %v", addressType, hostLength))
+	}
+
+	port := binary.BigEndian.Uint16(encoded[2+hostLength : size])
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), size, nil
+}
+
+//Addresses that cannot be encoded are left out.
+func encodeAddressList(addresses []string) []byte {
+	var encoded []byte
+	for _, address := range addresses {
+		if encodedAddress, err := encodeAddress(address); err == nil {
+			encoded = append(encoded, encodedAddress...)
+		}
+	}
+
+	return encoded
+}
+
+func decodeAddressList(encoded []byte) ([]string, error) {
+	var addresses []string
+	for len(encoded) > 0 {
+		address, size, err := decodeAddress(encoded)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+		encoded = encoded[size:]
+	}
+
+	return addresses, nil
+}
+
+//Host and port of an address. Addresses without a port, e.g. of in-memory connections, are returned as host.
+func splitAddress(address string) (string, string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, ""
+	}
+
+	return host, port
+}
@@ -0,0 +1,79 @@
+package p2p
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+//Connection with a fixed remote address.
+type remoteAddrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (conn *remoteAddrConn) RemoteAddr() net.Addr {
+	return conn.remote
+}
+
+func newRemotePeer(t *testing.T, remote string, listenerPort string) *peer {
+	addr, err := net.ResolveTCPAddr("tcp", remote)
+	if err != nil {
+		t.Fatalf("Could not resolve %v: %v\n", remote, err)
+	}
+
+	conn, _ := net.Pipe()
+	return newPeer(&remoteAddrConn{conn, addr}, listenerPort, PEERTYPE_MINER)
+}
+
+func TestAddressEncoding(t *testing.T) {
+	addresses := []string{"127.0.0.1:8000", "[2001:db8::1]:8001", "miner.bazo.example:40000"}
+
+	encoded := encodeAddressList(addresses)
+	decoded, err := decodeAddressList(encoded)
+	if err != nil || !reflect.DeepEqual(addresses, decoded) {
+		t.Errorf("Addresses not decoded: %v, %v\n", decoded, err)
+	}
+
+	if _, err := decodeAddressList(encoded[:len(encoded)-1]); err == nil {
+		t.Errorf("Truncated address decoded\n")
+	}
+
+	for _, invalid := range []string{"127.0.0.1", ":8000", "127.0.0.1:70000"} {
+		if _, err := encodeAddress(invalid); err == nil {
+			t.Errorf("Invalid address %v encoded\n", invalid)
+		}
+	}
+
+	//IPv4 addresses in IPv6 notation are sent as IPv4
+	if encoded, _ := encodeAddress("[::ffff:10.0.0.1]:8000"); encoded[0] != ADDRESS_TYPE_IPV4 {
+		t.Errorf("IPv4-mapped address not sent as IPv4\n")
+	}
+}
+
+func TestNeighborList(t *testing.T) {
+	ipv4 := newRemotePeer(t, "10.0.0.1:51234", "8000")
+	ipv6 := newRemotePeer(t, "[2001:db8::1]:51234", "8001")
+	nat := newRemotePeer(t, "172.17.0.2:51234", "8002")
+	nat.setAdvertisedAddress("miner.bazo.example:9000", false)
+	peerList := []*peer{ipv4, ipv6, nat}
+
+	if ipv6.getIPPort() != "[2001:db8::1]:8001" {
+		t.Errorf("Wrong address of IPv6 peer: %v\n", ipv6.getIPPort())
+	}
+
+	//The advertised address could be the address of any other node until it is verified
+	if !nat.hasAddress("172.17.0.2:8002") || nat.hasAddress("miner.bazo.example:9000") {
+		t.Errorf("Peer not found by its remote address or by its unverified advertised address\n")
+	}
+	nat.setAdvertisedAddress("miner.bazo.example:9000", true)
+	if !nat.hasAddress("miner.bazo.example:9000") {
+		t.Errorf("Peer not found by its verified advertised address\n")
+	}
+
+	addresses, err := decodeAddressList(neighborList(peerList))
+	expected := []string{"10.0.0.1:8000", "[2001:db8::1]:8001", "miner.bazo.example:9000"}
+	if err != nil || !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("Wrong neighbor list: %v, %v\n", addresses, err)
+	}
+}
@@ -0,0 +1,202 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/metrics"
+	"github.com/oigele/bazo-miner/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+//The address book keeps the miners this node knows about, when they were last seen and how often connecting to them
+//succeeded or failed. It is persisted, such that a restarted node does not depend on the bootstrap servers. Whenever
+//the node has less than MIN_MINERS miners, the most promising addresses are queued for the health check to dial.
+var (
+	addressBook      = make(map[string]*storage.PeerRecord)
+	addressBookMutex = &sync.Mutex{}
+
+	addressBookMetric = metrics.NewGaugeFunc("p2p_address_book_size", "Number of miner addresses in the address book.", func() float64 {
+		addressBookMutex.Lock()
+		defer addressBookMutex.Unlock()
+		return float64(len(addressBook))
+	})
+)
+
+//Loads the persisted address book, the bootstrap servers are always part of it.
+func initAddressBook() {
+	addressBookMutex.Lock()
+	defer addressBookMutex.Unlock()
+
+	addressBook = make(map[string]*storage.PeerRecord)
+	for _, record := range storage.ReadPeerRecords() {
+		addressBook[record.Address] = record
+	}
+
+	for _, server := range storage.BootstrapServers {
+		if _, exists := addressBook[server]; !exists {
+			addressBook[server] = &storage.PeerRecord{Address: server}
+			storage.WritePeerRecord(addressBook[server])
+		}
+	}
+}
+
+//Records an address advertised by another miner or by the miner itself.
+func learnAddress(address string) {
+	if peerSelfConn(address) {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	addressBookMutex.Lock()
+	defer addressBookMutex.Unlock()
+
+	record, exists := addressBook[address]
+	if !exists {
+		if len(addressBook) >= MAX_ADDRESS_BOOK_SIZE && !evictAddress() {
+			return
+		}
+		record = &storage.PeerRecord{Address: address}
+		addressBook[address] = record
+	} else if now-record.LastSeen < ADDRESS_SEEN_INTERVAL {
+		//Miners are advertised in every neighbor list, the record is not written every time
+		return
+	}
+
+	record.LastSeen = now
+	storage.WritePeerRecord(record)
+}
+
+//Records the outcome of dialing an address. Addresses that failed MAX_ADDRESS_FAILURES times in a row are forgotten,
+//except for the bootstrap servers.
+func recordAttempt(address string, success bool) {
+	now := time.Now().Unix()
+
+	addressBookMutex.Lock()
+	defer addressBookMutex.Unlock()
+
+	record, exists := addressBook[address]
+	if !exists {
+		if !success {
+			return
+		}
+		record = &storage.PeerRecord{Address: address}
+		addressBook[address] = record
+	}
+
+	record.LastAttempt = now
+	if success {
+		record.LastSeen = now
+		record.Successes++
+		record.Failures = 0
+	} else {
+		record.Failures++
+	}
+
+	if record.Failures >= MAX_ADDRESS_FAILURES && !isBootstrapServer(address) {
+		delete(addressBook, address)
+		storage.DeletePeerRecord(address)
+		return
+	}
+
+	storage.WritePeerRecord(record)
+}
+
+//Returns up to n addresses that are neither connected nor banned and were not dialed recently. Addresses that could be
+//connected to before come first. Called without the addressBookMutex held.
+func addressBookCandidates(n int, now time.Time) []string {
+	addressBookMutex.Lock()
+	var addresses []string
+	var candidates []*storage.PeerRecord
+	for _, record := range addressBook {
+		if record.LastAttempt > 0 && now.Unix()-record.LastAttempt < retryDelay(record) {
+			continue
+		}
+		candidates = append(candidates, record)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return betterRecord(candidates[i], candidates[j])
+	})
+	for _, record := range candidates {
+		addresses = append(addresses, record.Address)
+	}
+	addressBookMutex.Unlock()
+
+	var filtered []string
+	for _, address := range addresses {
+		if len(filtered) == n {
+			break
+		}
+		if !peerSelfConn(address) && !peerExists(address) && !isBanned(address) {
+			filtered = append(filtered, address)
+		}
+	}
+
+	return filtered
+}
+
+//Queues known miners for the health check to dial if the node is not well connected. Addresses are only added while
+//there is space in the channel, such that the caller is never blocked.
+func refillFromAddressBook() {
+	missing := MIN_MINERS - peers.len(PEERTYPE_MINER)
+	if missing <= 0 {
+		return
+	}
+
+	for _, address := range addressBookCandidates(missing, time.Now()) {
+		select {
+		case iplistChan <- address:
+		default:
+			return
+		}
+	}
+}
+
+//Seconds to wait before dialing the address again, doubled with every failure in a row.
+func retryDelay(record *storage.PeerRecord) int64 {
+	failures := record.Failures
+	if failures > 6 {
+		failures = 6
+	}
+
+	return ADDRESS_RETRY_INTERVAL << failures
+}
+
+func betterRecord(a *storage.PeerRecord, b *storage.PeerRecord) bool {
+	if a.Failures != b.Failures {
+		return a.Failures < b.Failures
+	}
+	if a.Successes != b.Successes {
+		return a.Successes > b.Successes
+	}
+
+	return a.LastSeen > b.LastSeen
+}
+
+//Removes the least promising address that is not a bootstrap server. Has to be called with the addressBookMutex held.
+func evictAddress() bool {
+	var worst *storage.PeerRecord
+	for address, record := range addressBook {
+		if !isBootstrapServer(address) && (worst == nil || betterRecord(worst, record)) {
+			worst = record
+		}
+	}
+
+	if worst == nil {
+		return false
+	}
+
+	delete(addressBook, worst.Address)
+	storage.DeletePeerRecord(worst.Address)
+	return true
+}
+
+func isBootstrapServer(address string) bool {
+	for _, server := range storage.BootstrapServers {
+		if server == address {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddressBook(t *testing.T) {
+	storage.BootstrapServers = []string{"10.0.1.1:8000"}
+	defer func() { storage.BootstrapServers = nil }()
+	initAddressBook()
+	defer func() {
+		for _, record := range storage.ReadPeerRecords() {
+			storage.DeletePeerRecord(record.Address)
+		}
+		initAddressBook()
+	}()
+
+	learnAddress("10.0.1.2:8000")
+	learnAddress("10.0.1.3:8000")
+	learnAddress(Ipport)
+	recordAttempt("10.0.1.3:8000", true)
+
+	//Miners connected to before come first, the bootstrap server was never seen
+	now := time.Now()
+	expected := []string{"10.0.1.3:8000", "10.0.1.2:8000", "10.0.1.1:8000"}
+	if candidates := addressBookCandidates(MIN_MINERS, now.Add(ADDRESS_RETRY_INTERVAL*time.Second)); !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("Wrong candidates: %v\n", candidates)
+	}
+
+	//Dialed addresses are retried later, the more failures the later
+	recordAttempt("10.0.1.2:8000", false)
+	recordAttempt("10.0.1.2:8000", false)
+	expected = []string{"10.0.1.1:8000"}
+	if candidates := addressBookCandidates(MIN_MINERS, now); !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("Recently dialed addresses are candidates: %v\n", candidates)
+	}
+	expected = []string{"10.0.1.3:8000", "10.0.1.1:8000"}
+	if candidates := addressBookCandidates(MIN_MINERS, now.Add(ADDRESS_RETRY_INTERVAL*2*time.Second)); !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("Wrong candidates after failures: %v\n", candidates)
+	}
+
+	//The address book survives a restart
+	initAddressBook()
+	if len(addressBook) != 3 || addressBook["10.0.1.2:8000"].Failures != 2 || addressBook["10.0.1.3:8000"].Successes != 1 {
+		t.Errorf("Address book not restored: %v\n", storage.ReadPeerRecords())
+	}
+
+	//Unreachable miners are forgotten, bootstrap servers are not
+	for i := 0; i < MAX_ADDRESS_FAILURES; i++ {
+		recordAttempt("10.0.1.1:8000", false)
+		recordAttempt("10.0.1.2:8000", false)
+	}
+	if _, exists := addressBook["10.0.1.2:8000"]; exists || len(storage.ReadPeerRecords()) != 2 {
+		t.Errorf("Unreachable miner not forgotten\n")
+	}
+	if _, exists := addressBook["10.0.1.1:8000"]; !exists {
+		t.Errorf("Bootstrap server forgotten\n")
+	}
+}
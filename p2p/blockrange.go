@@ -0,0 +1,191 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+//Blocks of a shard are requested by height range instead of one by one. A BLOCKS_BY_RANGE_REQ carries the shard ID,
+//the first height and the number of heights. The blocks are answered in BLOCKS_BY_RANGE_RES messages of at most
+//MAX_RANGE_RESPONSE_SIZE bytes, the last of which is flagged, such that the requester knows when the peer is done.
+//Heights of epoch blocks have no shard block and are left out. Light clients request the block headers the same way
+//with BLOCK_HEADERS_BY_RANGE_REQ.
+const (
+	BLOCK_RANGE_REQ_SIZE = 12
+)
+
+//Blocks received from a peer as answer to a range request.
+type BlockRange struct {
+	Peer   string
+	Blocks [][]byte
+	//Set on the last answer to a request
+	Last bool
+}
+
+var (
+	BlocksByRangeChan       = make(chan *BlockRange, MAX_BLOCKS_PER_RANGE)
+	BlockHeadersByRangeChan = make(chan *BlockRange, MAX_BLOCKS_PER_RANGE)
+)
+
+//Addresses of the miners that answer range requests.
+func RangePeers() (addresses []string) {
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		addresses = append(addresses, p.getIPPort())
+	}
+
+	return addresses
+}
+
+//Addresses of the miners that answer header range requests.
+func HeaderRangePeers() []string {
+	return RangePeers()
+}
+
+func BlocksByRangeReq(address string, shardID int, from uint32, count uint32) error {
+	return requestFrom(address, BLOCKS_BY_RANGE_REQ, encodeBlockRangeReq(shardID, from, count))
+}
+
+func BlockHeadersByRangeReq(address string, shardID int, from uint32, count uint32) error {
+	return requestFrom(address, BLOCK_HEADERS_BY_RANGE_REQ, encodeBlockRangeReq(shardID, from, count))
+}
+
+func requestFrom(address string, typeID uint8, payload []byte) error {
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		if p.getIPPort() == address {
+			sendData(p, BuildPacket(typeID, payload))
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("Miner %v not connected, request not transmitted.", address))
+}
+
+func blocksByRangeRes(p *peer, payload []byte) {
+	rangeRes(p, payload, BLOCKS_BY_RANGE_RES, func(block *protocol.Block) []byte {
+		return block.Encode()
+	})
+}
+
+//Headers carry the bloom filter of the block's transactions, like the ones pushed to clients
+func blockHeadersByRangeRes(p *peer, payload []byte) {
+	rangeRes(p, payload, BLOCK_HEADERS_BY_RANGE_RES, func(block *protocol.Block) []byte {
+		block.InitBloomFilter(storage.GetTxPubKeys(block))
+		return block.EncodeHeader()
+	})
+}
+
+func rangeRes(p *peer, payload []byte, typeID uint8, encode func(*protocol.Block) []byte) {
+	shardID, from, count, err := decodeBlockRangeReq(payload)
+	if err != nil {
+		logger.Warn("Invalid block range request", "peer", p.getIPPort(), "error", err)
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	if count > MAX_BLOCKS_PER_RANGE {
+		count = MAX_BLOCKS_PER_RANGE
+	}
+
+	var encodedBlocks [][]byte
+	for _, block := range storage.ReadClosedBlocksByRange(shardID, from, count) {
+		encodedBlocks = append(encodedBlocks, encode(block))
+	}
+
+	for _, response := range encodeBlockRangeRes(encodedBlocks) {
+		sendData(p, BuildPacket(typeID, response))
+	}
+}
+
+func processBlocksByRangeRes(p *peer, payload []byte) {
+	processRangeRes(p, payload, BlocksByRangeChan)
+}
+
+func processBlockHeadersByRangeRes(p *peer, payload []byte) {
+	processRangeRes(p, payload, BlockHeadersByRangeChan)
+}
+
+func processRangeRes(p *peer, payload []byte, answers chan *BlockRange) {
+	blocks, last, err := decodeBlockRangeRes(payload)
+	if err != nil {
+		logger.Warn("Invalid block range", "peer", p.getIPPort(), "error", err)
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	for _, block := range blocks {
+		rememberSender(payloadHash(block), p)
+	}
+
+	//Answers nobody waits for anymore are dropped
+	select {
+	case answers <- &BlockRange{p.getIPPort(), blocks, last}:
+	default:
+	}
+}
+
+func encodeBlockRangeReq(shardID int, from uint32, count uint32) []byte {
+	encoded := make([]byte, BLOCK_RANGE_REQ_SIZE)
+	binary.BigEndian.PutUint32(encoded[0:4], uint32(shardID))
+	binary.BigEndian.PutUint32(encoded[4:8], from)
+	binary.BigEndian.PutUint32(encoded[8:12], count)
+	return encoded
+}
+
+func decodeBlockRangeReq(encoded []byte) (shardID int, from uint32, count uint32, err error) {
+	if len(encoded) != BLOCK_RANGE_REQ_SIZE {
+		return 0, 0, 0, errors.New(fmt.Sprintf("block range request of %v bytes", len(encoded)))
+	}
+
+	shardID = int(binary.BigEndian.Uint32(encoded[0:4]))
+	from = binary.BigEndian.Uint32(encoded[4:8])
+	count = binary.BigEndian.Uint32(encoded[8:12])
+	if count == 0 {
+		return 0, 0, 0, errors.New("empty block range requested")
+	}
+
+	return shardID, from, count, nil
+}
+
+//Splits the blocks into answers of at most MAX_RANGE_RESPONSE_SIZE bytes, unless a single block is larger. Every
+//answer starts with a flag set on the last one, followed by the length-prefixed blocks. There is always at least one
+//answer, such that a peer without any of the blocks says so.
+func encodeBlockRangeRes(blocks [][]byte) (responses [][]byte) {
+	response := []byte{0}
+	for _, block := range blocks {
+		if len(response) > 1 && len(response)+4+len(block) > MAX_RANGE_RESPONSE_SIZE {
+			responses = append(responses, response)
+			response = []byte{0}
+		}
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(block)))
+		response = append(response, length[:]...)
+		response = append(response, block...)
+	}
+
+	response[0] = 1
+	return append(responses, response)
+}
+
+func decodeBlockRangeRes(encoded []byte) (blocks [][]byte, last bool, err error) {
+	if len(encoded) == 0 || encoded[0] > 1 {
+		return nil, false, errors.New("invalid block range flag")
+	}
+
+	last = encoded[0] == 1
+	for encoded = encoded[1:]; len(encoded) > 0; {
+		if len(encoded) < 4 {
+			return nil, false, errors.New("block length truncated")
+		}
+		length := binary.BigEndian.Uint32(encoded[:4])
+		if length == 0 || uint32(len(encoded)-4) < length {
+			return nil, false, errors.New(fmt.Sprintf("invalid block length %v", length))
+		}
+		blocks = append(blocks, encoded[4:4+length])
+		encoded = encoded[4+length:]
+	}
+
+	return blocks, last, nil
+}
@@ -0,0 +1,75 @@
+package p2p
+
+import (
+	"bytes"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestBlockRangeEncoding(t *testing.T) {
+	shardID, from, count, err := decodeBlockRangeReq(encodeBlockRangeReq(3, 100, 50))
+	if err != nil || shardID != 3 || from != 100 || count != 50 {
+		t.Errorf("Range request not decoded: %v, %v, %v, %v\n", shardID, from, count, err)
+	}
+
+	if _, _, _, err := decodeBlockRangeReq(encodeBlockRangeReq(3, 100, 0)); err == nil {
+		t.Errorf("Empty range decoded\n")
+	}
+
+	//Large blocks are split into several answers, only the last one is flagged
+	blocks := [][]byte{bytes.Repeat([]byte{1}, MAX_RANGE_RESPONSE_SIZE/2), bytes.Repeat([]byte{2}, MAX_RANGE_RESPONSE_SIZE/2), {3}}
+	responses := encodeBlockRangeRes(blocks)
+	if len(responses) != 2 {
+		t.Fatalf("Blocks split into %v answers\n", len(responses))
+	}
+
+	var decoded [][]byte
+	for i, response := range responses {
+		part, last, err := decodeBlockRangeRes(response)
+		if err != nil || last != (i == len(responses)-1) {
+			t.Errorf("Answer %v not decoded: %v, %v\n", i, last, err)
+		}
+		decoded = append(decoded, part...)
+	}
+	if !reflect.DeepEqual(decoded, blocks) {
+		t.Errorf("Blocks not decoded\n")
+	}
+
+	//Peers without the blocks answer with an empty last message
+	if blocks, last, err := decodeBlockRangeRes(encodeBlockRangeRes(nil)[0]); err != nil || !last || len(blocks) != 0 {
+		t.Errorf("Empty answer not decoded: %v, %v, %v\n", blocks, last, err)
+	}
+
+	if _, _, err := decodeBlockRangeRes(responses[0][:len(responses[0])-1]); err == nil {
+		t.Errorf("Truncated answer decoded\n")
+	}
+}
+
+func TestBlocksByRangeRes(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	block := protocol.NewBlock([32]byte{}, 5)
+	block.ShardId, block.Hash = 9, [32]byte{9}
+	storage.WriteClosedBlock(block)
+	defer storage.DeleteClosedBlock(block.Hash)
+
+	p := &peer{conn: conn, listenerPort: "8000", peerType: PEERTYPE_MINER, version: PROTOCOL_VERSION}
+	go blocksByRangeRes(p, encodeBlockRangeReq(9, 1, 10))
+
+	header, payload, err := RcvData_(remote)
+	if err != nil || header.TypeID != BLOCKS_BY_RANGE_RES {
+		t.Fatalf("No block range received: %v\n", err)
+	}
+
+	go processBlocksByRangeRes(p, payload)
+	response := <-BlocksByRangeChan
+	var received *protocol.Block
+	if len(response.Blocks) != 1 || !response.Last || received.Decode(response.Blocks[0]).Hash != block.Hash {
+		t.Errorf("Wrong block range: %v\n", response)
+	}
+}
@@ -17,7 +17,73 @@ const (
 	//Calculate system time every UPDATE_SYS_TIME seconds
 	UPDATE_SYS_TIME = 90
 
+	//Score of a well-behaved peer, see reputation.go. Peers recover SCORE_RECOVERY points per minute
+	MAX_SCORE      = 100
+	SCORE_RECOVERY = 1
+	//Duration of a ban in seconds
+	BAN_DURATION = 3600
+	//Number of received blocks, state transitions and transactions whose sender is remembered
+	MAX_REMEMBERED_SENDERS = 10000
+
+	//Maximum payload sizes in bytes per class of messages, see ratelimit.go. Blocks, epoch blocks and states may take
+	//up to MAX_PAYLOAD_SIZE
+	MAX_CONTROL_PAYLOAD_SIZE = 4096
+	MAX_REQUEST_PAYLOAD_SIZE = 4096
+	MAX_TX_PAYLOAD_SIZE      = 1000000
+	MAX_PAYLOAD_SIZE         = 80000000
+	//Messages per second a peer may send per message type of the class, and how many it may send at once
+	CONTROL_RATE  = 2
+	CONTROL_BURST = 20
+	REQUEST_RATE  = 200
+	REQUEST_BURST = 2000
+	TX_RATE       = 1000
+	TX_BURST      = 10000
+	DATA_RATE     = 20
+	DATA_BURST    = 200
+	//Messages per second a peer may send in total
+	PEER_RATE  = 2000
+	PEER_BURST = 20000
+	//Number of messages queued per peer for sending. Further gossip is dropped for the peer until it catches up, further
+	//consensus messages disconnect it, see ratelimit.go
+	PEER_QUEUE_SIZE = 100
+	//Timeout for writing a message to a peer in seconds, slower peers are disconnected
+	WRITE_TIMEOUT = 30
+
+	//Version of the messages exchanged between nodes, has to be increased whenever their encoding changes.
+	//Peers below MIN_PROTOCOL_VERSION are rejected in the handshake
+	PROTOCOL_VERSION     = 11
+	//Version 6 replaced gob with the canonical encoding of protocol/encoding.go, which changed all hashes, including
+	//the one of the genesis block. Version 7 added the receipts of cross-shard transfers to blocks, epoch blocks and
+	//state transitions, which changed their encoding and hashes. Version 8 added the shard loads and the account
+	//migrations of resharding to epoch blocks and state transitions. Version 9 added the quorum certificates of the
+	//validators of a shard to blocks, and their proposals and votes. Version 10 added the endorsements of the committee
+	//to epoch blocks and transaction assignments. Version 11 replaced the state of epoch blocks with the accounts changed
+	//in the epoch and answers state requests
+	MIN_PROTOCOL_VERSION = 11
+
+	//Maximum number of items announced or requested in one message
+	MAX_INV_ITEMS = 100
+	//Number of announced items kept to answer requests
+	INVENTORY_SIZE = 5000
+	//Number of announced and received items that are not requested again
+	MAX_SEEN_INVENTORY = 50000
+	//Seconds after which an item that was requested but not delivered is requested from the next peer announcing it
+	GETDATA_TIMEOUT = 10
+
+	//Maximum number of miner addresses in the address book, see addressbook.go
+	MAX_ADDRESS_BOOK_SIZE = 1000
+	//Addresses are forgotten after this many failed connection attempts in a row, except for bootstrap servers
+	MAX_ADDRESS_FAILURES = 10
+	//Seconds to wait before dialing an address again, doubled with every failure in a row
+	ADDRESS_RETRY_INTERVAL = 30
+	//An address advertised again is persisted at most once per this many seconds
+	ADDRESS_SEEN_INTERVAL = 600
+
+	//Maximum number of heights in a block range request, see blockrange.go
+	MAX_BLOCKS_PER_RANGE = 100
+	//Blocks of a range are split into answers of about this many bytes
+	MAX_RANGE_RESPONSE_SIZE = 1000000
+
 	//Protocol constants
-	IPV4ADDR_SIZE = 4
-	PORT_SIZE     = 2
+	PORT_SIZE = 2
 )
@@ -0,0 +1,161 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/oigele/bazo-miner/storage"
+	"strings"
+	"sync"
+)
+
+//Capabilities a node announces in the handshake.
+const (
+	CAPABILITY_VALIDATOR = 1 << iota
+	CAPABILITY_COMMITTEE
+	//Keeps all blocks and can serve them to other nodes
+	CAPABILITY_ARCHIVE
+	//Only follows the block headers
+	CAPABILITY_LIGHT
+)
+
+//The handshake consists of the listener port, the protocol version, the chain ID and the capabilities of the node.
+const (
+	HANDSHAKE_SIZE = PORT_SIZE + 2 + 32 + 4
+)
+
+var (
+	capabilityNames = map[uint32]string{
+		CAPABILITY_VALIDATOR: "validator",
+		CAPABILITY_COMMITTEE: "committee",
+		CAPABILITY_ARCHIVE:   "archive",
+		CAPABILITY_LIGHT:     "light",
+	}
+
+	chainID          [32]byte
+	ownCapabilities  uint32
+	handshakeMutex   = &sync.RWMutex{}
+)
+
+type handshake struct {
+	listenerPort string
+	version      uint16
+	chainID      [32]byte
+	capabilities uint32
+}
+
+//The chain ID is the hash of the genesis block. Nodes that do not know the genesis yet use the zero ID, which is
+//compatible with every network. Once the genesis is known, miners of other networks are disconnected.
+func SetChainID(genesisHash [32]byte) {
+	handshakeMutex.Lock()
+	chainID = genesisHash
+	handshakeMutex.Unlock()
+
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		if err := checkChainID(p.chainID, genesisHash); err != nil {
+			rejectHandshake(p, err)
+		}
+	}
+}
+
+func getChainID() [32]byte {
+	handshakeMutex.RLock()
+	defer handshakeMutex.RUnlock()
+
+	return chainID
+}
+
+func SetCapabilities(capabilities uint32) {
+	handshakeMutex.Lock()
+	defer handshakeMutex.Unlock()
+
+	ownCapabilities = capabilities
+}
+
+func getCapabilities() uint32 {
+	handshakeMutex.RLock()
+	defer handshakeMutex.RUnlock()
+
+	return ownCapabilities
+}
+
+//Restarted nodes already know their network.
+func initChainID() {
+	if genesis, err := storage.ReadGenesis(); err == nil && genesis != nil {
+		SetChainID(genesis.Hash())
+	}
+}
+
+func encodeHandshake(localPort int) []byte {
+	encoded := make([]byte, HANDSHAKE_SIZE)
+	id := getChainID()
+
+	binary.BigEndian.PutUint16(encoded[0:PORT_SIZE], uint16(localPort))
+	binary.BigEndian.PutUint16(encoded[PORT_SIZE:PORT_SIZE+2], PROTOCOL_VERSION)
+	copy(encoded[PORT_SIZE+2:PORT_SIZE+34], id[:])
+	binary.BigEndian.PutUint32(encoded[PORT_SIZE+34:HANDSHAKE_SIZE], getCapabilities())
+
+	return encoded
+}
+
+func decodeHandshake(payload []byte) (*handshake, error) {
+	if len(payload) != HANDSHAKE_SIZE {
+		return nil, errors.New(fmt.Sprintf("handshake has %v bytes instead of %v, the peer runs an outdated protocol version", len(payload), HANDSHAKE_SIZE))
+	}
+
+	hs := new(handshake)
+	hs.listenerPort = _pongRes(payload)
+	hs.version = binary.BigEndian.Uint16(payload[PORT_SIZE : PORT_SIZE+2])
+	copy(hs.chainID[:], payload[PORT_SIZE+2:PORT_SIZE+34])
+	hs.capabilities = binary.BigEndian.Uint32(payload[PORT_SIZE+34 : HANDSHAKE_SIZE])
+
+	return hs, nil
+}
+
+//Newer versions know whether they are compatible with ours and reject us themselves if not.
+func (hs *handshake) check() error {
+	if hs.version < MIN_PROTOCOL_VERSION {
+		return errors.New(fmt.Sprintf("protocol version %v is not supported, at least version %v is required", hs.version, MIN_PROTOCOL_VERSION))
+	}
+
+	return checkChainID(hs.chainID, getChainID())
+}
+
+func checkChainID(peerChainID [32]byte, own [32]byte) error {
+	if own != [32]byte{} && peerChainID != [32]byte{} && own != peerChainID {
+		return errors.New(fmt.Sprintf("peer is on network %x, this node on network %x", peerChainID[0:8], own[0:8]))
+	}
+
+	return nil
+}
+
+//Completes the handshake on the peer.
+func (hs *handshake) apply(p *peer) {
+	p.listenerPort = hs.listenerPort
+	p.version = hs.version
+	p.chainID = hs.chainID
+	p.capabilities = hs.capabilities
+}
+
+//Tells the peer why the connection is closed.
+func rejectHandshake(p *peer, reason error) {
+	logger.Warn("Rejecting peer", "peer", p.conn.RemoteAddr(), "reason", reason)
+
+	sendData(p, BuildPacket(HANDSHAKE_REJECT, []byte(reason.Error())))
+	p.conn.Close()
+}
+
+func capabilitiesString(capabilities uint32) string {
+	var names []string
+	for capability := uint32(CAPABILITY_VALIDATOR); capability <= CAPABILITY_LIGHT; capability <<= 1 {
+		if capabilities&capability != 0 {
+			names = append(names, capabilityNames[capability])
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	SetCapabilities(CAPABILITY_VALIDATOR | CAPABILITY_ARCHIVE)
+	defer SetCapabilities(0)
+
+	packet, _ := PrepareHandshake(MINER_PING, 8001)
+	hs, err := decodeHandshake(packet[HEADER_LEN:])
+	if err != nil {
+		t.Fatalf("Decoding handshake failed: %v\n", err)
+	}
+
+	if hs.listenerPort != "8001" || hs.version != PROTOCOL_VERSION || hs.chainID != getChainID() ||
+		capabilitiesString(hs.capabilities) != "validator,archive" {
+		t.Errorf("Handshake not correctly decoded: %v\n", hs)
+	}
+
+	if err := hs.check(); err != nil {
+		t.Errorf("Compatible handshake rejected: %v\n", err)
+	}
+
+	//Handshakes of outdated nodes only contain the port
+	if _, err := decodeHandshake([]byte{31, 64}); err == nil {
+		t.Errorf("Outdated handshake accepted\n")
+	}
+
+	hs.version = MIN_PROTOCOL_VERSION - 1
+	if err := hs.check(); err == nil {
+		t.Errorf("Unsupported protocol version accepted\n")
+	}
+}
+
+func TestHandshakeChainID(t *testing.T) {
+	defer SetChainID([32]byte{})
+
+	hs := &handshake{version: PROTOCOL_VERSION, chainID: [32]byte{1}}
+
+	//Nodes that do not know the genesis yet accept every network
+	if err := hs.check(); err != nil {
+		t.Errorf("Handshake rejected without known chain ID: %v\n", err)
+	}
+
+	SetChainID([32]byte{1})
+	if err := hs.check(); err != nil {
+		t.Errorf("Handshake of the same network rejected: %v\n", err)
+	}
+
+	SetChainID([32]byte{2})
+	if err := hs.check(); err == nil {
+		t.Errorf("Handshake of another network accepted\n")
+	}
+}
+
+func TestRejectHandshake(t *testing.T) {
+	SetChainID([32]byte{2})
+	packet, _ := PrepareHandshake(MINER_PING, 8001)
+	SetChainID([32]byte{3})
+	defer SetChainID([32]byte{})
+
+	conn1, conn2 := net.Pipe()
+	defer conn2.Close()
+	go pongRes(&peer{conn: conn1, secure: true}, packet[HEADER_LEN:], MINER_PING)
+
+	header, payload, err := RcvData(&peer{conn: conn2})
+	if err != nil || header.TypeID != HANDSHAKE_REJECT || !strings.Contains(string(payload), "network") {
+		t.Errorf("Handshake of another network was not rejected with a reason: %v, %s\n", err, payload)
+	}
+}
@@ -5,7 +5,27 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 
 	//logger.Printf("Received Message Type: %s from IP Port: %s", LogMapping[header.TypeID], p.getIPPort())
 
+	//Committee traffic and miner handshakes are refused unless the peer authenticated accordingly
+	if !authorized(p, header.TypeID) {
+		logger.Warn("Refusing message from unauthenticated peer", "type", messageTypeName(header.TypeID), "peer", p.conn.RemoteAddr())
+		penalize(p, MISBEHAVIOR_UNAUTHORIZED)
+		return
+	}
+
+	//Broadcasts announced by several miners are only processed once
+	if isDuplicate(p, header.TypeID, payload) {
+		return
+	}
+
 	switch header.TypeID {
+	//INVENTORY
+	case INV:
+		processInv(p, payload)
+	case GETDATA:
+		getDataRes(p, payload)
+	case ADDR:
+		processAddress(p, payload)
+
 	//BROADCASTING
 	case FUNDSTX_BRDCST:
 		processTxBrdcst(p, payload, FUNDSTX_BRDCST)
@@ -37,6 +57,12 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		forwardCommitteeCheckToMinerIn(p, payload)
 	case FINETX_BRDCST:
 		forwardFineTxBrdcstToMinerIn(p,payload)
+	case PROPOSAL_BRDCST:
+		forwardProposalToMiner(p, payload)
+	case VOTE_BRDCST:
+		forwardVoteToMiner(p, payload)
+	case ENDORSEMENT_BRDCST:
+		forwardEndorsementToMiner(p, payload)
 
 		//REQUESTS
 	case FUNDSTX_REQ:
@@ -63,6 +89,12 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		blockRes(p, payload)
 	case SHARD_BLOCK_REQ:
 		shardBlockRes(p, payload)
+	case BLOCKS_BY_RANGE_REQ:
+		blocksByRangeRes(p, payload)
+	case BLOCK_HEADERS_BY_RANGE_REQ:
+		blockHeadersByRangeRes(p, payload)
+	case EPOCH_BLOCK_HEADER_REQ:
+		epochBlockHeaderRes(p, payload)
 	case BLOCK_HEADER_REQ:
 		blockHeaderRes(p, payload)
 	case ACC_REQ:
@@ -77,6 +109,10 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		neighborRes(p)
 	case INTERMEDIATE_NODES_REQ:
 		intermediateNodesRes(p, payload)
+	case ACC_PROOF_REQ:
+		accProofRes(p, payload)
+	case RECEIPT_REQ:
+		receiptRes(p, payload)
 	case STATE_TRANSITION_REQ:
 		stateTransitionRes(p,payload)
 	case GENESIS_REQ:
@@ -87,6 +123,8 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		EpochBlockRes(p,payload)
 	case LAST_EPOCH_BLOCK_REQ:
 		LastEpochBlockRes(p,payload)
+	case STATE_REQ:
+		stateRes(p, payload)
 	case TRANSACTION_ASSIGNMENT_REQ:
 		TransactionAssignmentRes(p, payload)
 	case COMMITTEE_CHECK_REQ:
@@ -123,12 +161,32 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		forwardEpochBlockToMiner(p,payload)
 	case LAST_EPOCH_BLOCK_RES:
 		forwardLastEpochBlockToMiner(p,payload)
+	case STATE_RES:
+		forwardStateToMiner(p, payload)
 	case TRANSACTION_ASSIGNMENT_RES:
 		forwardTransactionAssignmentToMiner(p,payload)
 	case SHARD_BLOCK_RES:
 		forwardShardBlockToMiner(p, payload)
+	case BLOCKS_BY_RANGE_RES:
+		processBlocksByRangeRes(p, payload)
+	case BLOCK_HEADERS_BY_RANGE_RES:
+		processBlockHeadersByRangeRes(p, payload)
+	case EPOCH_BLOCK_HEADER_RES:
+		processEpochBlockHeaderRes(p, payload)
+	case ACC_PROOF_RES:
+		processAccProofRes(p, payload)
+	case RECEIPT_RES:
+		processReceiptRes(p, payload)
+	case BLOCK_HEADER_BRDCST:
+		processBlockHeaderBrdcst(p, payload)
 	case COMMITTEE_CHECK_RES:
 		forwardCommitteeCheckReqToMiner(p, payload)
+
+	default:
+		//Some known types are only consumed by clients or not at all, only unknown ones are a violation
+		if LogMapping[header.TypeID] == "" {
+			penalize(p, MISBEHAVIOR_PROTOCOL_VIOLATION)
+		}
 	}
 
 
@@ -0,0 +1,250 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//Blocks, state transitions, committee checks and transactions are not pushed to other miners, but announced by their
+//hash in an INV message. Miners fetch the items they have not seen yet with GETDATA and receive them in the original
+//broadcast message. Items are identified by the hash of their payload, such that duplicates are dropped before they
+//are decoded. Miners running a protocol version without inventory messages still get the payloads pushed.
+const (
+	INVENTORY_ITEM_SIZE = 1 + 32
+)
+
+type inventoryItem struct {
+	typeID uint8
+	hash   [32]byte
+}
+
+type inventoryEntry struct {
+	inventoryItem
+	payload []byte
+}
+
+var (
+	//Broadcast messages relayed by inventory
+	inventoryTypes = map[uint8]bool{
+		BLOCK_BRDCST:            true,
+		STATE_TRANSITION_BRDCST: true,
+		COMMITTEE_CHECK_BRDCST:  true,
+		FUNDSTX_BRDCST:          true,
+		ACCTX_BRDCST:            true,
+		CONFIGTX_BRDCST:         true,
+		STAKETX_BRDCST:          true,
+		AGGTX_BRDCST:            true,
+		DATATX_BRDCST:           true,
+		AGGDATATX_BRDCST:        true,
+		COMMITTEETX_BRDCST:      true,
+		PROPOSAL_BRDCST:         true,
+		VOTE_BRDCST:             true,
+		ENDORSEMENT_BRDCST:      true,
+	}
+
+	announcements = make(chan *inventoryEntry, MAX_INV_ITEMS)
+
+	//Items announced by this node, kept to answer GETDATA. Only the most recent INVENTORY_SIZE are kept.
+	inventory      = make(map[[32]byte]*inventoryEntry)
+	inventoryKeys  [][32]byte
+	inventoryMutex = &sync.Mutex{}
+
+	//Hashes of the items announced or received, only the most recent MAX_SEEN_INVENTORY are kept. Requested items are
+	//not requested again from another peer until GETDATA_TIMEOUT passed.
+	seen      = make(map[[32]byte]bool)
+	seenKeys  [][32]byte
+	requested = make(map[[32]byte]time.Time)
+	seenMutex = &sync.Mutex{}
+)
+
+func isInventoryType(typeID uint8) bool {
+	return inventoryTypes[typeID]
+}
+
+//Keeps the payload for GETDATA and queues the announcement.
+func announce(typeID uint8, payload []byte) {
+	entry := &inventoryEntry{inventoryItem{typeID, payloadHash(payload)}, payload}
+
+	inventoryMutex.Lock()
+	if _, exists := inventory[entry.hash]; !exists {
+		inventoryKeys = append(inventoryKeys, entry.hash)
+	}
+	inventory[entry.hash] = entry
+	if len(inventoryKeys) > INVENTORY_SIZE {
+		delete(inventory, inventoryKeys[0])
+		inventoryKeys = inventoryKeys[1:]
+	}
+	inventoryMutex.Unlock()
+
+	markSeen(entry.hash)
+	announcements <- entry
+}
+
+func getInventory(item inventoryItem) *inventoryEntry {
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+
+	if entry, exists := inventory[item.hash]; exists && entry.typeID == item.typeID {
+		return entry
+	}
+
+	return nil
+}
+
+//Announcements that queue up while an INV is sent are batched into the next one.
+func inventoryService() {
+	for {
+		entries := []*inventoryEntry{<-announcements}
+	BATCH:
+		for len(entries) < MAX_INV_ITEMS {
+			select {
+			case entry := <-announcements:
+				entries = append(entries, entry)
+			default:
+				break BATCH
+			}
+		}
+
+		sendInventory(entries)
+	}
+}
+
+func sendInventory(entries []*inventoryEntry) {
+	items := make([]inventoryItem, len(entries))
+	for i, entry := range entries {
+		items[i] = entry.inventoryItem
+	}
+	packet := BuildPacket(INV, encodeInventory(items))
+
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		enqueue(p, packet)
+	}
+}
+
+//Returns false if the item was seen before.
+func markSeen(hash [32]byte) bool {
+	seenMutex.Lock()
+	defer seenMutex.Unlock()
+
+	delete(requested, hash)
+	if seen[hash] {
+		return false
+	}
+
+	seen[hash] = true
+	seenKeys = append(seenKeys, hash)
+	if len(seenKeys) > MAX_SEEN_INVENTORY {
+		delete(seen, seenKeys[0])
+		seenKeys = seenKeys[1:]
+	}
+
+	return true
+}
+
+//Returns true if the item has to be requested, i.e. it was neither seen nor recently requested.
+func markRequested(hash [32]byte, now time.Time) bool {
+	seenMutex.Lock()
+	defer seenMutex.Unlock()
+
+	if seen[hash] {
+		return false
+	}
+
+	if requestedAt, exists := requested[hash]; exists && now.Sub(requestedAt) < GETDATA_TIMEOUT*time.Second {
+		return false
+	}
+
+	//Items that were never delivered are forgotten once the map grows too large
+	if len(requested) >= MAX_SEEN_INVENTORY {
+		for hash, requestedAt := range requested {
+			if now.Sub(requestedAt) >= GETDATA_TIMEOUT*time.Second {
+				delete(requested, hash)
+			}
+		}
+	}
+
+	requested[hash] = now
+	return true
+}
+
+//Duplicates of relayed broadcasts are dropped. Clients are excluded, because they expect an acknowledgement for
+//every transaction they send.
+func isDuplicate(p *peer, typeID uint8, payload []byte) bool {
+	if p.peerType != PEERTYPE_MINER || !isInventoryType(typeID) {
+		return false
+	}
+
+	if !markSeen(payloadHash(payload)) {
+		duplicatePayloadsMetric.WithLabel(messageTypeName(typeID)).Inc()
+		return true
+	}
+
+	return false
+}
+
+//Requests the announced items that were not seen yet.
+func processInv(p *peer, payload []byte) {
+	items, err := decodeInventory(payload)
+	if err != nil {
+		logger.Warn("Invalid inventory", "peer", p.getIPPort(), "error", err)
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	var missing []inventoryItem
+	now := time.Now()
+	for _, item := range items {
+		if markRequested(item.hash, now) {
+			missing = append(missing, item)
+		}
+	}
+
+	if len(missing) > 0 {
+		sendData(p, BuildPacket(GETDATA, encodeInventory(missing)))
+	}
+}
+
+//Sends the requested items that are still in the inventory, the others are ignored.
+func getDataRes(p *peer, payload []byte) {
+	items, err := decodeInventory(payload)
+	if err != nil {
+		logger.Warn("Invalid inventory request", "peer", p.getIPPort(), "error", err)
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	for _, item := range items {
+		if entry := getInventory(item); entry != nil {
+			sendData(p, BuildPacket(entry.typeID, entry.payload))
+		}
+	}
+}
+
+func encodeInventory(items []inventoryItem) []byte {
+	encoded := make([]byte, len(items)*INVENTORY_ITEM_SIZE)
+	for i, item := range items {
+		encoded[i*INVENTORY_ITEM_SIZE] = item.typeID
+		copy(encoded[i*INVENTORY_ITEM_SIZE+1:(i+1)*INVENTORY_ITEM_SIZE], item.hash[:])
+	}
+
+	return encoded
+}
+
+func decodeInventory(encoded []byte) ([]inventoryItem, error) {
+	if len(encoded) == 0 || len(encoded)%INVENTORY_ITEM_SIZE != 0 || len(encoded) > MAX_INV_ITEMS*INVENTORY_ITEM_SIZE {
+		return nil, errors.New(fmt.Sprintf("inventory of %v bytes", len(encoded)))
+	}
+
+	items := make([]inventoryItem, len(encoded)/INVENTORY_ITEM_SIZE)
+	for i := range items {
+		items[i].typeID = encoded[i*INVENTORY_ITEM_SIZE]
+		if !isInventoryType(items[i].typeID) {
+			return nil, errors.New(fmt.Sprintf("type %v is not relayed by inventory", items[i].typeID))
+		}
+		copy(items[i].hash[:], encoded[i*INVENTORY_ITEM_SIZE+1:(i+1)*INVENTORY_ITEM_SIZE])
+	}
+
+	return items, nil
+}
@@ -0,0 +1,100 @@
+package p2p
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInventoryEncoding(t *testing.T) {
+	items := []inventoryItem{{BLOCK_BRDCST, [32]byte{1}}, {FUNDSTX_BRDCST, [32]byte{2}}}
+
+	decoded, err := decodeInventory(encodeInventory(items))
+	if err != nil || !reflect.DeepEqual(items, decoded) {
+		t.Errorf("Inventory not decoded: %v, %v\n", decoded, err)
+	}
+
+	if _, err := decodeInventory(encodeInventory(items)[1:]); err == nil {
+		t.Errorf("Truncated inventory decoded\n")
+	}
+
+	if _, err := decodeInventory(encodeInventory([]inventoryItem{{TIME_BRDCST, [32]byte{}}})); err == nil {
+		t.Errorf("Inventory of a type that is not relayed decoded\n")
+	}
+}
+
+func TestProcessInv(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	p := &peer{conn: conn, listenerPort: "8000", peerType: PEERTYPE_MINER}
+	payload := []byte("unseen block")
+	items := []inventoryItem{{BLOCK_BRDCST, payloadHash(payload)}}
+
+	go processInv(p, encodeInventory(items))
+
+	header, request, err := RcvData_(remote)
+	if err != nil || header.TypeID != GETDATA || !reflect.DeepEqual(request, encodeInventory(items)) {
+		t.Fatalf("Announced item not requested: %v\n", err)
+	}
+
+	//Requested items are not requested again until the timeout passed or they arrive
+	if markRequested(items[0].hash, time.Now()) {
+		t.Errorf("Item requested twice\n")
+	}
+
+	if !markRequested(items[0].hash, time.Now().Add(GETDATA_TIMEOUT*time.Second)) {
+		t.Errorf("Item not requested again after the timeout\n")
+	}
+
+	if isDuplicate(p, BLOCK_BRDCST, payload) || !isDuplicate(p, BLOCK_BRDCST, payload) {
+		t.Errorf("Duplicate not detected\n")
+	}
+
+	if markRequested(items[0].hash, time.Now().Add(time.Hour)) {
+		t.Errorf("Received item requested again\n")
+	}
+
+	//Clients get an acknowledgement for every transaction
+	client := &peer{conn: conn, peerType: PEERTYPE_CLIENT}
+	if isDuplicate(client, BLOCK_BRDCST, payload) {
+		t.Errorf("Payload of a client dropped\n")
+	}
+}
+
+func TestGetDataRes(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	p := &peer{conn: conn, listenerPort: "8000", peerType: PEERTYPE_MINER, version: PROTOCOL_VERSION}
+	payload := []byte("announced state transition")
+	announce(STATE_TRANSITION_BRDCST, payload)
+	//The inventoryService of TestMain may have sent the announcement already
+	defer func() {
+		select {
+		case <-announcements:
+		default:
+		}
+	}()
+
+	//Items of the wrong type and unknown items are ignored
+	items := []inventoryItem{
+		{BLOCK_BRDCST, payloadHash(payload)},
+		{BLOCK_BRDCST, [32]byte{3}},
+		{STATE_TRANSITION_BRDCST, payloadHash(payload)},
+	}
+	go getDataRes(p, encodeInventory(items))
+
+	header, response, err := RcvData_(remote)
+	if err != nil || header.TypeID != STATE_TRANSITION_BRDCST || !reflect.DeepEqual(response, payload) {
+		t.Errorf("Announced item not sent: %v\n", err)
+	}
+
+	//Own items are not requested from others
+	if markRequested(payloadHash(payload), time.Now()) {
+		t.Errorf("Announced item requested\n")
+	}
+}
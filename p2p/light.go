@@ -0,0 +1,115 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"net"
+	"time"
+)
+
+//Light clients connect to miners over plain TCP with CLIENT_PING and are served like any other client. They keep the
+//miners as miner peers, such that the address book and the health check keep them connected, but have no listener.
+//Instead of blocks and states, they request block headers by range, epoch block headers without the state and the
+//account proofs of the validators. An EPOCH_BLOCK_HEADER_REQ carries the hash of the epoch block, or nothing for the
+//last closed one.
+var (
+	lightClient bool
+
+	//Answers to the requests of a light client and headers pushed by the miners that mined the blocks. Answers nobody
+	//waits for are dropped
+	EpochBlockHeaderChan = make(chan []byte, MIN_MINERS)
+	AccProofChan         = make(chan []byte, MIN_MINERS)
+	BlockHeaderIn        = make(chan []byte, MIN_MINERS)
+)
+
+//Entry point for light clients. The port of ipport is announced in the handshake, but nobody connects to it.
+func InitLight(ipport string) {
+	Ipport = ipport
+	lightClient = true
+	InitLogging()
+	initChainID()
+	initBans()
+	initAddressBook()
+
+	//Initialize peer map
+	peers.minerConns = make(map[*peer]bool)
+	peers.clientConns = make(map[*peer]bool)
+
+	go peerService()
+	go checkHealthService()
+
+	bootstrap()
+}
+
+func dialLight(dial string) (*peer, error) {
+	conn, err := net.DialTimeout("tcp", dial, HANDSHAKE_TIMEOUT*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	_, port := splitAddress(dial)
+	p := newPeer(conn, port, PEERTYPE_MINER)
+	p.setAdvertisedAddress(dial, true)
+
+	if err := completeHandshake(p, dial, CLIENT_PING, CLIENT_PONG); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+//Requests the header of the epoch block with the given hash from the miner, or of its last closed one if the hash is
+//nil.
+func EpochBlockHeaderReq(address string, hash []byte) error {
+	return requestFrom(address, EPOCH_BLOCK_HEADER_REQ, hash)
+}
+
+//Requests the proof of the account with the given hash against the miner's last closed epoch block.
+func AccProofReq(address string, hash [32]byte) error {
+	return requestFrom(address, ACC_PROOF_REQ, hash[:])
+}
+
+func epochBlockHeaderRes(p *peer, payload []byte) {
+	var epochBlock *protocol.EpochBlock
+	if len(payload) == 0 {
+		epochBlock = storage.ReadLastClosedEpochBlock()
+	} else if len(payload) == 32 {
+		var hash [32]byte
+		copy(hash[:], payload)
+		epochBlock = storage.ReadClosedEpochBlock(hash)
+	} else {
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	if epochBlock == nil {
+		sendData(p, BuildPacket(NOT_FOUND, nil))
+		return
+	}
+
+	sendData(p, BuildPacket(EPOCH_BLOCK_HEADER_RES, epochBlock.EncodeHeader()))
+}
+
+func processEpochBlockHeaderRes(p *peer, payload []byte) {
+	forwardToLightClient(p, payload, EpochBlockHeaderChan)
+}
+
+func processAccProofRes(p *peer, payload []byte) {
+	forwardToLightClient(p, payload, AccProofChan)
+}
+
+func processBlockHeaderBrdcst(p *peer, payload []byte) {
+	forwardToLightClient(p, payload, BlockHeaderIn)
+}
+
+//Miners get these messages as well, they are only consumed by light clients.
+func forwardToLightClient(p *peer, payload []byte, ch chan []byte) {
+	if !lightClient {
+		return
+	}
+
+	rememberSender(payloadHash(payload), p)
+	select {
+	case ch <- payload:
+	default:
+	}
+}
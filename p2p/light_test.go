@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"net"
+	"testing"
+)
+
+func TestBlockHeadersByRangeRes(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	block := protocol.NewBlock([32]byte{}, 5)
+	block.ShardId, block.Hash = 9, [32]byte{9}
+	block.FundsTxData = [][32]byte{{1}}
+	block.NrFundsTx = 1
+	storage.WriteClosedBlock(block)
+	defer storage.DeleteClosedBlock(block.Hash)
+
+	p := &peer{conn: conn, listenerPort: "8000", peerType: PEERTYPE_MINER, version: PROTOCOL_VERSION}
+	go blockHeadersByRangeRes(p, encodeBlockRangeReq(9, 1, 10))
+
+	header, payload, err := RcvData_(remote)
+	if err != nil || header.TypeID != BLOCK_HEADERS_BY_RANGE_RES {
+		t.Fatalf("No block header range received: %v\n", err)
+	}
+
+	go processBlockHeadersByRangeRes(p, payload)
+	response := <-BlockHeadersByRangeChan
+	if len(response.Blocks) != 1 || !response.Last {
+		t.Fatalf("Wrong block header range: %v\n", response)
+	}
+
+	var received *protocol.Block
+	received = received.Decode(response.Blocks[0])
+	if received.Hash != block.Hash || len(received.FundsTxData) != 0 || received.NrFundsTx != 1 {
+		t.Errorf("Wrong block header: %v\n", received)
+	}
+}
+
+func TestEpochBlockHeaderRes(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	epochBlock := protocol.NewEpochBlock([][32]byte{{1}}, 4)
+	epochBlock.Hash = [32]byte{4}
+	epochBlock.StateDelta = map[[32]byte]*protocol.Account{{5}: {Balance: 5}}
+	storage.WriteClosedEpochBlock(epochBlock)
+	defer storage.DeleteClosedEpochBlock(epochBlock.Hash)
+
+	p := &peer{conn: conn, listenerPort: "8000", peerType: PEERTYPE_CLIENT, version: PROTOCOL_VERSION}
+	go epochBlockHeaderRes(p, epochBlock.Hash[:])
+
+	header, payload, err := RcvData_(remote)
+	if err != nil || header.TypeID != EPOCH_BLOCK_HEADER_RES {
+		t.Fatalf("No epoch block header received: %v\n", err)
+	}
+
+	//Headers come without the state delta
+	var received *protocol.EpochBlock
+	received = received.Decode(payload)
+	if received == nil || received.Hash != epochBlock.Hash || len(received.StateDelta) != 0 {
+		t.Errorf("Wrong epoch block header: %v\n", received)
+	}
+
+	unknown := [32]byte{5}
+	go epochBlockHeaderRes(p, unknown[:])
+	if header, _, err := RcvData_(remote); err != nil || header.TypeID != NOT_FOUND {
+		t.Errorf("Unknown epoch block not reported: %v\n", err)
+	}
+}
@@ -1,17 +1,16 @@
 package p2p
 
 import (
-	"github.com/oigele/bazo-miner/storage"
-	"log"
+	"github.com/oigele/bazo-miner/logging"
 )
 
 var (
 	LogMapping map[uint8]string
-	logger     *log.Logger
+	logger     *logging.Logger
 )
 
 func InitLogging() {
-	logger = storage.InitLogger()
+	logger = logging.New("p2p")
 
 	//Instead of logging just the integer, we log the corresponding semantic meaning, makes scrolling through
 	//the log file more comfortable
@@ -44,6 +43,8 @@ func InitLogging() {
 	LogMapping[31] = "SPECIALTX_REQ"
 	LogMapping[32] = "NOT_FOUND_TX_REQ"
 	LogMapping[33] = "AGGDATATX_REQ"
+	LogMapping[34] = "ACC_PROOF_REQ"
+	LogMapping[35] = "RECEIPT_REQ"
 
 	LogMapping[40] = "FUNDSTX_RES"
 	LogMapping[41] = "ACCTX_RES"
@@ -56,6 +57,8 @@ func InitLogging() {
 	LogMapping[48] = "INTERMEDIATE_NODES_RES"
 	LogMapping[49] = "AGGTX_RES"
 	LogMapping[50] = "AGGDATATX_RES"
+	LogMapping[51] = "ACC_PROOF_RES"
+	LogMapping[52] = "RECEIPT_RES"
 
 	LogMapping[130] = "NEIGHBOR_REQ"
 	LogMapping[140] = "NEIGHBOR_RES"
@@ -66,6 +69,11 @@ func InitLogging() {
 	LogMapping[101] = "MINER_PONG"
 	LogMapping[102] = "CLIENT_PING"
 	LogMapping[103] = "CLIENT_PONG"
+	LogMapping[104] = "IDENTITY"
+	LogMapping[105] = "HANDSHAKE_REJECT"
+	LogMapping[106] = "INV"
+	LogMapping[107] = "GETDATA"
+	LogMapping[108] = "ADDR"
 
 	LogMapping[110] = "NOT_FOUND"
 
@@ -95,6 +103,15 @@ func InitLogging() {
 	LogMapping[147] = "COMMITTEE_CHECK_REQ"
 	LogMapping[148] = "COMMITTEE_CHECK_RES"
 	LogMapping[149] = "FINETX_BRDCST"
+	LogMapping[152] = "BLOCKS_BY_RANGE_REQ"
+	LogMapping[153] = "BLOCKS_BY_RANGE_RES"
+	LogMapping[154] = "BLOCK_HEADERS_BY_RANGE_REQ"
+	LogMapping[155] = "BLOCK_HEADERS_BY_RANGE_RES"
+	LogMapping[156] = "EPOCH_BLOCK_HEADER_REQ"
+	LogMapping[157] = "EPOCH_BLOCK_HEADER_RES"
+	LogMapping[158] = "PROPOSAL_BRDCST"
+	LogMapping[159] = "VOTE_BRDCST"
+	LogMapping[160] = "ENDORSEMENT_BRDCST"
 
 
 }
@@ -1,6 +1,7 @@
 package p2p
 
 import (
+	"github.com/oigele/bazo-miner/storage"
 	"os"
 	"testing"
 )
@@ -14,6 +15,11 @@ func TestMain(m *testing.M) {
 	//Used for some tests, the bootstarp server is listening at 8000 at the same time
 	Ipport = "127.0.0.1:9000"
 	InitLogging()
+	//Bans are persisted
+	storage.Init(storage.MEMORY_BACKEND, "")
+
+	initBans()
+	initAddressBook()
 
 	peers.minerConns = make(map[*peer]bool)
 	peers.clientConns = make(map[*peer]bool)
@@ -23,11 +29,15 @@ func TestMain(m *testing.M) {
 
 	iplistChan = make(chan string, MIN_MINERS)
 	minerBrdcstMsg = make(chan []byte)
+	minerTxBrdcstMsg = make(chan []byte)
 	clientBrdcstMsg = make(chan []byte)
 	register = make(chan *peer)
 	disconnect = make(chan *peer)
 
-	go broadcastService()
+	go minerBroadcastService()
+	go minerTxBroadcastService()
+	go inventoryService()
+	go clientBroadcastService()
 	go checkHealthService()
 	go timeService()
 	go forwardBlockBrdcstToMiner()
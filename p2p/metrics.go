@@ -0,0 +1,36 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/metrics"
+)
+
+var (
+	receivedMessagesMetric = metrics.NewCounterVec("p2p_messages_received_total", "Number of messages received per message type.", "type")
+	sentMessagesMetric     = metrics.NewCounterVec("p2p_messages_sent_total", "Number of messages sent per message type.", "type")
+	rateLimitedMessagesMetric = metrics.NewCounterVec("p2p_messages_rate_limited_total", "Number of received messages dropped because the peer exceeded its rate limit, per message type.", "type")
+	droppedBroadcastsMetric   = metrics.NewCounterVec("p2p_broadcasts_dropped_total", "Number of messages not sent to a peer because its queue was full, per message type.", "type")
+	slowPeersMetric           = metrics.NewCounterVec("p2p_slow_peers_disconnected_total", "Number of peers disconnected because their queue was full when a consensus message was sent, per message type.", "type")
+	duplicatePayloadsMetric   = metrics.NewCounterVec("p2p_duplicate_payloads_total", "Number of broadcasts received from miners that were already seen, per message type.", "type")
+
+	peersMetric = metrics.NewGaugeVecFunc("p2p_peers", "Number of connected peers per peer type.", "type", func() map[string]float64 {
+		return map[string]float64{
+			"miner":  float64(peers.len(PEERTYPE_MINER)),
+			"client": float64(peers.len(PEERTYPE_CLIENT)),
+		}
+	})
+)
+
+//Messages are counted by the name of their type in LogMapping.
+func messageTypeName(typeID uint8) string {
+	if name := LogMapping[typeID]; name != "" {
+		return name
+	}
+
+	return "UNKNOWN"
+}
+
+func countSentMessage(packet []byte) {
+	if len(packet) > 4 {
+		sentMessagesMetric.WithLabel(messageTypeName(packet[4])).Inc()
+	}
+}
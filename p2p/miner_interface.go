@@ -26,6 +26,16 @@ var (
 	//Committee check from committee to the network
 	CommitteeCheckOut = make(chan []byte)
 
+	//Proposals and votes of the agreement of a shard, from the miner to the network and back
+	ProposalOut = make(chan []byte)
+	ProposalIn  = make(chan []byte, 100)
+	VoteOut     = make(chan []byte, 100)
+	VoteIn      = make(chan []byte, 1000)
+
+	//Endorsements of the committee, from the committee to the network and from the network to the miners
+	EndorsementOut = make(chan []byte, 100)
+	EndorsementIn  = make(chan []byte, 100)
+
 	//State transition from the network to the miner
 	StateTransitionIn = make(chan []byte)
 
@@ -72,6 +82,8 @@ var (
 	FirstEpochBlockReqChan = make(chan []byte)
 	EpochBlockReqChan      = make(chan []byte)
 	LastEpochBlockReqChan  = make(chan []byte)
+	//Buffered, a response that arrives after the miner stopped waiting does not block the peer
+	StateReqChan           = make(chan []byte, 1)
 	GenesisReqChan         = make(chan []byte)
 
 	ValidatorShardMapReq = make(chan []byte)
@@ -95,8 +107,7 @@ var (
 func forwardBlockBrdcstToMiner() {
 	for {
 		block := <-BlockOut
-		toBrdcst := BuildPacket(BLOCK_BRDCST, block)
-		minerBrdcstMsg <- toBrdcst
+		announce(BLOCK_BRDCST, block)
 	}
 }
 
@@ -110,7 +121,7 @@ func forwardBlockHeaderBrdcstToMiner() {
 func forwardStateTransitionShardToMiner() {
 	for {
 		st := <-StateTransitionShardOut
-		logger.Printf("Building state transition request packet\n")
+		logger.Debug("Building state transition request packet")
 		toBrdcst := BuildPacket(STATE_TRANSITION_REQ, st)
 		minerBrdcstMsg <- toBrdcst
 	}
@@ -119,7 +130,7 @@ func forwardStateTransitionShardToMiner() {
 func forwardCommitteeCheckRequestToMiner() {
 	for {
 		cc := <- CommitteeCheckShardOut
-		logger.Printf("Building committee check request packet\n")
+		logger.Debug("Building committee check request packet")
 		toBrdcst := BuildPacket(COMMITTEE_CHECK_REQ, cc)
 		minerBrdcstMsg <- toBrdcst
 	}
@@ -128,7 +139,7 @@ func forwardCommitteeCheckRequestToMiner() {
 func forwardShardBlockRequestToMiner() {
 	for {
 		block := <-ShardBlockShardOut
-		logger.Printf("Building shard block request packet\n")
+		logger.Debug("Building shard block request packet")
 		toBrdcst := BuildPacket(SHARD_BLOCK_REQ, block)
 		minerBrdcstMsg <- toBrdcst
 	}
@@ -137,7 +148,7 @@ func forwardShardBlockRequestToMiner() {
 func forwardTransactionAssignmentRequestToMiner() {
 	for {
 		transactionAssignment := <-TransactionAssignmentReqOut
-		logger.Printf("Building transaction assignment request packet \n")
+		logger.Debug("Building transaction assignment request packet")
 		toBrdcst := BuildPacket(TRANSACTION_ASSIGNMENT_REQ, transactionAssignment)
 		minerBrdcstMsg <- toBrdcst
 	}
@@ -146,8 +157,28 @@ func forwardTransactionAssignmentRequestToMiner() {
 func forwardStateTransitionBrdcstToMiner() {
 	for {
 		st := <-StateTransitionOut
-		toBrdcst := BuildPacket(STATE_TRANSITION_BRDCST, st)
-		minerBrdcstMsg <- toBrdcst
+		announce(STATE_TRANSITION_BRDCST, st)
+	}
+}
+
+func forwardProposalBrdcstToMiner() {
+	for {
+		proposal := <-ProposalOut
+		announce(PROPOSAL_BRDCST, proposal)
+	}
+}
+
+func forwardVoteBrdcstToMiner() {
+	for {
+		vote := <-VoteOut
+		announce(VOTE_BRDCST, vote)
+	}
+}
+
+func forwardEndorsementBrdcstToMiner() {
+	for {
+		endorsement := <-EndorsementOut
+		announce(ENDORSEMENT_BRDCST, endorsement)
 	}
 }
 
@@ -170,8 +201,7 @@ func forwardTransactionAssignmentBrdcstToMiner() {
 func forwardCommitteeCheckToMiner() {
 	for {
 		committeeCheck := <- CommitteeCheckOut
-		toBrdcst := BuildPacket(COMMITTEE_CHECK_BRDCST, committeeCheck)
-		minerBrdcstMsg <- toBrdcst
+		announce(COMMITTEE_CHECK_BRDCST, committeeCheck)
 	}
 }
 
@@ -179,7 +209,7 @@ func forwardEpochBlockBrdcstToMiner() {
 	for {
 		epochBlock := <-EpochBlockOut
 		toBrdcst := BuildPacket(EPOCH_BLOCK_BRDCST, epochBlock)
-		logger.Printf("Build Epoch Block Brdcst Packet...\n")
+		logger.Debug("Building epoch block broadcast packet")
 		minerBrdcstMsg <- toBrdcst
 	}
 }
@@ -194,7 +224,11 @@ func forwardVerifiedTxsToMiner() {
 func forwardVerifiedTxsBrdcstToMiner() {
 	for {
 		verifiedTx := <-VerifiedTxsBrdcstOut
-		minerBrdcstMsg <- verifiedTx
+		if isInventoryType(verifiedTx[4]) {
+			announce(verifiedTx[4], verifiedTx[HEADER_LEN:])
+		} else {
+			minerBrdcstMsg <- verifiedTx
+		}
 	}
 }
 
@@ -207,8 +241,9 @@ func forwardBlockToMiner(p *peer, payload []byte) {
 	/*if len(BlockIn) > 0 {
 		var block *protocol.Block
 		block = block.Decode(payload)
-		logger.Printf("Inside ForwardBlockToMiner --> len(BlockIn) = %v for block %x", len(BlockIn), block.Hash[0:8])
+		logger.Debug("Forwarding block to the miner", "hash", block.Hash[0:8], "shard", block.ShardId, "height", block.Height, "queued", len(BlockIn))
 	}*/
+	rememberSender(payloadHash(payload), p)
 	BlockIn <- payload
 	//	}
 	//	blockStashMutex.Unlock()
@@ -392,14 +427,30 @@ func forwardBlockReqToMiner(p *peer, payload []byte) {
 }
 
 func forwardEpochBlockToMinerIn(p *peer, payload []byte) {
-	logger.Printf("Writing Epoch block to channel EpochBlockIn from %s.\n", p.getIPPort())
+	logger.Debug("Forwarding epoch block to the miner", "peer", p.getIPPort())
 	EpochBlockIn <- payload
 }
 
 func forwardStateTransitionToMiner(p *peer, payload []byte) () {
+	rememberSender(payloadHash(payload), p)
 	StateTransitionIn <- payload
 }
 
+func forwardProposalToMiner(p *peer, payload []byte) {
+	rememberSender(payloadHash(payload), p)
+	ProposalIn <- payload
+}
+
+func forwardVoteToMiner(p *peer, payload []byte) {
+	rememberSender(payloadHash(payload), p)
+	VoteIn <- payload
+}
+
+func forwardEndorsementToMiner(p *peer, payload []byte) {
+	rememberSender(payloadHash(payload), p)
+	EndorsementIn <- payload
+}
+
 func forwardTransactionAssignmentToMinerIn(p *peer, payload []byte) {
 	TransactionAssignmentIn <- payload
 }
@@ -416,23 +467,33 @@ func forwardLastEpochBlockToMiner(p *peer, payload []byte) {
 	LastEpochBlockReqChan <- payload
 }
 
+func forwardStateToMiner(p *peer, payload []byte) {
+	rememberSender(payloadHash(payload), p)
+	select {
+	case StateReqChan <- payload:
+	default:
+	}
+}
+
 func forwardStateTransitionShardReqToMiner(p *peer, payload []byte) {
-	logger.Printf("received state transition response..\n")
+	logger.Debug("Received state transition response")
+	rememberSender(payloadHash(payload), p)
 	StateTransitionShardReqChan <- payload
 }
 
 func forwardTransactionAssignmentToMiner(p *peer, payload []byte) {
-	logger.Printf("received transaction assignment response...\n")
+	logger.Debug("Received transaction assignment response")
 	TransactionAssignmentReqChan <- payload
 }
 
 func forwardCommitteeCheckReqToMiner(p *peer, payload []byte) {
-	logger.Printf("received committee check request response... \n")
+	logger.Debug("Received committee check response")
 	CommitteeCheckReqChan <- payload
 }
 
 func forwardShardBlockToMiner(p *peer, payload []byte) {
-	logger.Printf("received shard block response... \n")
+	logger.Debug("Received shard block response")
+	rememberSender(payloadHash(payload), p)
 	ShardBlockReqChan <- payload
 }
 
@@ -9,7 +9,7 @@ import (
 //legacy code
 func BlockReq(hash [32]byte, hashWithoutTx [32]byte) error {
 
-	logger.Printf("Request Block %x, %x from the network (%v Miners)", hash[0:8], hashWithoutTx[0:8], peers.len(PEERTYPE_MINER))
+	logger.Debug("Requesting block", "hash", hash[0:8], "hashWithoutTx", hashWithoutTx[0:8], "miners", peers.len(PEERTYPE_MINER))
 
 	payload := hash[:]
 	payloadTEMP := hashWithoutTx[:]
@@ -20,7 +20,7 @@ func BlockReq(hash [32]byte, hashWithoutTx [32]byte) error {
 		wait := true
 		for wait {
 			time.Sleep(2*time.Second)
-			logger.Printf("Currently no other miners around... Waiting to request block...")
+			logger.Debug("No miners connected, waiting to request the block")
 			if peers.len(PEERTYPE_MINER) > 0 {
 				wait = false
 			}
@@ -88,6 +88,18 @@ func LastEpochBlockReq() error {
 	return nil
 }
 
+//Requests the state of the epoch block with the given hash, nodes keep the state of their last closed epoch block.
+func StateReq(epochBlockHash [32]byte) error {
+	p := peers.getRandomPeer(PEERTYPE_MINER)
+	if p == nil {
+		return errors.New("Couldn't get a connection, request not transmitted.")
+	}
+
+	packet := BuildPacket(STATE_REQ, epochBlockHash[:])
+	sendData(p, packet)
+	return nil
+}
+
 func LastBlockReq() error {
 
 	p := peers.getRandomPeer(PEERTYPE_MINER)
@@ -147,17 +159,11 @@ func TxWithTxCntReq(payload []byte, reqType uint8) error {
 }
 
 func PrintMinerConns() {
-	minerConnections := peers.getAllPeers(PEERTYPE_MINER)
-	logger.Printf("  ____________")
-	logger.Printf(" | Neighbors: |__________________")
-	if len(minerConnections) > 0 {
-		for _, p := range minerConnections {
-			logger.Printf(" |-- Miner: %v", p.getIPPort())
-		}
-	} else {
-		logger.Printf("|   No Neighbors                |", )
+	var miners []string
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		miners = append(miners, p.getIPPort())
 	}
-	logger.Printf("|_______________________________|")
+	logger.Debug("Connected miners", "miners", miners)
 }
 
 func StateTransitionReqShard(shardID int,height int) {
@@ -1,9 +1,9 @@
 package p2p
 
 import (
+	"bufio"
 	"math/rand"
 	"net"
-	"strings"
 	"sync"
 )
 
@@ -23,6 +23,21 @@ type peer struct {
 	listenerPort string
 	time         int64
 	peerType     uint
+	//Messages are read through one reader, such that bytes buffered beyond a message are not lost
+	reader       *bufio.Reader
+	//Set if the connection is encrypted, identity is the proof the peer sent over it (nil if it has none)
+	secure       bool
+	identity     *Identity
+	//Announced in the handshake
+	version      uint16
+	chainID      [32]byte
+	capabilities uint32
+	//Rates of the messages received from the peer, see ratelimit.go
+	limiter      *rateLimiter
+	//Address the peer is reachable at, if it differs from its remote address (e.g. behind a NAT), see address.go.
+	//It is only used to recognize the peer once it is verified. Guarded by l.
+	advertisedAddress string
+	addressVerified   bool
 }
 
 //Block constructor, argument is the previous block in the blockchain.
@@ -38,6 +53,23 @@ func newPeer(conn net.Conn, listenerPort string, peerType uint) *peer {
 	return p
 }
 
+func (p *peer) getReader() *bufio.Reader {
+	if p.reader == nil {
+		p.reader = bufio.NewReader(p.conn)
+	}
+
+	return p.reader
+}
+
+//Only used by the goroutine reading from the peer.
+func (p *peer) getLimiter() *rateLimiter {
+	if p.limiter == nil {
+		p.limiter = newRateLimiter()
+	}
+
+	return p.limiter
+}
+
 //PeerStruct is a thread-safe map that supports all necessary map operations needed by the server.
 type peersStruct struct {
 	minerConns  map[*peer]bool
@@ -54,14 +86,14 @@ func (peers peersStruct) contains(ipport string, peerType uint) bool {
 
 	if peerType == PEERTYPE_MINER {
 		for peer := range peers.minerConns {
-			if peer.getIPPort() == ipport {
+			if peer.hasAddress(ipport) {
 				return true
 			}
 		}
 	}
 	if peerType == PEERTYPE_CLIENT {
 		for peer := range peers.clientConns {
-			if peer.getIPPort() == ipport {
+			if peer.hasAddress(ipport) {
 				return true
 			}
 		}
@@ -70,11 +102,43 @@ func (peers peersStruct) contains(ipport string, peerType uint) bool {
 }
 
 func (p *peer) getIPPort() string {
-	ip := strings.Split(p.conn.RemoteAddr().String(), ":")
 	//Cut off original port.
+	ip, _ := splitAddress(p.conn.RemoteAddr().String())
 	port := p.listenerPort
 
-	return ip[0] + ":" + port
+	return net.JoinHostPort(ip, port)
+}
+
+//The address other nodes should use to connect to the peer.
+func (p *peer) getAdvertisedAddress() string {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if p.advertisedAddress != "" {
+		return p.advertisedAddress
+	}
+
+	return p.getIPPort()
+}
+
+//Addresses this node dialed itself are verified, the addresses peers advertise are verified by a dial-back.
+func (p *peer) setAdvertisedAddress(address string, verified bool) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.advertisedAddress, p.addressVerified = address, verified
+}
+
+//Any node can claim any address, so the advertised address only counts once it is verified.
+func (p *peer) hasAddress(ipport string) bool {
+	if p.getIPPort() == ipport {
+		return true
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	return p.addressVerified && p.advertisedAddress == ipport
 }
 
 func (peers peersStruct) add(p *peer) {
@@ -85,7 +149,7 @@ func (peers peersStruct) add(p *peer) {
 		for peer := range peers.minerConns {
 			if p.getIPPort() == peer.getIPPort() {
 				delete(peers.minerConns, peer)
-				logger.Printf("Deleted Old Peer Entry for %v", peer.getIPPort())
+				logger.Debug("Deleted old peer entry", "peer", peer.getIPPort())
 			}
 		}
 		peers.minerConns[p] = true
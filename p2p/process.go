@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"github.com/oigele/bazo-miner/protocol"
 	"github.com/oigele/bazo-miner/storage"
-	"strconv"
 	"sync"
 )
 
@@ -34,6 +33,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 			return
 		}*/
 		if fTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = fTx
@@ -41,6 +41,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var aTx *protocol.AccTx
 		aTx = aTx.Decode(payload)
 		if aTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = aTx
@@ -48,6 +49,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var cTx *protocol.ConfigTx
 		cTx = cTx.Decode(payload)
 		if cTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = cTx
@@ -55,6 +57,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var sTx *protocol.StakeTx
 		sTx = sTx.Decode(payload)
 		if sTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = sTx
@@ -62,6 +65,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var aTx *protocol.AggTx
 		aTx = aTx.Decode(payload)
 		if aTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = aTx
@@ -69,6 +73,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var dTx *protocol.DataTx
 		dTx = dTx.Decode(payload)
 		if dTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = dTx
@@ -76,6 +81,7 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var aTx *protocol.AggDataTx
 		aTx = aTx.Decode(payload)
 		if aTx == nil {
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
 			return
 		}
 		tx = aTx
@@ -83,7 +89,8 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		var cTx *protocol.CommitteeTx
 		cTx = cTx.Decode(payload)
 		if cTx == nil {
-			return 
+			penalize(p, MISBEHAVIOR_UNDECODABLE)
+			return
 		}
 		tx = cTx
 	}
@@ -110,13 +117,14 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 	}
 
 	if storage.ReadOpenTxHashToDelete(tx.Hash()) == true {
-		logger.Printf("stopped transaction from being added")
+		logger.Debug("Closed transaction not added to the mempool", "tx", tx.Hash())
 		return
 	}
 
 
 	//logger.Printf("Received Tx %x from %v", tx.Hash(), p.getIPPort())
 	//Write to mempool and rebroadcast
+	rememberSender(tx.Hash(), p)
 	storage.WriteOpenTx(tx)
 	//toBrdcst := BuildPacket(brdcstType, payload)
 	//minerTxBrdcstMsg <- toBrdcst
@@ -135,11 +143,16 @@ func processTimeRes(p *peer, payload []byte) {
 }
 
 func processNeighborRes(p *peer, payload []byte) {
-	//Parse the incoming ipv4 addresses.
-	ipportList := _processNeighborRes(payload)
+	ipportList, err := decodeAddressList(payload)
+	if err != nil {
+		logger.Warn("Invalid neighbor list", "peer", p.getIPPort(), "error", err)
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
 
 	for _, ipportIter := range ipportList {
 		//logger.Printf("IP/Port received: %v\n", ipportIter)
+		learnAddress(ipportIter)
 		//iplistChan is a buffered channel to handle ips asynchronously.
 		if !peers.contains(ipportIter, PEERTYPE_MINER) && !peerSelfConn(ipportIter) && len(iplistChan) <= (MIN_MINERS * MIN_MINERS) {
 			iplistChan <- ipportIter
@@ -147,30 +160,6 @@ func processNeighborRes(p *peer, payload []byte) {
 	}
 }
 
-//Split the processNeighborRes function in two for cleaner testing.
-func _processNeighborRes(payload []byte) (ipportList []string) {
-	index := 0
-
-	for cnt := 0; cnt < len(payload)/(IPV4ADDR_SIZE+PORT_SIZE); cnt++ {
-		var addr string
-		for singleAddr := index; singleAddr < index+IPV4ADDR_SIZE; singleAddr++ {
-			tmp := int(payload[singleAddr])
-			addr += strconv.Itoa(tmp)
-			addr += "."
-		}
-		//Remove trailing dot.
-		addr = addr[:len(addr)-1]
-		addr += ":"
-		//Extract port number.
-		addr += strconv.Itoa(int(binary.BigEndian.Uint16(payload[index+4 : index+6])))
-
-		ipportList = append(ipportList, addr)
-		index += IPV4ADDR_SIZE + PORT_SIZE
-	}
-
-	return ipportList
-}
-
 func processValMappingRes(p *peer, payload []byte) {
 	ValidatorShardMapReq <- payload
 }
@@ -34,6 +34,8 @@ const (
 	SPECIALTX_REQ			= 31
 	NOT_FOUND_TX_REQ		= 32
 	AGGDATATX_REQ			= 33
+	ACC_PROOF_REQ			= 34
+	RECEIPT_REQ				= 35
 
 
 	FUNDSTX_RES            	= 40
@@ -47,6 +49,8 @@ const (
 	INTERMEDIATE_NODES_RES 	= 48
 	AGGTX_RES				= 49
 	AGGDATATX_RES			= 50
+	ACC_PROOF_RES			= 51
+	RECEIPT_RES				= 52
 
 	NEIGHBOR_REQ = 130
 	NEIGHBOR_RES = 140
@@ -57,6 +61,15 @@ const (
 	MINER_PONG  = 101
 	CLIENT_PING = 102
 	CLIENT_PONG = 103
+	//Sent over TLS before the handshake, see transport.go
+	IDENTITY    = 104
+	//Sent instead of MINER_PONG/CLIENT_PONG, the payload is the reason
+	HANDSHAKE_REJECT = 105
+	//Announces the hashes of broadcasts and requests the announced ones, see inventory.go
+	INV     = 106
+	GETDATA = 107
+	//Address the node is reachable at, sent after the handshake, see address.go
+	ADDR = 108
 
 	//Used to signal error
 	NOT_FOUND = 110
@@ -90,6 +103,19 @@ const (
 	COMMITTEE_CHECK_REQ = 147
 	COMMITTEE_CHECK_RES = 148
 	FINETX_BRDCST = 149
+
+	BLOCKS_BY_RANGE_REQ = 152
+	BLOCKS_BY_RANGE_RES = 153
+	//Used by light clients, see light.go
+	BLOCK_HEADERS_BY_RANGE_REQ = 154
+	BLOCK_HEADERS_BY_RANGE_RES = 155
+	EPOCH_BLOCK_HEADER_REQ     = 156
+	EPOCH_BLOCK_HEADER_RES     = 157
+	//Agreement of the validators of a shard on its blocks, see bft.go of the miner
+	PROPOSAL_BRDCST = 158
+	VOTE_BRDCST     = 159
+	//Endorsement of an epoch block or a transaction assignment by a committee member, see endorsement.go of the miner
+	ENDORSEMENT_BRDCST = 160
 )
 
 type Header struct {
@@ -0,0 +1,171 @@
+package p2p
+
+import (
+	"sync"
+	"time"
+)
+
+//Every message type belongs to a class, which defines the maximum payload size and how many messages of the type a
+//peer may send per second. The rates are enforced with token buckets per peer and type, plus one bucket per peer for
+//all of its messages. Messages exceeding the rate are dropped and the peer is penalized, oversized messages are not
+//even read and the connection is closed.
+type messageLimit struct {
+	maxSize uint32
+	rate    float64
+	burst   float64
+}
+
+var (
+	controlLimit = messageLimit{MAX_CONTROL_PAYLOAD_SIZE, CONTROL_RATE, CONTROL_BURST}
+	requestLimit = messageLimit{MAX_REQUEST_PAYLOAD_SIZE, REQUEST_RATE, REQUEST_BURST}
+	txLimit      = messageLimit{MAX_TX_PAYLOAD_SIZE, TX_RATE, TX_BURST}
+	//Blocks, epoch blocks, states and everything else that is not listed below
+	dataLimit = messageLimit{MAX_PAYLOAD_SIZE, DATA_RATE, DATA_BURST}
+
+	messageLimits = newMessageLimits()
+)
+
+func newMessageLimits() map[uint8]messageLimit {
+	limits := make(map[uint8]messageLimit)
+
+	for _, typeID := range []uint8{MINER_PING, MINER_PONG, CLIENT_PING, CLIENT_PONG, IDENTITY, HANDSHAKE_REJECT,
+		NEIGHBOR_REQ, NEIGHBOR_RES, TIME_BRDCST, TX_BRDCST_ACK, ADDR} {
+		limits[typeID] = controlLimit
+	}
+
+	for _, typeID := range []uint8{GENESIS_REQ, FUNDSTX_REQ, ACCTX_REQ, CONFIGTX_REQ, STAKETX_REQ, BLOCK_REQ,
+		BLOCK_HEADER_REQ, ACC_REQ, ROOTACC_REQ, INTERMEDIATE_NODES_REQ, AGGTX_REQ, UNKNOWNTX_REQ, SPECIALTX_REQ,
+		NOT_FOUND_TX_REQ, AGGDATATX_REQ, ACC_PROOF_REQ, STATE_REQ, FIRST_EPOCH_BLOCK_REQ, EPOCH_BLOCK_REQ,
+		VALIDATOR_SHARD_REQ, LAST_EPOCH_BLOCK_REQ, STATE_TRANSITION_REQ, SHARD_BLOCK_REQ, TRANSACTION_ASSIGNMENT_REQ,
+		COMMITTEE_CHECK_REQ, NOT_FOUND, INV, GETDATA, BLOCKS_BY_RANGE_REQ, BLOCK_HEADERS_BY_RANGE_REQ,
+		EPOCH_BLOCK_HEADER_REQ, RECEIPT_REQ} {
+		limits[typeID] = requestLimit
+	}
+
+	for _, typeID := range []uint8{FUNDSTX_BRDCST, ACCTX_BRDCST, CONFIGTX_BRDCST, STAKETX_BRDCST, DATATX_BRDCST,
+		COMMITTEETX_BRDCST, FINETX_BRDCST, FUNDSTX_RES, ACCTX_RES, CONFIGTX_RES, STAKETX_RES, VOTE_BRDCST} {
+		limits[typeID] = txLimit
+	}
+
+	return limits
+}
+
+func getMessageLimit(typeID uint8) messageLimit {
+	if limit, exists := messageLimits[typeID]; exists {
+		return limit
+	}
+
+	return dataLimit
+}
+
+func maxPayloadSize(typeID uint8) uint32 {
+	return getMessageLimit(typeID).maxSize
+}
+
+type tokenBucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	updated time.Time
+}
+
+//Buckets start full, such that a new peer can send a burst right away.
+func newTokenBucket(rate float64, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate, burst, burst, now}
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.updated = now
+}
+
+type rateLimiter struct {
+	total   *tokenBucket
+	perType map[uint8]*tokenBucket
+	lock    sync.Mutex
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		total:   newTokenBucket(PEER_RATE, PEER_BURST, time.Now()),
+		perType: make(map[uint8]*tokenBucket),
+	}
+}
+
+//Takes a token from the bucket of the type and the bucket of the peer. Nothing is taken if either is empty.
+func (limiter *rateLimiter) allow(typeID uint8, now time.Time) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	bucket, exists := limiter.perType[typeID]
+	if !exists {
+		limit := getMessageLimit(typeID)
+		bucket = newTokenBucket(limit.rate, limit.burst, now)
+		limiter.perType[typeID] = bucket
+	}
+
+	bucket.refill(now)
+	limiter.total.refill(now)
+	if bucket.tokens < 1 || limiter.total.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+	limiter.total.tokens--
+	return true
+}
+
+//Returns false and penalizes the peer if it exceeded its rate for the message type.
+func (p *peer) allowMessage(typeID uint8) bool {
+	if p.getLimiter().allow(typeID, time.Now()) {
+		return true
+	}
+
+	rateLimitedMessagesMetric.WithLabel(messageTypeName(typeID)).Inc()
+	penalize(p, MISBEHAVIOR_FLOODING)
+	return false
+}
+
+//Gossip the receivers can fetch again or do without, e.g. transactions are requested when a block misses them and light
+//clients sync the headers by range.
+var droppableTypes = map[uint8]bool{
+	FUNDSTX_BRDCST:      true,
+	ACCTX_BRDCST:        true,
+	CONFIGTX_BRDCST:     true,
+	STAKETX_BRDCST:      true,
+	VERIFIEDTX_BRDCST:   true,
+	AGGTX_BRDCST:        true,
+	DATATX_BRDCST:       true,
+	AGGDATATX_BRDCST:    true,
+	COMMITTEETX_BRDCST:  true,
+	TX_BRDCST_ACK:       true,
+	BLOCK_HEADER_BRDCST: true,
+	TIME_BRDCST:         true,
+	NEIGHBOR_RES:        true,
+}
+
+//Hands the message to the writer of the peer without blocking, such that a slow peer does not hold up the broadcast to
+//all others. If the queue of the peer is full, gossip is dropped for this peer. Blocks, epoch blocks, state transitions,
+//inventories and the other consensus messages are never dropped, the peer is disconnected instead and catches up by
+//range requests once it reconnects.
+func enqueue(p *peer, msg []byte) bool {
+	select {
+	case p.ch <- msg:
+		return true
+	default:
+	}
+
+	if droppableTypes[msg[4]] {
+		droppedBroadcastsMetric.WithLabel(messageTypeName(msg[4])).Inc()
+		logger.Debug("Dropped message for slow peer", "peer", p.getIPPort(), "type", messageTypeName(msg[4]))
+		return false
+	}
+
+	slowPeersMetric.WithLabel(messageTypeName(msg[4])).Inc()
+	logger.Warn("Disconnecting peer that does not keep up with consensus messages", "peer", p.getIPPort(), "type", messageTypeName(msg[4]))
+	p.conn.Close()
+	return false
+}
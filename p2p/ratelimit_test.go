@@ -0,0 +1,105 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Now()
+
+	for i := 0; i < CONTROL_BURST; i++ {
+		if !limiter.allow(TIME_BRDCST, now) {
+			t.Fatalf("Message %v of the burst refused\n", i+1)
+		}
+	}
+
+	if limiter.allow(TIME_BRDCST, now) {
+		t.Errorf("Message above the burst allowed\n")
+	}
+
+	//Other types have their own bucket
+	if !limiter.allow(FUNDSTX_BRDCST, now) {
+		t.Errorf("Message of another type refused\n")
+	}
+
+	//Tokens are refilled at the rate of the type
+	if !limiter.allow(TIME_BRDCST, now.Add(time.Second/CONTROL_RATE)) {
+		t.Errorf("Bucket not refilled\n")
+	}
+
+	if limiter.allow(TIME_BRDCST, now.Add(time.Second/CONTROL_RATE)) {
+		t.Errorf("Bucket refilled beyond its rate\n")
+	}
+}
+
+func TestRateLimiterTotal(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Now()
+	limiter.total.tokens = 1
+
+	if !limiter.allow(FUNDSTX_BRDCST, now) {
+		t.Fatalf("Message refused\n")
+	}
+
+	if limiter.allow(BLOCK_BRDCST, now) {
+		t.Errorf("Message above the rate of the peer allowed\n")
+	}
+}
+
+func TestMaxPayloadSize(t *testing.T) {
+	if maxPayloadSize(TIME_BRDCST) >= maxPayloadSize(FUNDSTX_BRDCST) || maxPayloadSize(FUNDSTX_BRDCST) >= maxPayloadSize(EPOCH_BLOCK_RES) {
+		t.Errorf("Unexpected payload sizes: %v, %v, %v\n", maxPayloadSize(TIME_BRDCST), maxPayloadSize(FUNDSTX_BRDCST), maxPayloadSize(EPOCH_BLOCK_RES))
+	}
+
+	conn, remote := net.Pipe()
+	defer remote.Close()
+
+	//Only the header is sent, the payload must not be waited for
+	go func() {
+		header := make([]byte, HEADER_LEN)
+		binary.BigEndian.PutUint32(header[0:4], MAX_CONTROL_PAYLOAD_SIZE+1)
+		header[4] = TIME_BRDCST
+		remote.Write(header)
+	}()
+
+	p := &peer{conn: conn, listenerPort: "8000"}
+	if _, _, err := RcvData(p); err == nil {
+		t.Errorf("Oversized payload accepted\n")
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	p := &peer{conn: conn, ch: make(chan []byte, 1)}
+	packet := BuildPacket(TIME_BRDCST, nil)
+
+	if !enqueue(p, packet) {
+		t.Errorf("Message not queued\n")
+	}
+
+	//Must not block while the queue of the peer is full
+	if enqueue(p, packet) {
+		t.Errorf("Message queued beyond the size of the queue\n")
+	}
+
+	//Gossip is dropped, the peer stays connected
+	go remote.Write([]byte{0})
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("Peer disconnected for dropped gossip\n")
+	}
+
+	//Consensus messages are not dropped, the peer is disconnected instead
+	if enqueue(p, BuildPacket(BLOCK_BRDCST, nil)) {
+		t.Errorf("Block queued beyond the size of the queue\n")
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Peer not disconnected for a block it could not take\n")
+	}
+}
@@ -0,0 +1,44 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+//Clients follow their cross-shard transfers with RECEIPT_REQ, the payload is the hash of the funds transaction. The
+//answer is the protocol.ReceiptStatus the miner has stored for the transfer, including the proof against the block or
+//epoch block that emitted, delivered or credited it, or NOT_FOUND if the miner has not seen the transfer.
+var ReceiptChan = make(chan []byte, MIN_MINERS)
+
+//Requests the status of the cross-shard transfer with the given transaction hash from the miner.
+func ReceiptReq(address string, txHash [32]byte) error {
+	return requestFrom(address, RECEIPT_REQ, txHash[:])
+}
+
+func receiptRes(p *peer, payload []byte) {
+	if len(payload) != 32 {
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	var txHash [32]byte
+	copy(txHash[:], payload)
+
+	status := storage.ReadReceiptStatus(txHash)
+	if status == nil {
+		sendData(p, BuildPacket(NOT_FOUND, nil))
+		return
+	}
+
+	sendData(p, BuildPacket(RECEIPT_RES, status.Encode()))
+}
+
+func processReceiptRes(p *peer, payload []byte) {
+	var status *protocol.ReceiptStatus
+	if status = status.Decode(payload); status == nil {
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	forwardToLightClient(p, payload, ReceiptChan)
+}
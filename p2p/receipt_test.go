@@ -0,0 +1,41 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"net"
+	"testing"
+)
+
+func TestReceiptRes(t *testing.T) {
+	conn, remote := net.Pipe()
+	defer conn.Close()
+	defer remote.Close()
+
+	status := &protocol.ReceiptStatus{Receipt: protocol.Receipt{TxHash: [32]byte{35}, Amount: 10}, Status: protocol.RECEIPT_CREDITED, Block: [32]byte{1}}
+	storage.WriteReceiptStatus(status)
+
+	//A transfer is never reported a stage back
+	pending := *status
+	pending.Status = protocol.RECEIPT_PENDING
+	storage.WriteReceiptStatus(&pending)
+
+	p := &peer{conn: conn, listenerPort: "8000", peerType: PEERTYPE_CLIENT, version: PROTOCOL_VERSION}
+	go receiptRes(p, status.Receipt.TxHash[:])
+
+	header, payload, err := RcvData_(remote)
+	if err != nil || header.TypeID != RECEIPT_RES {
+		t.Fatalf("No receipt status received: %v\n", err)
+	}
+
+	var received *protocol.ReceiptStatus
+	if received = received.Decode(payload); received == nil || received.Status != protocol.RECEIPT_CREDITED || received.Receipt != status.Receipt {
+		t.Errorf("Wrong receipt status: %v\n", received)
+	}
+
+	unknown := [32]byte{36}
+	go receiptRes(p, unknown[:])
+	if header, _, err := RcvData_(remote); err != nil || header.TypeID != NOT_FOUND {
+		t.Errorf("Unknown transfer not reported: %v\n", err)
+	}
+}
@@ -0,0 +1,255 @@
+package p2p
+
+import (
+	"github.com/oigele/bazo-miner/metrics"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"golang.org/x/crypto/sha3"
+	"sync"
+	"time"
+)
+
+//Every peer starts with MAX_SCORE. Misbehavior lowers the score, which recovers by SCORE_RECOVERY points per minute.
+//A peer whose score drops to zero is disconnected and banned for BAN_DURATION. Peers are identified by their IP and
+//listener port, as several nodes may run on the same host. Bans are persisted, such that a restart does not lift them.
+type Misbehavior int
+
+const (
+	MISBEHAVIOR_INVALID_BLOCK Misbehavior = iota
+	MISBEHAVIOR_INVALID_STATE_TRANSITION
+	MISBEHAVIOR_INVALID_TX
+	MISBEHAVIOR_UNDECODABLE
+	MISBEHAVIOR_PROTOCOL_VIOLATION
+	MISBEHAVIOR_UNAUTHORIZED
+	MISBEHAVIOR_FLOODING
+)
+
+type score struct {
+	value   int
+	updated time.Time
+}
+
+var (
+	misbehaviorNames = map[Misbehavior]string{
+		MISBEHAVIOR_INVALID_BLOCK:            "invalid_block",
+		MISBEHAVIOR_INVALID_STATE_TRANSITION: "invalid_state_transition",
+		MISBEHAVIOR_INVALID_TX:               "invalid_tx",
+		MISBEHAVIOR_UNDECODABLE:              "undecodable",
+		MISBEHAVIOR_PROTOCOL_VIOLATION:       "protocol_violation",
+		MISBEHAVIOR_UNAUTHORIZED:             "unauthorized",
+		MISBEHAVIOR_FLOODING:                 "flooding",
+	}
+
+	penalties = map[Misbehavior]int{
+		MISBEHAVIOR_INVALID_BLOCK:            50,
+		MISBEHAVIOR_INVALID_STATE_TRANSITION: 50,
+		MISBEHAVIOR_INVALID_TX:               10,
+		MISBEHAVIOR_UNDECODABLE:              25,
+		MISBEHAVIOR_PROTOCOL_VIOLATION:       25,
+		MISBEHAVIOR_UNAUTHORIZED:             10,
+		//Given for every message above the rate limit
+		MISBEHAVIOR_FLOODING:                 1,
+	}
+
+	scores          = make(map[string]*score)
+	bans            = make(map[string]int64)
+	reputationMutex = &sync.Mutex{}
+
+	//Senders of the payloads forwarded to the miner, such that validation failures can be traced back to them.
+	senders      = make(map[[32]byte]string)
+	senderKeys   [][32]byte
+	sendersMutex = &sync.Mutex{}
+
+	penaltiesMetric   = metrics.NewCounterVec("p2p_penalties_total", "Number of penalties given to peers per misbehavior.", "misbehavior")
+	bannedPeersMetric = metrics.NewGaugeFunc("p2p_banned_peers", "Number of banned peers.", func() float64 {
+		reputationMutex.Lock()
+		defer reputationMutex.Unlock()
+		return float64(len(bans))
+	})
+)
+
+//Loads the persisted bans, expired ones are removed.
+func initBans() {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+
+	now := time.Now().Unix()
+	for address, until := range storage.ReadBannedPeers() {
+		if until <= now {
+			storage.DeleteBannedPeer(address)
+			continue
+		}
+		bans[address] = until
+	}
+}
+
+//The miner reports the hash of blocks, state transitions and transactions that failed validation. The peer that
+//sent them is penalized, if it is still known. Content is only reported once, even if it is validated repeatedly.
+func ReportInvalid(hash [32]byte, misbehavior Misbehavior) {
+	if address := takeSender(hash); address != "" {
+		penalizeAddress(address, misbehavior)
+	}
+}
+
+//Blocks are signed by their beneficiary, such that a block that is invalid by its own content is held against the
+//validator that created it rather than against the miner that relayed it. The validator is only penalized if it is
+//connected and authenticated as the beneficiary.
+func ReportValidator(beneficiary [32]byte, misbehavior Misbehavior) {
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		if p.authenticatedAs(IDENTITY_VALIDATOR) && protocol.SerializeHashContent(p.identity.Address) == beneficiary {
+			penalize(p, misbehavior)
+		}
+	}
+}
+
+//Same as ReportInvalid for payloads that could not be decoded or validated before their hash was known.
+func ReportInvalidPayload(payload []byte, misbehavior Misbehavior) {
+	ReportInvalid(payloadHash(payload), misbehavior)
+}
+
+//Remembers the sender of the payload under the hash of its content, such that the content can be reported once it is
+//validated.
+func LinkSender(payload []byte, hash [32]byte) {
+	if address := senderOf(payloadHash(payload)); address != "" {
+		rememberSenderAddress(hash, address)
+	}
+}
+
+func payloadHash(payload []byte) [32]byte {
+	return sha3.Sum256(payload)
+}
+
+func rememberSender(hash [32]byte, p *peer) {
+	rememberSenderAddress(hash, p.getIPPort())
+}
+
+//Only the most recent MAX_REMEMBERED_SENDERS senders are kept.
+func rememberSenderAddress(hash [32]byte, address string) {
+	sendersMutex.Lock()
+	defer sendersMutex.Unlock()
+
+	if _, exists := senders[hash]; !exists {
+		senderKeys = append(senderKeys, hash)
+	}
+	senders[hash] = address
+
+	if len(senderKeys) > MAX_REMEMBERED_SENDERS {
+		delete(senders, senderKeys[0])
+		senderKeys = senderKeys[1:]
+	}
+}
+
+func senderOf(hash [32]byte) string {
+	sendersMutex.Lock()
+	defer sendersMutex.Unlock()
+
+	return senders[hash]
+}
+
+//Returns the sender and forgets it. The key stays in senderKeys until it is evicted.
+func takeSender(hash [32]byte) string {
+	sendersMutex.Lock()
+	defer sendersMutex.Unlock()
+
+	address := senders[hash]
+	delete(senders, hash)
+	return address
+}
+
+//Lowers the score of the peer and disconnects it if it gets banned.
+func penalize(p *peer, misbehavior Misbehavior) {
+	if penalizeAddress(p.getIPPort(), misbehavior) {
+		p.conn.Close()
+	}
+}
+
+//Returns true if the peer got banned.
+func penalizeAddress(address string, misbehavior Misbehavior) bool {
+	penaltiesMetric.WithLabel(misbehaviorNames[misbehavior]).Inc()
+
+	reputationMutex.Lock()
+	value := updateScore(address, -penalties[misbehavior])
+	banned := value <= 0
+	if banned {
+		until := time.Now().Add(BAN_DURATION * time.Second).Unix()
+		bans[address] = until
+		delete(scores, address)
+		storage.WriteBannedPeer(address, until)
+	}
+	reputationMutex.Unlock()
+
+	logger.Warn("Penalized peer", "peer", address, "misbehavior", misbehaviorNames[misbehavior], "score", value)
+	if banned {
+		logger.Warn("Banned peer", "peer", address, "duration", BAN_DURATION)
+		disconnectAddress(address)
+	}
+
+	return banned
+}
+
+//Adds delta to the score after restoring the points recovered since the last update. Has to be called with the
+//reputationMutex held.
+func updateScore(address string, delta int) int {
+	now := time.Now()
+	s, exists := scores[address]
+	if !exists {
+		s = &score{MAX_SCORE, now}
+		scores[address] = s
+	}
+
+	s.value += int(now.Sub(s.updated)/time.Minute) * SCORE_RECOVERY
+	if s.value > MAX_SCORE {
+		s.value = MAX_SCORE
+	}
+	s.value += delta
+	s.updated = now
+
+	return s.value
+}
+
+//Closes all connections to the address, the read loops of the peers take care of the rest.
+func disconnectAddress(address string) {
+	for _, peerType := range []uint{PEERTYPE_MINER, PEERTYPE_CLIENT} {
+		for _, p := range peers.getAllPeers(peerType) {
+			if p.getIPPort() == address {
+				p.conn.Close()
+			}
+		}
+	}
+}
+
+func isBanned(address string) bool {
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+
+	until, exists := bans[address]
+	if !exists {
+		return false
+	}
+
+	if until <= time.Now().Unix() {
+		delete(bans, address)
+		storage.DeleteBannedPeer(address)
+		return false
+	}
+
+	return true
+}
+
+//Connections are checked by their IP before the handshake, as the listener port is not known yet. A ban of any peer on
+//the host refuses the connection.
+func isBannedHost(remoteAddress string) bool {
+	host, _ := splitAddress(remoteAddress)
+
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+
+	now := time.Now().Unix()
+	for address, until := range bans {
+		if bannedHost, _ := splitAddress(address); bannedHost == host && until > now {
+			return true
+		}
+	}
+
+	return false
+}
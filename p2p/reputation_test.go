@@ -0,0 +1,148 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+func TestPenalize(t *testing.T) {
+	address := "10.0.0.1:8000"
+
+	for i := 0; i < MAX_SCORE/penalties[MISBEHAVIOR_INVALID_TX]-1; i++ {
+		if penalizeAddress(address, MISBEHAVIOR_INVALID_TX) {
+			t.Fatalf("Peer banned after %v penalties\n", i+1)
+		}
+	}
+
+	if isBanned(address) {
+		t.Errorf("Peer banned before its score dropped to zero\n")
+	}
+
+	if !penalizeAddress(address, MISBEHAVIOR_INVALID_TX) || !isBanned(address) {
+		t.Errorf("Peer not banned after its score dropped to zero\n")
+	}
+
+	if _, exists := storage.ReadBannedPeers()[address]; !exists {
+		t.Errorf("Ban not persisted\n")
+	}
+
+	//Incoming connections come from another port than the listener port of the banned peer
+	if !isBannedHost("10.0.0.1:51234") || isBannedHost("10.0.0.9:51234") {
+		t.Errorf("Connections not refused by the IP of the banned peer\n")
+	}
+
+	//Bans are lifted once they expire
+	reputationMutex.Lock()
+	bans[address] = time.Now().Unix() - 1
+	reputationMutex.Unlock()
+
+	if isBannedHost("10.0.0.1:51234") || isBanned(address) {
+		t.Errorf("Expired ban not lifted\n")
+	}
+
+	if _, exists := storage.ReadBannedPeers()[address]; exists {
+		t.Errorf("Expired ban not removed from storage\n")
+	}
+}
+
+func TestScoreRecovery(t *testing.T) {
+	address := "10.0.0.2:8000"
+	penalizeAddress(address, MISBEHAVIOR_INVALID_BLOCK)
+
+	reputationMutex.Lock()
+	defer reputationMutex.Unlock()
+
+	scores[address].updated = time.Now().Add(-30 * time.Minute)
+	if value := updateScore(address, 0); value != MAX_SCORE-penalties[MISBEHAVIOR_INVALID_BLOCK]+30*SCORE_RECOVERY {
+		t.Errorf("Score did not recover: %v\n", value)
+	}
+
+	scores[address].updated = time.Now().Add(-24 * time.Hour)
+	if value := updateScore(address, 0); value != MAX_SCORE {
+		t.Errorf("Score recovered beyond the maximum: %v\n", value)
+	}
+}
+
+func TestReportInvalid(t *testing.T) {
+	address := "10.0.0.3:8000"
+	payload := []byte{1, 2, 3}
+	hash := [32]byte{3}
+
+	//The sender of the payload is linked to the hash of its content by the miner
+	rememberSenderAddress(payloadHash(payload), address)
+	LinkSender(payload, hash)
+	if senderOf(hash) != address {
+		t.Fatalf("Sender not linked to the content\n")
+	}
+
+	ReportInvalid(hash, MISBEHAVIOR_INVALID_BLOCK)
+	ReportInvalid(hash, MISBEHAVIOR_INVALID_BLOCK)
+
+	reputationMutex.Lock()
+	value := scores[address].value
+	reputationMutex.Unlock()
+
+	if value != MAX_SCORE-penalties[MISBEHAVIOR_INVALID_BLOCK] {
+		t.Errorf("Invalid content not reported exactly once: score %v\n", value)
+	}
+
+	//Unknown senders are ignored
+	ReportInvalid([32]byte{4}, MISBEHAVIOR_INVALID_BLOCK)
+}
+
+func TestReportValidator(t *testing.T) {
+	relayer := newRemotePeer(t, "10.0.0.5:51234", "8000")
+	originator := newRemotePeer(t, "10.0.0.6:51234", "8000")
+	originator.identity = &Identity{Address: [64]byte{6}, KeyType: IDENTITY_VALIDATOR, verified: true}
+	peers.add(relayer)
+	peers.add(originator)
+	defer peers.delete(relayer)
+	defer peers.delete(originator)
+
+	ReportValidator(protocol.SerializeHashContent(originator.identity.Address), MISBEHAVIOR_INVALID_BLOCK)
+
+	reputationMutex.Lock()
+	_, relayerPenalized := scores[relayer.getIPPort()]
+	originatorScore, originatorPenalized := scores[originator.getIPPort()]
+	reputationMutex.Unlock()
+
+	if relayerPenalized {
+		t.Errorf("Relayer of the block penalized\n")
+	}
+	if !originatorPenalized || originatorScore.value != MAX_SCORE-penalties[MISBEHAVIOR_INVALID_BLOCK] {
+		t.Errorf("Beneficiary of the block not penalized\n")
+	}
+}
+
+func TestRememberedSendersBounded(t *testing.T) {
+	for i := 0; i < MAX_REMEMBERED_SENDERS+10; i++ {
+		rememberSenderAddress(payloadHash([]byte{byte(i), byte(i >> 8)}), "10.0.0.4:8000")
+	}
+
+	sendersMutex.Lock()
+	defer sendersMutex.Unlock()
+	if len(senderKeys) > MAX_REMEMBERED_SENDERS || len(senders) > MAX_REMEMBERED_SENDERS {
+		t.Errorf("Remembered senders not bounded: %v\n", len(senders))
+	}
+}
+
+func TestUndecodableTxBrdcst(t *testing.T) {
+	p := newRemotePeer(t, "10.0.0.5:51234", "8000")
+	mempool := len(storage.ReadAllOpenTxs())
+
+	processTxBrdcst(p, []byte{0xde, 0xad, 0xbe, 0xef}, FUNDSTX_BRDCST)
+
+	reputationMutex.Lock()
+	score := scores[p.getIPPort()]
+	reputationMutex.Unlock()
+
+	if score == nil || score.value != MAX_SCORE-penalties[MISBEHAVIOR_UNDECODABLE] {
+		t.Errorf("Peer not penalized for an undecodable transaction: %v\n", score)
+	}
+	if len(storage.ReadAllOpenTxs()) != mempool {
+		t.Errorf("Undecodable transaction written to the mempool\n")
+	}
+}
@@ -16,13 +16,7 @@ func NeighborReq() {
 func neighborBrdcst() {
 
 	knownPeers := peers.getAllPeers(PEERTYPE_MINER)
-	var ipportList []string
-	for _, p := range knownPeers {
-		ipportList = append(ipportList, p.getIPPort())
-
-	}
-
-	packet := BuildPacket(NEIGHBOR_RES, _neighborRes(ipportList))
+	packet := BuildPacket(NEIGHBOR_RES, neighborList(knownPeers))
 	for _, p := range knownPeers {
 		sendData(p, packet)
 	}
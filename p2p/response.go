@@ -1,8 +1,8 @@
 package p2p
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"github.com/oigele/bazo-miner/protocol"
 	"github.com/oigele/bazo-miner/storage"
 	"strconv"
@@ -13,6 +13,9 @@ import (
 var(
 	lastNotFoundTxWithHash = [32]byte{}
 	notFoundTxMutex = &sync.Mutex{}
+	stateTrie *protocol.StateTrie
+	stateTrieEpochBlock [32]byte
+	stateTrieMutex = &sync.Mutex{}
 	)
 
 //This file responds to incoming requests from miners in a synchronous fashion
@@ -223,12 +226,12 @@ func blockHeaderRes(p *peer, payload []byte) {
 		var blockHash [32]byte
 		copy(blockHash[:], payload[:32])
 		if block := storage.ReadClosedBlock(blockHash); block != nil {
-			//block.InitBloomFilter(append(storage.GetTxPubKeys(block)))
+			block.InitBloomFilter(storage.GetTxPubKeys(block))
 			encodedHeader = block.EncodeHeader()
 		}
 	} else {
 		if block := storage.ReadLastClosedBlock(); block != nil {
-			//block.InitBloomFilter(append(storage.GetTxPubKeys(block)))
+			block.InitBloomFilter(storage.GetTxPubKeys(block))
 			encodedHeader = block.EncodeHeader()
 		}
 	}
@@ -273,13 +276,19 @@ func rootAccRes(p *peer, payload []byte) {
 
 //Completes the handshake with another miner.
 func pongRes(p *peer, payload []byte, peerType uint) {
-	//Payload consists of a 2 bytes array (port number [big endian encoded]).
-	port := _pongRes(payload)
+	//Payload consists of the port number, protocol version, chain ID and capabilities, see handshake.go
+	hs, err := decodeHandshake(payload)
+	if err == nil {
+		err = hs.check()
+	}
+	if err != nil {
+		rejectHandshake(p, err)
+		return
+	}
+	hs.apply(p)
 
-	if port != "" {
-		p.listenerPort = port
-	} else {
-		p.conn.Close()
+	if isBanned(p.getIPPort()) {
+		rejectHandshake(p, errors.New("peer is banned"))
 		return
 	}
 
@@ -288,24 +297,29 @@ func pongRes(p *peer, payload []byte, peerType uint) {
 		return
 	}
 
-	//Complete handshake
+	//Complete handshake, our answer carries the same information
+	localPort, _ := getAdvertisedPort()
 	var packet []byte
 	if peerType == MINER_PING {
 		p.peerType = PEERTYPE_MINER
-		packet = BuildPacket(MINER_PONG, nil)
+		packet, _ = PrepareHandshake(MINER_PONG, localPort)
 	} else if peerType == CLIENT_PING {
 		p.peerType = PEERTYPE_CLIENT
-		packet = BuildPacket(CLIENT_PONG, nil)
+		packet, _ = PrepareHandshake(CLIENT_PONG, localPort)
 	}
+	logger.Debug("Handshake completed", "peer", p.getIPPort(), "version", p.version, "capabilities", capabilitiesString(p.capabilities))
 
 	go peerConn(p)
 
 	sendData(p, packet)
+	if p.peerType == PEERTYPE_MINER {
+		sendAddress(p)
+	}
 }
 
 //Decouple the function for testing.
 func _pongRes(payload []byte) string {
-	if len(payload) == PORT_SIZE {
+	if len(payload) >= PORT_SIZE {
 		return strconv.Itoa(int(binary.BigEndian.Uint16(payload[0:PORT_SIZE])))
 	} else {
 		return ""
@@ -313,52 +327,18 @@ func _pongRes(payload []byte) string {
 }
 
 func neighborRes(p *peer) {
-	//only supporting ipv4 addresses for now, makes fixed-size structure easier
-	//in the future following structure is possible:
-	//1) nr of ipv4 addresses, 2) nr of ipv6 addresses, followed by list of both
-	var packet []byte
-	var ipportList []string
-	peerList := peers.getAllPeers(PEERTYPE_MINER)
-
-	for _, p := range peerList {
-		ipportList = append(ipportList, p.getIPPort())
-	}
-
-	packet = BuildPacket(NEIGHBOR_RES, _neighborRes(ipportList))
+	packet := BuildPacket(NEIGHBOR_RES, neighborList(peers.getAllPeers(PEERTYPE_MINER)))
 	sendData(p, packet)
 }
 
-//Decouple functionality to facilitate testing
-func _neighborRes(ipportList []string) (payload []byte) {
-
-	payload = make([]byte, len(ipportList)*6) //6 = size of ipv4 address + port
-	index := 0
-	for _, ipportIter := range ipportList {
-		ipport := strings.Split(ipportIter, ":")
-		split := strings.Split(ipport[0], ".")
-
-		//Serializing IP:Port addr tuples
-		for ipv4addr := 0; ipv4addr < 4; ipv4addr++ {
-			addrPart, err := strconv.Atoi(split[ipv4addr])
-			if err != nil {
-				return nil
-			}
-			payload[index] = byte(addrPart)
-			index++
-		}
-
-		port, _ := strconv.ParseUint(ipport[1], 10, 16)
-
-		//serialize port number
-		var buf bytes.Buffer
-		binary.Write(&buf, binary.BigEndian, port)
-		payload[index] = buf.Bytes()[len(buf.Bytes())-2]
-		index++
-		payload[index] = buf.Bytes()[len(buf.Bytes())-1]
-		index++
+//The advertised addresses are sent in the length-prefixed format, see address.go.
+func neighborList(peerList []*peer) []byte {
+	var ipportList []string
+	for _, p := range peerList {
+		ipportList = append(ipportList, p.getAdvertisedAddress())
 	}
 
-	return payload
+	return encodeAddressList(ipportList)
 }
 
 func intermediateNodesRes(p *peer, payload []byte) {
@@ -386,6 +366,61 @@ func intermediateNodesRes(p *peer, payload []byte) {
 	sendData(p, packet)
 }
 
+//Responds with the account and its proof against the state root of the last closed epoch block. The account is the
+//one in the state of the epoch block, changes made in the current epoch are not included.
+func accProofRes(p *peer, payload []byte) {
+	var packet []byte
+	var hash [32]byte
+	if len(payload) != 32 {
+		return
+	}
+	copy(hash[:], payload[0:32])
+
+	if proof := buildAccountProof(hash); proof != nil {
+		packet = BuildPacket(ACC_PROOF_RES, proof.Encode())
+	} else {
+		packet = BuildPacket(NOT_FOUND, nil)
+	}
+
+	sendData(p, packet)
+}
+
+//The trie of the last closed epoch block is cached, since it only changes once per epoch.
+func buildAccountProof(hash [32]byte) *protocol.AccountProof {
+	epochBlock := storage.ReadLastClosedEpochBlock()
+	if epochBlock == nil {
+		return nil
+	}
+
+	stateTrieMutex.Lock()
+	if stateTrieEpochBlock != epochBlock.Hash || stateTrie == nil {
+		//The state is persisted with the epoch block, epoch blocks only carry the state delta
+		persisted := storage.ReadLastClosedEpochBlockState()
+		if persisted == nil || persisted.BlockHash != epochBlock.Hash {
+			stateTrieMutex.Unlock()
+			return nil
+		}
+		stateTrie = protocol.NewStateTrie(persisted.State)
+		stateTrieEpochBlock = epochBlock.Hash
+	}
+	trie := stateTrie
+	stateTrieMutex.Unlock()
+
+	//Without a matching root, a proof could not be verified by the client anyway
+	if trie.Root() != epochBlock.MerklePatriciaRoot {
+		return nil
+	}
+
+	proof, err := trie.Prove(hash)
+	if err != nil {
+		return nil
+	}
+	proof.EpochBlockHash = epochBlock.Hash
+	proof.EpochBlockHeight = epochBlock.Height
+
+	return proof
+}
+
 func shardBlockRes(p *peer, payload []byte) {
 	var packet []byte
 	var b *protocol.Block
@@ -401,28 +436,28 @@ func shardBlockRes(p *peer, payload []byte) {
 		return
 	}
 
-	logger.Printf("responding block request for shard %d for height: %d\n from peer: %s", shardID, height, p.getIPPort())
+	logger.Debug("Responding shard block request", "shard", shardID, "height", height, "peer", p.getIPPort())
 
 	//security check becuase the listener to incoming blocks is a concurrent goroutine
 	if storage.ReadLastClosedEpochBlock() == nil || storage.ReadLastClosedBlock() == nil {
-		logger.Printf("Haven't stored last epoch block yet.")
+		logger.Debug("No epoch block stored yet", "peer", p.getIPPort())
 		packet = BuildPacket(NOT_FOUND, nil)
 	} else {
 		b = storage.ReadLastClosedBlock()
 		//block cannot be nil or the genesis block
 		if b != nil && b.Height != 1 && int(b.Height) == int(height) && b.ShardId == int(shardID) {
-			logger.Printf("Responding Shard Block Request with block height: %d from shard ID: %d", b.Height, shardID)
+			logger.Debug("Sending shard block", "shard", shardID, "height", b.Height, "peer", p.getIPPort())
 			packet = BuildPacket(SHARD_BLOCK_RES, b.Encode())
 			sendData(p, packet)
 			return
 		} else {
 			if b == nil {
-				logger.Printf("Last closed block is nil")
+				logger.Debug("No closed block stored yet", "peer", p.getIPPort())
 				packet = BuildPacket(NOT_FOUND, nil)
 				sendData(p,packet)
 				return
 			}
-			logger.Printf("Last closed block height: %d and shard ID: %d", b.Height, b.ShardId)
+			logger.Debug("Requested shard block not found", "shard", shardID, "height", height, "lastShard", b.ShardId, "lastHeight", b.Height, "peer", p.getIPPort())
 			packet = BuildPacket(NOT_FOUND, nil)
 		}
 	}
@@ -448,20 +483,20 @@ func TransactionAssignmentRes(p *peer, payload []byte) {
 	} else {
 		//only the leader answers the request
 		if storage.CommitteeLeader == protocol.SerializeHashContent(storage.ValidatorAccAddress) {
-			logger.Printf("responding transaction assignment request for shard %d for height: %d\n", shardID, height)
+			logger.Debug("Responding transaction assignment request", "shard", shardID, "height", height, "peer", p.getIPPort())
 			//security check becuase the listener to incoming blocks is a concurrent goroutine
 			if storage.ReadLastClosedEpochBlock() == nil {
-				logger.Printf("Haven't stored last epoch block yet.")
+				logger.Debug("No epoch block stored yet", "peer", p.getIPPort())
 				packet = BuildPacket(NOT_FOUND, nil)
 			} else if storage.AssignmentHeight == int(height) {
 				ta = storage.AssignedTxMap[int(shardID)]
 				if ta == nil {
-					logger.Printf("Error: Can't find Assignment at Height: %d", height)
+					logger.Warn("Transaction assignment not found", "shard", shardID, "height", height, "peer", p.getIPPort())
 					packet = BuildPacket(NOT_FOUND, nil)
 					sendData(p, packet)
 					return
 				}
-				logger.Printf("responding assignment. Just read it from map. ShardID: %d Height: %d", shardID, height)
+				logger.Debug("Sending transaction assignment", "shard", shardID, "height", height, "peer", p.getIPPort())
 				packet = BuildPacket(TRANSACTION_ASSIGNMENT_RES, ta.EncodeTransactionAssignment())
 			}
 		} else {
@@ -487,13 +522,13 @@ func CommitteeCheckRes(p *peer, payload []byte) {
 	}
 
 	if storage.ReadLastClosedEpochBlock() == nil {
-		logger.Printf("Haven't stored the last Epoch Block yet.")
+		logger.Debug("No epoch block stored yet", "peer", p.getIPPort())
 		packet = BuildPacket(NOT_FOUND, nil)
 		sendData(p,packet)
 		return
 	}
 
-	logger.Printf("Committee Check Request received. Answering...")
+	logger.Debug("Responding committee check request", "peer", p.getIPPort())
 
 	strPayload := string(payload)
 	address := strings.Split(strPayload, ":")[0]
@@ -504,10 +539,10 @@ func CommitteeCheckRes(p *peer, payload []byte) {
 	//we reached the right height
 	if storage.AssignmentHeight == int(height) && string(validatorAccAddress[:]) == address  {
 		cc = storage.OwnCommitteeCheck
-		logger.Printf("Sending committee check request answer for height: %d", cc.Height)
+		logger.Debug("Sending committee check", "height", cc.Height, "peer", p.getIPPort())
 		packet = BuildPacket(COMMITTEE_CHECK_RES, cc.EncodeCommitteeCheck())
 	} else {
-		logger.Printf("Assignment height: %d vs Request height: %d", storage.AssignmentHeight, height)
+		logger.Debug("Committee check not available", "height", height, "assignmentHeight", storage.AssignmentHeight, "peer", p.getIPPort())
 	}
 
 	sendData(p, packet)
@@ -526,30 +561,30 @@ func stateTransitionRes(p *peer, payload []byte) {
 
 	height,_ := strconv.ParseInt(strings.Split(strPayload,":")[1],10,64)
 
-	logger.Printf("responding state transition request for shard %d for height: %d\n", shardID, height)
+	logger.Debug("Responding state transition request", "shard", shardID, "height", height, "peer", p.getIPPort())
 
 	//security check becuase the listener to incoming blocks is a concurrent goroutine
 	 if storage.ReadLastClosedEpochBlock() == nil {
-		logger.Printf("Haven't stored last epoch block yet.")
+		logger.Debug("No epoch block stored yet", "peer", p.getIPPort())
 		packet = BuildPacket(NOT_FOUND,nil)
 	} else {
 		//check if the transition is from last block before epoch block.
 		//this actually gives us a lot of trouble, as the shard IDs might have been switched around.
 		if height == int64(storage.ReadLastClosedEpochBlock().Height-1) {
-			logger.Printf("Got a request for a transition before the epoch block. Height: %d", height)
+			logger.Debug("State transition requested from before the epoch block", "shard", shardID, "height", height, "peer", p.getIPPort())
 			//check if the shard ID before the last epoch block was the same as the request. if yes, I am responsible for the transition
 			if shardID == int64(storage.ThisShardMap[int(storage.ReadLastClosedEpochBlock().Height)-storage.EpochLength-1]) {
-				logger.Printf("Request was from my (old) shard ID: %d", shardID)
+				logger.Debug("State transition requested from my previous shard", "shard", shardID, "height", height)
 				st = storage.ReadStateTransitionFromOwnStash(int(height))
 				if st != nil {
 					packet = BuildPacket(STATE_TRANSITION_RES, st.EncodeTransition())
-					logger.Printf("sent state transition response for height: %d\n", height)
+					logger.Debug("Sending state transition", "shard", shardID, "height", height, "peer", p.getIPPort())
 				} else {
-					logger.Printf("the state transition should have been mine but I couldn't find it...")
+					logger.Warn("Own state transition not found", "shard", shardID, "height", height, "peer", p.getIPPort())
 					packet = BuildPacket(NOT_FOUND, nil)
 				}
 			} else {
-				logger.Printf("Shard ID was %d, not mine", shardID)
+				logger.Debug("State transition requested from another shard", "shard", shardID, "height", height, "peer", p.getIPPort())
 				packet = BuildPacket(NOT_FOUND, nil)
 			}
 		} else {
@@ -558,14 +593,14 @@ func stateTransitionRes(p *peer, payload []byte) {
 				if (st != nil) {
 					if int64(st.ShardID) == shardID {
 						packet = BuildPacket(STATE_TRANSITION_RES, st.EncodeTransition())
-						logger.Printf("sent state transition response for height: %d\n", height)
+						logger.Debug("Sending state transition", "shard", shardID, "height", height, "peer", p.getIPPort())
 					}
 				} else {
 					packet = BuildPacket(NOT_FOUND, nil)
-					logger.Printf("state transition for height %d was nil.\n", height)
+					logger.Debug("State transition not found", "shard", shardID, "height", height, "peer", p.getIPPort())
 				}
 			} else {
-				logger.Printf("Shard ID was %d, not mine", shardID)
+				logger.Debug("State transition requested from another shard", "shard", shardID, "height", height, "peer", p.getIPPort())
 				packet = BuildPacket(NOT_FOUND, nil)
 			}
 		}
@@ -614,6 +649,27 @@ func LastEpochBlockRes(p *peer, payload []byte) {
 	sendData(p, packet)
 }
 
+//Sends the state of the last closed epoch block if it is the requested one. The receiver checks it against the
+//MerklePatriciaRoot of the epoch block.
+func stateRes(p *peer, payload []byte) {
+	if len(payload) != 32 {
+		penalize(p, MISBEHAVIOR_UNDECODABLE)
+		return
+	}
+
+	var ebHash [32]byte
+	copy(ebHash[:], payload)
+
+	persisted := storage.ReadLastClosedEpochBlockState()
+	if persisted == nil || persisted.BlockHash != ebHash {
+		sendData(p, BuildPacket(NOT_FOUND, nil))
+		return
+	}
+
+	state := &storage.PersistedState{BlockHash: persisted.BlockHash, State: persisted.State}
+	sendData(p, BuildPacket(STATE_RES, state.Encode()))
+}
+
 func EpochBlockRes(p *peer, payload []byte) {
 	var ebHash [32]byte
 	copy(ebHash[:], payload[0:32])
@@ -1,13 +1,10 @@
 package p2p
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/oigele/bazo-miner/storage"
 	"net"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
@@ -32,6 +29,9 @@ var (
 func Init(ipport string) {
 	Ipport = ipport
 	InitLogging()
+	initChainID()
+	initBans()
+	initAddressBook()
 
 	//Initialize peer map
 	peers.minerConns = make(map[*peer]bool)
@@ -44,6 +44,7 @@ func Init(ipport string) {
 	//waits for stuff to broadcast. Careful enough with concurrency?
 	go minerBroadcastService()
 	go minerTxBroadcastService()
+	go inventoryService()
 	go clientBroadcastService()
 	go checkHealthService()
 	go timeService()
@@ -54,6 +55,9 @@ func Init(ipport string) {
 	go forwardShardBlockRequestToMiner()
 	go forwardTransactionAssignmentRequestToMiner()
 	go forwardStateTransitionBrdcstToMiner()
+	go forwardProposalBrdcstToMiner()
+	go forwardVoteBrdcstToMiner()
+	go forwardEndorsementBrdcstToMiner()
 	go forwardFineTxBrdcstToMiner()
 	go forwardTransactionAssignmentBrdcstToMiner()
 	go forwardEpochBlockBrdcstToMiner()
@@ -69,21 +73,39 @@ func Init(ipport string) {
 	go listener(Ipport)
 }
 
+//Connect to all bootstrap servers and to the miners known from earlier runs, such that the node does not depend on a
+//single bootstrap server. initiateNewMinerConn(...) starts with MINER_PING to perform the initial handshake message
 func bootstrap() {
-	//Connect to bootstrap server. To make it more fault-tolerant, we can increase the number of bootstrap servers in
-	//the future. initiateNewMinerConn(...) starts with MINER_PING to perform the initial handshake message
-	p, err := initiateNewMinerConnection(storage.Bootstrap_Server)
+	connected := false
+	for _, server := range storage.BootstrapServers {
+		if connectMiner(server) {
+			connected = true
+		}
+	}
+
+	//Bootstrap servers were just dialed and are left out. Without any of them reachable, the node waits until it
+	//is connected to one of the known miners
+	for _, address := range addressBookCandidates(MIN_MINERS, time.Now()) {
+		if connected {
+			go connectMiner(address)
+		} else {
+			connected = connectMiner(address)
+		}
+	}
+}
+
+func connectMiner(dial string) bool {
+	p, err := initiateNewMinerConnection(dial)
 	if err != nil {
-		logger.Printf("Initiating new miner connection failed: %v", err)
+		logger.Debug("Connecting to miner failed", "error", err)
+		return false
 	}
 
 	go peerConn(p)
+	return true
 }
 
-
 func initiateNewMinerConnection(dial string) (*peer, error) {
-	var conn net.Conn
-
 	//Check if we already established a dial with that ip or if the ip belongs to us
 	if peerExists(dial) {
 		return nil, errors.New(fmt.Sprintf("Connection with %v already established.", dial))
@@ -93,45 +115,94 @@ func initiateNewMinerConnection(dial string) (*peer, error) {
 		return nil, errors.New(fmt.Sprintf("Cannot self-connect %v.", dial))
 	}
 
-	//Open up a tcp dial and instantiate a peer struct, wait for adding it to the peerStruct before we finalize
+	if isBanned(dial) {
+		return nil, errors.New(fmt.Sprintf("Miner %v is banned.", dial))
+	}
+
+	//The outcome of the attempt is kept in the address book
+	p, err := dialMiner(dial)
+	recordAttempt(dial, err == nil)
+
+	return p, err
+}
+
+func dialMiner(dial string) (*peer, error) {
+	//Light clients connect like clients, see light.go
+	if lightClient {
+		return dialLight(dial)
+	}
+
+	//Open up an encrypted dial and instantiate a peer struct, wait for adding it to the peerStruct before we finalize
 	//the handshake
-	conn, err := net.Dial("tcp", dial)
-	p := newPeer(conn, strings.Split(dial, ":")[1], PEERTYPE_MINER)
+	conn, identity, err := dialSecure(dial)
 	if err != nil {
 		return nil, err
 	}
+	_, port := splitAddress(dial)
+	p := newPeer(conn, port, PEERTYPE_MINER)
+	p.secure = true
+	p.identity = identity
+	//The peer is reachable at the address we dialed, which might be a hostname
+	p.setAdvertisedAddress(dial, true)
+
+	if err := completeHandshake(p, dial, MINER_PING, MINER_PONG); err != nil {
+		return nil, err
+	}
+	sendAddress(p)
 
-	//Extracts the port from our localConn variable (which is in the form IP:Port)
-	localPort, err := strconv.Atoi(strings.Split(Ipport, ":")[1])
+	return p, nil
+}
+
+//Sends the ping and checks the pong of the dialed peer. The connection is closed on errors.
+func completeHandshake(p *peer, dial string, pingType uint8, pongType uint8) error {
+	//Other nodes connect to the port of our advertised address
+	localPort, err := getAdvertisedPort()
 	if err != nil {
-		conn.Close()
-		return nil, errors.New(fmt.Sprintf("Parsing port failed: %v\n", err))
+		p.conn.Close()
+		return errors.New(fmt.Sprintf("Parsing port failed: %v\n", err))
 	}
 
-	packet, err := PrepareHandshake(MINER_PING, localPort)
+	packet, err := PrepareHandshake(pingType, localPort)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		p.conn.Close()
+		return err
 	}
 
-	conn.Write(packet)
+	p.conn.Write(packet)
+	countSentMessage(packet)
 
 	//Wait for the other party to finish the handshake with the corresponding message
-	header, _, err := RcvData(p)
-	if err != nil || header.TypeID != MINER_PONG {
-		conn.Close()
-		return nil, errors.New(fmt.Sprintf("Failed to complete miner handshake: %v", err))
+	header, payload, err := RcvData(p)
+	if err == nil && header.TypeID == HANDSHAKE_REJECT {
+		p.conn.Close()
+		return errors.New(fmt.Sprintf("Miner handshake rejected by %v: %s", dial, payload))
+	}
+	if err != nil || header.TypeID != pongType {
+		p.conn.Close()
+		return errors.New(fmt.Sprintf("Failed to complete miner handshake: %v", err))
 	}
 
-	return p, nil
+	//Check the other party in turn. The port is the one we dialed.
+	hs, err := decodeHandshake(payload)
+	if err == nil {
+		err = hs.check()
+	}
+	if err != nil {
+		rejectHandshake(p, err)
+		return errors.New(fmt.Sprintf("Rejected miner %v: %v", dial, err))
+	}
+	p.version = hs.version
+	p.chainID = hs.chainID
+	p.capabilities = hs.capabilities
+
+	return nil
 }
 
 func PrepareHandshake(pingType uint8, localPort int) ([]byte, error) {
 	//We need to additionally send our local listening port in order to construct a valid first message
-	//This will be the only time we need it so we don't save it
-	portBuf := make([]byte, PORT_SIZE)
-	binary.BigEndian.PutUint16(portBuf[:], uint16(localPort))
-	packet := BuildPacket(pingType, portBuf)
+	//This will be the only time we need it so we don't save it. The protocol version, chain ID and capabilities
+	//allow the other party to reject us if we cannot talk to each other
+	packet := BuildPacket(pingType, encodeHandshake(localPort))
 
 	return packet, nil
 }
@@ -139,10 +210,10 @@ func PrepareHandshake(pingType uint8, localPort int) ([]byte, error) {
 //listener keeps listening to new connections
 //the argument is the node's own IPPort
 func listener(ipport string) {
-	//Listen on all interfaces, this NAT stuff easier
-	listener, err := net.Listen("tcp", ":"+strings.Split(ipport, ":")[1])
+	//Listen on all interfaces unless a listen address is set, this NAT stuff easier
+	listener, err := net.Listen("tcp", getListenAddress(ipport))
 	if err != nil {
-		logger.Printf("%v\n", err)
+		logger.Error("Could not listen for connections", "error", err)
 		return
 	}
 
@@ -156,20 +227,35 @@ func listener(ipport string) {
 		conn.(*net.TCPConn).SetKeepAlive(true)
 		conn.(*net.TCPConn).SetKeepAlivePeriod(1 * time.Minute)
 
-		//the listener port is kept empty here. It will be finished after a handshake is performed
-		p := newPeer(conn, "", 0)
 		//infinite for loop means that this goroutine will run indefinitely
 		//this goroutine will read the content of the newly instantiated message
-		go handleNewConn(p)
+		go handleNewConn(conn)
 	}
 }
 
-func handleNewConn(p *peer) {
-	//logger.Printf("New incoming connection: %v\n", p.conn.RemoteAddr().String())
+func handleNewConn(conn net.Conn) {
+	//logger.Printf("New incoming connection: %v\n", conn.RemoteAddr().String())
+
+	if isBannedHost(conn.RemoteAddr().String()) {
+		conn.Close()
+		return
+	}
+
+	//Miners connect over TLS, clients over plain TCP
+	conn, secure, identity, err := acceptConn(conn)
+	if err != nil {
+		logger.Debug("Failed to set up incoming connection", "error", err)
+		return
+	}
+
+	//the listener port is kept empty here. It will be finished after a handshake is performed
+	p := newPeer(conn, "", 0)
+	p.secure = secure
+	p.identity = identity
 
 	header, payload, err := RcvData(p)
 	if err != nil {
-		logger.Printf("Failed to handle incoming connection: %v\n", err)
+		logger.Debug("Failed to handle incoming connection", "peer", conn.RemoteAddr().String(), "error", err)
 		return
 	}
 
@@ -178,14 +264,17 @@ func handleNewConn(p *peer) {
 
 func peerConn(p *peer) {
 	if p.peerType == PEERTYPE_MINER {
-		logger.Printf("Adding a new miner: %v\n", p.getIPPort())
-		neighborBrdcst()
+		logger.Info("Adding a new miner", "peer", p.getIPPort())
+		//Miners treat light clients as clients, which do not relay neighbors
+		if !lightClient {
+			neighborBrdcst()
+		}
 	} else if p.peerType == PEERTYPE_CLIENT {
 		//logger.Printf("Adding a new client: %v\n", p.getIPPort())
 	}
 
 	//Give the peer a channel
-	p.ch = make(chan []byte, 100)
+	p.ch = make(chan []byte, PEER_QUEUE_SIZE)
 
 	//Register withe the broadcast service and start the additional writer
 	register <- p
@@ -197,12 +286,12 @@ func peerConn(p *peer) {
 		//logger.Printf("Received message from %s", p.getIPPort())
 		if err != nil {
 			if p.peerType == PEERTYPE_MINER {
-				logger.Printf("Miner disconnected: %v\n", err)
+				logger.Warn("Miner disconnected", "peer", p.getIPPort(), "error", err)
 				disconnect <- p
 				time.Sleep(time.Second)
 				lastpeerMutex.Lock()
 				if getLastTriedPeer() != p.getIPPort() {
-					logger.Printf("Try To Reconnect to %v", p.getIPPort())
+					logger.Info("Trying to reconnect", "peer", p.getIPPort())
 					//iplistChan gets consumed in checkhelthservice
 					iplistChan <- p.getIPPort()
 					setLastTriedPeer(p.getIPPort())
@@ -217,6 +306,10 @@ func peerConn(p *peer) {
 			return
 		}
 
+		if !p.allowMessage(header.TypeID) {
+			continue
+		}
+
 		go processIncomingMsg(p, header, payload)
 
 	}
@@ -40,10 +40,12 @@ func TestPrepareHandshake(t *testing.T) {
 		packet[0] != 0x00 ||
 		packet[1] != 0x00 ||
 		packet[2] != 0x00 ||
-		packet[3] != 0x02 || //payload size is 2 bytes, listener port
+		packet[3] != HANDSHAKE_SIZE || //listener port, protocol version, chain ID and capabilities
 		packet[4] != 0x64 || //dec(0x64) == 100, MINER_PING
 		packet[5] != 0x23 ||
-		packet[6] != 0x28 {
+		packet[6] != 0x28 ||
+		packet[7] != 0x00 ||
+		packet[8] != PROTOCOL_VERSION {
 		t.Errorf("Building MINER_PING packet failed")
 	}
 }
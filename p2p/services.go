@@ -1,13 +1,12 @@
 package p2p
 
 import (
-	"github.com/oigele/bazo-miner/storage"
 	"time"
 )
 
 
 var (
-	sendingMap  map[string]*delayedMessagesPerSender
+	sendingMap  = map[string]*delayedMessagesPerSender{}
 )
 
 type delayedMessagesPerSender struct {
@@ -27,16 +26,16 @@ func peerService() {
 			peers.delete(p)
 			//close(p.ch)  https://tour.golang.org/concurrency/4
 			peers.closeChannelMutex.Unlock()
+			//Replace lost miners by known ones
+			if p.peerType == PEERTYPE_MINER {
+				go refillFromAddressBook()
+			}
 		}
 	}
 }
 
 func minerBroadcastService() {
-	sendingMap = map[string]*delayedMessagesPerSender{}
-
 	//For miner connections a map is created where all connections are stored based on the IP and Port of the peer.
-	// In the first iteration this map is initalized.
-
 	for {
 		select {
 		case msg := <-minerBrdcstMsg:
@@ -51,12 +50,17 @@ func minerTxBroadcastService() {
 	for {
 		select {
 		case msg := <-minerTxBrdcstMsg:
+			//Transactions are announced, the miners fetch the ones they do not have yet.
+			if isInventoryType(msg[4]) {
+				announce(msg[4], msg[HEADER_LEN:])
+				continue
+			}
 			for p := range peers.minerConns {
 				//Write to the channel, which the peerBroadcast(*peer) running in a seperate goroutine consumes right away.
 				if peers.contains(p.getIPPort(),PEERTYPE_MINER) {
-					p.ch <- msg
+					enqueue(p, msg)
 				} else {
-					logger.Printf("CHANNEL_MINER: Wanted to send to %v, but %v is not in the peers.minerConns anymore", p.getIPPort(), p.getIPPort())
+					logger.Debug("Miner disconnected, message not sent", "peer", p.getIPPort())
 				}
 			}
 		}
@@ -71,14 +75,14 @@ func clientBroadcastService() {
 		case msg := <-clientBrdcstMsg:
 			for p := range peers.clientConns {
 				if LogMapping[msg[4]] == "" {
-					logger.Printf("Stop sending message with strange type ID: %v", msg[4])
+					logger.Warn("Message with unknown type not sent", "type", msg[4])
 					time.Sleep(2 * time.Millisecond)
 					continue
 				}
 				if peers.contains(p.getIPPort(),PEERTYPE_CLIENT) {
-					p.ch <- msg
+					enqueue(p, msg)
 				} else {
-					logger.Printf("CHANNEL_CLIENT: Wanted to send to %v, but %v is not in the peers.minerConns anymore", p.getIPPort(), p.getIPPort())
+					logger.Debug("Client disconnected, message not sent", "peer", p.getIPPort())
 				}
 			}
 		}
@@ -90,7 +94,7 @@ func sendAndSearchMessages(msg []byte) {
 	sMap := sendingMap
 	//check logmapping first
 	if LogMapping[msg[4]] == "" {
-		logger.Printf("Stop sending message with strange type ID: %v", msg[4])
+		logger.Warn("Message with unknown type not sent", "type", msg[4])
 		return
 	}
 	for _, p := range sMap {
@@ -104,13 +108,11 @@ func sendAndSearchMessages(msg []byte) {
 			_, _ = isConnectionAlreadyInSendingMap(p.peer, sendingMap)
 
 			receiver := sendingMap[p.peer.getIPPort()].peer
-			receiver.l.Lock()
-			time.Sleep(5 * time.Millisecond)
-			receiver.conn.Write(msg)
-			time.Sleep(5 * time.Millisecond)
-			receiver.l.Unlock()
-			logger.Printf("Tx with payload: %s successfully sent to %s", LogMapping[msg[4]], receiver.getIPPort())
-			//receiver.ch <- msg
+			//The message is written by the peerBroadcast(*peer) of the receiver, such that a slow receiver does not
+			//block the others while the closeChannelMutex is held.
+			if enqueue(receiver, msg) {
+				logger.Debug("Message queued", "type", LogMapping[msg[4]], "peer", receiver.getIPPort())
+			}
 
 			//Send previously stored messages for this miner as well.
 			/*for _, hMsg := range p.delayedMessages {
@@ -177,16 +179,8 @@ func checkHealthService() {
 
 		time.Sleep(time.Duration(nrOfMiners) * 5 * time.Second)  //Dynamic searching for neighbours interval --> 5 times the number of miners
 
-		//if I'm not connected to bootstrap, connect to bootstrap
-		if Ipport != storage.Bootstrap_Server && !peers.contains(storage.Bootstrap_Server, PEERTYPE_MINER) {
-			p, err := initiateNewMinerConnection(storage.Bootstrap_Server)
-			if p == nil || err != nil {
-				logger.Printf("Initiating new miner connection failed: %v", err)
-
-			} else {
-				go peerConn(p)
-			}
-		}
+		//If we are not well-connected, dial the bootstrap servers and known miners
+		refillFromAddressBook()
 
 	//	//Periodically check if we are well-connected
 	//	if peers.len(PEERTYPE_MINER) >= MIN_MINERS {
@@ -204,7 +198,7 @@ func checkHealthService() {
 			if !peerExists(ipaddr) && !peerSelfConn(ipaddr) {
 				p, err := initiateNewMinerConnection(ipaddr)
 				if err != nil {
-					logger.Printf("Initiating new miner connection failed: %v", err)
+					logger.Debug("Connecting to miner failed", "error", err)
 					goto RETRY
 				}
 				if p == nil || err != nil {
@@ -218,7 +212,7 @@ func checkHealthService() {
 		default:
 			//In case we don't have any ip addresses in the channel left, make a request to the network.
 			PrintMinerConns()
-			logger.Printf("     |-- Request Neighbors...        |\n                                                       |_______________________________|")
+			logger.Debug("Requesting neighbors", "miners", peers.len(PEERTYPE_MINER))
 			NeighborReq()
 			break
 		}
@@ -0,0 +1,357 @@
+package p2p
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+//Miners talk to each other over TLS 1.3. The certificates are ephemeral and not checked, because the identity of a
+//node is not tied to a certificate authority but to its account: right after the TLS handshake, both sides sign the
+//keying material exported from the TLS session with the RSA key registered in their account (the commitment key of
+//a validator or the committee key of a committee member). Since the keying material is unique per session, the
+//proof cannot be replayed on another connection.
+//Clients still connect over plain TCP, the listener tells the two apart by the first byte of the connection.
+const (
+	IDENTITY_NONE      = 0
+	IDENTITY_VALIDATOR = 1
+	IDENTITY_COMMITTEE = 2
+
+	IDENTITY_LABEL       = "EXPORTER-bazo-identity"
+	IDENTITY_BINDING_LEN = 32
+	IDENTITY_SIZE        = 64 + 1 + crypto.COMM_PROOF_LENGTH
+
+	//First byte of a TLS record carrying a handshake message, i.e. of a ClientHello.
+	TLS_RECORD_HANDSHAKE = 0x16
+	//Timeout for the TLS handshake and the exchange of the identities in seconds
+	HANDSHAKE_TIMEOUT = 20
+)
+
+//Proof that the node controls the RSA key registered for Address.
+type Identity struct {
+	Address   [64]byte
+	KeyType   uint8
+	Signature [crypto.COMM_PROOF_LENGTH]byte
+
+	//The message signed by the peer, not transmitted but derived from the TLS session.
+	message string
+	verified bool
+	lock     sync.Mutex
+}
+
+var (
+	tlsConfig      *tls.Config
+	tlsConfigErr   error
+	tlsConfigOnce  = &sync.Once{}
+
+	ownIdentityAddress [64]byte
+	ownIdentityKey     *rsa.PrivateKey
+	ownIdentityType    uint8 = IDENTITY_NONE
+	ownIdentityMutex   = &sync.RWMutex{}
+)
+
+//Sets the account and key this node proves its identity with. Nodes without an identity can still connect, but are
+//not trusted with committee traffic.
+func SetIdentity(address [64]byte, key *rsa.PrivateKey, keyType uint8) {
+	ownIdentityMutex.Lock()
+	defer ownIdentityMutex.Unlock()
+
+	ownIdentityAddress = address
+	ownIdentityKey = key
+	ownIdentityType = keyType
+}
+
+func getTLSConfig() (*tls.Config, error) {
+	tlsConfigOnce.Do(func() {
+		tlsConfig, tlsConfigErr = newTLSConfig()
+	})
+
+	return tlsConfig, tlsConfigErr
+}
+
+//The certificate only serves to set up the encrypted channel, a new one is created on every start.
+func newTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "bazo-miner"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS13,
+		//Peers are authenticated by the identity exchanged over the channel, not by their certificate.
+		InsecureSkipVerify: true,
+	}, nil
+}
+
+//Opens an encrypted connection and exchanges the identities. The returned identity is nil if the other node has
+//none.
+func dialSecure(address string) (net.Conn, *Identity, error) {
+	config, err := getTLSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", address, HANDSHAKE_TIMEOUT*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConn := tls.Client(conn, config)
+	identity, err := secureHandshake(tlsConn, true)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return tlsConn, identity, nil
+}
+
+//Wraps an accepted connection. Connections starting with a TLS handshake are upgraded, all others are returned as
+//plain connections. The connection is closed on errors.
+func acceptConn(conn net.Conn) (secureConn net.Conn, secure bool, identity *Identity, err error) {
+	buffered := &bufferedConn{conn, bufio.NewReader(conn)}
+
+	conn.SetReadDeadline(time.Now().Add(HANDSHAKE_TIMEOUT * time.Second))
+	first, err := buffered.reader.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, false, nil, err
+	}
+
+	if first[0] != TLS_RECORD_HANDSHAKE {
+		return buffered, false, nil, nil
+	}
+
+	config, err := getTLSConfig()
+	if err != nil {
+		conn.Close()
+		return nil, false, nil, err
+	}
+
+	tlsConn := tls.Server(buffered, config)
+	if identity, err = secureHandshake(tlsConn, false); err != nil {
+		conn.Close()
+		return nil, false, nil, err
+	}
+
+	return tlsConn, true, identity, nil
+}
+
+func secureHandshake(conn *tls.Conn, dialer bool) (*Identity, error) {
+	conn.SetDeadline(time.Now().Add(HANDSHAKE_TIMEOUT * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := conn.ConnectionState()
+	binding, err := state.ExportKeyingMaterial(IDENTITY_LABEL, nil, IDENTITY_BINDING_LEN)
+	if err != nil {
+		return nil, err
+	}
+
+	own, err := newOwnIdentity(binding, dialer)
+	if err != nil {
+		return nil, err
+	}
+
+	//The dialer sends its identity first, such that neither side relies on the buffers of the connection.
+	var identity *Identity
+	if dialer {
+		if _, err := conn.Write(BuildPacket(IDENTITY, own)); err != nil {
+			return nil, err
+		}
+		if identity, err = readIdentity(conn); err != nil {
+			return nil, err
+		}
+	} else {
+		if identity, err = readIdentity(conn); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(BuildPacket(IDENTITY, own)); err != nil {
+			return nil, err
+		}
+	}
+
+	if identity != nil {
+		identity.message = identityMessage(identity.Address, identity.KeyType, binding, !dialer)
+	}
+
+	return identity, nil
+}
+
+//Reads the identity message, which is sent before the peer is set up. An empty message means that the node has no
+//identity.
+func readIdentity(conn net.Conn) (*Identity, error) {
+	var headerArr [HEADER_LEN]byte
+	if _, err := io.ReadFull(conn, headerArr[:]); err != nil {
+		return nil, err
+	}
+
+	header := extractHeader(headerArr[:])
+	if header.TypeID != IDENTITY || (header.Len != 0 && header.Len != IDENTITY_SIZE) {
+		return nil, errors.New(fmt.Sprintf("Invalid identity message: %v bytes of type %v", header.Len, header.TypeID))
+	}
+
+	if header.Len == 0 {
+		return nil, nil
+	}
+
+	payload := make([]byte, header.Len)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+
+	return decodeIdentity(payload), nil
+}
+
+//The role of the signer is part of the message, otherwise a node could send our own proof back to us.
+func identityMessage(address [64]byte, keyType uint8, binding []byte, dialer bool) string {
+	role := "listener"
+	if dialer {
+		role = "dialer"
+	}
+
+	return fmt.Sprintf("%v:%v:%v:%x:%x", IDENTITY_LABEL, role, keyType, address, binding)
+}
+
+//Returns the encoded identity of this node, or an empty payload if it has none.
+func newOwnIdentity(binding []byte, dialer bool) ([]byte, error) {
+	ownIdentityMutex.RLock()
+	defer ownIdentityMutex.RUnlock()
+
+	if ownIdentityKey == nil || ownIdentityType == IDENTITY_NONE {
+		return nil, nil
+	}
+
+	signature, err := crypto.SignMessageWithRSAKey(ownIdentityKey, identityMessage(ownIdentityAddress, ownIdentityType, binding, dialer))
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Address: ownIdentityAddress, KeyType: ownIdentityType, Signature: signature}
+	return identity.encode(), nil
+}
+
+func (identity *Identity) encode() []byte {
+	encoded := make([]byte, IDENTITY_SIZE)
+	copy(encoded[0:64], identity.Address[:])
+	encoded[64] = identity.KeyType
+	copy(encoded[65:], identity.Signature[:])
+
+	return encoded
+}
+
+func decodeIdentity(encoded []byte) *Identity {
+	identity := new(Identity)
+	copy(identity.Address[:], encoded[0:64])
+	identity.KeyType = encoded[64]
+	copy(identity.Signature[:], encoded[65:IDENTITY_SIZE])
+
+	return identity
+}
+
+//Checks the signature against the key registered in the state of the last closed block, since the miner changes the
+//state concurrently. The key of a new account might only be known later, so only successful checks are remembered.
+func (identity *Identity) verify() bool {
+	identity.lock.Lock()
+	defer identity.lock.Unlock()
+
+	if identity.verified {
+		return true
+	}
+
+	state, _ := storage.ReadStateSnapshot()
+	acc := state[protocol.SerializeHashContent(identity.Address)]
+	if acc == nil {
+		return false
+	}
+
+	var key [crypto.COMM_KEY_LENGTH]byte
+	switch identity.KeyType {
+	case IDENTITY_VALIDATOR:
+		key = acc.CommitmentKey
+	case IDENTITY_COMMITTEE:
+		if !acc.IsCommittee {
+			return false
+		}
+		key = acc.CommitteeKey
+	default:
+		return false
+	}
+
+	pubKey, err := crypto.CreateRSAPubKeyFromBytes(key)
+	if err != nil {
+		return false
+	}
+
+	identity.verified = crypto.VerifyMessageWithRSAKey(pubKey, identity.message, identity.Signature) == nil
+	return identity.verified
+}
+
+//Returns true if the peer proved to control the key of the given type registered in its account.
+func (p *peer) authenticatedAs(keyType uint8) bool {
+	return p.identity != nil && p.identity.KeyType == keyType && p.identity.verify()
+}
+
+//Committee traffic is only accepted from authenticated committee members, the transaction assignments are
+//additionally handed out to authenticated validators.
+func authorized(p *peer, typeID uint8) bool {
+	switch typeID {
+	case TRANSACTION_ASSIGNMENT_BRDCST, TRANSACTION_ASSIGNMENT_RES, COMMITTEE_CHECK_BRDCST, COMMITTEE_CHECK_REQ, COMMITTEE_CHECK_RES:
+		return p.authenticatedAs(IDENTITY_COMMITTEE)
+	case TRANSACTION_ASSIGNMENT_REQ:
+		return p.authenticatedAs(IDENTITY_VALIDATOR) || p.authenticatedAs(IDENTITY_COMMITTEE)
+	case MINER_PING:
+		return p.secure
+	}
+
+	return true
+}
+
+//Connection which first returns the bytes peeked by the listener.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (conn *bufferedConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
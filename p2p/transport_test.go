@@ -0,0 +1,141 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+type acceptResult struct {
+	conn     net.Conn
+	secure   bool
+	identity *Identity
+	err      error
+}
+
+func acceptOnce(t *testing.T) (string, chan acceptResult) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v\n", err)
+	}
+
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- acceptResult{err: err}
+			return
+		}
+		conn, secure, identity, err := acceptConn(conn)
+		accepted <- acceptResult{conn, secure, identity, err}
+	}()
+
+	return listener.Addr().String(), accepted
+}
+
+//Both ends of the connection run in this process and therefore prove the same identity.
+func TestSecureHandshake(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, crypto.COMM_KEY_BITS)
+	if err != nil {
+		t.Fatalf("Could not create key: %v\n", err)
+	}
+
+	var address [64]byte
+	copy(address[:], "committee")
+	var committeeKey [crypto.COMM_KEY_LENGTH]byte
+	copy(committeeKey[:], key.N.Bytes())
+
+	SetIdentity(address, key, IDENTITY_COMMITTEE)
+	defer SetIdentity([64]byte{}, nil, IDENTITY_NONE)
+
+	addressHash := protocol.SerializeHashContent(address)
+	acc := protocol.NewAccount(address, [32]byte{}, 0, false, true, [crypto.COMM_KEY_LENGTH]byte{}, committeeKey, nil, nil)
+	storage.State[addressHash] = &acc
+	defer delete(storage.State, addressHash)
+	//Identities are verified against the state of the last closed block
+	storage.WriteLastClosedBlock(protocol.NewBlock([32]byte{}, 1))
+	defer storage.DeleteAllLastClosedBlock()
+
+	ipport, accepted := acceptOnce(t)
+	conn, identity, err := dialSecure(ipport)
+	if err != nil {
+		t.Fatalf("Could not establish secure connection: %v\n", err)
+	}
+	defer conn.Close()
+
+	result := <-accepted
+	if result.err != nil || !result.secure || result.identity == nil {
+		t.Fatalf("Secure connection was not accepted: %v\n", result.err)
+	}
+	defer result.conn.Close()
+
+	if identity == nil || identity.Address != address || identity.KeyType != IDENTITY_COMMITTEE {
+		t.Fatalf("Identity not received: %v\n", identity)
+	}
+
+	dialerPeer := &peer{conn: result.conn, secure: true, identity: result.identity}
+	listenerPeer := &peer{conn: conn, secure: true, identity: identity}
+	for _, p := range []*peer{dialerPeer, listenerPeer} {
+		if !p.authenticatedAs(IDENTITY_COMMITTEE) || p.authenticatedAs(IDENTITY_VALIDATOR) {
+			t.Errorf("Committee identity not verified\n")
+		}
+		if !authorized(p, COMMITTEE_CHECK_BRDCST) || !authorized(p, TRANSACTION_ASSIGNMENT_REQ) {
+			t.Errorf("Committee traffic from authenticated peer refused\n")
+		}
+	}
+
+	//A proof sent back to its signer must not be accepted
+	reflected := &Identity{Address: identity.Address, KeyType: identity.KeyType, Signature: identity.Signature}
+	reflected.message = result.identity.message
+	if (&peer{identity: reflected}).authenticatedAs(IDENTITY_COMMITTEE) {
+		t.Errorf("Reflected identity was accepted\n")
+	}
+
+	//The committee key has to be registered in the state
+	storage.State[addressHash].CommitteeKey = [crypto.COMM_KEY_LENGTH]byte{}
+	storage.WriteLastClosedBlock(protocol.NewBlock([32]byte{}, 2))
+	unverified := &Identity{Address: identity.Address, KeyType: identity.KeyType, Signature: identity.Signature, message: identity.message}
+	if (&peer{identity: unverified}).authenticatedAs(IDENTITY_COMMITTEE) {
+		t.Errorf("Identity verified without a registered key\n")
+	}
+}
+
+func TestAcceptPlainConn(t *testing.T) {
+	ipport, accepted := acceptOnce(t)
+	conn, err := net.Dial("tcp", ipport)
+	if err != nil {
+		t.Fatalf("Could not connect: %v\n", err)
+	}
+	defer conn.Close()
+
+	packet := BuildPacket(MINER_PING, []byte{0x23, 0x28})
+	conn.Write(packet)
+
+	result := <-accepted
+	if result.err != nil || result.secure || result.identity != nil {
+		t.Fatalf("Plain connection not accepted: %v\n", result.err)
+	}
+	defer result.conn.Close()
+
+	//The byte peeked by the listener must not be lost
+	p := &peer{conn: result.conn}
+	header, payload, err := RcvData(p)
+	if err != nil || header.TypeID != MINER_PING || !reflect.DeepEqual(payload, []byte{0x23, 0x28}) {
+		t.Errorf("Message of plain connection not received: %v\n", err)
+	}
+
+	if authorized(p, MINER_PING) || authorized(p, COMMITTEE_CHECK_BRDCST) || authorized(p, TRANSACTION_ASSIGNMENT_REQ) {
+		t.Errorf("Traffic from unauthenticated peer authorized\n")
+	}
+
+	if !authorized(p, FUNDSTX_BRDCST) {
+		t.Errorf("Transaction from client refused\n")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/oigele/bazo-miner/protocol"
 	"github.com/oigele/bazo-miner/storage"
 	"net"
-	"strings"
 	"time"
 	"sync"
 )
@@ -19,7 +18,7 @@ func Connect(connectionString string) *net.TCPConn {
 	conn, err := net.DialTCP("tcp", nil, tcpAddr)
 
 	if err != nil {
-		logger.Printf("Connection to %v failed.\n", connectionString)
+		logger.Debug("Connection failed", "peer", connectionString, "error", err)
 		return nil
 	}
 
@@ -30,26 +29,23 @@ func Connect(connectionString string) *net.TCPConn {
 }
 
 func RcvData(p *peer) (header *Header, payload []byte, err error) {
-	//logger.Printf("Before creating reader")
-	reader := bufio.NewReader(p.conn)
-	//logger.Printf("after creating reader")
+	reader := p.getReader()
 	header, err = ReadHeader(reader)
 	//logger.Printf("after reading from reader")
 	if err != nil {
 		p.conn.Close()
 		if p.peerType == PEERTYPE_MINER {
-			logger.Printf(" RcvData %v -- (1) --> %v ", p.getIPPort(), err)
+			logger.Debug("Could not read header", "peer", p.getIPPort(), "error", err)
 		}
 		return nil, nil, errors.New(fmt.Sprintf("Connection to %v aborted: %v", p.getIPPort(), err))
 	}
 
-	if int(header.Len) > 80000000 { //FABIO
-		logger.Printf("Header.Len = %v --> Abort here to prevent an Out Of Memory Error", header.Len)
+	//The payload is not read, the length is checked before the memory for it is allocated.
+	if header.Len > maxPayloadSize(header.TypeID) {
+		logger.Warn("Payload exceeds maximum size", "peer", p.getIPPort(), "type", LogMapping[header.TypeID], "length", header.Len, "max", maxPayloadSize(header.TypeID))
+		penalize(p, MISBEHAVIOR_PROTOCOL_VIOLATION)
 		p.conn.Close()
-		if p.peerType == PEERTYPE_MINER {
-			logger.Printf(" RcvData %v -- (2)", p.getIPPort())
-		}
-		return nil, nil, errors.New(fmt.Sprintf("Abort Receiving Data from %v to prevent Out Of Memory Error", p.getIPPort()))
+		return nil, nil, errors.New(fmt.Sprintf("Abort receiving data from %v: %v payload of %v bytes exceeds %v bytes", p.getIPPort(), LogMapping[header.TypeID], header.Len, maxPayloadSize(header.TypeID)))
 	}
 
 	payload = make([]byte, header.Len)
@@ -60,7 +56,7 @@ func RcvData(p *peer) (header *Header, payload []byte, err error) {
 		if err != nil {
 			p.conn.Close()
 			if p.peerType == PEERTYPE_MINER {
-				logger.Printf(" RcvData %v -- (3) --> %v ", p.getIPPort(), err)
+				logger.Debug("Could not read payload", "peer", p.getIPPort(), "error", err)
 			}
 			return nil, nil, errors.New(fmt.Sprintf("Connection to %v aborted: %v", p.getIPPort(), err))
 		}
@@ -68,6 +64,7 @@ func RcvData(p *peer) (header *Header, payload []byte, err error) {
 	//logger.Printf("After reading payload")
 
 	//logger.Printf("Receive message:\nSender: %v\nType: %v\nPayload length: %v\n", p.getIPPort(), LogMapping[header.TypeID], len(payload))
+	receivedMessagesMetric.WithLabel(messageTypeName(header.TypeID)).Inc()
 	return header, payload, nil
 }
 
@@ -78,6 +75,10 @@ func RcvData_(c net.Conn) (header *Header, payload []byte, err error) {
 		c.Close()
 		return nil, nil, errors.New(fmt.Sprintf("Connection to aborted: (%v)\n", err))
 	}
+	if header.Len > maxPayloadSize(header.TypeID) {
+		c.Close()
+		return nil, nil, errors.New(fmt.Sprintf("Connection to aborted: %v payload of %v bytes exceeds %v bytes\n", LogMapping[header.TypeID], header.Len, maxPayloadSize(header.TypeID)))
+	}
 	payload = make([]byte, header.Len)
 
 	for cnt := 0; cnt < int(header.Len); cnt++ {
@@ -96,9 +97,16 @@ func sendData(p *peer, payload []byte) {
 
 	p.l.Lock()
 	if LogMapping[payload[4]] == "" {
-		logger.Printf("Strange Header.TypeID (%v) to send to %v", payload[4], p.getIPPort())
+		logger.Warn("Message with unknown type not sent", "type", payload[4], "peer", p.getIPPort())
+	}
+	//A peer that does not read its messages must not block the writer forever. The read loop cleans up after the
+	//connection is closed.
+	p.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT * time.Second))
+	if _, err := p.conn.Write(payload); err != nil {
+		logger.Debug("Failed to send message", "peer", p.getIPPort(), "type", LogMapping[payload[4]], "error", err)
+		p.conn.Close()
 	}
-	p.conn.Write(payload)
+	countSentMessage(payload)
 	//logger.Printf("Tx with payload: %s successfully sent to %s", LogMapping[payload[4]], p.getIPPort())
 	p.l.Unlock()
 }
@@ -108,8 +116,7 @@ func peerExists(newIpport string) bool {
 	peerList := peers.getAllPeers(PEERTYPE_MINER)
 
 	for _, p := range peerList {
-		ipport := p.getIPPort()
-		if ipport == newIpport {
+		if p.hasAddress(newIpport) {
 			return true
 		}
 	}
@@ -119,14 +126,14 @@ func peerExists(newIpport string) bool {
 
 //Tested in server_test.go
 func peerSelfConn(newIpport string) bool {
-	return newIpport == Ipport
+	return newIpport == Ipport || newIpport == getAdvertiseAddress()
 }
 
 func BuildPacket(typeID uint8, payload []byte) (packet []byte) {
 	var payloadLen [4]byte
 
-	if int(len(payload)) > 80000000 {
-		logger.Printf("Payload = %v --> Probably Abort here to prevent an Out Of Memory Error", len(payload))
+	if len(payload) > MAX_PAYLOAD_SIZE {
+		logger.Warn("Payload exceeds the maximum size", "length", len(payload))
 	}
 
 	packet = make([]byte, HEADER_LEN+len(payload))
@@ -136,7 +143,7 @@ func BuildPacket(typeID uint8, payload []byte) (packet []byte) {
 	copy(packet[5:], payload)
 	//changed to check what's actually inside the message
 	if LogMapping[packet[4]] == "" {
-		logger.Printf("Build Packet with Strange TypeID: %v", typeID)
+		logger.Warn("Packet with unknown type built", "type", typeID)
 	}
 
 	return packet
@@ -162,13 +169,13 @@ func ReadHeader(reader *bufio.Reader) (*Header, error) {
 
 	//Check if the type is registered in the protocol.
 	if LogMapping[header.TypeID] == "" {
-		logger.Printf("Header: TypeID not found. --> typeID: %v", header.TypeID)
+		logger.Warn("Header with unknown type", "type", header.TypeID)
 		return nil, errors.New("Header: TypeID not found.")
 	}
 
 	//Check if the payload length does not exceed the MAX_BLOCK_SIZE defined in configtx.go
 	if header.Len > protocol.MAX_BLOCK_SIZE {
-		logger.Printf("Payload exceeds maxblocksize. typeID: %v, length: %d", header.TypeID, header.Len)
+		logger.Warn("Payload exceeds the maximum block size", "type", header.TypeID, "length", header.Len)
 		return nil, errors.New("Header: Payload exceeds MAX_BLOCK_SIZE.")
 	}
 
@@ -190,8 +197,8 @@ func extractHeader(headerData []byte) *Header {
 
 func IsBootstrap() bool {
 	//Set thisPort global, this will be the listening port for incoming connection
-	bootstrapPort := strings.Split(storage.Bootstrap_Server, ":")[1]
-	thisPort := strings.Split(Ipport, ":")[1]
+	_, bootstrapPort := splitAddress(storage.Bootstrap_Server)
+	_, thisPort := splitAddress(Ipport)
 	if thisPort == bootstrapPort {
 		//Only the port is checked if it is bootstrapping... Not the whole IP-Address
 		//All Clients need to run on another port than teh bootstrap server....
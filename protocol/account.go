@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
 )
@@ -75,16 +73,15 @@ func (acc *Account) Encode() []byte {
 		ContractVariables:  acc.ContractVariables,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*Account) Decode(encoded []byte) (acc *Account) {
 	var decoded Account
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
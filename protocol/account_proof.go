@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+//AccountProof proves that an account is part of the state an epoch block commits to with its MerklePatriciaRoot.
+//Bits and Siblings hold the branches on the path from the account's leaf up to the root: the bit the branch splits
+//at and the hash of the subtrie the path does not go through.
+type AccountProof struct {
+	EpochBlockHash   [32]byte
+	EpochBlockHeight uint32
+	Account          Account
+	Bits             []uint8
+	Siblings         [][32]byte
+}
+
+//Checks that the account of the proof is part of the state with the given root. The account is identified by the
+//hash of its address, like in the state.
+func VerifyAccountProof(root [32]byte, proof *AccountProof) bool {
+	if proof == nil || len(proof.Bits) != len(proof.Siblings) {
+		return false
+	}
+
+	key := proof.Account.Hash()
+	hash := hashTrieLeaf(key, &proof.Account)
+	for i, bit := range proof.Bits {
+		//Branches closer to the root split at lower bits
+		if i > 0 && bit >= proof.Bits[i-1] {
+			return false
+		}
+
+		if getKeyBit(key, bit) == 0 {
+			hash = hashTrieBranch(bit, hash, proof.Siblings[i])
+		} else {
+			hash = hashTrieBranch(bit, proof.Siblings[i], hash)
+		}
+	}
+
+	return hash == root
+}
+
+func (proof *AccountProof) Encode() []byte {
+	if proof == nil {
+		return nil
+	}
+
+	return encodeCanonical(*proof)
+}
+
+func (*AccountProof) Decode(encoded []byte) *AccountProof {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded AccountProof
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func (proof AccountProof) String() string {
+	return fmt.Sprintf(
+		"Epoch Block: %x\n"+
+			"Epoch Block Height: %v\n"+
+			"Account: %x\n"+
+			"Proof Length: %v\n",
+		proof.EpochBlockHash[0:8],
+		proof.EpochBlockHeight,
+		proof.Account.Address[0:8],
+		len(proof.Siblings),
+	)
+}
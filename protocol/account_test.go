@@ -7,7 +7,7 @@ import (
 )
 
 func TestAccountCreation(t *testing.T) {
-	createdAcc := NewAccount(accA.Address, accA.Issuer, accA.Balance, accA.IsStaking, accA.CommitmentKey, accA.Contract, accA.ContractVariables)
+	createdAcc := NewAccount(accA.Address, accA.Issuer, accA.Balance, accA.IsStaking, accA.IsCommittee, accA.CommitmentKey, accA.CommitteeKey, accA.Contract, accA.ContractVariables)
 
 	if !reflect.DeepEqual(createdAcc.Address, accA.Address) {
 		t.Errorf("Address does not match the given one: %x vs. %x", createdAcc.Address, accA.Address)
@@ -25,10 +25,18 @@ func TestAccountCreation(t *testing.T) {
 		t.Errorf("IsStaking does not match the given one: %v vs. %v", createdAcc.IsStaking, accA.IsStaking)
 	}
 
+	if !reflect.DeepEqual(createdAcc.IsCommittee, accA.IsCommittee) {
+		t.Errorf("IsCommittee does not match the given one: %v vs. %v", createdAcc.IsCommittee, accA.IsCommittee)
+	}
+
 	if !reflect.DeepEqual(createdAcc.CommitmentKey, accA.CommitmentKey) {
 		t.Errorf("CommitmentKey does not match the given one: %x vs. %x", createdAcc.CommitmentKey, accA.CommitmentKey)
 	}
 
+	if !reflect.DeepEqual(createdAcc.CommitteeKey, accA.CommitteeKey) {
+		t.Errorf("CommitteeKey does not match the given one: %x vs. %x", createdAcc.CommitteeKey, accA.CommitteeKey)
+	}
+
 	if !reflect.DeepEqual(createdAcc.Contract, accA.Contract) {
 		t.Errorf("Contract does not match the given one: %x vs. %x", createdAcc.Contract, accA.Contract)
 	}
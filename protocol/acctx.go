@@ -1,11 +1,9 @@
 package protocol
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"encoding/gob"
 	"fmt"
 )
 
@@ -103,16 +101,15 @@ func (tx *AccTx) Encode() []byte {
 		Sig:    tx.Sig,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*AccTx) Decode(encoded []byte) (tx *AccTx) {
 	var decoded AccTx
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
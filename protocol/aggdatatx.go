@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 )
 
@@ -67,16 +65,15 @@ func (tx *AggDataTx) Encode() (encodedTx []byte) {
 		AggregatedDataTx: 		tx.AggregatedDataTx,
 		Data:					tx.Data,
 	}
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encodeData)
-	return buffer.Bytes()
+	return encodeCanonical(encodeData)
 }
 
 func (*AggDataTx) Decode(encodedTx []byte) *AggDataTx {
 	var decoded AggDataTx
-	buffer := bytes.NewBuffer(encodedTx)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encodedTx, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 )
 
@@ -78,16 +76,15 @@ func (tx *AggTx) Encode() (encodedTx []byte) {
 		Block: 					tx.Block,
 		MerkleRoot:				tx.MerkleRoot,
 	}
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encodeData)
-	return buffer.Bytes()
+	return encodeCanonical(encodeData)
 }
 
 func (*AggTx) Decode(encodedTx []byte) *AggTx {
 	var decoded AggTx
-	buffer := bytes.NewBuffer(encodedTx)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encodedTx, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -1,11 +1,10 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
 	"github.com/willf/bloom"
+	"golang.org/x/crypto/sha3"
 	"reflect"
 )
 
@@ -31,6 +30,8 @@ type Block struct {
 	BloomFilter  		*bloom.BloomFilter	//8 byte
 	Height       		uint32
 	Beneficiary  		[32]byte
+	//Root of the receipts of the cross-shard transfers of this block, see receipt.go
+	ReceiptsRoot		[32]byte
 //	Aggregated			bool 				//Indicates if All transactions are aggregated with a boolean.
 	// ==> 177 bytes
 
@@ -47,6 +48,7 @@ type Block struct {
 	NrDataTx			  uint16
 	NrAggDataTx			  uint16
 	NrFineTx			  uint16
+	NrReceipts			  uint16
 	SlashedAddress        [32]byte
 	CommitmentProof       [crypto.COMM_PROOF_LENGTH]byte
 	ConflictingBlockHash1 [32]byte
@@ -66,6 +68,11 @@ type Block struct {
 	AggTxData  	 		 [][32]byte
 	AggDataTxData		 [][32]byte
 	FineTxData			 [][32]byte
+	//Hashes of the receipts credited by this block
+	ReceiptData			 [][32]byte
+
+	//Commit votes of the validators of the shard, see quorum.go. Not covered by the block hash
+	Certificate			 *QuorumCertificate
 }
 
 func NewBlock(prevHash [32]byte, height uint32) *Block {
@@ -94,6 +101,7 @@ func (block *Block) HashBlock() [32]byte {
 		slashedAddress        			[32]byte
 		conflictingBlockHash1 			[32]byte
 		conflictingBlockHash2 			[32]byte
+		receiptsRoot					[32]byte
 //		conflictingBlockHashWithoutTx1 	[32]byte
 //		conflictingBlockHashWithoutTx2 	[32]byte
 //		Aggregated			  			bool
@@ -107,6 +115,7 @@ func (block *Block) HashBlock() [32]byte {
 		block.SlashedAddress,
 		block.ConflictingBlockHash1,
 		block.ConflictingBlockHash2,
+		block.ReceiptsRoot,
 //		block.ConflictingBlockHashWithoutTx1,
 //		block.ConflictingBlockHashWithoutTx2,
 //		false,
@@ -114,6 +123,38 @@ func (block *Block) HashBlock() [32]byte {
 	return SerializeHashContent(blockHash)
 }
 
+//Recomputes the hash the block was finalized with: the hash of the block before the proof of stake, preceded by the
+//nonce. It only depends on fields of the header.
+func (block *Block) HashBlockHeader() [32]byte {
+	if block == nil {
+		return [32]byte{}
+	}
+
+	partial := *block
+	partial.Timestamp = 0
+	partial.CommitmentProof = [crypto.COMM_PROOF_LENGTH]byte{}
+	partialHash := partial.HashBlock()
+
+	return sha3.Sum256(append(block.Nonce[:], partialHash[:]...))
+}
+
+//Tells whether the block may contain a transaction of one of the given account hashes. Blocks without bloom filter are
+//only known not to if they have no transactions besides config transactions, which involve no account.
+func (block *Block) MayContain(accounts [][32]byte) bool {
+	if block.BloomFilter == nil {
+		return block.NrAccTx+block.NrFundsTx+block.NrStakeTx+block.NrCommitteeTx+block.NrAggTx+block.NrDataTx+
+			block.NrAggDataTx+block.NrFineTx+block.NrReceipts > 0
+	}
+
+	for _, account := range accounts {
+		if block.BloomFilter.Test(account[:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (block *Block) HashBlockWithoutMerkleRoot() [32]byte {
 	if block == nil {
 		return [32]byte{}
@@ -129,6 +170,7 @@ func (block *Block) HashBlockWithoutMerkleRoot() [32]byte {
 		slashedAddress        			[32]byte
 		conflictingBlockHash1 			[32]byte
 		conflictingBlockHash2 			[32]byte
+		receiptsRoot					[32]byte
 //		conflictingBlockHashWithoutTx1 	[32]byte
 //		conflictingBlockHashWithoutTx2 	[32]byte
 //		Aggregated			 			bool
@@ -142,6 +184,7 @@ func (block *Block) HashBlockWithoutMerkleRoot() [32]byte {
 		block.SlashedAddress,
 		block.ConflictingBlockHash1,
 		block.ConflictingBlockHash2,
+		block.ReceiptsRoot,
 //		block.ConflictingBlockHashWithoutTx1,
 //		block.ConflictingBlockHashWithoutTx2,
 //		true,
@@ -152,6 +195,12 @@ func (block *Block) HashBlockWithoutMerkleRoot() [32]byte {
 func (block *Block) InitBloomFilter(txPubKeys [][32]byte) {
 	block.NrElementsBF = uint16(len(txPubKeys))
 
+	//A filter without elements cannot be sized, blocks without transactions have none
+	if len(txPubKeys) == 0 {
+		block.BloomFilter = nil
+		return
+	}
+
 	m, k := calculateBloomFilterParams(float64(len(txPubKeys)), BLOOM_FILTER_ERROR_RATE)
 	filter := bloom.New(m, k)
 	for _, txPubKey := range txPubKeys {
@@ -181,7 +230,8 @@ func (block *Block) GetHeaderSize() uint64 {
 		reflect.TypeOf(block.NrConfigTx).Size() +
 		reflect.TypeOf(block.NrElementsBF).Size() +
 		reflect.TypeOf(block.Height).Size() +
-		reflect.TypeOf(block.Beneficiary).Size())
+		reflect.TypeOf(block.Beneficiary).Size() +
+		reflect.TypeOf(block.ReceiptsRoot).Size())
 //		reflect.TypeOf(block.Aggregated).Size())
 
 	size += int(block.GetBloomFilterSize())
@@ -201,6 +251,7 @@ func (block *Block) GetBodySize() uint64 {
 		reflect.TypeOf(block.NrCommitteeTx).Size() +
 		reflect.TypeOf(block.NrAggDataTx).Size() +
 		reflect.TypeOf(block.NrFineTx).Size() +
+		reflect.TypeOf(block.NrReceipts).Size() +
 		reflect.TypeOf(block.SlashedAddress).Size() +
 		reflect.TypeOf(block.CommitmentProof).Size() +
 		reflect.TypeOf(block.ConflictingBlockHash1).Size() +
@@ -223,7 +274,8 @@ func (block *Block) GetTxDataSize() uint64 {
 		int(block.NrDataTx)*HASH_LEN +
 		int(block.NrAggDataTx)*HASH_LEN+
 		int(block.NrCommitteeTx)*HASH_LEN+
-		int(block.NrFineTx)*HASH_LEN
+		int(block.NrFineTx)*HASH_LEN+
+		int(block.NrReceipts)*HASH_LEN
 
 	return uint64(size)
 }
@@ -264,10 +316,12 @@ func (block *Block) Encode() []byte {
 		NrDataTx:						block.NrDataTx,
 		NrAggDataTx: 					block.NrAggDataTx,
 		NrFineTx:						block.NrFineTx,
+		NrReceipts:						block.NrReceipts,
 		NrElementsBF:          			block.NrElementsBF,
 		BloomFilter:           			block.BloomFilter,
 		SlashedAddress:        			block.SlashedAddress,
 		Height:                			block.Height,
+		ReceiptsRoot:					block.ReceiptsRoot,
 		CommitmentProof:	   			block.CommitmentProof,
 		ConflictingBlockHash1: 			block.ConflictingBlockHash1,
 		ConflictingBlockHash2: 			block.ConflictingBlockHash2,
@@ -283,11 +337,11 @@ func (block *Block) Encode() []byte {
 		DataTxData:						block.DataTxData,
 		AggDataTxData:					block.AggDataTxData,
 		FineTxData:						block.FineTxData,
+		ReceiptData:					block.ReceiptData,
+		Certificate:					block.Certificate,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (block *Block) EncodeHeader() []byte {
@@ -307,12 +361,29 @@ func (block *Block) EncodeHeader() []byte {
 		BloomFilter:  		block.BloomFilter,
 		Height:       		block.Height,
 		Beneficiary:  		block.Beneficiary,
+		ReceiptsRoot:		block.ReceiptsRoot,
 //		Aggregated:			block.Aggregated,
+		//Needed to check the hash and the proof of stake without the transactions
+		Nonce:					block.Nonce,
+		Timestamp:				block.Timestamp,
+		MerkleRoot:				block.MerkleRoot,
+		SlashedAddress:			block.SlashedAddress,
+		CommitmentProof:		block.CommitmentProof,
+		ConflictingBlockHash1:	block.ConflictingBlockHash1,
+		ConflictingBlockHash2:	block.ConflictingBlockHash2,
+		//Tell whether a block without bloom filter has transactions
+		NrAccTx:				block.NrAccTx,
+		NrFundsTx:				block.NrFundsTx,
+		NrStakeTx:				block.NrStakeTx,
+		NrCommitteeTx:			block.NrCommitteeTx,
+		NrAggTx:				block.NrAggTx,
+		NrDataTx:				block.NrDataTx,
+		NrAggDataTx:			block.NrAggDataTx,
+		NrFineTx:				block.NrFineTx,
+		NrReceipts:				block.NrReceipts,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (block *Block) Decode(encoded []byte) (b *Block) {
@@ -321,9 +392,10 @@ func (block *Block) Decode(encoded []byte) (b *Block) {
 	}
 
 	var decoded Block
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -347,6 +419,8 @@ func (block Block) String() string {
 		"Amount of aggDataTx: %v --> %x\n" +
 		"Amount of aggTx: %v --> %x\n"+
 		"Amount of fineTx: %v ---> %x\n" +
+		"Credited receipts: %v --> %x\n" +
+		"ReceiptsRoot: %x\n" +
 		"Total Transactions in this block: %v\n"+
 		"Height: %d\n"+
 		"Commitment Proof: %x\n"+
@@ -371,6 +445,8 @@ func (block Block) String() string {
 		block.NrAggDataTx, block.AggDataTxData,
 		block.NrAggTx, block.AggTxData,
 		block.NrFineTx, block.FineTxData,
+		block.NrReceipts, block.ReceiptData,
+		block.ReceiptsRoot[0:8],
 		uint16(block.NrFundsTx) + uint16(block.NrAccTx) + uint16(block.NrConfigTx) + uint16(block.NrStakeTx) + uint16(block.NrAggTx),
 		block.Height,
 		block.CommitmentProof[0:8],
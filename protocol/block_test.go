@@ -140,3 +140,51 @@ func TestGetSize(t *testing.T) {
 		fmt.Printf("Miscalculated block size: %v vs. %v\n", b.GetSize(), uint64(txAmount)*32+MIN_BLOCK_SIZE)
 	}
 }
+
+func TestBlockHeaderHash(t *testing.T) {
+	block := NewBlock([32]byte{1}, 10)
+	rand.Read(block.Nonce[:])
+	rand.Read(block.MerkleRoot[:])
+	rand.Read(block.Beneficiary[:])
+	rand.Read(block.CommitmentProof[:])
+	block.Timestamp = time.Now().UnixNano()
+	block.NrFundsTx = 1
+	block.Hash = block.HashBlockHeader()
+
+	//Everything the hash covers is part of the header
+	var header *Block
+	header = header.Decode(block.EncodeHeader())
+	if header.HashBlockHeader() != block.Hash {
+		t.Errorf("Header does not hash to the block hash: %x vs. %x\n", header.HashBlockHeader(), block.Hash)
+	}
+
+	header.Beneficiary = [32]byte{2}
+	if header.HashBlockHeader() == block.Hash {
+		t.Errorf("Changed header hashes to the block hash\n")
+	}
+}
+
+func TestMayContain(t *testing.T) {
+	var v1, v2 [32]byte
+	rand.Read(v1[:])
+	rand.Read(v2[:])
+
+	block := NewBlock([32]byte{}, 1)
+	if block.MayContain([][32]byte{v1}) {
+		t.Errorf("Empty block may contain transactions\n")
+	}
+
+	//Without a filter, any block with transactions may contain the account's
+	block.NrFundsTx = 1
+	if !block.MayContain([][32]byte{v1}) {
+		t.Errorf("Block without bloom filter does not contain transactions\n")
+	}
+
+	block.InitBloomFilter([][32]byte{v1})
+	if !block.MayContain([][32]byte{v2, v1}) {
+		t.Errorf("Bloom filter does not contain account\n")
+	}
+	if block.MayContain(nil) {
+		t.Errorf("Block contains transactions of no account\n")
+	}
+}
@@ -1,3 +1,34 @@
 package protocol
 
+import "bytes"
+
 type ByteArray []byte
+
+//Returns a deep copy of the contract variables, such that changes to the copy do not affect the original account.
+func CopyContractVariables(variables []ByteArray) []ByteArray {
+	if variables == nil {
+		return nil
+	}
+
+	cp := make([]ByteArray, len(variables))
+	for i, variable := range variables {
+		cp[i] = make(ByteArray, len(variable))
+		copy(cp[i], variable)
+	}
+
+	return cp
+}
+
+func ContractVariablesEqual(a, b []ByteArray) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"github.com/oigele/bazo-miner/crypto"
 	"os"
 )
@@ -64,16 +62,15 @@ func (cc *CommitteeCheck) EncodeCommitteeCheck() []byte {
 
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*CommitteeCheck) DecodeCommitteeCheck(encoded []byte) (ta *CommitteeCheck) {
 	var decoded CommitteeCheck
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -1,11 +1,9 @@
 package protocol
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
-	"encoding/gob"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
 )
@@ -98,16 +96,15 @@ func (tx *CommitteeTx) Encode() (encodedTx []byte) {
 		CommitteeKey: tx.CommitteeKey,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*CommitteeTx) Decode(encoded []byte) (tx *CommitteeTx) {
 	var decoded CommitteeTx
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
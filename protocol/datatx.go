@@ -1,10 +1,8 @@
 package protocol
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"encoding/gob"
 	"fmt"
 	"time"
 )
@@ -105,16 +103,15 @@ func (tx *DataTx) Encode() (encodedTx []byte) {
 		Sig2:   	tx.Sig2,
 		Data:   	tx.Data,
 	}
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encodeData)
-	return buffer.Bytes()
+	return encodeCanonical(encodeData)
 }
 
 func (*DataTx) Decode(encodedTx []byte) *DataTx {
 	var decoded DataTx
-	buffer := bytes.NewBuffer(encodedTx)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encodedTx, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -0,0 +1,389 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+//Protocol types are serialized with a canonical binary encoding, such that the encoded bytes and therefore the hashes
+//neither depend on the Go release nor on the iteration order of maps, and clients in other languages can compute them.
+//A value is encoded as follows:
+//  - bool as 0 or 1, byte, int8 and uint8 as one byte
+//  - the other integers big-endian in their size, int and uint as 8 bytes, floats as their IEEE 754 bits
+//  - arrays element by element
+//  - strings and slices as their length (uint32), followed by the elements
+//  - maps as their number of entries (uint32), followed by key and value of every entry in ascending order of the
+//    encoded keys
+//  - pointers as 0 if nil, otherwise as 1 followed by the value
+//  - structs field by field in the order the fields are declared
+//  - types with their own binary form (the bloom filter) as byte slice of that form
+//Encode methods prefix the encoding with ENCODING_VERSION. Hashes are taken over the encoding without the version,
+//see SerializeHashContent. Decoding rejects everything that is not the canonical encoding of a value, such as maps
+//with unordered keys or trailing bytes. Empty slices and maps are decoded as nil.
+const (
+	ENCODING_VERSION = 1
+)
+
+//Implemented by the bloom filter.
+type binaryEncoder interface {
+	GobEncode() ([]byte, error)
+}
+
+type binaryDecoder interface {
+	GobDecode([]byte) error
+}
+
+var (
+	binaryEncoderType = reflect.TypeOf((*binaryEncoder)(nil)).Elem()
+	binaryDecoderType = reflect.TypeOf((*binaryDecoder)(nil)).Elem()
+)
+
+//Returns the versioned encoding of the value.
+func encodeCanonical(data interface{}) []byte {
+	buffer := bytes.NewBuffer([]byte{ENCODING_VERSION})
+	encodeValue(buffer, addressable(data))
+	return buffer.Bytes()
+}
+
+//Returns the encoding of the value without version.
+func canonicalContent(data interface{}) []byte {
+	buffer := new(bytes.Buffer)
+	encodeValue(buffer, addressable(data))
+	return buffer.Bytes()
+}
+
+//Byte arrays of addressable values are written at once instead of byte by byte.
+func addressable(data interface{}) reflect.Value {
+	value := reflect.ValueOf(data)
+	if !value.IsValid() {
+		panic("cannot encode nil")
+	}
+
+	copied := reflect.New(value.Type()).Elem()
+	copied.Set(value)
+	return copied
+}
+
+//Decodes the versioned encoding into the value data points to.
+func decodeCanonical(encoded []byte, data interface{}) error {
+	if len(encoded) == 0 {
+		return errors.New("empty encoding")
+	}
+	if encoded[0] != ENCODING_VERSION {
+		return errors.New(fmt.Sprintf("encoding version %v is not supported", encoded[0]))
+	}
+
+	value := reflect.ValueOf(data)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return errors.New(fmt.Sprintf("cannot decode into %v", value.Type()))
+	}
+
+	reader := bytes.NewReader(encoded[1:])
+	if err := decodeValue(reader, value.Elem()); err != nil {
+		return err
+	}
+	if reader.Len() > 0 {
+		return errors.New(fmt.Sprintf("%v trailing bytes", reader.Len()))
+	}
+
+	return nil
+}
+
+//Types are fixed at compile time, a type that cannot be encoded is a programming error.
+func encodeValue(buffer *bytes.Buffer, value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			buffer.WriteByte(1)
+		} else {
+			buffer.WriteByte(0)
+		}
+	case reflect.Int8:
+		buffer.WriteByte(byte(value.Int()))
+	case reflect.Uint8:
+		buffer.WriteByte(byte(value.Uint()))
+	case reflect.Int16:
+		writeUint(buffer, uint64(value.Int()), 2)
+	case reflect.Uint16:
+		writeUint(buffer, value.Uint(), 2)
+	case reflect.Int32:
+		writeUint(buffer, uint64(value.Int()), 4)
+	case reflect.Uint32:
+		writeUint(buffer, value.Uint(), 4)
+	case reflect.Int, reflect.Int64:
+		writeUint(buffer, uint64(value.Int()), 8)
+	case reflect.Uint, reflect.Uint64:
+		writeUint(buffer, value.Uint(), 8)
+	case reflect.Float32:
+		writeUint(buffer, uint64(math.Float32bits(float32(value.Float()))), 4)
+	case reflect.Float64:
+		writeUint(buffer, math.Float64bits(value.Float()), 8)
+	case reflect.String:
+		writeUint(buffer, uint64(value.Len()), 4)
+		buffer.WriteString(value.String())
+	case reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 && value.CanAddr() {
+			buffer.Write(value.Slice(0, value.Len()).Bytes())
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			encodeValue(buffer, value.Index(i))
+		}
+	case reflect.Slice:
+		writeUint(buffer, uint64(value.Len()), 4)
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			buffer.Write(value.Bytes())
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			encodeValue(buffer, value.Index(i))
+		}
+	case reflect.Map:
+		writeUint(buffer, uint64(value.Len()), 4)
+		type entry struct {
+			key   []byte
+			value reflect.Value
+		}
+		entries := make([]entry, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			encodedKey := new(bytes.Buffer)
+			encodeValue(encodedKey, key)
+			entries = append(entries, entry{encodedKey.Bytes(), value.MapIndex(key)})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+		for _, e := range entries {
+			buffer.Write(e.key)
+			encodeValue(buffer, e.value)
+		}
+	case reflect.Ptr:
+		if value.IsNil() {
+			buffer.WriteByte(0)
+			return
+		}
+		buffer.WriteByte(1)
+		if value.Type().Implements(binaryEncoderType) && value.CanInterface() {
+			encoded, err := value.Interface().(binaryEncoder).GobEncode()
+			if err != nil {
+				panic(fmt.Sprintf("encoding %v failed: %v", value.Type(), err))
+			}
+			writeUint(buffer, uint64(len(encoded)), 4)
+			buffer.Write(encoded)
+			return
+		}
+		encodeValue(buffer, value.Elem())
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			encodeValue(buffer, value.Field(i))
+		}
+	default:
+		panic(fmt.Sprintf("cannot encode %v", value.Type()))
+	}
+}
+
+func decodeValue(reader *bytes.Reader, value reflect.Value) error {
+	if !value.CanSet() {
+		return errors.New(fmt.Sprintf("cannot decode into unexported %v", value.Type()))
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		b, err := readUint(reader, 1)
+		if err != nil {
+			return err
+		}
+		if b > 1 {
+			return errors.New(fmt.Sprintf("invalid bool %v", b))
+		}
+		value.SetBool(b == 1)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64:
+		size := intSize(value.Kind())
+		u, err := readUint(reader, size)
+		if err != nil {
+			return err
+		}
+		//Sign extension of the smaller sizes
+		shift := uint(64 - 8*size)
+		value.SetInt(int64(u<<shift) >> shift)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		u, err := readUint(reader, intSize(value.Kind()))
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32:
+		u, err := readUint(reader, 4)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(float64(math.Float32frombits(uint32(u))))
+	case reflect.Float64:
+		u, err := readUint(reader, 8)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(math.Float64frombits(u))
+	case reflect.String:
+		encoded, err := readBytes(reader)
+		if err != nil {
+			return err
+		}
+		value.SetString(string(encoded))
+	case reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			encoded := make([]byte, value.Len())
+			if n, _ := reader.Read(encoded); n != len(encoded) && len(encoded) > 0 {
+				return errors.New("encoding truncated")
+			}
+			reflect.Copy(value, reflect.ValueOf(encoded))
+			return nil
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := decodeValue(reader, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			encoded, err := readBytes(reader)
+			if err != nil || len(encoded) == 0 {
+				return err
+			}
+			value.SetBytes(encoded)
+			return nil
+		}
+		n, err := readLength(reader)
+		if err != nil || n == 0 {
+			return err
+		}
+		slice := reflect.MakeSlice(value.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := decodeValue(reader, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	case reflect.Map:
+		n, err := readLength(reader)
+		if err != nil || n == 0 {
+			return err
+		}
+		m := reflect.MakeMapWithSize(value.Type(), n)
+		var prevKey []byte
+		for i := 0; i < n; i++ {
+			start := reader.Len()
+			key := reflect.New(value.Type().Key()).Elem()
+			if err := decodeValue(reader, key); err != nil {
+				return err
+			}
+			//The encoded key is the part of the input just read
+			encodedKey := make([]byte, start-reader.Len())
+			reader.Seek(int64(-len(encodedKey)), 1)
+			reader.Read(encodedKey)
+			if i > 0 && bytes.Compare(prevKey, encodedKey) >= 0 {
+				return errors.New("map keys not in ascending order")
+			}
+			prevKey = encodedKey
+
+			entry := reflect.New(value.Type().Elem()).Elem()
+			if err := decodeValue(reader, entry); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, entry)
+		}
+		value.Set(m)
+	case reflect.Ptr:
+		flag, err := readUint(reader, 1)
+		if err != nil {
+			return err
+		}
+		if flag > 1 {
+			return errors.New(fmt.Sprintf("invalid pointer flag %v", flag))
+		}
+		if flag == 0 {
+			value.Set(reflect.Zero(value.Type()))
+			return nil
+		}
+		pointer := reflect.New(value.Type().Elem())
+		if pointer.Type().Implements(binaryDecoderType) {
+			encoded, err := readBytes(reader)
+			if err != nil {
+				return err
+			}
+			if err := pointer.Interface().(binaryDecoder).GobDecode(encoded); err != nil {
+				return err
+			}
+		} else if err := decodeValue(reader, pointer.Elem()); err != nil {
+			return err
+		}
+		value.Set(pointer)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if err := decodeValue(reader, value.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("cannot decode %v", value.Type()))
+	}
+
+	return nil
+}
+
+func intSize(kind reflect.Kind) int {
+	switch kind {
+	case reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func writeUint(buffer *bytes.Buffer, u uint64, size int) {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], u)
+	buffer.Write(encoded[8-size:])
+}
+
+func readUint(reader *bytes.Reader, size int) (uint64, error) {
+	var encoded [8]byte
+	if n, _ := reader.Read(encoded[8-size:]); n != size {
+		return 0, errors.New("encoding truncated")
+	}
+
+	return binary.BigEndian.Uint64(encoded[:]), nil
+}
+
+//Every element takes at least one byte, longer lengths cannot be valid.
+func readLength(reader *bytes.Reader) (int, error) {
+	n, err := readUint(reader, 4)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(reader.Len()) {
+		return 0, errors.New(fmt.Sprintf("length %v exceeds the encoding", n))
+	}
+
+	return int(n), nil
+}
+
+func readBytes(reader *bytes.Reader) ([]byte, error) {
+	n, err := readLength(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]byte, n)
+	reader.Read(encoded)
+	return encoded, nil
+}
@@ -0,0 +1,292 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+//Golden vectors for other implementations, see testdata/vectors.json. Every vector names a value built by
+//goldenValues and holds its encoding and its hash as hex.
+type goldenVector struct {
+	Name     string
+	Encoding string
+	Hash     string
+}
+
+func TestCanonicalEncoding(t *testing.T) {
+	type inner struct {
+		A uint16
+	}
+	value := struct {
+		Bool   bool
+		Byte   byte
+		Int    int
+		Int32  int32
+		Array  [2]byte
+		Bytes  []byte
+		String string
+		Slice  []uint16
+		Map    map[uint8]bool
+		Nil    *inner
+		Ptr    *inner
+	}{
+		true, 0xab, -2, 3, [2]byte{4, 5}, []byte{6}, "ab", []uint16{7}, map[uint8]bool{9: false, 8: true}, nil, &inner{10},
+	}
+
+	expected := "01" + "ab" + "fffffffffffffffe" + "00000003" + "0405" + "0000000106" + "000000026162" + "000000010007" +
+		"00000002" + "0801" + "0900" + "00" + "01000a"
+	if encoded := hex.EncodeToString(canonicalContent(value)); encoded != expected {
+		t.Errorf("Wrong encoding:\n%v\n%v\n", encoded, expected)
+	}
+	if encoded := hex.EncodeToString(encodeCanonical(value)); encoded != "01"+expected {
+		t.Errorf("Encoding not versioned: %v\n", encoded)
+	}
+
+	decoded := value
+	decoded.Map, decoded.Ptr = nil, nil
+	if err := decodeCanonical(encodeCanonical(value), &decoded); err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Decoding failed (%v): %v\n", err, decoded)
+	}
+}
+
+func TestCanonicalDecodingStrict(t *testing.T) {
+	var m map[uint8]bool
+	encoded := encodeCanonical(map[uint8]bool{1: true, 2: false})
+	if err := decodeCanonical(encoded, &m); err != nil || len(m) != 2 {
+		t.Errorf("Map not decoded: %v\n", err)
+	}
+
+	//Keys out of order, duplicate keys, trailing bytes, invalid bools and unknown versions are not canonical
+	invalid := [][]byte{
+		{ENCODING_VERSION, 0, 0, 0, 2, 2, 0, 1, 1},
+		{ENCODING_VERSION, 0, 0, 0, 2, 1, 0, 1, 1},
+		append(encoded, 0),
+		{ENCODING_VERSION, 0, 0, 0, 1, 1, 2},
+		{ENCODING_VERSION + 1, 0, 0, 0, 0},
+		{ENCODING_VERSION, 0xff, 0xff, 0xff, 0xff},
+	}
+	for _, encoded := range invalid {
+		if err := decodeCanonical(encoded, &m); err == nil {
+			t.Errorf("Invalid encoding %x decoded\n", encoded)
+		}
+	}
+}
+
+//Bytes that are not a canonical encoding must not decode to a zero value
+func TestDecodeNonCanonical(t *testing.T) {
+	decoders := map[string]func([]byte) bool{
+		"account":        func(b []byte) bool { return new(Account).Decode(b) == nil },
+		"relativeacc":    func(b []byte) bool { return new(RelativeAccount).Decode(b) == nil },
+		"transition":     func(b []byte) bool { return new(StateTransition).DecodeTransition(b) == nil },
+		"acctx":          func(b []byte) bool { return new(AccTx).Decode(b) == nil },
+		"aggtx":          func(b []byte) bool { return new(AggTx).Decode(b) == nil },
+		"aggdatatx":      func(b []byte) bool { return new(AggDataTx).Decode(b) == nil },
+		"block":          func(b []byte) bool { return new(Block).Decode(b) == nil },
+		"epochblock":     func(b []byte) bool { return new(EpochBlock).Decode(b) == nil },
+		"committeecheck": func(b []byte) bool { return new(CommitteeCheck).DecodeCommitteeCheck(b) == nil },
+		"committeetx":    func(b []byte) bool { return new(CommitteeTx).Decode(b) == nil },
+		"contracttx":     func(b []byte) bool { return new(ContractTx).Decode(b) == nil },
+		"datasummary":    func(b []byte) bool { return new(DataSummary).Decode(b) == nil },
+		"datatx":         func(b []byte) bool { return new(DataTx).Decode(b) == nil },
+		"finetx":         func(b []byte) bool { return new(FineTx).Decode(b) == nil },
+		"fundstx":        func(b []byte) bool { return new(FundsTx).Decode(b) == nil },
+		"genesis":        func(b []byte) bool { return new(Genesis).Decode(b) == nil },
+		"assignment":     func(b []byte) bool { return new(TransactionAssignment).DecodeTransactionAssignment(b) == nil },
+		"valmapping":     func(b []byte) bool { return new(ValShardMapping).Decode(b) == nil },
+	}
+
+	invalid := [][]byte{
+		{0xde, 0xad, 0xbe, 0xef},
+		{ENCODING_VERSION, 0xde, 0xad, 0xbe, 0xef},
+		{},
+	}
+	for name, isNil := range decoders {
+		for _, encoded := range invalid {
+			if !isNil(encoded) {
+				t.Errorf("Invalid encoding %x decoded as %v\n", encoded, name)
+			}
+		}
+	}
+}
+
+func TestGoldenVectors(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []goldenVector
+	if err := json.Unmarshal(file, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	values := goldenValues()
+	if len(vectors) != len(values) {
+		t.Errorf("%v vectors for %v values\n", len(vectors), len(values))
+	}
+
+	for _, vector := range vectors {
+		value, exists := values[vector.Name]
+		if !exists {
+			t.Errorf("No value for vector %v\n", vector.Name)
+			continue
+		}
+		encoding, hash := value()
+		if hex.EncodeToString(encoding) != vector.Encoding {
+			t.Errorf("Encoding of %v changed: %x\n", vector.Name, encoding)
+		}
+		if hex.EncodeToString(hash[:]) != vector.Hash {
+			t.Errorf("Hash of %v changed: %x\n", vector.Name, hash)
+		}
+	}
+}
+
+//Maps are encoded in key order, the order of insertion does not matter
+func TestEncodingMapOrder(t *testing.T) {
+	a, b := goldenEpochBlock(), goldenEpochBlock()
+	b.StateDelta = make(map[[32]byte]*Account)
+	for i := len(goldenAccounts()) - 1; i >= 0; i-- {
+		acc := goldenAccounts()[i]
+		b.StateDelta[acc.Hash()] = acc
+	}
+
+	if !reflect.DeepEqual(a.Encode(), b.Encode()) || a.HashEpochBlock() != b.HashEpochBlock() {
+		t.Errorf("Encoding depends on the order of the map\n")
+	}
+
+	var decoded *EpochBlock
+	if decoded = decoded.Decode(a.Encode()); !reflect.DeepEqual(decoded, a) {
+		t.Errorf("Epoch block not decoded: %v\n", decoded)
+	}
+}
+
+func goldenValues() map[string]func() ([]byte, [32]byte) {
+	return map[string]func() ([]byte, [32]byte){
+		"address": func() ([]byte, [32]byte) {
+			address := goldenAccounts()[0].Address
+			return canonicalContent(address), SerializeHashContent(address)
+		},
+		"account": func() ([]byte, [32]byte) {
+			acc := goldenAccounts()[1]
+			return acc.Encode(), acc.StateHash()
+		},
+		"fundstx": func() ([]byte, [32]byte) {
+			tx := &FundsTx{Header: 1, Amount: 1000, Fee: 1, TxCnt: 7, TimeStamp: 1500000000, From: [32]byte{1}, To: [32]byte{2}, Sig1: [64]byte{3}, Data: []byte("bazo")}
+			return tx.Encode(), tx.Hash()
+		},
+		"acctx": func() ([]byte, [32]byte) {
+			tx := &AccTx{Header: 1, Issuer: [32]byte{1}, Fee: 1, PubKey: [64]byte{2}, Sig: [64]byte{3}, Contract: []byte{4}, ContractVariables: []ByteArray{{5}, {6, 7}}}
+			return tx.Encode(), tx.Hash()
+		},
+		"block": func() ([]byte, [32]byte) {
+			block := goldenBlock()
+			return block.Encode(), block.HashBlock()
+		},
+		"blockheader": func() ([]byte, [32]byte) {
+			block := goldenBlock()
+			return block.EncodeHeader(), block.HashBlockHeader()
+		},
+		"epochblock": func() ([]byte, [32]byte) {
+			epochBlock := goldenEpochBlock()
+			return epochBlock.Encode(), epochBlock.HashEpochBlock()
+		},
+		"statetransition": func() ([]byte, [32]byte) {
+			change := make(map[[32]byte]*RelativeAccount)
+			for i, acc := range goldenAccounts() {
+				relative := NewRelativeAccount(acc.Address, acc.Issuer, int64(-i), false, false, acc.CommitmentKey, acc.CommitteeKey, nil, nil)
+				change[acc.Hash()] = &relative
+			}
+			st := NewStateTransition(change, []*Receipt{goldenReceipt()}, NewShardLoad(7, 650), 12, 2, [256]byte{9})
+			return st.EncodeTransition(), st.HashTransition()
+		},
+		"vote": func() ([]byte, [32]byte) {
+			vote := goldenVote(goldenBlock())
+			return vote.Encode(), vote.Hash()
+		},
+		"endorsement": func() ([]byte, [32]byte) {
+			endorsement := goldenEndorsement(goldenEpochBlock())
+			return endorsement.Encode(), endorsement.Hash()
+		},
+		"receipt": func() ([]byte, [32]byte) {
+			receipt := goldenReceipt()
+			return receipt.Encode(), receipt.Hash()
+		},
+	}
+}
+
+func goldenAccounts() []*Account {
+	var accounts []*Account
+	for i := 0; i < 3; i++ {
+		var address [64]byte
+		for j := range address {
+			address[j] = byte(i + j)
+		}
+		acc := NewAccount(address, [32]byte{byte(i)}, uint64(100*i), i == 1, i == 2, [256]byte{byte(i)}, [256]byte{}, nil, nil)
+		if i == 1 {
+			acc.Contract = []byte{1, 2, 3}
+			acc.ContractVariables = []ByteArray{{4}, {5, 6}}
+		}
+		accounts = append(accounts, &acc)
+	}
+
+	return accounts
+}
+
+func goldenBlock() *Block {
+	block := NewBlock([32]byte{1}, 5)
+	block.ShardId = 2
+	block.Nonce = [8]byte{3}
+	block.Timestamp = 1500000000
+	block.MerkleRoot = [32]byte{4}
+	block.Beneficiary = [32]byte{5}
+	block.CommitmentProof = [256]byte{6}
+	block.NrFundsTx = 2
+	block.FundsTxData = [][32]byte{{7}, {8}}
+	block.ReceiptsRoot = [32]byte{9}
+	block.NrReceipts = 1
+	block.ReceiptData = [][32]byte{{10}}
+	block.Hash = block.HashBlockHeader()
+	block.Certificate = NewQuorumCertificate([]*Vote{goldenVote(block)})
+	return block
+}
+
+func goldenEpochBlock() *EpochBlock {
+	epochBlock := NewEpochBlock([][32]byte{{1}, {2}}, 4)
+	epochBlock.Timestamp = 1500000000
+	epochBlock.MerkleRoot = [32]byte{3}
+	epochBlock.CommitmentProof = [256]byte{4}
+	epochBlock.StateDelta = make(map[[32]byte]*Account)
+	for _, acc := range goldenAccounts() {
+		epochBlock.StateDelta[acc.Hash()] = acc
+	}
+	epochBlock.MerklePatriciaRoot = StateRoot(epochBlock.StateDelta)
+	epochBlock.ValMapping = NewMapping()
+	epochBlock.ValMapping.ValMapping[goldenAccounts()[1].Address] = 1
+	epochBlock.ValMapping.ValMapping[goldenAccounts()[0].Address] = 2
+	epochBlock.NofShards = 2
+	epochBlock.ShardLoads = []ShardLoad{NewShardLoad(0, 1000), NewShardLoad(12, 400)}
+	epochBlock.MigrationsRoot = BuildMigrationsMerkleTree([]*AccountMigration{{Account: [32]byte{5}, FromShard: 1, ToShard: 2}}).MerkleRoot()
+	epochBlock.Receipts = []*Receipt{goldenReceipt()}
+	epochBlock.ReceiptsRoot = BuildReceiptsMerkleTree(epochBlock.Receipts).MerkleRoot()
+	epochBlock.Hash = epochBlock.HashEpochBlockHeader()
+	epochBlock.Certificate = NewCommitteeCertificate([]*Endorsement{goldenEndorsement(epochBlock)})
+	return epochBlock
+}
+
+func goldenVote(block *Block) *Vote {
+	vote := NewVote(VOTE_COMMIT, block.Height, block.ShardId, 1, block.Hash, [32]byte{11}, [32]byte{12})
+	vote.Signature = [256]byte{13}
+	return vote
+}
+
+func goldenEndorsement(epochBlock *EpochBlock) *Endorsement {
+	endorsement := NewEndorsement(ENDORSE_EPOCH_BLOCK, epochBlock.Height, 0, epochBlock.Hash, [32]byte{14})
+	endorsement.Signature = [256]byte{15}
+	return endorsement
+}
+
+func goldenReceipt() *Receipt {
+	return &Receipt{TxHash: [32]byte{1}, From: [32]byte{2}, To: [32]byte{3}, Amount: 1000, FromShard: 2, Height: 5}
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+)
+
+//The committee members endorse the epoch blocks and the transaction assignments they checked by signing their hash
+//with their committee key. The endorsements of a quorum of the committee form the certificate of the epoch block or
+//assignment. The committee keys are RSA keys, which can not be aggregated into one signature, so the certificate
+//holds the endorsements of the quorum.
+const (
+	ENDORSE_EPOCH_BLOCK = 1
+	ENDORSE_ASSIGNMENT  = 2
+)
+
+type Endorsement struct {
+	Kind         uint8
+	Height       uint32
+	//Shard of an endorsed transaction assignment, 0 for epoch blocks
+	ShardID      int
+	EndorsedHash [32]byte
+	Member       [32]byte
+	Signature    [crypto.COMM_PROOF_LENGTH]byte
+}
+
+//Not covered by the hash of the epoch block or assignment, the committee endorses them once they are complete.
+type CommitteeCertificate struct {
+	Kind         uint8
+	Height       uint32
+	ShardID      int
+	EndorsedHash [32]byte
+	Endorsements []*Endorsement
+}
+
+func NewEndorsement(kind uint8, height uint32, shardId int, hash [32]byte, member [32]byte) *Endorsement {
+	return &Endorsement{
+		Kind:         kind,
+		Height:       height,
+		ShardID:      shardId,
+		EndorsedHash: hash,
+		Member:       member,
+	}
+}
+
+//The endorsements have to endorse the same epoch block or assignment as the first one.
+func NewCommitteeCertificate(endorsements []*Endorsement) *CommitteeCertificate {
+	if len(endorsements) == 0 {
+		return nil
+	}
+
+	return &CommitteeCertificate{
+		Kind:         endorsements[0].Kind,
+		Height:       endorsements[0].Height,
+		ShardID:      endorsements[0].ShardID,
+		EndorsedHash: endorsements[0].EndorsedHash,
+		Endorsements: endorsements,
+	}
+}
+
+//Message signed with the committee key of the member.
+func (endorsement *Endorsement) Message() string {
+	return fmt.Sprintf("endorsement:%d:%d:%d:%x", endorsement.Kind, endorsement.Height, endorsement.ShardID, endorsement.EndorsedHash)
+}
+
+func (endorsement *Endorsement) Hash() [32]byte {
+	if endorsement == nil {
+		return [32]byte{}
+	}
+
+	endorsementHash := struct {
+		Message string
+		Member  [32]byte
+	}{
+		endorsement.Message(),
+		endorsement.Member,
+	}
+	return SerializeHashContent(endorsementHash)
+}
+
+func (endorsement *Endorsement) Encode() []byte {
+	if endorsement == nil {
+		return nil
+	}
+
+	encoded := Endorsement{
+		Kind:         endorsement.Kind,
+		Height:       endorsement.Height,
+		ShardID:      endorsement.ShardID,
+		EndorsedHash: endorsement.EndorsedHash,
+		Member:       endorsement.Member,
+		Signature:    endorsement.Signature,
+	}
+
+	return encodeCanonical(encoded)
+}
+
+func (*Endorsement) Decode(encoded []byte) *Endorsement {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded Endorsement
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func (endorsement Endorsement) String() string {
+	return fmt.Sprintf("Kind: %v, Height: %v, Shard: %v, Hash: %x, Member: %x", endorsement.Kind, endorsement.Height, endorsement.ShardID, endorsement.EndorsedHash[0:8], endorsement.Member[0:8])
+}
+
+func (certificate CommitteeCertificate) String() string {
+	return fmt.Sprintf("Kind: %v, Height: %v, Shard: %v, Hash: %x, Endorsements: %v", certificate.Kind, certificate.Height, certificate.ShardID, certificate.EndorsedHash[0:8], len(certificate.Endorsements))
+}
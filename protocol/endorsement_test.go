@@ -0,0 +1,50 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestEndorsementHash(t *testing.T) {
+	endorsement := goldenEndorsement(goldenEpochBlock())
+	signed := *endorsement
+	signed.Signature = [256]byte{1}
+	if endorsement.Hash() != signed.Hash() {
+		t.Errorf("Hash of endorsement depends on its signature\n")
+	}
+
+	other := *endorsement
+	other.Kind = ENDORSE_ASSIGNMENT
+	if endorsement.Hash() == other.Hash() || endorsement.Message() == other.Message() {
+		t.Errorf("Endorsements of an epoch block and an assignment can't be told apart\n")
+	}
+
+	var decoded *Endorsement
+	if decoded = decoded.Decode(endorsement.Encode()); decoded == nil || *decoded != *endorsement {
+		t.Errorf("Endorsement not decoded: %v\n", decoded)
+	}
+	if decoded.Decode([]byte{ENCODING_VERSION, 1}) != nil {
+		t.Errorf("Invalid endorsement decoded\n")
+	}
+}
+
+func TestTransactionAssignmentHash(t *testing.T) {
+	tx := &FundsTx{Header: 1, Amount: 1000, Fee: 1, TxCnt: 7, From: [32]byte{1}, To: [32]byte{2}}
+	ta := NewTransactionAssignment(4, 2, [256]byte{3}, nil, nil, nil, []*FundsTx{tx}, nil, nil)
+	hash := ta.HashTransactionAssignment()
+
+	ta.Certificate = NewCommitteeCertificate([]*Endorsement{NewEndorsement(ENDORSE_ASSIGNMENT, 4, 2, hash, [32]byte{5})})
+	if ta.HashTransactionAssignment() != hash {
+		t.Errorf("Hash of transaction assignment depends on its certificate\n")
+	}
+
+	var decoded *TransactionAssignment
+	if decoded = decoded.DecodeTransactionAssignment(ta.EncodeTransactionAssignment()); decoded.HashTransactionAssignment() != hash ||
+		decoded.Certificate == nil || decoded.Certificate.EndorsedHash != hash {
+		t.Errorf("Transaction assignment not decoded: %v\n", decoded)
+	}
+
+	ta.FundsTxs = nil
+	if ta.HashTransactionAssignment() == hash {
+		t.Errorf("Hash of transaction assignment does not cover its transactions\n")
+	}
+}
@@ -1,10 +1,10 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
+	"encoding/binary"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
+	"golang.org/x/crypto/sha3"
 )
 
 type EpochBlock struct {
@@ -18,12 +18,24 @@ type EpochBlock struct {
 	Timestamp             int64
 	MerkleRoot            [32]byte
 	MerklePatriciaRoot    [32]byte
+	//Root of the receipts the epoch block delivers to the shards of the next epoch, see receipt.go
+	ReceiptsRoot		  [32]byte
+	//Root of the accounts that change their shard with the number of shards of the epoch block, see shardload.go
+	MigrationsRoot		  [32]byte
 	CommitmentProof       [crypto.COMM_PROOF_LENGTH]byte
-	State				  map[[32]byte]*Account
+	//Accounts created or changed since the previous epoch block, with their values at this epoch block. Applied to the
+	//state of the previous epoch block, they result in the state the MerklePatriciaRoot commits to. Not covered by the
+	//hash, the root proves them.
+	StateDelta			  map[[32]byte]*Account
 	ValMapping			  *ValShardMapping
 	CommitteeLeader		  [32]byte //hash of the wallet of the chosen committee leader
 	NofShards			  int
+	//Loads of the shards of the previous epoch, ordered by shard ID, the number of shards is decided with them
+	ShardLoads			  []ShardLoad
 	Beneficiary 		  [32]byte
+	Receipts			  []*Receipt
+	//Endorsements of a quorum of the committee, not covered by the hash, see endorsement.go
+	Certificate			  *CommitteeCertificate
 }
 
 func NewEpochBlock(prevShardHashes [][32]byte, height uint32) *EpochBlock {
@@ -45,27 +57,60 @@ func (epochBlock *EpochBlock) HashEpochBlock() [32]byte {
 		timestamp             		  int64
 		merkleRoot            		  [32]byte
 		merklePatriciaRoot	  		  [32]byte
+		receiptsRoot				  [32]byte
+		migrationsRoot				  [32]byte
 		height				  		  uint32
 		commitmentProof       		  [crypto.COMM_PROOF_LENGTH]byte
-		state					      map[[32]byte]*Account
 		valmapping					  *ValShardMapping
 		committeeleader				  [32]byte
 		noshards					  int
+		shardLoads					  []ShardLoad
 	}{
 		epochBlock.PrevShardHashes,
 		epochBlock.Timestamp,
 		epochBlock.MerkleRoot,
 		epochBlock.MerklePatriciaRoot,
+		epochBlock.ReceiptsRoot,
+		epochBlock.MigrationsRoot,
 		epochBlock.Height,
 		epochBlock.CommitmentProof,
-		epochBlock.State,
 		epochBlock.ValMapping,
 		epochBlock.CommitteeLeader,
 		epochBlock.NofShards,
+		epochBlock.ShardLoads,
 	}
 	return SerializeHashContent(blockHash)
 }
 
+//Recomputes the hash the epoch block was finalized with. The partial hash is taken before the proof of stake, the
+//validator mapping and the committee leader are added and is preceded by the nonce, which is kept as
+//timestamp. The number of shards and the loads it was decided with are already set. The first epoch block has no
+//proof of stake.
+func (epochBlock *EpochBlock) HashEpochBlockHeader() [32]byte {
+	if epochBlock == nil {
+		return [32]byte{}
+	}
+
+	partial := EpochBlock{
+		PrevShardHashes:    epochBlock.PrevShardHashes,
+		MerkleRoot:         epochBlock.MerkleRoot,
+		MerklePatriciaRoot: epochBlock.MerklePatriciaRoot,
+		ReceiptsRoot:       epochBlock.ReceiptsRoot,
+		MigrationsRoot:     epochBlock.MigrationsRoot,
+		Height:             epochBlock.Height,
+		NofShards:          epochBlock.NofShards,
+		ShardLoads:         epochBlock.ShardLoads,
+	}
+	partialHash := partial.HashEpochBlock()
+	if epochBlock.Height == 0 {
+		return partialHash
+	}
+
+	var nonceBuf [8]byte
+	binary.BigEndian.PutUint64(nonceBuf[:], uint64(epochBlock.Timestamp))
+	return sha3.Sum256(append(nonceBuf[:], partialHash[:]...))
+}
+
 func (epochBlock *EpochBlock) Encode() []byte {
 	if epochBlock == nil {
 		return nil
@@ -78,18 +123,21 @@ func (epochBlock *EpochBlock) Encode() []byte {
 		Timestamp:             epochBlock.Timestamp,
 		MerkleRoot:            epochBlock.MerkleRoot,
 		MerklePatriciaRoot:    epochBlock.MerklePatriciaRoot,
+		ReceiptsRoot:          epochBlock.ReceiptsRoot,
+		MigrationsRoot:        epochBlock.MigrationsRoot,
 		Height:                epochBlock.Height,
 		CommitmentProof:	   epochBlock.CommitmentProof,
-		State:				   epochBlock.State,
+		StateDelta:			   epochBlock.StateDelta,
 		ValMapping:			   epochBlock.ValMapping,
 		CommitteeLeader:	   epochBlock.CommitteeLeader,
 		NofShards:			   epochBlock.NofShards,
+		ShardLoads:			   epochBlock.ShardLoads,
 		Beneficiary:		   epochBlock.Beneficiary,
+		Receipts:			   epochBlock.Receipts,
+		Certificate:		   epochBlock.Certificate,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (epochBlock *EpochBlock) EncodeHeader() []byte {
@@ -97,16 +145,27 @@ func (epochBlock *EpochBlock) EncodeHeader() []byte {
 		return nil
 	}
 
+	//Everything but the state delta and the receipts, which are proven with the MerklePatriciaRoot and the ReceiptsRoot
 	encoded := EpochBlock{
 		Header:       		 epochBlock.Header,
 		Hash:         		 epochBlock.Hash,
 		PrevShardHashes:     epochBlock.PrevShardHashes,
 		Height:       		 epochBlock.Height,
+		Timestamp:			 epochBlock.Timestamp,
+		MerkleRoot:			 epochBlock.MerkleRoot,
+		MerklePatriciaRoot:	 epochBlock.MerklePatriciaRoot,
+		ReceiptsRoot:		 epochBlock.ReceiptsRoot,
+		MigrationsRoot:		 epochBlock.MigrationsRoot,
+		CommitmentProof:	 epochBlock.CommitmentProof,
+		ValMapping:			 epochBlock.ValMapping,
+		CommitteeLeader:	 epochBlock.CommitteeLeader,
+		NofShards:			 epochBlock.NofShards,
+		ShardLoads:			 epochBlock.ShardLoads,
+		Beneficiary:		 epochBlock.Beneficiary,
+		Certificate:		 epochBlock.Certificate,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (epochBlock *EpochBlock) Decode(encoded []byte) (b *EpochBlock) {
@@ -115,9 +174,10 @@ func (epochBlock *EpochBlock) Decode(encoded []byte) (b *EpochBlock) {
 	}
 
 	var decoded EpochBlock
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -128,11 +188,14 @@ func (epochBlock EpochBlock) String() string {
 		"Timestamp: %v\n"+
 		"MerkleRoot: %x\n"+
 		"MerklePatriciaRoot: %x\n"+
+		"Receipts: %d --> %x\n"+
+		"MigrationsRoot: %x\n"+
 		"Height: %d\n"+
 		"Commitment Proof: %x\n" +
-		"State: \n%v\n" +
+		"State Delta: \n%v\n" +
 		"Validator Shard Mapping: %s\n" +
 		"Number of Shards: %d\n" +
+		"Shard Loads: %v\n" +
 		"Committee Leader: %x\n",
 		epochBlock.Hash[0:8],
 		len(epochBlock.PrevShardHashes),
@@ -140,11 +203,14 @@ func (epochBlock EpochBlock) String() string {
 		epochBlock.Timestamp,
 		epochBlock.MerkleRoot[0:8],
 		epochBlock.MerklePatriciaRoot,
+		len(epochBlock.Receipts), epochBlock.ReceiptsRoot[0:8],
+		epochBlock.MigrationsRoot[0:8],
 		epochBlock.Height,
 		epochBlock.CommitmentProof[0:8],
-		epochBlock.StringState(),
+		epochBlock.StringStateDelta(),
 		epochBlock.ValMapping.String(),
 		epochBlock.NofShards,
+		epochBlock.ShardLoads,
 		epochBlock.CommitteeLeader,
 	)
 }
@@ -157,8 +223,8 @@ func (epochBlock EpochBlock) StringPrevHashes() (prevHashes string) {
 	return prevHashes
 }
 
-func (epochBlock EpochBlock) StringState() (state string) {
-	for _, acc := range epochBlock.State {
+func (epochBlock EpochBlock) StringStateDelta() (state string) {
+	for _, acc := range epochBlock.StateDelta {
 		state += fmt.Sprintf("Is root: %v\n", acc)
 	}
 	return state
@@ -1,10 +1,8 @@
 package protocol
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"encoding/gob"
 	"fmt"
 	"time"
 )
@@ -96,16 +94,15 @@ func (tx *FineTx) Encode() (encodedTx []byte) {
 		Sig:   		tx.Sig,
 		TimeStamp:  tx.TimeStamp,
 	}
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encodeData)
-	return buffer.Bytes()
+	return encodeCanonical(encodeData)
 }
 
 func (*FineTx) Decode(encodedTx []byte) *FineTx {
 	var decoded FineTx
-	buffer := bytes.NewBuffer(encodedTx)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encodedTx, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -1,10 +1,8 @@
 package protocol
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"encoding/gob"
 	"fmt"
 	"time"
 )
@@ -132,16 +130,15 @@ func (tx *FundsTx) Encode() (encodedTx []byte) {
 		Aggregated: tx.Aggregated,
 		Block: 		tx.Block,
 	}
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encodeData)
-	return buffer.Bytes()
+	return encodeCanonical(encodeData)
 }
 
 func (*FundsTx) Decode(encodedTx []byte) *FundsTx {
 	var decoded FundsTx
-	buffer := bytes.NewBuffer(encodedTx)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encodedTx, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
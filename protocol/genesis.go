@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
 )
@@ -60,9 +58,7 @@ func (genesis *Genesis) Encode() []byte {
 
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*Genesis) Decode(encoded []byte) (acc *Genesis) {
@@ -71,9 +67,10 @@ func (*Genesis) Decode(encoded []byte) (acc *Genesis) {
 	}
 
 	var decoded Genesis
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -72,6 +72,11 @@ func BuildMerkleTree(b *Block) *MerkleTree {
 			txHashes = append(txHashes, txHash)
 		}
 	}
+	if b.ReceiptData != nil {
+		for _, receiptHash := range b.ReceiptData {
+			txHashes = append(txHashes, receiptHash)
+		}
+	}
 
 	//Merkle root for no transactions is 0 hash
 	if len(txHashes) == 0 {
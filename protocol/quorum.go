@@ -0,0 +1,210 @@
+package protocol
+
+import (
+	"fmt"
+	"github.com/oigele/bazo-miner/crypto"
+)
+
+//The validators of a shard agree on every block in rounds. The proposer of a round broadcasts the block in a
+//proposal, the validators prevote for it once they checked it, execute it once a quorum prevoted for it and commit to
+//the resulting relative state with a commit vote. The commit votes of a quorum form the certificate of the block.
+const (
+	VOTE_PREVOTE = 1
+	VOTE_COMMIT  = 2
+)
+
+type Proposal struct {
+	Round     int
+	//Load of the shard after the block, the validators report it in their state transitions
+	Load      ShardLoad
+	Block     *Block
+	Proposer  [32]byte
+	Signature [crypto.COMM_PROOF_LENGTH]byte
+}
+
+type Vote struct {
+	Stage     uint8
+	Height    uint32
+	ShardID   int
+	Round     int
+	BlockHash [32]byte
+	//Hash of the relative state of the block, only set in commit votes, see RelativeStateHash
+	StateHash [32]byte
+	Validator [32]byte
+	Signature [crypto.COMM_PROOF_LENGTH]byte
+}
+
+//Not covered by the block hash, the validators only vote once the block is final.
+type QuorumCertificate struct {
+	Height    uint32
+	ShardID   int
+	Round     int
+	BlockHash [32]byte
+	StateHash [32]byte
+	Commits   []*Vote
+}
+
+func NewProposal(round int, load ShardLoad, block *Block, proposer [32]byte) *Proposal {
+	return &Proposal{
+		Round:    round,
+		Load:     load,
+		Block:    block,
+		Proposer: proposer,
+	}
+}
+
+func NewVote(stage uint8, height uint32, shardId int, round int, blockHash [32]byte, stateHash [32]byte, validator [32]byte) *Vote {
+	return &Vote{
+		Stage:     stage,
+		Height:    height,
+		ShardID:   shardId,
+		Round:     round,
+		BlockHash: blockHash,
+		StateHash: stateHash,
+		Validator: validator,
+	}
+}
+
+//The commit votes have to agree on the height, shard, round, block and state of the first one.
+func NewQuorumCertificate(commits []*Vote) *QuorumCertificate {
+	if len(commits) == 0 {
+		return nil
+	}
+
+	return &QuorumCertificate{
+		Height:    commits[0].Height,
+		ShardID:   commits[0].ShardID,
+		Round:     commits[0].Round,
+		BlockHash: commits[0].BlockHash,
+		StateHash: commits[0].StateHash,
+		Commits:   commits,
+	}
+}
+
+//The relative state is a map, its canonical encoding does not depend on the order of insertion.
+func RelativeStateHash(stateChange map[[32]byte]*RelativeAccount) [32]byte {
+	return SerializeHashContent(stateChange)
+}
+
+//Message signed with the commitment key of the proposer.
+func (proposal *Proposal) Message() string {
+	return fmt.Sprintf("proposal:%d:%d:%d:%x:%d:%d", proposal.Block.Height, proposal.Block.ShardId, proposal.Round, proposal.Block.Hash, proposal.Load.MempoolDepth, proposal.Load.BlockFill)
+}
+
+func (proposal *Proposal) Hash() [32]byte {
+	if proposal == nil || proposal.Block == nil {
+		return [32]byte{}
+	}
+
+	return SerializeHashContent(proposal.Message())
+}
+
+func (proposal *Proposal) Encode() []byte {
+	if proposal == nil || proposal.Block == nil {
+		return nil
+	}
+
+	encoded := struct {
+		Round     int
+		Load      ShardLoad
+		Block     []byte
+		Proposer  [32]byte
+		Signature [crypto.COMM_PROOF_LENGTH]byte
+	}{
+		proposal.Round,
+		proposal.Load,
+		proposal.Block.Encode(),
+		proposal.Proposer,
+		proposal.Signature,
+	}
+
+	return encodeCanonical(encoded)
+}
+
+func (*Proposal) Decode(encoded []byte) *Proposal {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded struct {
+		Round     int
+		Load      ShardLoad
+		Block     []byte
+		Proposer  [32]byte
+		Signature [crypto.COMM_PROOF_LENGTH]byte
+	}
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	var block *Block
+	if block = block.Decode(decoded.Block); block == nil {
+		return nil
+	}
+
+	return &Proposal{decoded.Round, decoded.Load, block, decoded.Proposer, decoded.Signature}
+}
+
+//Message signed with the commitment key of the validator.
+func (vote *Vote) Message() string {
+	return fmt.Sprintf("vote:%d:%d:%d:%d:%x:%x", vote.Stage, vote.Height, vote.ShardID, vote.Round, vote.BlockHash, vote.StateHash)
+}
+
+func (vote *Vote) Hash() [32]byte {
+	if vote == nil {
+		return [32]byte{}
+	}
+
+	voteHash := struct {
+		Message   string
+		Validator [32]byte
+	}{
+		vote.Message(),
+		vote.Validator,
+	}
+	return SerializeHashContent(voteHash)
+}
+
+func (vote *Vote) Encode() []byte {
+	if vote == nil {
+		return nil
+	}
+
+	encoded := Vote{
+		Stage:     vote.Stage,
+		Height:    vote.Height,
+		ShardID:   vote.ShardID,
+		Round:     vote.Round,
+		BlockHash: vote.BlockHash,
+		StateHash: vote.StateHash,
+		Validator: vote.Validator,
+		Signature: vote.Signature,
+	}
+
+	return encodeCanonical(encoded)
+}
+
+func (*Vote) Decode(encoded []byte) *Vote {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded Vote
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func (proposal Proposal) String() string {
+	return fmt.Sprintf("Round: %v, Block: %x, Height: %v, Shard: %v, Proposer: %x", proposal.Round, proposal.Block.Hash[0:8], proposal.Block.Height, proposal.Block.ShardId, proposal.Proposer[0:8])
+}
+
+func (vote Vote) String() string {
+	return fmt.Sprintf("Stage: %v, Height: %v, Shard: %v, Round: %v, Block: %x, State: %x, Validator: %x", vote.Stage, vote.Height, vote.ShardID, vote.Round, vote.BlockHash[0:8], vote.StateHash[0:8], vote.Validator[0:8])
+}
+
+func (certificate QuorumCertificate) String() string {
+	return fmt.Sprintf("Height: %v, Shard: %v, Round: %v, Block: %x, State: %x, Commits: %v", certificate.Height, certificate.ShardID, certificate.Round, certificate.BlockHash[0:8], certificate.StateHash[0:8], len(certificate.Commits))
+}
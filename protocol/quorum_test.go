@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProposalEncoding(t *testing.T) {
+	block := goldenBlock()
+	proposal := NewProposal(2, NewShardLoad(3, 400), block, [32]byte{1})
+	proposal.Signature = [256]byte{2}
+
+	var decoded *Proposal
+	if decoded = decoded.Decode(proposal.Encode()); decoded == nil || decoded.Round != 2 || decoded.Load != proposal.Load ||
+		decoded.Proposer != proposal.Proposer || decoded.Signature != proposal.Signature {
+		t.Fatalf("Proposal not decoded: %v\n", decoded)
+	}
+	if decoded.Block.Hash != block.Hash || !reflect.DeepEqual(decoded.Block.Certificate, block.Certificate) {
+		t.Errorf("Block of proposal not decoded: %v\n", decoded.Block)
+	}
+	if decoded.Decode(nil) != nil || decoded.Decode([]byte{ENCODING_VERSION, 1}) != nil {
+		t.Errorf("Invalid proposal decoded\n")
+	}
+}
+
+func TestVoteHash(t *testing.T) {
+	vote := goldenVote(goldenBlock())
+	signed := *vote
+	signed.Signature = [256]byte{1}
+	if vote.Hash() != signed.Hash() {
+		t.Errorf("Hash of vote depends on its signature\n")
+	}
+
+	other := *vote
+	other.Stage = VOTE_PREVOTE
+	if vote.Hash() == other.Hash() || vote.Message() == other.Message() {
+		t.Errorf("Prevote and commit vote can't be told apart\n")
+	}
+
+	var decoded *Vote
+	if decoded = decoded.Decode(vote.Encode()); decoded == nil || *decoded != *vote {
+		t.Errorf("Vote not decoded: %v\n", decoded)
+	}
+}
+
+func TestRelativeStateHash(t *testing.T) {
+	a, b := make(map[[32]byte]*RelativeAccount), make(map[[32]byte]*RelativeAccount)
+	for i, acc := range goldenAccounts() {
+		relative := NewRelativeAccount(acc.Address, acc.Issuer, int64(i), false, false, acc.CommitmentKey, acc.CommitteeKey, nil, nil)
+		a[acc.Hash()] = &relative
+	}
+	for i := len(goldenAccounts()) - 1; i >= 0; i-- {
+		acc := goldenAccounts()[i]
+		relative := NewRelativeAccount(acc.Address, acc.Issuer, int64(i), false, false, acc.CommitmentKey, acc.CommitteeKey, nil, nil)
+		b[acc.Hash()] = &relative
+	}
+	if RelativeStateHash(a) != RelativeStateHash(b) {
+		t.Errorf("Hash of relative state depends on the order of the map\n")
+	}
+
+	b[goldenAccounts()[0].Hash()].Balance++
+	if RelativeStateHash(a) == RelativeStateHash(b) {
+		t.Errorf("Different relative states have the same hash\n")
+	}
+
+	var decoded *StateTransition
+	st := NewStateTransition(a, nil, ShardLoad{}, 1, 2, [256]byte{})
+	if decoded = decoded.DecodeTransition(st.EncodeTransition()); RelativeStateHash(decoded.RelativeStateChange) != RelativeStateHash(a) {
+		t.Errorf("Hash of relative state changed by the state transition\n")
+	}
+}
@@ -0,0 +1,175 @@
+package protocol
+
+import (
+	"fmt"
+	"golang.org/x/crypto/sha3"
+)
+
+//A receipt is emitted for every funds transaction whose receiver is assigned to another shard than the one that
+//validates it. The sending shard debits the sender, commits the receipt with the ReceiptsRoot of its block and sends
+//it along with its state transition. The epoch block delivers the receipts of all shards, and the shard the receiver
+//is assigned to in the next epoch credits them in its first block after the epoch block.
+type Receipt struct {
+	TxHash    [32]byte
+	From      [32]byte
+	To        [32]byte
+	Amount    uint64
+	FromShard int
+	//Height of the block of the sending shard
+	Height uint32
+}
+
+//Stages of a cross-shard transfer, as far as a node has seen them. A transfer is never reported a stage back.
+const (
+	RECEIPT_UNKNOWN   = iota
+	RECEIPT_PENDING   //Debited, the receipt is committed in the block of the sending shard
+	RECEIPT_DELIVERED //The receipt is part of an epoch block
+	RECEIPT_CREDITED  //Credited in a block of the receiving shard
+)
+
+//Answer to a receipt request of a client. Block is the block that emitted the receipt if it is pending, the epoch
+//block that delivered it or the block that credited it. Proof holds the Merkle path from the receipt's hash to the
+//ReceiptsRoot of the (epoch) block that emitted or delivered it, or to the MerkleRoot of the block that credited it.
+type ReceiptStatus struct {
+	Receipt Receipt
+	Status  uint8
+	Block   [32]byte
+	Proof   [][32]byte
+}
+
+func NewReceipt(tx *FundsTx, fromShard int, height uint32) *Receipt {
+	return &Receipt{
+		TxHash:    tx.Hash(),
+		From:      tx.From,
+		To:        tx.To,
+		Amount:    tx.Amount,
+		FromShard: fromShard,
+		Height:    height,
+	}
+}
+
+func (receipt *Receipt) Hash() [32]byte {
+	if receipt == nil {
+		return [32]byte{}
+	}
+
+	return SerializeHashContent(*receipt)
+}
+
+func ReceiptHashes(receipts []*Receipt) (hashes [][32]byte) {
+	for _, receipt := range receipts {
+		hashes = append(hashes, receipt.Hash())
+	}
+
+	return hashes
+}
+
+//The root of blocks without receipts is the 0 hash, like the Merkle root of blocks without transactions.
+func BuildReceiptsMerkleTree(receipts []*Receipt) *MerkleTree {
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	m, _ := newTree(ReceiptHashes(receipts))
+
+	return m
+}
+
+//Path from the leaf with the given hash to the root of the tree, nil if the tree does not contain the leaf.
+func ReceiptProof(merkleTree *MerkleTree, hash [32]byte) (proof [][32]byte) {
+	if merkleTree == nil {
+		return nil
+	}
+
+	leaf := GetLeaf(merkleTree, hash)
+	if leaf == nil {
+		return nil
+	}
+
+	intermediates, err := GetIntermediate(leaf)
+	if err != nil {
+		return nil
+	}
+	for _, node := range intermediates {
+		proof = append(proof, node.Hash)
+	}
+
+	return proof
+}
+
+//The proof alternates between the sibling and the parent of every node on the path, starting at the leaf, as it is
+//returned by GetIntermediate.
+func VerifyReceiptProof(root [32]byte, receiptHash [32]byte, proof [][32]byte) bool {
+	if len(proof)%2 != 0 {
+		return false
+	}
+
+	hash := receiptHash
+	for i := 0; i < len(proof); i += 2 {
+		sibling, parent := proof[i], proof[i+1]
+		if sha3.Sum256(append(hash[:], sibling[:]...)) != parent && sha3.Sum256(append(sibling[:], hash[:]...)) != parent {
+			return false
+		}
+		hash = parent
+	}
+
+	return hash == root
+}
+
+func (receipt *Receipt) Encode() []byte {
+	if receipt == nil {
+		return nil
+	}
+
+	return encodeCanonical(*receipt)
+}
+
+func (*Receipt) Decode(encoded []byte) *Receipt {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded Receipt
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func (status *ReceiptStatus) Encode() []byte {
+	if status == nil {
+		return nil
+	}
+
+	return encodeCanonical(*status)
+}
+
+func (*ReceiptStatus) Decode(encoded []byte) *ReceiptStatus {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded ReceiptStatus
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func (receipt Receipt) String() string {
+	return fmt.Sprintf(
+		"TxHash: %x, "+
+			"From: %x, "+
+			"To: %x, "+
+			"Amount: %v, "+
+			"FromShard: %v, "+
+			"Height: %v",
+		receipt.TxHash[0:8],
+		receipt.From[0:8],
+		receipt.To[0:8],
+		receipt.Amount,
+		receipt.FromShard,
+		receipt.Height)
+}
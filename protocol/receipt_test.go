@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestReceiptProof(t *testing.T) {
+	var receipts []*Receipt
+	for i := 0; i < 5; i++ {
+		receipts = append(receipts, &Receipt{TxHash: [32]byte{byte(i)}, Amount: uint64(i), FromShard: i % 2})
+	}
+
+	if root := BuildReceiptsMerkleTree(nil).MerkleRoot(); root != [32]byte{} {
+		t.Errorf("Root without receipts is not the 0 hash: %x\n", root)
+	}
+
+	merkleTree := BuildReceiptsMerkleTree(receipts)
+	root := merkleTree.MerkleRoot()
+	for _, receipt := range receipts {
+		proof := ReceiptProof(merkleTree, receipt.Hash())
+		if proof == nil || !VerifyReceiptProof(root, receipt.Hash(), proof) {
+			t.Errorf("Valid proof of receipt %v rejected: %x\n", receipt, proof)
+		}
+	}
+
+	proof := ReceiptProof(merkleTree, receipts[0].Hash())
+	other := &Receipt{TxHash: [32]byte{9}}
+	if VerifyReceiptProof(root, other.Hash(), proof) {
+		t.Errorf("Proof accepted for another receipt\n")
+	}
+	if VerifyReceiptProof(root, receipts[0].Hash(), proof[:len(proof)-1]) {
+		t.Errorf("Truncated proof accepted\n")
+	}
+	if ReceiptProof(merkleTree, other.Hash()) != nil {
+		t.Errorf("Proof of unknown receipt returned\n")
+	}
+
+	var decoded *ReceiptStatus
+	status := &ReceiptStatus{Receipt: *receipts[1], Status: RECEIPT_DELIVERED, Block: [32]byte{1}, Proof: proof}
+	if decoded = decoded.Decode(status.Encode()); decoded == nil || decoded.Receipt != status.Receipt || len(decoded.Proof) != len(proof) {
+		t.Errorf("Receipt status not decoded: %v\n", decoded)
+	}
+}
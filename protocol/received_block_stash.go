@@ -51,6 +51,12 @@ func (m *BlockStash) BlockIncluded(k KeyBlock) bool {
 	}
 }
 
+func (m *BlockStash) Len() int {
+	blockMutex.Lock()
+	defer blockMutex.Unlock()
+	return len(m.M)
+}
+
 /*This function includes a key and tracks its order in the slice. No need to put the lock because it is used from the calling function*/
 func (m *BlockStash) DeleteFirstEntry() {
 	firstBlockHash := m.Keys[0]
@@ -61,6 +67,19 @@ func (m *BlockStash) DeleteFirstEntry() {
 	m.Keys = append(m.Keys[:0], m.Keys[1:]...)
 }
 
+/*This function returns the highest height of the blocks in the stash for every shard*/
+func ReturnHeightPerShard(blockStash *BlockStash) map[int]uint32 {
+	blockMutex.Lock()
+	defer blockMutex.Unlock()
+	heights := make(map[int]uint32)
+	for _,block := range blockStash.M {
+		if block.Height > heights[block.ShardId] {
+			heights[block.ShardId] = block.Height
+		}
+	}
+	return heights
+}
+
 /*This function counts how many blocks in the stash have some predefined height*/
 func CheckForHeightBlock(blockStash *BlockStash, height uint32) int {
 	blockMutex.Lock()
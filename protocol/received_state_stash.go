@@ -51,6 +51,12 @@ func (m *StateStash) StateTransitionIncluded(k KeyState) bool {
 	}
 }
 
+func (m *StateStash) Len() int {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return len(m.M)
+}
+
 /*This function includes a key and tracks its order in the slice. No need to put the lock because it is used from the calling function*/
 func (m *StateStash) DeleteFirstEntry() {
 	firstStateTransitionHash := m.Keys[0]
@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"github.com/oigele/bazo-miner/crypto"
 )
@@ -13,6 +11,10 @@ import (
  */
 type StateTransition struct {
 	RelativeStateChange			map[[32]byte]*RelativeAccount //changed to 32 Byte for streamlining
+	//Receipts of the cross-shard transfers of the block, collected into the epoch block
+	Receipts					[]*Receipt
+	//Load of the shard, the epoch block decides the number of shards of the next epoch with it
+	Load						ShardLoad
 	Height						int
 	ShardID						int
 	CommitmentProof				[crypto.COMM_KEY_LENGTH]byte
@@ -45,9 +47,11 @@ type RelativeAccount struct {
 	ContractVariables  []ByteArray           // Arbitrary length
 }
 
-func NewStateTransition(stateChange map[[32]byte]*RelativeAccount, height int, shardid int, commProof [crypto.COMM_KEY_LENGTH]byte) *StateTransition {
+func NewStateTransition(stateChange map[[32]byte]*RelativeAccount, receipts []*Receipt, load ShardLoad, height int, shardid int, commProof [crypto.COMM_KEY_LENGTH]byte) *StateTransition {
 	newTransition := StateTransition{
 		stateChange,
+		receipts,
+		load,
 		height,
 		shardid,
 		commProof,
@@ -126,21 +130,22 @@ func (st *StateTransition) EncodeTransition() []byte {
 
 	encoded := StateTransition{
 		RelativeStateChange:		st.RelativeStateChange,
+		Receipts:					st.Receipts,
+		Load:						st.Load,
 		Height:						st.Height,
 		ShardID:					st.ShardID,
 		CommitmentProof:			st.CommitmentProof,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*StateTransition) DecodeTransition(encoded []byte) (st *StateTransition) {
 	var decoded StateTransition
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -163,16 +168,15 @@ func (acc *RelativeAccount) Encode() []byte {
 		ContractVariables:  acc.ContractVariables,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*RelativeAccount) Decode(encoded []byte) (acc *RelativeAccount) {
 	var decoded RelativeAccount
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+//Load of a shard in the last block of an epoch. The shards report it with their state transition, and the epoch block
+//carries the loads of all shards it decided the number of shards of the next epoch with.
+type ShardLoad struct {
+	//Transactions assigned to the shard that did not fit into the block
+	MempoolDepth uint32
+	//Transactions in the block, in per mille of the transactions that fit into a block
+	BlockFill uint16
+}
+
+//An account whose shard changes at an epoch boundary, because the number of shards changes. The epoch block commits
+//to the migrations of all accounts of its state with the MigrationsRoot.
+type AccountMigration struct {
+	Account   [32]byte
+	FromShard int
+	ToShard   int
+}
+
+func NewShardLoad(mempoolDepth uint32, blockFill uint16) ShardLoad {
+	return ShardLoad{
+		MempoolDepth: mempoolDepth,
+		BlockFill:    blockFill,
+	}
+}
+
+func (migration *AccountMigration) Hash() [32]byte {
+	if migration == nil {
+		return [32]byte{}
+	}
+
+	return SerializeHashContent(*migration)
+}
+
+//The root of epoch blocks without migrations is the 0 hash.
+func BuildMigrationsMerkleTree(migrations []*AccountMigration) *MerkleTree {
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	var hashes [][32]byte
+	for _, migration := range migrations {
+		hashes = append(hashes, migration.Hash())
+	}
+	m, _ := newTree(hashes)
+
+	return m
+}
+
+func (load ShardLoad) String() string {
+	return fmt.Sprintf("MempoolDepth: %v, BlockFill: %v", load.MempoolDepth, load.BlockFill)
+}
+
+func (migration AccountMigration) String() string {
+	return fmt.Sprintf("Account: %x, FromShard: %v, ToShard: %v", migration.Account[0:8], migration.FromShard, migration.ToShard)
+}
@@ -0,0 +1,198 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+//StateTrie is a binary Merkle Patricia trie over the accounts of a state, keyed by the account hash. Paths are
+//compressed: a branch only exists at the bits where the keys below it differ, such that the trie of n accounts has
+//n leaves and n-1 branches independent of the key length. The root commits to every account and is stored in the
+//MerklePatriciaRoot of the epoch block.
+type StateTrie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	hash [32]byte
+
+	//Leaf
+	key     [32]byte
+	account *Account
+
+	//Branch. All keys in the left subtrie have bit 0 at position bit, all keys in the right subtrie bit 1.
+	bit   uint8
+	left  *trieNode
+	right *trieNode
+}
+
+const (
+	TRIE_LEAF_PREFIX   = 0x00
+	TRIE_BRANCH_PREFIX = 0x01
+)
+
+func NewStateTrie(state map[[32]byte]*Account) *StateTrie {
+	keys := make([][32]byte, 0, len(state))
+	for key, acc := range state {
+		if acc != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+
+	if len(keys) == 0 {
+		return &StateTrie{}
+	}
+
+	return &StateTrie{buildTrieNode(keys, state)}
+}
+
+//Returns the root hash of the trie, the empty trie has the zero hash as root.
+func (trie *StateTrie) Root() [32]byte {
+	if trie == nil || trie.root == nil {
+		return [32]byte{}
+	}
+
+	return trie.root.hash
+}
+
+//Returns the account stored under the given hash, nil if it is not in the trie.
+func (trie *StateTrie) Get(key [32]byte) *Account {
+	if trie == nil {
+		return nil
+	}
+
+	node := trie.root
+	for node != nil && node.account == nil {
+		if getKeyBit(key, node.bit) == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+
+	if node == nil || node.key != key {
+		return nil
+	}
+
+	return node.account
+}
+
+//Shorthand for the root of the trie over the given state.
+func StateRoot(state map[[32]byte]*Account) [32]byte {
+	return NewStateTrie(state).Root()
+}
+
+//keys have to be sorted, unique and non-empty.
+func buildTrieNode(keys [][32]byte, state map[[32]byte]*Account) *trieNode {
+	if len(keys) == 1 {
+		node := &trieNode{key: keys[0], account: state[keys[0]]}
+		node.hash = hashTrieLeaf(node.key, node.account)
+		return node
+	}
+
+	//Since the keys are sorted, the bits shared by all of them are the ones shared by the first and the last key.
+	bit := firstDifferingBit(keys[0], keys[len(keys)-1])
+	split := sort.Search(len(keys), func(i int) bool {
+		return getKeyBit(keys[i], bit) == 1
+	})
+
+	node := &trieNode{
+		bit:   bit,
+		left:  buildTrieNode(keys[:split], state),
+		right: buildTrieNode(keys[split:], state),
+	}
+	node.hash = hashTrieBranch(node.bit, node.left.hash, node.right.hash)
+
+	return node
+}
+
+func hashTrieLeaf(key [32]byte, acc *Account) [32]byte {
+	accHash := acc.StateHash()
+
+	buffer := make([]byte, 0, 1+len(key)+len(accHash))
+	buffer = append(buffer, TRIE_LEAF_PREFIX)
+	buffer = append(buffer, key[:]...)
+	buffer = append(buffer, accHash[:]...)
+
+	return sha3.Sum256(buffer)
+}
+
+func hashTrieBranch(bit uint8, left [32]byte, right [32]byte) [32]byte {
+	buffer := make([]byte, 0, 2+len(left)+len(right))
+	buffer = append(buffer, TRIE_BRANCH_PREFIX, bit)
+	buffer = append(buffer, left[:]...)
+	buffer = append(buffer, right[:]...)
+
+	return sha3.Sum256(buffer)
+}
+
+//Bits are counted from the most significant bit of the first byte.
+func getKeyBit(key [32]byte, bit uint8) byte {
+	return (key[bit/8] >> (7 - bit%8)) & 1
+}
+
+func firstDifferingBit(a [32]byte, b [32]byte) uint8 {
+	for i := range a {
+		if diff := a[i] ^ b[i]; diff != 0 {
+			bit := uint8(i * 8)
+			for diff&0x80 == 0 {
+				diff <<= 1
+				bit++
+			}
+			return bit
+		}
+	}
+
+	return 255
+}
+
+//The hash of an account as stored in the state trie. Unlike Hash(), which only identifies the account by its
+//address, it covers all fields.
+func (acc *Account) StateHash() [32]byte {
+	return SerializeHashContent(*acc)
+}
+
+//Returns a proof that the account stored under key is part of the trie, which can be checked against the root with
+//VerifyAccountProof.
+func (trie *StateTrie) Prove(key [32]byte) (*AccountProof, error) {
+	if trie == nil || trie.root == nil {
+		return nil, errors.New("State trie is empty.")
+	}
+
+	var bits []uint8
+	var siblings [][32]byte
+	node := trie.root
+	for node.account == nil {
+		bits = append(bits, node.bit)
+		if getKeyBit(key, node.bit) == 0 {
+			siblings = append(siblings, node.right.hash)
+			node = node.left
+		} else {
+			siblings = append(siblings, node.left.hash)
+			node = node.right
+		}
+	}
+
+	if node.key != key {
+		return nil, errors.New(fmt.Sprintf("Account (%x) not in the state trie.", key[0:8]))
+	}
+
+	//The proof is verified from the leaf up to the root
+	for i, j := 0, len(bits)-1; i < j; i, j = i+1, j-1 {
+		bits[i], bits[j] = bits[j], bits[i]
+		siblings[i], siblings[j] = siblings[j], siblings[i]
+	}
+
+	return &AccountProof{
+		Account:  *node.account,
+		Bits:     bits,
+		Siblings: siblings,
+	}, nil
+}
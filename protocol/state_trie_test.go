@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+func newTestState(n int) map[[32]byte]*Account {
+	state := make(map[[32]byte]*Account)
+	for i := 0; i < n; i++ {
+		var address [64]byte
+		address[0] = byte(i)
+		address[1] = byte(i >> 8)
+		acc := NewAccount(address, [32]byte{}, uint64(i), false, false, [256]byte{}, [256]byte{}, nil, nil)
+		state[acc.Hash()] = &acc
+	}
+
+	return state
+}
+
+func TestStateTrieRoot(t *testing.T) {
+	if root := StateRoot(nil); root != [32]byte{} {
+		t.Errorf("Empty state has root %x\n", root)
+	}
+
+	//A single account is a leaf and the root
+	state := newTestState(1)
+	for key, acc := range state {
+		accHash := acc.StateHash()
+		expected := sha3.Sum256(append(append([]byte{TRIE_LEAF_PREFIX}, key[:]...), accHash[:]...))
+		if root := StateRoot(state); root != expected {
+			t.Errorf("Root of a single account is %x, expected %x\n", root, expected)
+		}
+	}
+
+	//Two keys differing in the first bit are split by a branch at bit 0
+	left, right := [32]byte{0x10}, [32]byte{0x80}
+	accLeft, accRight := &Account{Balance: 1}, &Account{Balance: 2}
+	state = map[[32]byte]*Account{left: accLeft, right: accRight}
+	expected := hashTrieBranch(0, hashTrieLeaf(left, accLeft), hashTrieLeaf(right, accRight))
+	if root := StateRoot(state); root != expected {
+		t.Errorf("Root of two accounts is %x, expected %x\n", root, expected)
+	}
+}
+
+func TestStateTrieChanges(t *testing.T) {
+	state := newTestState(300)
+	root := StateRoot(state)
+
+	//The root does not depend on the order of the map
+	if StateRoot(state) != root {
+		t.Error("Root of the same state changed.\n")
+	}
+
+	//Every change of an account changes the root
+	for _, acc := range state {
+		acc.TxCnt++
+		if StateRoot(state) == root {
+			t.Error("Root did not change with the tx count.\n")
+		}
+		acc.TxCnt--
+
+		acc.ContractVariables = []ByteArray{{1}}
+		if StateRoot(state) == root {
+			t.Error("Root did not change with the contract variables.\n")
+		}
+		acc.ContractVariables = nil
+		break
+	}
+
+	if StateRoot(state) != root {
+		t.Error("Root differs after reverting the changes.\n")
+	}
+
+	var missing [32]byte
+	for key := range newTestState(301) {
+		if _, exists := state[key]; !exists {
+			missing = key
+		}
+	}
+
+	trie := NewStateTrie(state)
+	for key, acc := range state {
+		if trie.Get(key) != acc {
+			t.Errorf("Account (%x) not found in the trie.\n", key[0:8])
+		}
+	}
+	if trie.Get(missing) != nil {
+		t.Error("Account not in the state found in the trie.\n")
+	}
+}
+
+func TestAccountProof(t *testing.T) {
+	state := newTestState(100)
+	trie := NewStateTrie(state)
+	root := trie.Root()
+
+	for key, acc := range state {
+		proof, err := trie.Prove(key)
+		if err != nil {
+			t.Fatalf("Could not create proof: %v\n", err)
+		}
+
+		decoded := proof.Decode(proof.Encode())
+		if !VerifyAccountProof(root, decoded) {
+			t.Errorf("Valid proof of account (%x) rejected.\n", key[0:8])
+		}
+		if decoded.Account.Balance != acc.Balance {
+			t.Errorf("Wrong account in proof: %v\n", decoded.Account)
+		}
+
+		//A changed account must not verify
+		decoded.Account.Balance++
+		if VerifyAccountProof(root, decoded) {
+			t.Error("Proof of a changed account accepted.\n")
+		}
+		decoded.Account.Balance--
+
+		//Neither a changed path
+		if len(decoded.Siblings) > 0 {
+			decoded.Siblings[0][0]++
+			if VerifyAccountProof(root, decoded) {
+				t.Error("Proof with a changed sibling accepted.\n")
+			}
+		}
+	}
+
+	var missing [64]byte
+	missing[2] = 1
+	if _, err := trie.Prove(SerializeHashContent(missing)); err == nil {
+		t.Error("Proof of an account not in the state created.\n")
+	}
+
+	if VerifyAccountProof(root, nil) {
+		t.Error("Empty proof accepted.\n")
+	}
+}
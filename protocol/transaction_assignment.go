@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"github.com/oigele/bazo-miner/crypto"
 	"os"
 )
@@ -18,6 +16,8 @@ type TransactionAssignment struct {
 	FundsTxs					[]*FundsTx
 	DataTxs						[]*DataTx
 	FineTxs						[]*FineTx
+	//Endorsements of a quorum of the committee, not covered by the hash, see endorsement.go
+	Certificate					*CommitteeCertificate
 }
 
 
@@ -34,6 +34,7 @@ func NewTransactionAssignment(height int, shardid int, committeeProof [crypto.CO
 		fundsTxs,
 		dataTxs,
 		fineTxs,
+		nil,
 	}
 
 	return &newTransition
@@ -46,18 +47,43 @@ func (ta *TransactionAssignment) HashTransactionAssignment() [32]byte {
 		return [32]byte{}
 	}
 
+	//The hash covers the assigned transactions, such that the committee endorses them
 	stHash := struct {
 		Height				  			  int
 		ShardID							  int
 		CommitteeProof					  [crypto.COMM_PROOF_LENGTH]byte
+		Transactions					  [][32]byte
 	}{
 		ta.Height,
 		ta.ShardID,
 		ta.CommitteeProof,
+		ta.transactionHashes(),
 	}
 	return SerializeHashContent(stHash)
 }
 
+func (ta *TransactionAssignment) transactionHashes() (hashes [][32]byte) {
+	for _, tx := range ta.AccTxs {
+		hashes = append(hashes, tx.Hash())
+	}
+	for _, tx := range ta.StakeTxs {
+		hashes = append(hashes, tx.Hash())
+	}
+	for _, tx := range ta.CommitteeTxs {
+		hashes = append(hashes, tx.Hash())
+	}
+	for _, tx := range ta.FundsTxs {
+		hashes = append(hashes, tx.Hash())
+	}
+	for _, tx := range ta.DataTxs {
+		hashes = append(hashes, tx.Hash())
+	}
+	for _, tx := range ta.FineTxs {
+		hashes = append(hashes, tx.Hash())
+	}
+	return hashes
+}
+
 
 func (ta *TransactionAssignment) EncodeTransactionAssignment() []byte {
 	if ta == nil {
@@ -75,18 +101,18 @@ func (ta *TransactionAssignment) EncodeTransactionAssignment() []byte {
 		FundsTxs:					ta.FundsTxs,
 		DataTxs:					ta.DataTxs,
 		FineTxs: 					ta.FineTxs,
+		Certificate:				ta.Certificate,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (*TransactionAssignment) DecodeTransactionAssignment(encoded []byte) (ta *TransactionAssignment) {
 	var decoded TransactionAssignment
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
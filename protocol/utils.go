@@ -1,7 +1,6 @@
 package protocol
 
 import (
-	"fmt"
 	"math"
 	"time"
 
@@ -11,9 +10,10 @@ import (
 	"golang.org/x/crypto/sha3"
 )
 
-//Serializes the input and returns the sha3 hash function applied on ths input
+//Serializes the input with the canonical encoding and returns the sha3 hash function applied on this input, see
+//encoding.go
 func SerializeHashContent(data interface{}) (hash [32]byte) {
-	return sha3.Sum256([]byte(fmt.Sprintf("%v", data)))
+	return sha3.Sum256(canonicalContent(data))
 }
 
 func Encode(data [][]byte, sliceSize int) []byte {
@@ -1,8 +1,6 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 )
 
@@ -50,9 +48,7 @@ func (valMapping *ValShardMapping) Encode() []byte {
 		EpochHeight:			   valMapping.EpochHeight,
 	}
 
-	buffer := new(bytes.Buffer)
-	gob.NewEncoder(buffer).Encode(encoded)
-	return buffer.Bytes()
+	return encodeCanonical(encoded)
 }
 
 func (valMapping *ValShardMapping) Decode(encoded []byte) (valMappingDecoded *ValShardMapping) {
@@ -61,9 +57,10 @@ func (valMapping *ValShardMapping) Decode(encoded []byte) (valMappingDecoded *Va
 	}
 
 	var decoded ValShardMapping
-	buffer := bytes.NewBuffer(encoded)
-	decoder := gob.NewDecoder(buffer)
-	decoder.Decode(&decoded)
+	if err := decodeCanonical(encoded, &decoded); err != nil {
+		return nil
+	}
+
 	return &decoded
 }
 
@@ -8,6 +8,11 @@ type Context struct {
 	Account
 	changes []Change
 	FundsTx
+	//Looks up the accounts of external contracts called with CALLEXT. External calls fail if it is not set.
+	AccountLookup func(address [32]byte) (*Account, error)
+	//Accounts of the external contracts called successfully during the execution, including their changed variables.
+	externalContracts map[[32]byte]Account
+	parent            *Context
 }
 
 type Change struct {
@@ -23,7 +28,10 @@ func (c *Change) GetChange() (int, []byte) {
 	return c.index, c.value
 }
 
+//The contract variables are copied, changes made by the vm only become visible in the account passed in if they are
+//explicitly taken over after PersistChanges().
 func NewContext(account Account, fundsTx FundsTx) *Context {
+	account.ContractVariables = CopyContractVariables(account.ContractVariables)
 	newContext := Context{
 		Account: account,
 		changes: []Change{},
@@ -65,6 +73,86 @@ func (c *Context) PersistChanges() {
 		i, value := change.GetChange()
 		c.ContractVariables[i] = value
 	}
+	c.changes = []Change{}
+}
+
+//Creates the context to call the contract of the account with the given address hash from within this contract. The
+//called contract sees the changes of earlier successful external calls within the same execution. Calling a contract
+//that is already part of the call chain is not allowed, since its changes are not persisted yet.
+func (c *Context) NewExternalContext(address [32]byte, data []byte, fee uint64) (*Context, error) {
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		if SerializeHashContent(ctx.Address) == address {
+			return nil, errors.New("Recursive external calls are not allowed")
+		}
+	}
+
+	account, err := c.getExternalAccount(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.Contract == nil {
+		return nil, errors.New("External account has no contract")
+	}
+
+	tx := FundsTx{
+		From: SerializeHashContent(c.Address),
+		To:   address,
+		Fee:  fee,
+		Data: data,
+	}
+
+	externalContext := NewContext(account, tx)
+	externalContext.AccountLookup = c.AccountLookup
+	externalContext.parent = c
+
+	return externalContext, nil
+}
+
+//Takes over the changes of a successfully executed external call, including the changes of the calls it made itself.
+//Changes of failed calls are never committed and therefore discarded as a whole.
+func (c *Context) CommitExternalContext(externalContext *Context) {
+	if c.externalContracts == nil {
+		c.externalContracts = make(map[[32]byte]Account)
+	}
+
+	externalContext.PersistChanges()
+	for address, account := range externalContext.externalContracts {
+		c.externalContracts[address] = account
+	}
+	c.externalContracts[externalContext.To] = externalContext.Account
+}
+
+//Returns the contract variables of all external contracts called successfully, keyed by the address hash.
+func (c *Context) GetExternalContractVariables() map[[32]byte][]ByteArray {
+	variables := make(map[[32]byte][]ByteArray)
+	for address, account := range c.externalContracts {
+		variables[address] = account.ContractVariables
+	}
+
+	return variables
+}
+
+func (c *Context) getExternalAccount(address [32]byte) (Account, error) {
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		if account, exists := ctx.externalContracts[address]; exists {
+			return account, nil
+		}
+	}
+
+	if c.AccountLookup == nil {
+		return Account{}, errors.New("External calls are not supported in this context")
+	}
+
+	account, err := c.AccountLookup(address)
+	if err != nil {
+		return Account{}, err
+	}
+	if account == nil {
+		return Account{}, errors.New("External account does not exist")
+	}
+
+	return *account, nil
 }
 
 func (c *Context) GetAddress() [64]byte {
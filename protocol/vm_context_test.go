@@ -51,3 +51,25 @@ func TestVMContext_SetContractVariable_EncapsulationBreach(t *testing.T) {
 		t.Errorf("Expected result to be '%v' but was '%v'", expected, actual)
 	}
 }
+
+func TestVMContext_NewContext_CopiesContractVariables(t *testing.T) {
+	acc := Account{}
+	acc.ContractVariables = []ByteArray{[]byte{0x00, 0x00, 0x00}}
+
+	c := NewContext(acc, FundsTx{})
+	c.SetContractVariable(0, []byte{0x01})
+	c.PersistChanges()
+
+	expected := []byte{0x00, 0x00, 0x00}
+	if !bytes.Equal(expected, acc.ContractVariables[0]) {
+		t.Errorf("Expected account variable to be '%v' but was '%v'", expected, acc.ContractVariables[0])
+	}
+
+	if !bytes.Equal([]byte{0x01}, c.ContractVariables[0]) {
+		t.Errorf("Expected context variable to be '%v' but was '%v'", []byte{0x01}, c.ContractVariables[0])
+	}
+
+	if ContractVariablesEqual(acc.ContractVariables, c.ContractVariables) {
+		t.Error("Expected contract variables to differ after the change")
+	}
+}
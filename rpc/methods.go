@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/oigele/bazo-miner/p2p"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+type methodFunc func(params json.RawMessage) (interface{}, *Error)
+
+//All methods take their parameters as a positional array of strings, e.g. {"params": ["<hash as hex>"]}.
+var methods = map[string]methodFunc{
+	"getBlock":           getBlock,
+	"getLastBlock":       getLastBlock,
+	"getEpochBlock":      getEpochBlock,
+	"getLastEpochBlock":  getLastEpochBlock,
+	"getAccount":         getAccount,
+	"getClosedTx":        getClosedTx,
+	"getMempool":         getMempool,
+	"getValShardMapping": getValShardMapping,
+	"sendTransaction":    sendTransaction,
+}
+
+func getBlock(params json.RawMessage) (interface{}, *Error) {
+	hash, err := hashParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	block := storage.ReadClosedBlock(hash)
+	if block == nil {
+		block = storage.ReadOpenBlock(hash)
+	}
+	if block == nil {
+		return nil, &Error{NOT_FOUND, fmt.Sprintf("Block (%x) not found.", hash[:8])}
+	}
+
+	return newBlockView(block), nil
+}
+
+func getLastBlock(params json.RawMessage) (interface{}, *Error) {
+	block := storage.ReadLastClosedBlock()
+	if block == nil {
+		return nil, &Error{NOT_FOUND, "No closed block stored yet."}
+	}
+
+	return newBlockView(block), nil
+}
+
+func getEpochBlock(params json.RawMessage) (interface{}, *Error) {
+	hash, err := hashParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	epochBlock := storage.ReadClosedEpochBlock(hash)
+	if epochBlock == nil {
+		epochBlock = storage.ReadOpenEpochBlock(hash)
+	}
+	if epochBlock == nil {
+		return nil, &Error{NOT_FOUND, fmt.Sprintf("Epoch block (%x) not found.", hash[:8])}
+	}
+
+	return newEpochBlockView(epochBlock), nil
+}
+
+func getLastEpochBlock(params json.RawMessage) (interface{}, *Error) {
+	epochBlock := storage.ReadLastClosedEpochBlock()
+	if epochBlock == nil {
+		return nil, &Error{NOT_FOUND, "No closed epoch block stored yet."}
+	}
+
+	return newEpochBlockView(epochBlock), nil
+}
+
+//The account can either be queried with its 64 byte address (public key) or the 32 byte hash of the address.
+func getAccount(params json.RawMessage) (interface{}, *Error) {
+	decoded, err := bytesParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var hash [32]byte
+	switch len(decoded) {
+	case 64:
+		var address [64]byte
+		copy(address[:], decoded)
+		hash = protocol.SerializeHashContent(address)
+	case 32:
+		copy(hash[:], decoded)
+	default:
+		return nil, &Error{INVALID_PARAMS, "Expected a 64 byte address or a 32 byte address hash."}
+	}
+
+	//The miner changes the state while the request is served, the account is read from the last published copy
+	state, _ := storage.ReadStateSnapshot()
+	acc := state[hash]
+	if acc == nil {
+		return nil, &Error{NOT_FOUND, fmt.Sprintf("Acc (%x) not in the state.", hash[0:8])}
+	}
+
+	return newAccountView(acc), nil
+}
+
+func getClosedTx(params json.RawMessage) (interface{}, *Error) {
+	hash, err := hashParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := storage.ReadClosedTx(hash)
+	if tx == nil {
+		return nil, &Error{NOT_FOUND, fmt.Sprintf("Transaction (%x) not found.", hash[:8])}
+	}
+
+	return newTxView(tx), nil
+}
+
+func getMempool(params json.RawMessage) (interface{}, *Error) {
+	mempool := mempoolView{
+		Open:     []txView{},
+		Assigned: []txView{},
+		Invalid:  []txView{},
+	}
+
+	for _, tx := range storage.ReadAllOpenTxs() {
+		mempool.Open = append(mempool.Open, newTxView(tx))
+	}
+	for _, tx := range storage.ReadAllAssignedTx() {
+		mempool.Assigned = append(mempool.Assigned, newTxView(tx))
+	}
+	for _, tx := range storage.ReadAllINVALIDOpenTx() {
+		mempool.Invalid = append(mempool.Invalid, newTxView(tx))
+	}
+
+	return mempool, nil
+}
+
+//The validator to shard mapping that is currently in use is the one of the last closed epoch block.
+func getValShardMapping(params json.RawMessage) (interface{}, *Error) {
+	epochBlock := storage.ReadLastClosedEpochBlock()
+	if epochBlock == nil || epochBlock.ValMapping == nil {
+		return nil, &Error{NOT_FOUND, "No validator shard mapping available yet."}
+	}
+
+	return newValShardMappingView(epochBlock.ValMapping), nil
+}
+
+//Expects the transaction type (funds, acc, config, stake, committee, data) followed by the hex encoded transaction
+//as produced by its Encode() function. The transaction goes through the same checks as a transaction received from a
+//client over p2p and is verified before it is written to the mempool and broadcast.
+func sendTransaction(params json.RawMessage) (interface{}, *Error) {
+	if !submitEnabled {
+		return nil, &Error{SUBMIT_DISABLED, "Transaction submission is disabled on this node."}
+	}
+
+	args, err := stringParams(params, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, decodeErr := hex.DecodeString(args[1])
+	if decodeErr != nil || len(encoded) == 0 {
+		return nil, &Error{INVALID_PARAMS, "Transaction is not valid hex."}
+	}
+
+	tx, brdcstType := decodeTx(args[0], encoded)
+	if tx == nil {
+		return nil, &Error{INVALID_PARAMS, fmt.Sprintf("Could not decode transaction of type %v.", args[0])}
+	}
+
+	hash := tx.Hash()
+	if storage.ReadOpenTx(hash) != nil || storage.ReadClosedTx(hash) != nil {
+		return hex.EncodeToString(hash[:]), nil
+	}
+
+	if storage.ReadOpenTxHashToDelete(hash) {
+		return nil, &Error{INVALID_TX, fmt.Sprintf("Transaction (%x) was already removed from the mempool.", hash[:8])}
+	}
+
+	if verifyTx == nil || !verifyTx(tx) {
+		return nil, &Error{INVALID_TX, fmt.Sprintf("Transaction (%x) could not be verified.", hash[:8])}
+	}
+
+	storage.WriteOpenTx(tx)
+	p2p.VerifiedTxsBrdcstOut <- p2p.BuildPacket(brdcstType, tx.Encode())
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func decodeTx(txType string, encoded []byte) (protocol.Transaction, uint8) {
+	switch txType {
+	case "funds":
+		var tx *protocol.FundsTx
+		if tx = tx.Decode(encoded); tx != nil {
+			return tx, p2p.FUNDSTX_BRDCST
+		}
+	case "acc":
+		var tx *protocol.AccTx
+		if tx = tx.Decode(encoded); tx != nil {
+			return tx, p2p.ACCTX_BRDCST
+		}
+	case "config":
+		var tx *protocol.ConfigTx
+		if tx = tx.Decode(encoded); tx != nil {
+			return tx, p2p.CONFIGTX_BRDCST
+		}
+	case "stake":
+		var tx *protocol.StakeTx
+		if tx = tx.Decode(encoded); tx != nil {
+			return tx, p2p.STAKETX_BRDCST
+		}
+	case "committee":
+		var tx *protocol.CommitteeTx
+		if tx = tx.Decode(encoded); tx != nil {
+			return tx, p2p.COMMITTEETX_BRDCST
+		}
+	case "data":
+		var tx *protocol.DataTx
+		if tx = tx.Decode(encoded); tx != nil {
+			return tx, p2p.DATATX_BRDCST
+		}
+	}
+
+	return nil, 0
+}
+
+func stringParams(params json.RawMessage, expected int) (args []string, err *Error) {
+	if len(params) == 0 || json.Unmarshal(params, &args) != nil || len(args) != expected {
+		return nil, &Error{INVALID_PARAMS, fmt.Sprintf("Expected %d string parameter(s).", expected)}
+	}
+
+	return args, nil
+}
+
+func bytesParam(params json.RawMessage) ([]byte, *Error) {
+	args, err := stringParams(params, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, decodeErr := hex.DecodeString(args[0])
+	if decodeErr != nil {
+		return nil, &Error{INVALID_PARAMS, "Parameter is not valid hex."}
+	}
+
+	return decoded, nil
+}
+
+func hashParam(params json.RawMessage) (hash [32]byte, err *Error) {
+	decoded, err := bytesParam(params)
+	if err != nil {
+		return hash, err
+	}
+
+	if len(decoded) != 32 {
+		return hash, &Error{INVALID_PARAMS, "Expected a 32 byte hash."}
+	}
+
+	copy(hash[:], decoded)
+	return hash, nil
+}
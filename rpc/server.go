@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+const (
+	JSONRPC_VERSION  = "2.0"
+	MAX_REQUEST_SIZE = 1 << 20 //Byte
+
+	//Error codes as defined by the JSON-RPC 2.0 specification
+	PARSE_ERROR      = -32700
+	INVALID_REQUEST  = -32600
+	METHOD_NOT_FOUND = -32601
+	INVALID_PARAMS   = -32602
+	NOT_FOUND        = -32000
+	SUBMIT_DISABLED  = -32001
+	INVALID_TX       = -32002
+)
+
+var (
+	logger *logging.Logger
+	//Transaction submission changes the state of the node, it is therefore only served when explicitly enabled.
+	submitEnabled bool
+	//Submitted transactions are verified by the miner before they are accepted.
+	verifyTx func(tx protocol.Transaction) bool
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+//A successful response always carries a result, even if it is null, an error response must not carry one.
+func (res response) MarshalJSON() ([]byte, error) {
+	if res.Error != nil {
+		return json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			Error   *Error          `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{res.JSONRPC, res.Error, res.ID})
+	}
+
+	type result response
+	return json.Marshal(result(res))
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+//Entry point for the rpc package. The server runs in its own goroutine and only reads from storage, unless
+//allowSubmit is set. Submitted transactions are only accepted if verify returns true.
+func Init(address string, allowSubmit bool, verify func(tx protocol.Transaction) bool) {
+	logger = logging.New("rpc")
+	submitEnabled = allowSubmit
+	verifyTx = verify
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRequest)
+
+	go func() {
+		logger.Printf("Starting JSON-RPC server at %v (transaction submission enabled: %v)\n", address, allowSubmit)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Printf("JSON-RPC server stopped: %v\n", err)
+		}
+	}()
+}
+
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeResponse(w, response{JSONRPC: JSONRPC_VERSION, Error: &Error{INVALID_REQUEST, "Only POST requests are supported."}})
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_SIZE)).Decode(&req); err != nil {
+		writeResponse(w, response{JSONRPC: JSONRPC_VERSION, Error: &Error{PARSE_ERROR, err.Error()}})
+		return
+	}
+
+	writeResponse(w, dispatch(&req))
+}
+
+func dispatch(req *request) response {
+	res := response{JSONRPC: JSONRPC_VERSION, ID: req.ID}
+
+	if req.JSONRPC != JSONRPC_VERSION || req.Method == "" {
+		res.Error = &Error{INVALID_REQUEST, "Invalid JSON-RPC 2.0 request."}
+		return res
+	}
+
+	method, exists := methods[req.Method]
+	if !exists {
+		res.Error = &Error{METHOD_NOT_FOUND, "Method " + req.Method + " not found."}
+		return res
+	}
+
+	result, err := method(req.Params)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	res.Result = result
+	return res
+}
+
+func writeResponse(w http.ResponseWriter, res response) {
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Printf("Writing JSON-RPC response failed: %v\n", err)
+	}
+}
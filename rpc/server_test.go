@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oigele/bazo-miner/logging"
+	"github.com/oigele/bazo-miner/protocol"
+	"github.com/oigele/bazo-miner/storage"
+)
+
+func TestMain(m *testing.M) {
+	logging.SetOutput(ioutil.Discard)
+	logger = logging.New("rpc")
+	storage.InitWithBackend(storage.NewMemoryBackend(), "127.0.0.1:8000")
+	m.Run()
+}
+
+func doRequest(t *testing.T, method string, body string) response {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handleRequest(rec, req)
+
+	var res response
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("Could not decode response: %v\n", err)
+	}
+
+	return res
+}
+
+func TestHandleRequestErrors(t *testing.T) {
+	res := doRequest(t, http.MethodGet, "")
+	if res.Error == nil || res.Error.Code != INVALID_REQUEST {
+		t.Errorf("GET request was not rejected: %v\n", res.Error)
+	}
+
+	res = doRequest(t, http.MethodPost, "{not json")
+	if res.Error == nil || res.Error.Code != PARSE_ERROR {
+		t.Errorf("Malformed request was not rejected: %v\n", res.Error)
+	}
+
+	res = doRequest(t, http.MethodPost, `{"jsonrpc":"1.0","method":"getLastBlock","id":1}`)
+	if res.Error == nil || res.Error.Code != INVALID_REQUEST {
+		t.Errorf("Wrong JSON-RPC version was not rejected: %v\n", res.Error)
+	}
+
+	res = doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"unknown","id":1}`)
+	if res.Error == nil || res.Error.Code != METHOD_NOT_FOUND {
+		t.Errorf("Unknown method was not rejected: %v\n", res.Error)
+	}
+
+	res = doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"getBlock","params":["abcd"],"id":1}`)
+	if res.Error == nil || res.Error.Code != INVALID_PARAMS {
+		t.Errorf("Short block hash was not rejected: %v\n", res.Error)
+	}
+
+	res = doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"getAccount","params":["zz"],"id":1}`)
+	if res.Error == nil || res.Error.Code != INVALID_PARAMS {
+		t.Errorf("Invalid hex was not rejected: %v\n", res.Error)
+	}
+
+	if string(res.ID) != "1" {
+		t.Errorf("Request ID not echoed: %s\n", res.ID)
+	}
+}
+
+func TestSendTransactionDisabled(t *testing.T) {
+	submitEnabled = false
+
+	res := doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"sendTransaction","params":["funds","00"],"id":2}`)
+	if res.Error == nil || res.Error.Code != SUBMIT_DISABLED {
+		t.Errorf("Transaction submission was not rejected on a read-only node: %v\n", res.Error)
+	}
+
+	submitEnabled = true
+	res = doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"sendTransaction","params":["unknown","00"],"id":2}`)
+	if res.Error == nil || res.Error.Code != INVALID_PARAMS {
+		t.Errorf("Unknown transaction type was not rejected: %v\n", res.Error)
+	}
+	submitEnabled = false
+}
+
+func TestResponseResult(t *testing.T) {
+	encoded, _ := json.Marshal(response{JSONRPC: JSONRPC_VERSION, ID: json.RawMessage("3")})
+	if !strings.Contains(string(encoded), `"result":null`) {
+		t.Errorf("Empty result left out of a successful response: %s\n", encoded)
+	}
+
+	encoded, _ = json.Marshal(response{JSONRPC: JSONRPC_VERSION, Error: &Error{NOT_FOUND, "not found"}, ID: json.RawMessage("3")})
+	if strings.Contains(string(encoded), `"result"`) {
+		t.Errorf("Result included in an error response: %s\n", encoded)
+	}
+}
+
+func TestSendTransactionUnverified(t *testing.T) {
+	submitEnabled = true
+	verifyTx = func(tx protocol.Transaction) bool { return false }
+	defer func() {
+		submitEnabled = false
+		verifyTx = nil
+	}()
+
+	tx := &protocol.FundsTx{Amount: 1, Fee: 1, TxCnt: 7}
+	body := `{"jsonrpc":"2.0","method":"sendTransaction","params":["funds","` + hex.EncodeToString(tx.Encode()) + `"],"id":4}`
+	res := doRequest(t, http.MethodPost, body)
+	if res.Error == nil || res.Error.Code != INVALID_TX {
+		t.Errorf("Unverified transaction was not rejected: %v\n", res.Error)
+	}
+	if storage.ReadOpenTx(tx.Hash()) != nil {
+		t.Error("Unverified transaction written to the mempool.\n")
+	}
+}
+
+func TestSendTransactionUndecodable(t *testing.T) {
+	submitEnabled = true
+	defer func() { submitEnabled = false }()
+
+	mempool := len(storage.ReadAllOpenTxs())
+	body := `{"jsonrpc":"2.0","method":"sendTransaction","params":["funds","deadbeef"],"id":5}`
+	res := doRequest(t, http.MethodPost, body)
+	if res.Error == nil || res.Error.Code != INVALID_PARAMS {
+		t.Errorf("Undecodable transaction was not rejected: %v\n", res.Error)
+	}
+	if len(storage.ReadAllOpenTxs()) != mempool {
+		t.Error("Undecodable transaction written to the mempool.\n")
+	}
+}
+
+func TestGetAccountFromSnapshot(t *testing.T) {
+	acc := protocol.NewAccount([64]byte{'a'}, [32]byte{}, 100, false, false, [256]byte{}, [256]byte{}, nil, nil)
+	hash := acc.Hash()
+	storage.State[hash] = &acc
+	defer delete(storage.State, hash)
+
+	//The account is only served once a block is closed with it
+	res := doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"getAccount","params":["`+hex.EncodeToString(hash[:])+`"],"id":5}`)
+	if res.Error == nil || res.Error.Code != NOT_FOUND {
+		t.Errorf("Account served before a block was closed with it: %v\n", res.Error)
+	}
+
+	block := protocol.NewBlock([32]byte{}, 1)
+	storage.WriteLastClosedBlock(block)
+	defer storage.DeleteAllLastClosedBlock()
+
+	//Changes after the block was closed are not visible
+	storage.State[hash].Balance = 0
+	res = doRequest(t, http.MethodPost, `{"jsonrpc":"2.0","method":"getAccount","params":["`+hex.EncodeToString(acc.Address[:])+`"],"id":5}`)
+	if res.Error != nil {
+		t.Fatalf("Account not served: %v\n", res.Error)
+	}
+	if view, ok := res.Result.(map[string]interface{}); !ok || view["balance"] != float64(100) {
+		t.Errorf("Account not served from the state of the last closed block: %v\n", res.Result)
+	}
+}
@@ -0,0 +1,194 @@
+package rpc
+
+import (
+	"encoding/hex"
+
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+//The protocol types contain plenty of fixed size byte arrays, which encoding/json would serialize as arrays of
+//numbers. The views below present the same data with hex encoded hashes and addresses.
+
+type blockView struct {
+	Hash            string   `json:"hash"`
+	PrevHash        string   `json:"prevHash"`
+	ShardID         int      `json:"shardId"`
+	Height          uint32   `json:"height"`
+	Timestamp       int64    `json:"timestamp"`
+	MerkleRoot      string   `json:"merkleRoot"`
+	Beneficiary     string   `json:"beneficiary"`
+	SlashedAddress  string   `json:"slashedAddress"`
+	AccTxData       []string `json:"accTxData"`
+	FundsTxData     []string `json:"fundsTxData"`
+	ConfigTxData    []string `json:"configTxData"`
+	StakeTxData     []string `json:"stakeTxData"`
+	CommitteeTxData []string `json:"committeeTxData"`
+	AggTxData       []string `json:"aggTxData"`
+	DataTxData      []string `json:"dataTxData"`
+	AggDataTxData   []string `json:"aggDataTxData"`
+	FineTxData      []string `json:"fineTxData"`
+}
+
+type epochBlockView struct {
+	Hash               string   `json:"hash"`
+	PrevShardHashes    []string `json:"prevShardHashes"`
+	Height             uint32   `json:"height"`
+	Timestamp          int64    `json:"timestamp"`
+	MerkleRoot         string   `json:"merkleRoot"`
+	MerklePatriciaRoot string   `json:"merklePatriciaRoot"`
+	CommitteeLeader    string   `json:"committeeLeader"`
+	Beneficiary        string   `json:"beneficiary"`
+	NofShards          int      `json:"nofShards"`
+	//Accounts created or changed since the previous epoch block
+	NofChangedAccounts int      `json:"nofChangedAccounts"`
+}
+
+type accountView struct {
+	Hash               string `json:"hash"`
+	Address            string `json:"address"`
+	Issuer             string `json:"issuer"`
+	Balance            uint64 `json:"balance"`
+	TxCnt              uint32 `json:"txCnt"`
+	IsStaking          bool   `json:"isStaking"`
+	IsCommittee        bool   `json:"isCommittee"`
+	StakingBlockHeight uint32 `json:"stakingBlockHeight"`
+	Contract           string `json:"contract,omitempty"`
+}
+
+type txView struct {
+	Hash     string `json:"hash"`
+	Type     string `json:"type"`
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Fee      uint64 `json:"fee"`
+	Amount   uint64 `json:"amount,omitempty"`
+	TxCnt    uint32 `json:"txCnt,omitempty"`
+	Encoded  string `json:"encoded"`
+}
+
+type mempoolView struct {
+	Open     []txView `json:"open"`
+	Assigned []txView `json:"assigned"`
+	Invalid  []txView `json:"invalid"`
+}
+
+type valShardMappingView struct {
+	EpochHeight int            `json:"epochHeight"`
+	ValMapping  map[string]int `json:"valMapping"`
+}
+
+func newBlockView(block *protocol.Block) blockView {
+	return blockView{
+		Hash:            hex.EncodeToString(block.Hash[:]),
+		PrevHash:        hex.EncodeToString(block.PrevHash[:]),
+		ShardID:         block.ShardId,
+		Height:          block.Height,
+		Timestamp:       block.Timestamp,
+		MerkleRoot:      hex.EncodeToString(block.MerkleRoot[:]),
+		Beneficiary:     hex.EncodeToString(block.Beneficiary[:]),
+		SlashedAddress:  hex.EncodeToString(block.SlashedAddress[:]),
+		AccTxData:       hashesToHex(block.AccTxData),
+		FundsTxData:     hashesToHex(block.FundsTxData),
+		ConfigTxData:    hashesToHex(block.ConfigTxData),
+		StakeTxData:     hashesToHex(block.StakeTxData),
+		CommitteeTxData: hashesToHex(block.CommitteeTxData),
+		AggTxData:       hashesToHex(block.AggTxData),
+		DataTxData:      hashesToHex(block.DataTxData),
+		AggDataTxData:   hashesToHex(block.AggDataTxData),
+		FineTxData:      hashesToHex(block.FineTxData),
+	}
+}
+
+func newEpochBlockView(epochBlock *protocol.EpochBlock) epochBlockView {
+	return epochBlockView{
+		Hash:               hex.EncodeToString(epochBlock.Hash[:]),
+		PrevShardHashes:    hashesToHex(epochBlock.PrevShardHashes),
+		Height:             epochBlock.Height,
+		Timestamp:          epochBlock.Timestamp,
+		MerkleRoot:         hex.EncodeToString(epochBlock.MerkleRoot[:]),
+		MerklePatriciaRoot: hex.EncodeToString(epochBlock.MerklePatriciaRoot[:]),
+		CommitteeLeader:    hex.EncodeToString(epochBlock.CommitteeLeader[:]),
+		Beneficiary:        hex.EncodeToString(epochBlock.Beneficiary[:]),
+		NofShards:          epochBlock.NofShards,
+		NofChangedAccounts: len(epochBlock.StateDelta),
+	}
+}
+
+func newAccountView(acc *protocol.Account) accountView {
+	hash := acc.Hash()
+	return accountView{
+		Hash:               hex.EncodeToString(hash[:]),
+		Address:            hex.EncodeToString(acc.Address[:]),
+		Issuer:             hex.EncodeToString(acc.Issuer[:]),
+		Balance:            acc.Balance,
+		TxCnt:              acc.TxCnt,
+		IsStaking:          acc.IsStaking,
+		IsCommittee:        acc.IsCommittee,
+		StakingBlockHeight: acc.StakingBlockHeight,
+		Contract:           hex.EncodeToString(acc.Contract),
+	}
+}
+
+func newTxView(tx protocol.Transaction) txView {
+	hash := tx.Hash()
+	sender := tx.Sender()
+	receiver := tx.Receiver()
+
+	view := txView{
+		Hash:     hex.EncodeToString(hash[:]),
+		Sender:   hex.EncodeToString(sender[:]),
+		Receiver: hex.EncodeToString(receiver[:]),
+		Fee:      tx.TxFee(),
+		Encoded:  hex.EncodeToString(tx.Encode()),
+	}
+
+	switch tx := tx.(type) {
+	case *protocol.FundsTx:
+		view.Type = "funds"
+		view.Amount = tx.Amount
+		view.TxCnt = tx.TxCnt
+	case *protocol.AccTx:
+		view.Type = "acc"
+	case *protocol.ConfigTx:
+		view.Type = "config"
+	case *protocol.StakeTx:
+		view.Type = "stake"
+	case *protocol.CommitteeTx:
+		view.Type = "committee"
+	case *protocol.AggTx:
+		view.Type = "agg"
+		view.Amount = tx.Amount
+	case *protocol.DataTx:
+		view.Type = "data"
+		view.TxCnt = tx.TxCnt
+	case *protocol.AggDataTx:
+		view.Type = "aggdata"
+	case *protocol.FineTx:
+		view.Type = "fine"
+		view.Amount = tx.Amount
+	}
+
+	return view
+}
+
+func newValShardMappingView(mapping *protocol.ValShardMapping) valShardMappingView {
+	view := valShardMappingView{
+		EpochHeight: mapping.EpochHeight,
+		ValMapping:  make(map[string]int),
+	}
+
+	for address, shardID := range mapping.ValMapping {
+		view.ValMapping[hex.EncodeToString(address[:])] = shardID
+	}
+
+	return view
+}
+
+func hashesToHex(hashes [][32]byte) []string {
+	hexHashes := make([]string, len(hashes))
+	for i, hash := range hashes {
+		hexHashes[i] = hex.EncodeToString(hash[:])
+	}
+
+	return hexHashes
+}
@@ -0,0 +1,47 @@
+package storage
+
+//The persistent part of the storage package (blocks, epoch blocks, closed transactions, ...) is a set of named
+//buckets of key/value pairs. Backend abstracts the key/value store that holds these buckets, such that the
+//Read*/Write*/Delete* functions don't depend on a specific database. The volatile part of the storage (state,
+//mempools, stashes) lives in package level maps and is independent of the backend.
+type Backend interface {
+	//Runs fn in a read-only transaction.
+	View(fn func(tx Tx) error) error
+	//Runs fn in a read-write transaction. If fn returns an error, all changes made in the transaction are discarded.
+	Update(fn func(tx Tx) error) error
+	Close() error
+}
+
+type Tx interface {
+	//Returns nil if the bucket does not exist.
+	Bucket(name string) Bucket
+	//Returns an error if the bucket already exists.
+	CreateBucket(name string) (Bucket, error)
+}
+
+//Slices returned by a bucket are only valid within the transaction they were read in.
+type Bucket interface {
+	//Returns nil if the key does not exist.
+	Get(key []byte) []byte
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	//Returns the first key/value pair in key order, nil if the bucket is empty.
+	First() (key []byte, value []byte)
+	//Iterates over all key/value pairs in key order. Deleting the current key within fn is allowed.
+	ForEach(fn func(key []byte, value []byte) error) error
+}
+
+//Backend names that can be given to Init instead of a database file.
+const (
+	MEMORY_BACKEND = ":memory:"
+)
+
+//Returns the in-memory backend for MEMORY_BACKEND and a BoltDB backend stored at dbname otherwise.
+func NewBackend(dbname string) (Backend, error) {
+	switch dbname {
+	case MEMORY_BACKEND:
+		return NewMemoryBackend(), nil
+	default:
+		return NewBoltBackend(dbname)
+	}
+}
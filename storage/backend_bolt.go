@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+type boltBackend struct {
+	db *bolt.DB
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+type boltBucket struct {
+	bucket *bolt.Bucket
+}
+
+//Opens (or creates) the BoltDB database file at dbname.
+func NewBoltBackend(dbname string) (Backend, error) {
+	db, err := bolt.Open(dbname, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltBackend{db}, nil
+}
+
+func (backend *boltBackend) View(fn func(tx Tx) error) error {
+	return backend.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (backend *boltBackend) Update(fn func(tx Tx) error) error {
+	return backend.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (backend *boltBackend) Close() error {
+	return backend.db.Close()
+}
+
+func (tx *boltTx) Bucket(name string) Bucket {
+	bucket := tx.tx.Bucket([]byte(name))
+	if bucket == nil {
+		return nil
+	}
+
+	return &boltBucket{bucket}
+}
+
+func (tx *boltTx) CreateBucket(name string) (Bucket, error) {
+	bucket, err := tx.tx.CreateBucket([]byte(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltBucket{bucket}, nil
+}
+
+func (b *boltBucket) Get(key []byte) []byte {
+	return b.bucket.Get(key)
+}
+
+func (b *boltBucket) Put(key []byte, value []byte) error {
+	return b.bucket.Put(key, value)
+}
+
+func (b *boltBucket) Delete(key []byte) error {
+	return b.bucket.Delete(key)
+}
+
+func (b *boltBucket) First() (key []byte, value []byte) {
+	return b.bucket.Cursor().First()
+}
+
+//Bolt's own ForEach must not be used while the bucket is modified, the keys are therefore collected first.
+func (b *boltBucket) ForEach(fn func(key []byte, value []byte) error) error {
+	var keys [][]byte
+	b.bucket.ForEach(func(k, v []byte) error {
+		keys = append(keys, append([]byte(nil), k...))
+		return nil
+	})
+
+	for _, key := range keys {
+		if value := b.bucket.Get(key); value != nil {
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
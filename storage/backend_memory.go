@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//The in-memory backend keeps all buckets in maps and is lost when the process exits. It is meant for tests and
+//short-lived simulation nodes that should not touch the disk.
+type memoryBackend struct {
+	buckets map[string]map[string][]byte
+	mutex   sync.RWMutex
+}
+
+type memoryTx struct {
+	backend  *memoryBackend
+	writable bool
+	//Undo log of a read-write transaction, replayed backwards if the transaction fails.
+	undo []func()
+}
+
+type memoryBucket struct {
+	tx     *memoryTx
+	name   string
+	values map[string][]byte
+}
+
+func NewMemoryBackend() Backend {
+	return &memoryBackend{buckets: make(map[string]map[string][]byte)}
+}
+
+func (backend *memoryBackend) View(fn func(tx Tx) error) error {
+	backend.mutex.RLock()
+	defer backend.mutex.RUnlock()
+
+	return fn(&memoryTx{backend: backend})
+}
+
+func (backend *memoryBackend) Update(fn func(tx Tx) error) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	tx := &memoryTx{backend: backend, writable: true}
+	err := fn(tx)
+	if err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+	}
+
+	return err
+}
+
+func (backend *memoryBackend) Close() error {
+	return nil
+}
+
+func (tx *memoryTx) Bucket(name string) Bucket {
+	values, exists := tx.backend.buckets[name]
+	if !exists {
+		return nil
+	}
+
+	return &memoryBucket{tx, name, values}
+}
+
+func (tx *memoryTx) CreateBucket(name string) (Bucket, error) {
+	if !tx.writable {
+		return nil, errors.New("Transaction not writable.")
+	}
+	if _, exists := tx.backend.buckets[name]; exists {
+		return nil, errors.New(fmt.Sprintf("Bucket %v already exists.", name))
+	}
+
+	values := make(map[string][]byte)
+	tx.backend.buckets[name] = values
+	tx.undo = append(tx.undo, func() {
+		delete(tx.backend.buckets, name)
+	})
+
+	return &memoryBucket{tx, name, values}, nil
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	return b.values[string(key)]
+}
+
+func (b *memoryBucket) Put(key []byte, value []byte) error {
+	if !b.tx.writable {
+		return errors.New("Transaction not writable.")
+	}
+	if len(key) == 0 {
+		return errors.New("Key required.")
+	}
+
+	//The caller may reuse the value after the transaction, it is therefore copied.
+	b.set(string(key), append([]byte{}, value...))
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errors.New("Transaction not writable.")
+	}
+
+	b.set(string(key), nil)
+	return nil
+}
+
+func (b *memoryBucket) First() (key []byte, value []byte) {
+	keys := b.sortedKeys()
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	return []byte(keys[0]), b.values[keys[0]]
+}
+
+func (b *memoryBucket) ForEach(fn func(key []byte, value []byte) error) error {
+	for _, key := range b.sortedKeys() {
+		value, exists := b.values[key]
+		if !exists {
+			continue
+		}
+		if err := fn([]byte(key), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Sets or (with a nil value) deletes the key and records how to revert it.
+func (b *memoryBucket) set(key string, value []byte) {
+	oldValue, existed := b.values[key]
+	b.tx.undo = append(b.tx.undo, func() {
+		if existed {
+			b.values[key] = oldValue
+		} else {
+			delete(b.values, key)
+		}
+	})
+
+	if value == nil {
+		delete(b.values, key)
+	} else {
+		b.values[key] = value
+	}
+}
+
+func (b *memoryBucket) sortedKeys() []string {
+	keys := make([]string, 0, len(b.values))
+	for key := range b.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+const TestBackendDBFileName = "testbackend.db"
+
+//Both backends have to behave the same, they are therefore tested with the same function
+func TestBackends(t *testing.T) {
+	memoryBackend := NewMemoryBackend()
+	testBackend(t, memoryBackend)
+	memoryBackend.Close()
+
+	boltBackend, err := NewBoltBackend(TestBackendDBFileName)
+	if err != nil {
+		t.Fatalf("Could not open bolt backend: %v\n", err)
+	}
+	defer os.Remove(TestBackendDBFileName)
+	testBackend(t, boltBackend)
+	boltBackend.Close()
+}
+
+func testBackend(t *testing.T, backend Backend) {
+	err := backend.Update(func(tx Tx) error {
+		_, err := tx.CreateBucket("test")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Could not create bucket: %v\n", err)
+	}
+
+	err = backend.Update(func(tx Tx) error {
+		_, err := tx.CreateBucket("test")
+		return err
+	})
+	if err == nil {
+		t.Error("Existing bucket created twice.\n")
+	}
+
+	backend.View(func(tx Tx) error {
+		if tx.Bucket("missing") != nil {
+			t.Error("Missing bucket returned.\n")
+		}
+		if key, value := tx.Bucket("test").First(); key != nil || value != nil {
+			t.Errorf("Empty bucket returned a first element: %x, %x\n", key, value)
+		}
+		return nil
+	})
+
+	backend.Update(func(tx Tx) error {
+		b := tx.Bucket("test")
+		b.Put([]byte("c"), []byte("3"))
+		b.Put([]byte("a"), []byte("1"))
+		b.Put([]byte("b"), []byte("2"))
+		return nil
+	})
+
+	//A failing transaction must not change the bucket
+	err = backend.Update(func(tx Tx) error {
+		b := tx.Bucket("test")
+		b.Put([]byte("a"), []byte("10"))
+		b.Delete([]byte("b"))
+		b.Put([]byte("d"), []byte("4"))
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Error("Error of the transaction not returned.\n")
+	}
+
+	backend.View(func(tx Tx) error {
+		b := tx.Bucket("test")
+		if value := b.Get([]byte("a")); !bytes.Equal(value, []byte("1")) {
+			t.Errorf("Wrong value after rollback: %s\n", value)
+		}
+		if value := b.Get([]byte("d")); value != nil {
+			t.Errorf("Value of a failed transaction stored: %s\n", value)
+		}
+		if key, value := b.First(); !bytes.Equal(key, []byte("a")) || !bytes.Equal(value, []byte("1")) {
+			t.Errorf("Wrong first element: %s, %s\n", key, value)
+		}
+
+		var keys []byte
+		b.ForEach(func(k, v []byte) error {
+			keys = append(keys, k...)
+			return nil
+		})
+		if string(keys) != "abc" {
+			t.Errorf("Keys not iterated in order: %s\n", keys)
+		}
+		return nil
+	})
+
+	//Deleting all elements while iterating, like DeleteAll does
+	backend.Update(func(tx Tx) error {
+		b := tx.Bucket("test")
+		return b.ForEach(func(k, v []byte) error {
+			return b.Delete(k)
+		})
+	})
+
+	backend.View(func(tx Tx) error {
+		if key, _ := tx.Bucket("test").First(); key != nil {
+			t.Errorf("Bucket not empty after deleting all elements: %s\n", key)
+		}
+		return nil
+	})
+}
+
+func TestInitMemoryBackend(t *testing.T) {
+	backend := db
+	defer func() { db = backend }()
+
+	InitWithBackend(NewMemoryBackend(), TestIpPort)
+
+	block := protocol.NewBlock([32]byte{}, 1)
+	block.Hash = [32]byte{'b'}
+	WriteClosedBlock(block)
+	WriteLastClosedBlock(block)
+
+	if readBlock := ReadClosedBlock(block.Hash); readBlock == nil || readBlock.Hash != block.Hash {
+		t.Errorf("Block not stored in the memory backend: %v\n", readBlock)
+	}
+	if lastBlock := ReadLastClosedBlock(); lastBlock == nil || lastBlock.Hash != block.Hash {
+		t.Errorf("Last closed block not stored in the memory backend: %v\n", lastBlock)
+	}
+
+	DeleteAll()
+	if readBlock := ReadClosedBlock(block.Hash); readBlock != nil {
+		t.Errorf("Block not deleted from the memory backend: %v\n", readBlock)
+	}
+}
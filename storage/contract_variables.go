@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+//A contract call may change the variables of the called contract and of the external contracts it calls. To revert
+//the call on rollback, the variables of all changed contracts before the call are written to the contract variables
+//bucket, keyed by the hash of the funds transaction. They are kept across restarts until the call is rolled back or
+//its block can't be rolled back anymore, which is the case once the state of the next epoch block is taken over.
+const (
+	CONTRACTVARIABLES_BUCKET = "contractvariables"
+)
+
+type contractVariablesBeforeTx struct {
+	Variables map[[32]byte][]protocol.ByteArray
+}
+
+func encodeContractVariables(variables map[[32]byte][]protocol.ByteArray) []byte {
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(contractVariablesBeforeTx{variables})
+	return buffer.Bytes()
+}
+
+func decodeContractVariables(encoded []byte) (variables map[[32]byte][]protocol.ByteArray, exists bool) {
+	if encoded == nil {
+		return nil, false
+	}
+
+	var decoded contractVariablesBeforeTx
+	if err := gob.NewDecoder(bytes.NewBuffer(encoded)).Decode(&decoded); err != nil {
+		return nil, false
+	}
+
+	if decoded.Variables == nil {
+		decoded.Variables = make(map[[32]byte][]protocol.ByteArray)
+	}
+	return decoded.Variables, true
+}
+
+func WriteContractVariablesBeforeTx(txHash [32]byte, variables map[[32]byte][]protocol.ByteArray) error {
+	return db.Update(func(tx Tx) error {
+		return tx.Bucket(CONTRACTVARIABLES_BUCKET).Put(txHash[:], encodeContractVariables(variables))
+	})
+}
+
+func ReadContractVariablesBeforeTx(txHash [32]byte) (variables map[[32]byte][]protocol.ByteArray, exists bool) {
+	db.View(func(tx Tx) error {
+		variables, exists = decodeContractVariables(tx.Bucket(CONTRACTVARIABLES_BUCKET).Get(txHash[:]))
+		return nil
+	})
+
+	return variables, exists
+}
+
+func DeleteContractVariablesBeforeTx(txHash [32]byte) error {
+	return db.Update(func(tx Tx) error {
+		return tx.Bucket(CONTRACTVARIABLES_BUCKET).Delete(txHash[:])
+	})
+}
+
+//Called when the blocks of the last epoch can't be rolled back anymore.
+func DeleteAllContractVariablesBeforeTx() error {
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(CONTRACTVARIABLES_BUCKET)
+		return b.ForEach(func(k, v []byte) error {
+			return b.Delete(k)
+		})
+	})
+}
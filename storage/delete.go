@@ -1,71 +1,95 @@
 package storage
 
 import (
-	"github.com/boltdb/bolt"
+	"bytes"
 	"github.com/oigele/bazo-miner/protocol"
 )
 
 //There exist open/closed buckets and closed tx buckets for all types (open txs are in volatile storage)
 func DeleteOpenBlock(hash [32]byte) {
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("openblocks"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("openblocks")
 		err := b.Delete(hash[:])
 		return err
 	})
 }
 
 func DeleteClosedBlock(hash [32]byte) {
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblocks"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedblocks")
+		//The height index may already point to a block of another chain
+		var block *protocol.Block
+		if block = block.Decode(b.Get(hash[:])); block != nil {
+			index := tx.Bucket(BLOCKHEIGHTS_BUCKET)
+			key := blockHeightKey(block.ShardId, block.Height)
+			if bytes.Equal(index.Get(key), hash[:]) {
+				if err := index.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
 		err := b.Delete(hash[:])
 		return err
 	})
 }
 
+func DeleteBannedPeer(address string) error {
+	return db.Update(func(tx Tx) error {
+		return tx.Bucket(BANNEDPEERS_BUCKET).Delete([]byte(address))
+	})
+}
+
+func DeletePeerRecord(address string) error {
+	return db.Update(func(tx Tx) error {
+		return tx.Bucket(ADDRESSBOOK_BUCKET).Delete([]byte(address))
+	})
+}
+
 func DeleteClosedEpochBlock(hash [32]byte) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(CLOSEDEPOCHBLOCK_BUCKET))
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(CLOSEDEPOCHBLOCK_BUCKET)
 		return b.Delete(hash[:])
 	})
 }
 
 func DeleteOpenEpochBlock(hash [32]byte) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(OPENEPOCHBLOCK_BUCKET))
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(OPENEPOCHBLOCK_BUCKET)
 		return b.Delete(hash[:])
 	})
 }
 
 func DeleteClosedBlockWithoutTx(hash [32]byte) {
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblockswithouttx"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedblockswithouttx")
 		err := b.Delete(hash[:])
 		return err
 	})
 }
 
 func DeleteLastClosedBlock(hash [32]byte) {
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("lastclosedblock"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("lastclosedblock")
 		err := b.Delete(hash[:])
 		return err
 	})
 }
 
 func DeleteAllLastClosedBlock() {
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("lastclosedblock"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("lastclosedblock")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
-		return nil
+		//The state persisted with the last closed epoch block is kept, a restarted node falls back to it
+		return tx.Bucket(STATE_BUCKET).Delete([]byte(LASTCLOSEDBLOCK_STATE))
 	})
 }
 
 func DeleteAllLastClosedEpochBlock() error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(LASTCLOSEDEPOCHBLOCK_BUCKET))
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(LASTCLOSEDEPOCHBLOCK_BUCKET)
 		return b.ForEach(func(k, v []byte) error {
 			return b.Delete(k)
 		})
@@ -185,8 +209,8 @@ func DeleteClosedTx(transaction protocol.Transaction) {
 	}
 	
 	hash := transaction.Hash()
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket(bucket)
 		err := b.Delete(hash[:])
 		return err
 	})
@@ -212,68 +236,74 @@ func DeleteAll() {
 	}
 
 	//Delete disk-based storage
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("openblocks"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("openblocks")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblocks"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedblocks")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblockswithouttx"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedblockswithouttx")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedfunds"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedfunds")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedaccs"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedaccs")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedconfigs"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedconfigs")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedstakes"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedstakes")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("lastclosedblock"))
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket("lastclosedblock")
 		b.ForEach(func(k, v []byte) error {
 			b.Delete(k)
 			return nil
 		})
 		return nil
 	})
+	db.Update(func(tx Tx) error {
+		b := tx.Bucket(STATE_BUCKET)
+		return b.ForEach(func(k, v []byte) error {
+			return b.Delete(k)
+		})
+	})
 }
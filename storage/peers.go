@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+)
+
+//Entry of the address book, which keeps the miners a node knew about across restarts. Times are unix timestamps.
+type PeerRecord struct {
+	Address string
+	//Last time the peer was connected or advertised by another peer
+	LastSeen int64
+	//Last time a connection to the peer was attempted
+	LastAttempt int64
+	Successes   uint32
+	Failures    uint32
+}
+
+const (
+	ADDRESSBOOK_BUCKET = "addressbook"
+)
+
+func (record *PeerRecord) Encode() []byte {
+	if record == nil {
+		return nil
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(record)
+	return buffer.Bytes()
+}
+
+func (*PeerRecord) Decode(encoded []byte) *PeerRecord {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded PeerRecord
+	buffer := bytes.NewBuffer(encoded)
+	if err := gob.NewDecoder(buffer).Decode(&decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+//Several bootstrap servers are given as a comma-separated list. The first one creates the genesis block.
+func parseBootstrapServers(bootstrapIpport string) (servers []string) {
+	for _, server := range strings.Split(bootstrapIpport, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
@@ -1,10 +1,10 @@
 package storage
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/oigele/bazo-miner/protocol"
-	"github.com/boltdb/bolt"
 	"sort"
 )
 
@@ -12,8 +12,8 @@ import (
 func ReadOpenBlock(hash [32]byte) (block *protocol.Block) {
 
 	var encodedBlock []byte
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("openblocks"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("openblocks")
 		encodedBlock = b.Get(hash[:])
 		return nil
 	})
@@ -27,8 +27,8 @@ func ReadOpenBlock(hash [32]byte) (block *protocol.Block) {
 
 func ReadClosedBlock(hash [32]byte) (block *protocol.Block) {
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblocks"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedblocks")
 		encodedBlock := b.Get(hash[:])
 		block = block.Decode(encodedBlock)
 		return nil
@@ -41,10 +41,30 @@ func ReadClosedBlock(hash [32]byte) (block *protocol.Block) {
 	return block
 }
 
+//Returns the closed blocks of the shard in the given height range in height order. Heights of epoch blocks have no
+//shard block and are skipped.
+func ReadClosedBlocksByRange(shardID int, from uint32, count uint32) (blocks []*protocol.Block) {
+	db.View(func(tx Tx) error {
+		index := tx.Bucket(BLOCKHEIGHTS_BUCKET)
+		b := tx.Bucket("closedblocks")
+		for height := from; height-from < count; height++ {
+			var block *protocol.Block
+			if hash := index.Get(blockHeightKey(shardID, height)); hash != nil {
+				if block = block.Decode(b.Get(hash)); block != nil {
+					blocks = append(blocks, block)
+				}
+			}
+		}
+		return nil
+	})
+
+	return blocks
+}
+
 func ReadOpenEpochBlock(hash [32]byte) (epochBlock *protocol.EpochBlock) {
 	var encodedEpochBlock []byte
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(OPENEPOCHBLOCK_BUCKET))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket(OPENEPOCHBLOCK_BUCKET)
 		encodedEpochBlock = b.Get(hash[:])
 		return nil
 	})
@@ -57,8 +77,8 @@ func ReadOpenEpochBlock(hash [32]byte) (epochBlock *protocol.EpochBlock) {
 }
 
 func ReadClosedEpochBlock(hash [32]byte) (epochBlock *protocol.EpochBlock) {
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(CLOSEDEPOCHBLOCK_BUCKET))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket(CLOSEDEPOCHBLOCK_BUCKET)
 		encodedBlock := b.Get(hash[:])
 		epochBlock = epochBlock.Decode(encodedBlock)
 		return nil
@@ -74,8 +94,8 @@ func ReadClosedEpochBlock(hash [32]byte) (epochBlock *protocol.EpochBlock) {
 //This function does read all blocks without transactions inside.
 func ReadClosedBlockWithoutTx(hash [32]byte) (block *protocol.Block) {
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblockswithouttx"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedblockswithouttx")
 		encodedBlock := b.Get(hash[:])
 		block = block.Decode(encodedBlock)
 		return nil
@@ -90,10 +110,9 @@ func ReadClosedBlockWithoutTx(hash [32]byte) (block *protocol.Block) {
 
 func ReadLastClosedBlock() (block *protocol.Block) {
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("lastclosedblock"))
-		cb := b.Cursor()
-		_, encodedBlock := cb.First()
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("lastclosedblock")
+		_, encodedBlock := b.First()
 		block = block.Decode(encodedBlock)
 		return nil
 	})
@@ -111,8 +130,8 @@ func ReadAllClosedBlocksWithTransactions() (allClosedBlocks []*protocol.Block) {
 	//They are not ordered at teh request, but this does actually not matter. Because it will be ordered below
 	block := ReadLastClosedBlock()
 	if  block != nil {
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("closedblocks"))
+		db.View(func(tx Tx) error {
+			b := tx.Bucket("closedblocks")
 			b.ForEach(func(k, v []byte) error {
 				if v != nil {
 					encodedBlock := v
@@ -134,8 +153,8 @@ func ReadAllClosedBlocksWithTransactions() (allClosedBlocks []*protocol.Block) {
 func ReadAllClosedFundsAndAggTransactions() (allClosedTransactions []protocol.Transaction) {
 
 	var fundsTx protocol.FundsTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedfunds"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedfunds")
 		b.ForEach(func(k, v []byte) error {
 			if v != nil {
 				encodedFundsTx := v
@@ -147,8 +166,8 @@ func ReadAllClosedFundsAndAggTransactions() (allClosedTransactions []protocol.Tr
 	})
 
 	var aggTx protocol.AggTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedaggregations"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedaggregations")
 		b.ForEach(func(k, v []byte) error {
 			if v != nil {
 				encodedAggTx := v
@@ -171,8 +190,8 @@ func ReadAllClosedBlocks() (allClosedBlocks []*protocol.Block) {
 	//They are not ordered at teh request, but this does actually not matter. Because it will be ordered below
 	block := ReadLastClosedBlock()
 	if  block != nil {
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("closedblocks"))
+		db.View(func(tx Tx) error {
+			b := tx.Bucket("closedblocks")
 			b.ForEach(func(k, v []byte) error {
 				if v != nil {
 					encodedBlock := v
@@ -182,7 +201,7 @@ func ReadAllClosedBlocks() (allClosedBlocks []*protocol.Block) {
 				return nil
 			})
 
-			b = tx.Bucket([]byte("closedblockswithouttx"))
+			b = tx.Bucket("closedblockswithouttx")
 			b.ForEach(func(k, v []byte) error {
 				if v != nil {
 					encodedBlock := v
@@ -298,8 +317,8 @@ func ReadAccount(pubKey [64]byte) (acc *protocol.Account, err error) {
 }
 
 func ReadGenesis() (genesis *protocol.Genesis, err error) {
-	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(GENESIS_BUCKET))
+	err = db.View(func(tx Tx) error {
+		b := tx.Bucket(GENESIS_BUCKET)
 		encoded := b.Get([]byte("genesis"))
 		genesis = genesis.Decode(encoded)
 		return nil
@@ -308,8 +327,8 @@ func ReadGenesis() (genesis *protocol.Genesis, err error) {
 }
 
 func ReadFirstEpochBlock() (firstEpochBlock *protocol.EpochBlock, err error) {
-	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(CLOSEDEPOCHBLOCK_BUCKET))
+	err = db.View(func(tx Tx) error {
+		b := tx.Bucket(CLOSEDEPOCHBLOCK_BUCKET)
 		encoded := b.Get([]byte("firstepochblock"))
 		firstEpochBlock = firstEpochBlock.Decode(encoded)
 		return nil
@@ -317,10 +336,9 @@ func ReadFirstEpochBlock() (firstEpochBlock *protocol.EpochBlock, err error) {
 	return firstEpochBlock, err
 }
 func ReadLastClosedEpochBlock() (epochBlock *protocol.EpochBlock) {
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(LASTCLOSEDEPOCHBLOCK_BUCKET))
-		cb := b.Cursor()
-		_, encodedBlock := cb.First()
+	db.View(func(tx Tx) error {
+		b := tx.Bucket(LASTCLOSEDEPOCHBLOCK_BUCKET)
+		_, encodedBlock := b.First()
 		epochBlock = epochBlock.Decode(encodedBlock)
 		return nil
 	})
@@ -332,6 +350,54 @@ func ReadLastClosedEpochBlock() (epochBlock *protocol.EpochBlock) {
 	return epochBlock
 }
 
+//Returns the state persisted with the last closed block, nil if there is none.
+func ReadLastClosedBlockState() (persisted *PersistedState) {
+	return readPersistedState(LASTCLOSEDBLOCK_STATE)
+}
+
+//Returns the state persisted with the last closed epoch block, nil if there is none.
+func ReadLastClosedEpochBlockState() (persisted *PersistedState) {
+	return readPersistedState(LASTCLOSEDEPOCHBLOCK_STATE)
+}
+
+//Returns the banned peers and the unix time their ban expires.
+func ReadBannedPeers() (bans map[string]int64) {
+	bans = make(map[string]int64)
+	db.View(func(tx Tx) error {
+		return tx.Bucket(BANNEDPEERS_BUCKET).ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				bans[string(k)] = int64(binary.BigEndian.Uint64(v))
+			}
+			return nil
+		})
+	})
+
+	return bans
+}
+
+func ReadPeerRecords() (records []*PeerRecord) {
+	db.View(func(tx Tx) error {
+		return tx.Bucket(ADDRESSBOOK_BUCKET).ForEach(func(k, v []byte) error {
+			var record *PeerRecord
+			if record = record.Decode(v); record != nil {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+
+	return records
+}
+
+func readPersistedState(key string) (persisted *PersistedState) {
+	db.View(func(tx Tx) error {
+		b := tx.Bucket(STATE_BUCKET)
+		persisted = persisted.Decode(b.Get([]byte(key)))
+		return nil
+	})
+
+	return persisted
+}
 
 func GetMemPoolSize() int {
 	memPoolMutex.Lock()
@@ -339,6 +405,18 @@ func GetMemPoolSize() int {
 	return len(txMemPool)
 }
 
+func GetAssignedMemPoolSize() int {
+	assignedTransactionMutex.Lock()
+	defer assignedTransactionMutex.Unlock()
+	return len(AssignedTxMempool)
+}
+
+func GetINVALIDMemPoolSize() int {
+	openINVALIDTxMutex.Lock()
+	defer openINVALIDTxMutex.Unlock()
+	return len(txINVALIDMemPool)
+}
+
 //Needed for the miner to prepare a new block
 func ReadAllOpenTxs() (allOpenTxs []protocol.Transaction) {
 	openTxMutex.Lock()
@@ -354,8 +432,8 @@ func ReadAllOpenTxs() (allOpenTxs []protocol.Transaction) {
 func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	var encodedTx []byte
 	var fundstx *protocol.FundsTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedfunds"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedfunds")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -364,8 +442,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var acctx *protocol.AccTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedaccs"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedaccs")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -374,8 +452,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var configtx *protocol.ConfigTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedconfigs"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedconfigs")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -384,8 +462,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var staketx *protocol.StakeTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedstakes"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedstakes")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -393,8 +471,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 		return staketx.Decode(encodedTx)
 	}
 	var committeetx *protocol.CommitteeTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedcommittees"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedcommittees")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -403,8 +481,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var aggTx *protocol.AggTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedaggregations"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedaggregations")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -413,8 +491,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var dataTx *protocol.DataTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closeddata"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closeddata")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -423,8 +501,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var aggDataTx *protocol.AggDataTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedaggdata"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedaggdata")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -433,8 +511,8 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	}
 
 	var fineTx *protocol.FineTx
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedfines"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("closedfines")
 		encodedTx = b.Get(hash[:])
 		return nil
 	})
@@ -460,8 +538,8 @@ func ReadAllDataSummary() []*protocol.DataSummary {
 	var dataSummarySlice []*protocol.DataSummary
 	var dataSummary *protocol.DataSummary
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("datasummary"))
+	db.View(func(tx Tx) error {
+		b := tx.Bucket("datasummary")
 		b.ForEach(func(k, v []byte) error {
 			if v != nil {
 				encodedDataSummary := v
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+//The receipts bucket keeps the stage of every cross-shard transfer the node has seen, keyed by the hash of the funds
+//transaction, such that clients can track their transfers across the epoch boundary.
+const (
+	RECEIPTS_BUCKET = "receipts"
+)
+
+//Writes the status unless the transfer is already known at a later stage. Blocks and epoch blocks may be validated
+//out of order, but a transfer is never reported a stage back.
+func WriteReceiptStatus(status *protocol.ReceiptStatus) error {
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(RECEIPTS_BUCKET)
+		var stored *protocol.ReceiptStatus
+		if stored = stored.Decode(b.Get(status.Receipt.TxHash[:])); stored != nil && stored.Status > status.Status {
+			return nil
+		}
+		return b.Put(status.Receipt.TxHash[:], status.Encode())
+	})
+}
+
+func ReadReceiptStatus(txHash [32]byte) (status *protocol.ReceiptStatus) {
+	db.View(func(tx Tx) error {
+		status = status.Decode(tx.Bucket(RECEIPTS_BUCKET).Get(txHash[:]))
+		return nil
+	})
+
+	return status
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/oigele/bazo-miner/crypto"
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+//Snapshot holds everything a node needs to start from the last closed epoch block without replaying the chain from
+//its peers. It is written to a file by "bazo-miner snapshot export" and loaded into an empty database with
+//"bazo-miner snapshot import". The epoch block doesn't commit to the data summaries, they can't be verified and are
+//therefore not part of a snapshot.
+type Snapshot struct {
+	Magic           string
+	Version         uint8
+	Genesis         *protocol.Genesis
+	FirstEpochBlock *protocol.EpochBlock
+	EpochBlock      *protocol.EpochBlock
+	State           map[[32]byte]*protocol.Account
+	ValShardMapping *protocol.ValShardMapping
+}
+
+const (
+	SNAPSHOT_MAGIC   = "bazo-snapshot"
+	SNAPSHOT_VERSION = 2
+)
+
+//Collects the snapshot of the last closed epoch block from the database.
+func NewSnapshot() (*Snapshot, error) {
+	genesis, err := ReadGenesis()
+	if err != nil {
+		return nil, err
+	}
+
+	firstEpochBlock, err := ReadFirstEpochBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	epochBlock := ReadLastClosedEpochBlock()
+	if epochBlock == nil {
+		return nil, errors.New("No closed epoch block in the database.")
+	}
+
+	snapshot := &Snapshot{
+		Magic:           SNAPSHOT_MAGIC,
+		Version:         SNAPSHOT_VERSION,
+		Genesis:         genesis,
+		FirstEpochBlock: firstEpochBlock,
+		EpochBlock:      epochBlock,
+		ValShardMapping: epochBlock.ValMapping,
+	}
+
+	//Epoch blocks don't carry the state, it is persisted with them
+	if persisted := ReadLastClosedEpochBlockState(); persisted != nil && persisted.BlockHash == epochBlock.Hash {
+		snapshot.State = persisted.State
+	}
+
+	if err := snapshot.Verify(epochBlock.Hash); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+//Checks that the snapshot belongs to the epoch block with the given hash. Nothing but that hash is trusted: the epoch
+//block has to hash to it, the state has to match its state root, the validator mapping has to be the one the committee
+//endorsed with it and the genesis has to be the one the first epoch block links to and its accounts have to be in the
+//state.
+func (snapshot *Snapshot) Verify(epochBlockHash [32]byte) error {
+	if snapshot.Magic != SNAPSHOT_MAGIC {
+		return errors.New("Not a snapshot file.")
+	}
+
+	if snapshot.Version != SNAPSHOT_VERSION {
+		return errors.New(fmt.Sprintf("Snapshot version %v not supported, expected %v.", snapshot.Version, SNAPSHOT_VERSION))
+	}
+
+	if snapshot.Genesis == nil || snapshot.FirstEpochBlock == nil || snapshot.EpochBlock == nil {
+		return errors.New("Snapshot is missing the genesis, the first epoch block or the epoch block.")
+	}
+
+	epochBlock := snapshot.EpochBlock
+	if epochBlock.Hash != epochBlockHash {
+		return errors.New(fmt.Sprintf("Snapshot is of epoch block %x, expected %x.", epochBlock.Hash[0:8], epochBlockHash[0:8]))
+	}
+
+	if hash := epochBlock.HashEpochBlockHeader(); hash != epochBlock.Hash {
+		return errors.New(fmt.Sprintf("Epoch block of the snapshot hashes to %x, not to %x.", hash[0:8], epochBlock.Hash[0:8]))
+	}
+
+	if root := protocol.StateRoot(snapshot.State); root != epochBlock.MerklePatriciaRoot {
+		return errors.New(fmt.Sprintf("State of the snapshot has root %x, epoch block %x.", root[0:8], epochBlock.MerklePatriciaRoot[0:8]))
+	}
+
+	if err := snapshot.verifyGenesis(); err != nil {
+		return err
+	}
+
+	return snapshot.verifyValShardMapping()
+}
+
+//The first epoch block is chained to the genesis and hashed like any other epoch block. The snapshot does not carry
+//the epochs in between, but the accounts the genesis creates have to be in the verified state.
+func (snapshot *Snapshot) verifyGenesis() error {
+	first := snapshot.FirstEpochBlock
+	if first.Height != 0 || first.HashEpochBlockHeader() != first.Hash {
+		return errors.New(fmt.Sprintf("First epoch block of the snapshot (%x) is invalid.", first.Hash[0:8]))
+	}
+
+	genesisHash := snapshot.Genesis.Hash()
+	if len(first.PrevShardHashes) != 1 || first.PrevShardHashes[0] != genesisHash {
+		return errors.New(fmt.Sprintf("First epoch block of the snapshot is not chained to the genesis %x.", genesisHash[0:8]))
+	}
+
+	if _, exists := snapshot.State[protocol.SerializeHashContent(snapshot.Genesis.RootAddress)]; !exists {
+		return errors.New("Root account of the genesis is not in the state of the snapshot.")
+	}
+	if _, exists := snapshot.State[protocol.SerializeHashContent(snapshot.Genesis.FirstCommitteeAddress)]; !exists {
+		return errors.New("First committee account of the genesis is not in the state of the snapshot.")
+	}
+
+	return nil
+}
+
+//The validator mapping is not covered by the hash of the epoch block, only by the hash the committee endorses. The
+//certificate of the epoch block is therefore checked against the committee members of the verified state.
+func (snapshot *Snapshot) verifyValShardMapping() error {
+	epochBlock := snapshot.EpochBlock
+	if snapshot.ValShardMapping == nil || epochBlock.ValMapping == nil ||
+		snapshot.ValShardMapping.HashMapping() != epochBlock.ValMapping.HashMapping() {
+		return errors.New("Validator shard mapping of the snapshot is not the one of the epoch block.")
+	}
+
+	certificate := epochBlock.Certificate
+	if certificate == nil {
+		return errors.New(fmt.Sprintf("Epoch block %x of the snapshot is not endorsed by the committee.", epochBlock.Hash[0:8]))
+	}
+
+	hash := epochBlock.HashEpochBlock()
+	if certificate.Kind != protocol.ENDORSE_EPOCH_BLOCK || certificate.Height != epochBlock.Height || certificate.ShardID != 0 || certificate.EndorsedHash != hash {
+		return errors.New(fmt.Sprintf("Certificate of the snapshot certifies %x, not the epoch block %x.", certificate.EndorsedHash[0:8], hash[0:8]))
+	}
+
+	members := 0
+	for _, acc := range snapshot.State {
+		if acc.IsCommittee {
+			members++
+		}
+	}
+
+	signers := make(map[[32]byte]bool)
+	for _, endorsement := range certificate.Endorsements {
+		if endorsement.Kind != certificate.Kind || endorsement.Height != certificate.Height || endorsement.ShardID != certificate.ShardID || endorsement.EndorsedHash != certificate.EndorsedHash {
+			return errors.New(fmt.Sprintf("Certificate of the snapshot contains an endorsement of something else: %v", endorsement))
+		}
+
+		acc, exists := snapshot.State[endorsement.Member]
+		if !exists || !acc.IsCommittee || signers[endorsement.Member] {
+			continue
+		}
+
+		committeePubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitteeKey)
+		if err != nil {
+			continue
+		}
+		if err := crypto.VerifyMessageWithRSAKey(committeePubKey, endorsement.Message(), endorsement.Signature); err != nil {
+			return errors.New(fmt.Sprintf("Certificate of the snapshot contains an invalid endorsement of %x.", endorsement.Member[0:8]))
+		}
+		signers[endorsement.Member] = true
+	}
+
+	//Same quorum of 2n/3+1 as the miner requires
+	if members == 0 || len(signers) < 2*members/3+1 {
+		return errors.New(fmt.Sprintf("Certificate of the snapshot has %d endorsements, but %d of %d committee members are needed.", len(signers), 2*members/3+1, members))
+	}
+
+	return nil
+}
+
+func (snapshot *Snapshot) Write(writer io.Writer) error {
+	return gob.NewEncoder(writer).Encode(snapshot)
+}
+
+//Reads a snapshot and verifies it against the given epoch block hash.
+func ReadSnapshot(reader io.Reader, epochBlockHash [32]byte) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := gob.NewDecoder(reader).Decode(&snapshot); err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not decode snapshot: %v", err))
+	}
+
+	if err := snapshot.Verify(epochBlockHash); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+//Writes the snapshot to the database in a single transaction. The node then starts from the snapshot's epoch block
+//like from an epoch block it closed itself, in the shard the validator mapping assigns to ValidatorAccAddress. A
+//database of another chain is not overwritten.
+func (snapshot *Snapshot) Import() error {
+	if genesis, err := ReadGenesis(); err == nil && genesis != nil && genesis.Hash() != snapshot.Genesis.Hash() {
+		return errors.New("Database belongs to another genesis than the snapshot.")
+	}
+
+	epochBlock := snapshot.EpochBlock
+	//The shard is the one the verified validator mapping assigns to the validator of this node
+	persisted := &PersistedState{
+		BlockHash:       epochBlock.Hash,
+		State:           snapshot.State,
+		RelativeState:   make(map[[32]byte]*protocol.RelativeAccount),
+		ThisShardID:     snapshot.ValShardMapping.ValMapping[ValidatorAccAddress],
+		ValShardMapping: snapshot.ValShardMapping,
+	}
+
+	return db.Update(func(tx Tx) error {
+		if err := tx.Bucket(GENESIS_BUCKET).Put([]byte("genesis"), snapshot.Genesis.Encode()); err != nil {
+			return err
+		}
+
+		b := tx.Bucket(CLOSEDEPOCHBLOCK_BUCKET)
+		if snapshot.FirstEpochBlock != nil {
+			if err := b.Put([]byte("firstepochblock"), snapshot.FirstEpochBlock.Encode()); err != nil {
+				return err
+			}
+		}
+		if err := b.Put(epochBlock.Hash[:], epochBlock.Encode()); err != nil {
+			return err
+		}
+
+		b = tx.Bucket(LASTCLOSEDEPOCHBLOCK_BUCKET)
+		if err := b.ForEach(func(k, v []byte) error {
+			return b.Delete(k)
+		}); err != nil {
+			return err
+		}
+		if err := b.Put(epochBlock.Hash[:], epochBlock.Encode()); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(STATE_BUCKET).Put([]byte(LASTCLOSEDEPOCHBLOCK_STATE), persisted.Encode()); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
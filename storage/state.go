@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+
+	"github.com/oigele/bazo-miner/protocol"
+)
+
+//State and sharding metadata are kept in memory while the node runs. To be able to restart from local disk without
+//asking peers, a copy is written to the state bucket in the same transaction as the last closed block and the last
+//closed epoch block. The copy is not incremental: the whole state is gob encoded and rewritten with every block, so
+//closing a block costs time and disk writes in the size of the state rather than of the block.
+type PersistedState struct {
+	//Hash of the (epoch) block the state was persisted with.
+	BlockHash       [32]byte
+	State           map[[32]byte]*protocol.Account
+	RelativeState   map[[32]byte]*protocol.RelativeAccount
+	//Receipts of the last closed block, they are sent along with its state transition.
+	OutboundReceipts []*protocol.Receipt
+	ThisShardID     int
+	ValShardMapping *protocol.ValShardMapping
+}
+
+//State and RootKeys are changed by the miner without locking. Goroutines serving other nodes or clients, e.g. the rpc
+//server, read a copy instead that is published whenever a block or an epoch block is closed. A published copy is never
+//changed, it is replaced by the next one.
+var (
+	stateSnapshot      = make(map[[32]byte]*protocol.Account)
+	rootKeysSnapshot   = make(map[[32]byte]*protocol.Account)
+	stateSnapshotMutex = &sync.RWMutex{}
+)
+
+const (
+	STATE_BUCKET               = "state"
+	LASTCLOSEDBLOCK_STATE      = "lastclosedblock"
+	LASTCLOSEDEPOCHBLOCK_STATE = "lastclosedepochblock"
+)
+
+//The state after the last closed block is the state currently held in memory.
+func newBlockPersistedState(block *protocol.Block) *PersistedState {
+	return &PersistedState{
+		BlockHash:       block.Hash,
+		State:           State,
+		RelativeState:   RelativeState,
+		OutboundReceipts: OutboundReceipts,
+		ThisShardID:     ThisShardID,
+		ValShardMapping: ValShardMapping,
+	}
+}
+
+//Epoch blocks are written before their state is taken over, the state and the validator assignment are therefore
+//those of the epoch block. Epoch blocks don't carry the state, it is passed along.
+func newEpochBlockPersistedState(epochBlock *protocol.EpochBlock, state map[[32]byte]*protocol.Account) *PersistedState {
+	persisted := &PersistedState{
+		BlockHash:       epochBlock.Hash,
+		State:           state,
+		RelativeState:   make(map[[32]byte]*protocol.RelativeAccount),
+		ThisShardID:     ThisShardID,
+		ValShardMapping: ValShardMapping,
+	}
+
+	if epochBlock.ValMapping != nil && len(epochBlock.ValMapping.ValMapping) > 0 {
+		persisted.ValShardMapping = epochBlock.ValMapping
+		persisted.ThisShardID = epochBlock.ValMapping.ValMapping[ValidatorAccAddress]
+	}
+
+	return persisted
+}
+
+func (persisted *PersistedState) Encode() []byte {
+	if persisted == nil {
+		return nil
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(persisted)
+	return buffer.Bytes()
+}
+
+func (*PersistedState) Decode(encoded []byte) *PersistedState {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded PersistedState
+	buffer := bytes.NewBuffer(encoded)
+	if err := gob.NewDecoder(buffer).Decode(&decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func publishStateSnapshot(state map[[32]byte]*protocol.Account) {
+	stateCopy := copyAccounts(state)
+	rootKeysCopy := copyAccounts(RootKeys)
+
+	stateSnapshotMutex.Lock()
+	defer stateSnapshotMutex.Unlock()
+	stateSnapshot, rootKeysSnapshot = stateCopy, rootKeysCopy
+}
+
+//Publishes the state restored from disk, it is the state of the last closed (epoch) block of the previous run.
+func PublishStateSnapshot() {
+	publishStateSnapshot(State)
+}
+
+//Returns the state and the root keys as of the last closed (epoch) block. The maps must not be changed.
+func ReadStateSnapshot() (state map[[32]byte]*protocol.Account, rootKeys map[[32]byte]*protocol.Account) {
+	stateSnapshotMutex.RLock()
+	defer stateSnapshotMutex.RUnlock()
+	return stateSnapshot, rootKeysSnapshot
+}
+
+func copyAccounts(accounts map[[32]byte]*protocol.Account) map[[32]byte]*protocol.Account {
+	accountsCopy := make(map[[32]byte]*protocol.Account, len(accounts))
+	for hash, acc := range accounts {
+		if acc == nil {
+			continue
+		}
+
+		accCopy := *acc
+		accCopy.Contract = append([]byte(nil), acc.Contract...)
+		accCopy.ContractVariables = nil
+		for _, variable := range acc.ContractVariables {
+			accCopy.ContractVariables = append(accCopy.ContractVariables, append(protocol.ByteArray(nil), variable...))
+		}
+		accountsCopy[hash] = &accCopy
+	}
+
+	return accountsCopy
+}
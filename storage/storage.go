@@ -4,21 +4,21 @@ import (
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"fmt"
-	"log"
 	"sync"
-	"time"
 
-	"github.com/boltdb/bolt"
+	"github.com/oigele/bazo-miner/logging"
 	"github.com/oigele/bazo-miner/protocol"
 )
 
 var (
-	db                 				*bolt.DB
-	logger             				*log.Logger
+	db                 				Backend
+	logger             				*logging.Logger
 	//don't get confused with the key of the account.
 	State              				= make(map[[32]byte]*protocol.Account)
 	//This map keeps track of the relative account adjustments within a shard, such as balance, txcount and stakingheight
 	RelativeState                     = make(map[[32]byte]*protocol.RelativeAccount)
+	//Receipts of the cross-shard transfers of the last block validated, sent along with its state transition
+	OutboundReceipts				[]*protocol.Receipt
 	OwnStateTransitionStash 		[]*protocol.StateTransition
 	RootKeys           				= make(map[[32]byte]*protocol.Account)
 	txMemPool          				= make(map[[32]byte]protocol.Transaction)
@@ -46,6 +46,8 @@ var (
 
 	AllClosedBlocksAsc []*protocol.Block
 	Bootstrap_Server string
+	//All bootstrap servers, Bootstrap_Server is the first one
+	BootstrapServers []string
 	averageTxSize float32 				= 0
 	totalTransactionSize float32 		= 0
 	nrClosedTransactions float32 		= 0
@@ -61,6 +63,8 @@ var (
 	ThisShardID             int // ID of the shard this validator is assigned to
 	ThisShardIDDelayed		int
 	ThisShardMap			= make(map[int]int)
+	//Validator to shard mapping of the current epoch, set by the miner and persisted together with the state
+	ValShardMapping			*protocol.ValShardMapping
 	EpochLength				int
 	ReceivedStateStash                      = protocol.NewStateStash()
 	ReceivedShardBlockStash					= protocol.NewShardBlockStash()
@@ -82,19 +86,38 @@ const (
 	LASTCLOSEDEPOCHBLOCK_BUCKET = "lastclosedepochblocks"
 	OPENEPOCHBLOCK_BUCKET	= "openepochblock"
 	GENESIS_BUCKET			= "genesis"
+	BANNEDPEERS_BUCKET		= "bannedpeers"
+	//Hash of the closed block of every shard and height, see blockHeightKey
+	BLOCKHEIGHTS_BUCKET		= "blockheights"
 )
 
-//Entry function for the storage package
+//Entry function for the storage package. dbname is either the database file of the BoltDB backend or
+//MEMORY_BACKEND to keep all buckets in memory.
 func Init(dbname string, bootstrapIpport string) {
-	Bootstrap_Server = bootstrapIpport
-	logger = InitLogger()
+	logger = logging.New("storage")
 
-	var err error
-	db, err = bolt.Open(dbname, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	backend, err := NewBackend(dbname)
 	if err != nil {
 		logger.Fatal(ERROR_MSG, err)
 	}
 
+	InitWithBackend(backend, bootstrapIpport)
+}
+
+//Initializes the storage package with an already opened backend and creates the buckets that don't exist yet.
+func InitWithBackend(backend Backend, bootstrapIpport string) {
+	BootstrapServers = parseBootstrapServers(bootstrapIpport)
+	Bootstrap_Server = ""
+	if len(BootstrapServers) > 0 {
+		Bootstrap_Server = BootstrapServers[0]
+	}
+	if logger == nil {
+		logger = logging.New("storage")
+	}
+
+	var err error
+	db = backend
+
 	//Check if db file is empty for all non-bootstraping miners
 	//if ipport != BOOTSTRAP_SERVER_PORT {
 	//	err := db.View(func(tx *bolt.Tx) error {
@@ -115,132 +138,175 @@ func Init(dbname string, bootstrapIpport string) {
 	//	}
 	//}
 
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("openblocks"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("openblocks")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedblocks"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedblocks")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedblockswithouttx"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedblockswithouttx")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedfunds"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedfunds")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedaccs"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedaccs")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedstakes"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedstakes")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedcommittees"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedcommittees")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedaggregations"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedaggregations")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedconfigs"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedconfigs")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closeddata"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closeddata")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedaggdata"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedaggdata")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("lastclosedblock"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("lastclosedblock")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("genesis"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("genesis")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("openepochblock"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("openepochblock")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte(CLOSEDEPOCHBLOCK_BUCKET))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(CLOSEDEPOCHBLOCK_BUCKET)
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte(LASTCLOSEDEPOCHBLOCK_BUCKET))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(LASTCLOSEDEPOCHBLOCK_BUCKET)
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("datasummary"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("datasummary")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG + "Create bucket: %s", err)
 		}
 		return nil
 	})
-	db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucket([]byte("closedfines"))
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket("closedfines")
 		if err != nil {
 			return fmt.Errorf(ERROR_MSG + "Create bucket: %s", err)
 		}
 		return nil
 	})
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(STATE_BUCKET)
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(BANNEDPEERS_BUCKET)
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(ADDRESSBOOK_BUCKET)
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(RECEIPTS_BUCKET)
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(CONTRACTVARIABLES_BUCKET)
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx Tx) error {
+		_, err = tx.CreateBucket(BLOCKHEIGHTS_BUCKET)
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		//Databases of older versions have no index yet
+		return indexClosedBlocks(tx)
+	})
 }
 
 func TearDown() {
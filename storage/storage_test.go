@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"math/rand"
@@ -8,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/oigele/bazo-miner/crypto"
 	"github.com/oigele/bazo-miner/protocol"
 )
 
@@ -295,4 +297,296 @@ func TestReadWriteDeleteBlock(t *testing.T) {
 	if ReadLastClosedBlock() != nil {
 		t.Error("Failed to delete last closed block from storage.\n")
 	}
-}
\ No newline at end of file
+}
+func TestPersistedState(t *testing.T) {
+	stateBefore, relativeStateBefore, receiptsBefore := State, RelativeState, OutboundReceipts
+	shardIDBefore, mappingBefore := ThisShardID, ValShardMapping
+	defer func() {
+		State, RelativeState, OutboundReceipts = stateBefore, relativeStateBefore, receiptsBefore
+		ThisShardID, ValShardMapping = shardIDBefore, mappingBefore
+	}()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	ThisShardID = 2
+	ValShardMapping = protocol.NewMapping()
+	ValShardMapping.ValMapping[accA.Address] = 2
+	RelativeState = map[[32]byte]*protocol.RelativeAccount{accAHash: {Address: accA.Address, Balance: -5}}
+	OutboundReceipts = []*protocol.Receipt{{TxHash: [32]byte{'r'}, From: accAHash, Amount: 5, FromShard: 2}}
+
+	block := protocol.NewBlock([32]byte{}, 1)
+	block.Hash = [32]byte{'p'}
+	WriteLastClosedBlock(block)
+
+	persisted := ReadLastClosedBlockState()
+	if persisted == nil || persisted.BlockHash != block.Hash {
+		t.Fatalf("State not persisted with the last closed block: %v\n", persisted)
+	}
+	if persisted.ThisShardID != 2 || persisted.ValShardMapping.ValMapping[accA.Address] != 2 {
+		t.Errorf("Sharding metadata not persisted: %v, %v\n", persisted.ThisShardID, persisted.ValShardMapping)
+	}
+	if acc := persisted.State[accAHash]; acc == nil || acc.Address != accA.Address {
+		t.Errorf("Account not persisted: %v\n", acc)
+	}
+	if acc := persisted.RelativeState[accAHash]; acc == nil || acc.Balance != -5 {
+		t.Errorf("Relative account not persisted: %v\n", acc)
+	}
+	if len(persisted.OutboundReceipts) != 1 || persisted.OutboundReceipts[0].TxHash != [32]byte{'r'} {
+		t.Errorf("Outbound receipts not persisted: %v\n", persisted.OutboundReceipts)
+	}
+
+	//The state of the epoch block and the mapping shipped with it take precedence over the ones in memory
+	epochBlock := protocol.NewEpochBlock([][32]byte{}, 2)
+	epochBlock.Hash = [32]byte{'e'}
+	epochBlock.ValMapping = protocol.NewMapping()
+	epochBlock.ValMapping.ValMapping[ValidatorAccAddress] = 3
+	WriteLastClosedEpochBlock(epochBlock, map[[32]byte]*protocol.Account{accAHash: accA})
+
+	persisted = ReadLastClosedEpochBlockState()
+	if persisted == nil || persisted.BlockHash != epochBlock.Hash {
+		t.Fatalf("State not persisted with the last closed epoch block: %v\n", persisted)
+	}
+	if len(persisted.State) != 1 || persisted.ThisShardID != 3 {
+		t.Errorf("State of the epoch block not persisted: %v accounts, shard %v\n", len(persisted.State), persisted.ThisShardID)
+	}
+
+	//Replacing the last closed block keeps the state of the last closed epoch block
+	DeleteAllLastClosedBlock()
+	if ReadLastClosedBlockState() != nil {
+		t.Error("State of the last closed block not deleted.\n")
+	}
+	if ReadLastClosedEpochBlockState() == nil {
+		t.Error("State of the last closed epoch block deleted with the last closed block.\n")
+	}
+
+	DeleteAll()
+	if ReadLastClosedEpochBlockState() != nil {
+		t.Error("Persisted state not deleted.\n")
+	}
+	DeleteAllLastClosedEpochBlock()
+}
+
+func TestSnapshot(t *testing.T) {
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+
+	//accB is the committee, it endorses the epoch block with the commitment key of accA
+	committeeAcc := *accB
+	committeeAcc.IsCommittee = true
+	copy(committeeAcc.CommitteeKey[:], CommitmentKeyA.N.Bytes())
+
+	genesis := protocol.NewGenesis(accA.Address, [crypto.COMM_KEY_LENGTH]byte{}, accB.Address, committeeAcc.CommitteeKey)
+	WriteGenesis(&genesis)
+
+	firstEpochBlock := protocol.NewEpochBlock([][32]byte{genesis.Hash()}, 0)
+	firstEpochBlock.Hash = firstEpochBlock.HashEpochBlockHeader()
+	WriteFirstEpochBlock(firstEpochBlock)
+
+	epochBlock := protocol.NewEpochBlock([][32]byte{{'s'}}, 2)
+	epochBlock.Timestamp = 7
+	state := map[[32]byte]*protocol.Account{accAHash: accA, accBHash: &committeeAcc}
+	epochBlock.MerklePatriciaRoot = protocol.StateRoot(state)
+	epochBlock.Hash = epochBlock.HashEpochBlockHeader()
+	epochBlock.ValMapping = protocol.NewMapping()
+	epochBlock.ValMapping.EpochHeight = 2
+	epochBlock.ValMapping.ValMapping[accA.Address] = 1
+
+	endorsement := protocol.NewEndorsement(protocol.ENDORSE_EPOCH_BLOCK, 2, 0, epochBlock.HashEpochBlock(), accBHash)
+	endorsement.Signature, _ = crypto.SignMessageWithRSAKey(CommitmentKeyA, endorsement.Message())
+	epochBlock.Certificate = protocol.NewCommitteeCertificate([]*protocol.Endorsement{endorsement})
+	WriteLastClosedEpochBlock(epochBlock, state)
+
+	snapshot, err := NewSnapshot()
+	if err != nil {
+		t.Fatalf("Could not create snapshot: %v\n", err)
+	}
+
+	var file bytes.Buffer
+	if err := snapshot.Write(&file); err != nil {
+		t.Fatalf("Could not write snapshot: %v\n", err)
+	}
+	encoded := file.Bytes()
+
+	if _, err := ReadSnapshot(bytes.NewReader(encoded), [32]byte{'o'}); err == nil {
+		t.Error("Snapshot of another epoch block accepted.\n")
+	}
+
+	snapshot, err = ReadSnapshot(bytes.NewReader(encoded), epochBlock.Hash)
+	if err != nil {
+		t.Fatalf("Could not read snapshot: %v\n", err)
+	}
+
+	//The state has to match the state root of the epoch block
+	snapshot.State[accAHash].Balance++
+	if err := snapshot.Verify(epochBlock.Hash); err == nil {
+		t.Error("Snapshot with a changed state accepted.\n")
+	}
+	snapshot.State[accAHash].Balance--
+
+	//The epoch block has to hash to the given hash
+	snapshot.EpochBlock.MerkleRoot = [32]byte{'m'}
+	if err := snapshot.Verify(epochBlock.Hash); err == nil {
+		t.Error("Snapshot with a changed epoch block accepted.\n")
+	}
+	snapshot.EpochBlock.MerkleRoot = [32]byte{}
+
+	//The validator mapping has to be the one the committee endorsed
+	snapshot.ValShardMapping.ValMapping[accA.Address] = 2
+	if err := snapshot.Verify(epochBlock.Hash); err == nil {
+		t.Error("Snapshot with another validator mapping accepted.\n")
+	}
+	snapshot.EpochBlock.ValMapping.ValMapping[accA.Address] = 2
+	if err := snapshot.Verify(epochBlock.Hash); err == nil {
+		t.Error("Snapshot with an epoch block of another validator mapping accepted.\n")
+	}
+	snapshot.ValShardMapping.ValMapping[accA.Address] = 1
+	snapshot.EpochBlock.ValMapping.ValMapping[accA.Address] = 1
+
+	//The genesis has to be the one of the first epoch block
+	snapshotGenesis := snapshot.Genesis
+	otherGenesis := protocol.NewGenesis(accB.Address, [crypto.COMM_KEY_LENGTH]byte{}, accA.Address, [crypto.COMM_KEY_LENGTH]byte{})
+	snapshot.Genesis = &otherGenesis
+	if err := snapshot.Verify(epochBlock.Hash); err == nil {
+		t.Error("Snapshot with another genesis accepted.\n")
+	}
+	snapshot.Genesis = snapshotGenesis
+
+	if err := snapshot.Verify(epochBlock.Hash); err != nil {
+		t.Fatalf("Restored snapshot not accepted: %v\n", err)
+	}
+
+	backend, validatorBefore := db, ValidatorAccAddress
+	defer func() { db, ValidatorAccAddress = backend, validatorBefore }()
+	InitWithBackend(NewMemoryBackend(), TestIpPort)
+
+	//The node is restored as accA, which the mapping assigns to shard 1
+	ValidatorAccAddress = accA.Address
+	if err := snapshot.Import(); err != nil {
+		t.Fatalf("Could not import snapshot: %v\n", err)
+	}
+
+	if readGenesis, _ := ReadGenesis(); readGenesis == nil || readGenesis.Hash() != genesis.Hash() {
+		t.Errorf("Genesis not imported: %v\n", readGenesis)
+	}
+	if lastEpochBlock := ReadLastClosedEpochBlock(); lastEpochBlock == nil || lastEpochBlock.Hash != epochBlock.Hash {
+		t.Errorf("Epoch block not imported: %v\n", lastEpochBlock)
+	}
+	persisted := ReadLastClosedEpochBlockState()
+	if persisted == nil || persisted.BlockHash != epochBlock.Hash || persisted.State[accAHash] == nil {
+		t.Fatalf("State not imported: %v\n", persisted)
+	}
+	if persisted.ValShardMapping == nil || persisted.ValShardMapping.ValMapping[accA.Address] != 1 {
+		t.Errorf("Validator shard mapping not imported: %v\n", persisted.ValShardMapping)
+	}
+	if persisted.ThisShardID != 1 {
+		t.Errorf("Shard of the validator not imported: %v\n", persisted.ThisShardID)
+	}
+
+	//A database of another chain is not overwritten
+	WriteGenesis(&otherGenesis)
+	if err := snapshot.Import(); err == nil {
+		t.Error("Snapshot imported into a database of another genesis.\n")
+	}
+
+	db = backend
+	DeleteAll()
+	DeleteAllLastClosedEpochBlock()
+}
+
+func TestBannedPeers(t *testing.T) {
+	WriteBannedPeer("10.0.0.1:8000", 1000)
+	WriteBannedPeer("10.0.0.2:", 2000)
+
+	bans := ReadBannedPeers()
+	if len(bans) != 2 || bans["10.0.0.1:8000"] != 1000 || bans["10.0.0.2:"] != 2000 {
+		t.Errorf("Banned peers not correctly read: %v\n", bans)
+	}
+
+	DeleteBannedPeer("10.0.0.1:8000")
+	DeleteBannedPeer("10.0.0.2:")
+	if bans := ReadBannedPeers(); len(bans) != 0 {
+		t.Errorf("Banned peers not deleted: %v\n", bans)
+	}
+}
+
+func TestPeerRecords(t *testing.T) {
+	record := &PeerRecord{Address: "[2001:db8::1]:8000", LastSeen: 1000, LastAttempt: 900, Successes: 3, Failures: 1}
+	WritePeerRecord(record)
+
+	records := ReadPeerRecords()
+	if len(records) != 1 || !reflect.DeepEqual(records[0], record) {
+		t.Errorf("Peer records not correctly read: %v\n", records)
+	}
+
+	DeletePeerRecord(record.Address)
+	if records := ReadPeerRecords(); len(records) != 0 {
+		t.Errorf("Peer records not deleted: %v\n", records)
+	}
+}
+
+func TestContractVariablesBeforeTx(t *testing.T) {
+	txHash := [32]byte{1}
+	variables := map[[32]byte][]protocol.ByteArray{{2}: {{0}, {1, 2}}, {3}: nil}
+	WriteContractVariablesBeforeTx(txHash, variables)
+
+	//The variables are needed to roll back the call after a restart
+	TearDown()
+	Init(TestDBFileName, TestIpPort)
+
+	read, exists := ReadContractVariablesBeforeTx(txHash)
+	if !exists || len(read) != 2 || !protocol.ContractVariablesEqual(read[[32]byte{2}], variables[[32]byte{2}]) || len(read[[32]byte{3}]) != 0 {
+		t.Errorf("Contract variables not correctly read: %v\n", read)
+	}
+
+	DeleteContractVariablesBeforeTx(txHash)
+	if _, exists := ReadContractVariablesBeforeTx(txHash); exists {
+		t.Errorf("Contract variables not deleted\n")
+	}
+
+	//All entries are pruned when the epoch state is taken over
+	WriteContractVariablesBeforeTx([32]byte{4}, variables)
+	WriteContractVariablesBeforeTx([32]byte{5}, variables)
+	DeleteAllContractVariablesBeforeTx()
+	for _, hash := range [][32]byte{{4}, {5}} {
+		if _, exists := ReadContractVariablesBeforeTx(hash); exists {
+			t.Errorf("Contract variables of %x not pruned\n", hash[0:1])
+		}
+	}
+}
+
+func TestBootstrapServers(t *testing.T) {
+	servers := parseBootstrapServers("127.0.0.1:8000, [2001:db8::1]:8000,,miner.bazo.example:8000")
+	expected := []string{"127.0.0.1:8000", "[2001:db8::1]:8000", "miner.bazo.example:8000"}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Errorf("Bootstrap servers not correctly parsed: %v\n", servers)
+	}
+}
+
+func TestClosedBlocksByRange(t *testing.T) {
+	//Height 3 belongs to an epoch block, the block of the other shard is not returned
+	b2 := protocol.NewBlock([32]byte{}, 2)
+	b2.ShardId, b2.Hash = 7, [32]byte{2}
+	b4 := protocol.NewBlock([32]byte{3}, 4)
+	b4.ShardId, b4.Hash = 7, [32]byte{4}
+	other := protocol.NewBlock([32]byte{}, 2)
+	other.ShardId, other.Hash = 8, [32]byte{8}
+	WriteClosedBlock(b2)
+	WriteClosedBlock(b4)
+	WriteClosedBlock(other)
+	defer DeleteClosedBlock(b4.Hash)
+	defer DeleteClosedBlock(other.Hash)
+
+	blocks := ReadClosedBlocksByRange(7, 1, 10)
+	if len(blocks) != 2 || blocks[0].Hash != b2.Hash || blocks[1].Hash != b4.Hash {
+		t.Errorf("Wrong blocks of range: %v\n", blocks)
+	}
+
+	if blocks := ReadClosedBlocksByRange(7, 3, 1); len(blocks) != 0 {
+		t.Errorf("Blocks returned for a height without block: %v\n", blocks)
+	}
+
+	//Deleting a block removes it from the height index
+	DeleteClosedBlock(b2.Hash)
+	if blocks := ReadClosedBlocksByRange(7, 2, 3); len(blocks) != 1 || blocks[0].Hash != b4.Hash {
+		t.Errorf("Deleted block returned: %v\n", blocks)
+	}
+}
@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"github.com/boltdb/bolt"
 	"github.com/oigele/bazo-miner/protocol"
 )
 
@@ -84,8 +83,8 @@ func UpdateDataSummary(dataTxs []*protocol.DataTx) (err error){
 	//iterate through each sender in the map. For each, update the database.
 	for sender, dataTxSliceOfSender = range updateMap {
 		//check if there already exists an entry for our sender
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("datasummary"))
+		db.View(func(tx Tx) error {
+			b := tx.Bucket("datasummary")
 			encodedOldDataSummary = b.Get(sender[:])
 			return nil
 		})
@@ -118,9 +117,9 @@ func UpdateDataSummary(dataTxs []*protocol.DataTx) (err error){
 			//newDataSummary now contains all the updates, so activate it
 			newDataSummary = oldDataSummary
 			//delete the old entry and write the new entry to database
-			err = db.Update(func(tx *bolt.Tx) error {
+			err = db.Update(func(tx Tx) error {
 				var err error
-				b := tx.Bucket([]byte("datasummary"))
+				b := tx.Bucket("datasummary")
 				err = b.Delete(sender[:])
 				err = b.Put(sender[:], newDataSummary.Encode())
 				return err
@@ -1,35 +1,12 @@
 package storage
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/oigele/bazo-miner/protocol"
-	"io"
-	"log"
-	"os"
-	"time"
 )
 
-func InitLogger() *log.Logger {
-
-	//Create a Log-file (Logger.Miner.log) and write all logger.printf(...) Statements into it.
-
-	//use this two lines, if all miners should have distinct names for their log files. 
-	time.Now().Format("030405")
-	filename := "LoggerMiner" + time.Now().Format("150405") + ".log"
-
-	//use this line when all miners should have the same log file name.
-	//filename := "LoggerMiner.log"
-	LogFile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
-	}
-
-	wrt := io.MultiWriter(os.Stdout, LogFile)
-	log.SetOutput(wrt)
-	return log.New(wrt, "INFO: ", log.Ldate|log.Lmicroseconds|log.Lshortfile)
-}
-
 //Needed by miner and p2p package
 func GetAccount(hash [32]byte) (acc *protocol.Account, err error) {
 	if acc = State[hash]; acc != nil {
@@ -53,10 +30,39 @@ func IsRootKey(hash [32]byte) bool {
 	return exists
 }
 
-//Get all pubKeys involved in AccTx, FundsTx of a given block
+//Get all pubKeys involved in the transactions of a given block, the block's bloom filter is built from them
 func GetTxPubKeys(block *protocol.Block) (txPubKeys [][32]byte) {
 	txPubKeys = GetAccTxPubKeys(block.AccTxData)
 	txPubKeys = append(txPubKeys, GetFundsTxPubKeys(block.FundsTxData)...)
+	for _, txData := range [][][32]byte{block.AggTxData, block.StakeTxData, block.CommitteeTxData, block.DataTxData, block.FineTxData} {
+		txPubKeys = append(txPubKeys, getOtherTxPubKeys(txData)...)
+	}
+
+	return txPubKeys
+}
+
+//Get all pubKeys involved in AggTx, StakeTx, CommitteeTx, DataTx and FineTx
+func getOtherTxPubKeys(txData [][32]byte) (txPubKeys [][32]byte) {
+	for _, txHash := range txData {
+		tx := ReadClosedTx(txHash)
+		if tx == nil {
+			tx = ReadOpenTx(txHash)
+		}
+
+		switch tx := tx.(type) {
+		case *protocol.AggTx:
+			txPubKeys = append(txPubKeys, tx.From...)
+			txPubKeys = append(txPubKeys, tx.To...)
+		case *protocol.StakeTx:
+			txPubKeys = append(txPubKeys, tx.Account)
+		case *protocol.CommitteeTx:
+			txPubKeys = append(txPubKeys, protocol.SerializeHashContent(tx.Account))
+		case *protocol.DataTx:
+			txPubKeys = append(txPubKeys, tx.From, tx.To)
+		case *protocol.FineTx:
+			txPubKeys = append(txPubKeys, tx.From, tx.To)
+		}
+	}
 
 	return txPubKeys
 }
@@ -71,6 +77,10 @@ func GetAccTxPubKeys(accTxData [][32]byte) (accTxPubKeys [][32]byte) {
 		if tx == nil {
 			tx = ReadOpenTx(txHash)
 		}
+		//nil check for null pointer safety
+		if tx == nil {
+			continue
+		}
 
 		accTx = tx.(*protocol.AccTx)
 		accTxPubKeys = append(accTxPubKeys, accTx.Issuer)
@@ -95,8 +105,15 @@ func GetRelativeState(statePrev map[[32]byte]protocol.Account, stateNow map[[32]
 			accPrev := statePrev[know]
 			accNew := stateNow[know]
 
+			//Contract variables are only changed by the shard the contract calls are assigned to. They are only part of
+			//the transition if they changed, such that other shards don't overwrite them with their outdated version.
+			var contractVariables []protocol.ByteArray
+			if !protocol.ContractVariablesEqual(accPrev.ContractVariables, accNew.ContractVariables) {
+				contractVariables = accNew.ContractVariables
+			}
+
 			//account with relative adjustments of the fields, will be  applied by the other shards
-			accTransition := protocol.NewRelativeAccount(stateNow[know].Address, [32]byte{}, int64(accNew.Balance-accPrev.Balance), accNew.IsStaking, accNew.IsCommittee, accNew.CommitmentKey, accNew.CommitteeKey, accNew.Contract, accNew.ContractVariables)
+			accTransition := protocol.NewRelativeAccount(stateNow[know].Address, [32]byte{}, int64(accNew.Balance-accPrev.Balance), accNew.IsStaking, accNew.IsCommittee, accNew.CommitmentKey, accNew.CommitteeKey, accNew.Contract, contractVariables)
 			accTransition.TxCnt = int32(accNew.TxCnt - accPrev.TxCnt)
 			accTransition.StakingBlockHeight = int32(accNew.StakingBlockHeight - accPrev.StakingBlockHeight)
 			stateRelative[know] = &accTransition
@@ -122,8 +139,15 @@ func GetRelativeStateForCommittee(statePrev map[[32]byte]protocol.Account, state
 			accPrev := statePrev[know]
 			accNew := stateNow[know]
 
+			//Contract variables are only changed by the shard the contract calls are assigned to. They are only part of
+			//the transition if they changed, such that other shards don't overwrite them with their outdated version.
+			var contractVariables []protocol.ByteArray
+			if !protocol.ContractVariablesEqual(accPrev.ContractVariables, accNew.ContractVariables) {
+				contractVariables = accNew.ContractVariables
+			}
+
 			//account with relative adjustments of the fields, will be  applied by the other shards
-			accTransition := protocol.NewRelativeAccount(stateNow[know].Address, [32]byte{}, int64(accNew.Balance-accPrev.Balance), accNew.IsStaking, accNew.IsCommittee, accNew.CommitmentKey, accNew.CommitteeKey, accNew.Contract, accNew.ContractVariables)
+			accTransition := protocol.NewRelativeAccount(stateNow[know].Address, [32]byte{}, int64(accNew.Balance-accPrev.Balance), accNew.IsStaking, accNew.IsCommittee, accNew.CommitmentKey, accNew.CommitteeKey, accNew.Contract, contractVariables)
 			accTransition.TxCnt = int32(accNew.TxCnt - accPrev.TxCnt)
 			accTransition.StakingBlockHeight = int32(accNew.StakingBlockHeight - accPrev.StakingBlockHeight)
 			stateRelative[know] = &accTransition
@@ -173,6 +197,10 @@ func ApplyRelativeState(statePrev map[[32]byte]*protocol.Account, stateRel map[[
 			accPrev.Balance = accPrev.Balance + uint64(accRel.Balance)
 			accPrev.TxCnt = accPrev.TxCnt + uint32(accRel.TxCnt)
 			accPrev.StakingBlockHeight = accPrev.StakingBlockHeight + uint32(accRel.StakingBlockHeight)
+			//Contract variables are absolute values, only sent along if a contract call changed them.
+			if accRel.ContractVariables != nil {
+				accPrev.ContractVariables = accRel.ContractVariables
+			}
 			//Staking Tx can only be positive. So only take the info from the relative state if currently not staking (otherwhise we might accidentally change the state back)
 			//Also take over commitment key.
 			if accPrev.IsStaking == false {
@@ -186,4 +214,46 @@ func ApplyRelativeState(statePrev map[[32]byte]*protocol.Account, stateRel map[[
 		}
 	}
 	return statePrev
-}
\ No newline at end of file
+}
+
+//Returns the accounts that were created or changed in the current state compared to the previous state, an epoch
+//block carries them instead of the whole state.
+func GetStateDelta(statePrev map[[32]byte]*protocol.Account, stateNow map[[32]byte]*protocol.Account) (stateDelta map[[32]byte]*protocol.Account) {
+	stateDelta = make(map[[32]byte]*protocol.Account)
+	for k, accNow := range stateNow {
+		if accPrev, ok := statePrev[k]; !ok || accPrev.StateHash() != accNow.StateHash() {
+			stateDelta[k] = accNow
+		}
+	}
+	return stateDelta
+}
+
+//Returns the state that results from applying the state delta to the previous state. The previous state is not
+//changed.
+func ApplyStateDelta(statePrev map[[32]byte]*protocol.Account, stateDelta map[[32]byte]*protocol.Account) (stateUpdated map[[32]byte]*protocol.Account) {
+	stateUpdated = copyAccounts(statePrev)
+	for k, acc := range copyAccounts(stateDelta) {
+		stateUpdated[k] = acc
+	}
+	return stateUpdated
+}
+
+//Key of a block in the BLOCKHEIGHTS_BUCKET. Shard ID and height are big-endian, such that the blocks of a shard are
+//stored in height order.
+func blockHeightKey(shardID int, height uint32) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint32(key[:4], uint32(shardID))
+	binary.BigEndian.PutUint32(key[4:], height)
+	return key
+}
+
+func indexClosedBlocks(tx Tx) error {
+	index := tx.Bucket(BLOCKHEIGHTS_BUCKET)
+	return tx.Bucket("closedblocks").ForEach(func(k, v []byte) error {
+		var block *protocol.Block
+		if block = block.Decode(v); block == nil {
+			return nil
+		}
+		return index.Put(blockHeightKey(block.ShardId, block.Height), block.Hash[:])
+	})
+}
@@ -14,8 +14,8 @@ func TestSerializeHashContent(t *testing.T) {
 
 	hash := protocol.SerializeHashContent(data)
 
-  if fmt.Sprintf("%x", hash) != "ca4510738395af1429224dd785675309c344b2b549632e20275c69b15ed1d210" {
-		t.Errorf("Error serializing: %x != %v\n", hash, "ca4510738395af1429224dd785675309c344b2b549632e20275c69b15ed1d210")
+  if fmt.Sprintf("%x", hash) != "8b0a2385d83c8bf7be27e59996f7d881d3bf1fc6606f81ce600b753ad94192a2" {
+		t.Errorf("Error serializing: %x != %v\n", hash, "8b0a2385d83c8bf7be27e59996f7d881d3bf1fc6606f81ce600b753ad94192a2")
 	}
 }
 
@@ -56,3 +56,31 @@ func TestGetRootAccount(t *testing.T) {
 		t.Errorf("Error fetching account from state: %x\n", nilHash)
 	}
 }
+
+func TestStateDelta(t *testing.T) {
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+
+	accAPrev, accBPrev := *accA, *accB
+	statePrev := map[[32]byte]*protocol.Account{accAHash: &accAPrev, accBHash: &accBPrev}
+
+	accANow, accBNow := *accA, *accB
+	accANow.Balance += 10
+	newAcc := protocol.NewAccount([64]byte{'n'}, [32]byte{}, 5, false, false, [256]byte{}, [256]byte{}, nil, nil)
+	newAccHash := protocol.SerializeHashContent(newAcc.Address)
+	stateNow := map[[32]byte]*protocol.Account{accAHash: &accANow, accBHash: &accBNow, newAccHash: &newAcc}
+
+	//Only the changed and the new account are part of the delta
+	delta := GetStateDelta(statePrev, stateNow)
+	if len(delta) != 2 || delta[accAHash] == nil || delta[newAccHash] == nil {
+		t.Fatalf("Wrong state delta: %v\n", delta)
+	}
+
+	state := ApplyStateDelta(statePrev, delta)
+	if protocol.StateRoot(state) != protocol.StateRoot(stateNow) {
+		t.Errorf("State delta does not lead to the current state\n")
+	}
+	if statePrev[accAHash].Balance != accA.Balance || len(statePrev) != 2 {
+		t.Errorf("Previous state changed by the state delta\n")
+	}
+}
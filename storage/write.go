@@ -1,14 +1,14 @@
 package storage
 
 import (
-	"github.com/boltdb/bolt"
+	"encoding/binary"
 	"github.com/oigele/bazo-miner/protocol"
 )
 
 func WriteOpenBlock(block *protocol.Block) (err error) {
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("openblocks"))
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket("openblocks")
 		err := b.Put(block.Hash[:], block.Encode())
 		return err
 	})
@@ -18,48 +18,79 @@ func WriteOpenBlock(block *protocol.Block) (err error) {
 
 func WriteClosedBlock(block *protocol.Block) (err error) {
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblocks"))
-		err := b.Put(block.Hash[:], block.Encode())
-		return err
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedblocks")
+		if err := b.Put(block.Hash[:], block.Encode()); err != nil {
+			return err
+		}
+		//Other miners request blocks by shard and height
+		return tx.Bucket(BLOCKHEIGHTS_BUCKET).Put(blockHeightKey(block.ShardId, block.Height), block.Hash[:])
 	})
 
 	return err
 }
 
 func WriteClosedEpochBlock(epochBlock *protocol.EpochBlock) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(CLOSEDEPOCHBLOCK_BUCKET))
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(CLOSEDEPOCHBLOCK_BUCKET)
 		return b.Put(epochBlock.Hash[:], epochBlock.Encode())
 	})
 }
 
 func WriteFirstEpochBlock(epochBlock *protocol.EpochBlock) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(CLOSEDEPOCHBLOCK_BUCKET))
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(CLOSEDEPOCHBLOCK_BUCKET)
 		return b.Put([]byte("firstepochblock"), epochBlock.Encode())
 	})
 }
 
-func WriteLastClosedEpochBlock(epochBlock *protocol.EpochBlock) (err error) {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(LASTCLOSEDEPOCHBLOCK_BUCKET))
-		return b.Put(epochBlock.Hash[:], epochBlock.Encode())
+//The state of the epoch block is persisted in the same transaction, such that the epoch block and its state can't
+//diverge on disk.
+func WriteLastClosedEpochBlock(epochBlock *protocol.EpochBlock, state map[[32]byte]*protocol.Account) (err error) {
+	persisted := newEpochBlockPersistedState(epochBlock, state)
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket(LASTCLOSEDEPOCHBLOCK_BUCKET)
+		if err := b.Put(epochBlock.Hash[:], epochBlock.Encode()); err != nil {
+			return err
+		}
+		return tx.Bucket(STATE_BUCKET).Put([]byte(LASTCLOSEDEPOCHBLOCK_STATE), persisted.Encode())
 	})
+
+	if err == nil {
+		publishStateSnapshot(persisted.State)
+	}
+
+	return err
 }
 
 func WriteGenesis(genesis *protocol.Genesis) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(GENESIS_BUCKET))
+	return db.Update(func(tx Tx) error {
+		b := tx.Bucket(GENESIS_BUCKET)
 		return b.Put([]byte("genesis"), genesis.Encode())
 	})
 }
 
+//Bans are stored with the unix time they expire.
+func WriteBannedPeer(address string, until int64) error {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], uint64(until))
+
+	return db.Update(func(tx Tx) error {
+		return tx.Bucket(BANNEDPEERS_BUCKET).Put([]byte(address), encoded[:])
+	})
+}
+
+func WritePeerRecord(record *PeerRecord) error {
+	return db.Update(func(tx Tx) error {
+		return tx.Bucket(ADDRESSBOOK_BUCKET).Put([]byte(record.Address), record.Encode())
+	})
+}
+
 /* TODO UNCOMMENT
 func WriteClosedBlockWithoutTx(block *protocol.Block) (err error) {
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("closedblockswithouttx"))
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket("closedblockswithouttx")
 		err := b.Put(block.HashWithoutTx[:], block.Encode())
 		return err
 	})
@@ -67,18 +98,25 @@ func WriteClosedBlockWithoutTx(block *protocol.Block) (err error) {
 	return err
 }
 */
+//The state is persisted in the same transaction, such that the block and its state can't diverge on disk.
 func WriteLastClosedBlock(block *protocol.Block) (err error) {
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("lastclosedblock"))
-		err := b.Put(block.Hash[:], block.Encode())
-		return err
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket("lastclosedblock")
+		if err := b.Put(block.Hash[:], block.Encode()); err != nil {
+			return err
+		}
+		return tx.Bucket(STATE_BUCKET).Put([]byte(LASTCLOSEDBLOCK_STATE), newBlockPersistedState(block).Encode())
 	})
 
+	if err == nil {
+		publishStateSnapshot(State)
+	}
+
 	return err
 }
 
-//Changing the "tx" shortcut here and using "transaction" to distinguish between bolt's transactions
+//Changing the "tx" shortcut here and using "transaction" to distinguish between the backend's transactions
 //write open tx doesnt allow for a tx to be added twice
 func WriteOpenTx(transaction protocol.Transaction) {
 	openTxMutex.Lock()
@@ -160,9 +198,9 @@ func BlockAlreadyInStash(slice []*protocol.Block, newBlockHash [32]byte) bool {
 
 func WriteClosedFundsTxFromAggTxSlice(transactions []protocol.FundsTx) (err error) {
 	bucket := "closedfunds"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range transactions {
 			hash := transaction.Hash()
 			err = b.Put(hash[:], transaction.Encode())
@@ -185,9 +223,9 @@ func WriteClosedFundsTxFromAggTxSlice(transactions []protocol.FundsTx) (err erro
 //To make the code more efficient and performant, the check of who is actually malicious will be conducted at a different part of the code
 func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, stakeTxs []*protocol.StakeTx, committeeTxs []*protocol.CommitteeTx, fundsTxs []*protocol.FundsTx, aggTxs []*protocol.AggTx, dataTxs []*protocol.DataTx, aggDataTxs []*protocol.AggDataTx, fineTxs []*protocol.FineTx) (alreadyIncludedTxHashes [][32]byte, err error) {
 	bucket := "closedaccs"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range accTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.AccTx
@@ -209,9 +247,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closedstakes"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range stakeTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.StakeTx
@@ -232,9 +270,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closedcommittees"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range committeeTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.CommitteeTx
@@ -255,9 +293,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closedfunds"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range fundsTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.FundsTx
@@ -278,9 +316,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closedaggregations"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range aggTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.AggTx
@@ -301,9 +339,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closeddata"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range dataTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.DataTx
@@ -324,9 +362,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closedaggdata"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range aggDataTxs {
 			hash := transaction.Hash()
 			var accTx *protocol.AggDataTx
@@ -347,9 +385,9 @@ func WriteAllClosedTxAndReturnAlreadyClosedTxHashes(accTxs []*protocol.AccTx, st
 	})
 
 	bucket = "closedfines"
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket(bucket)
 		for _, transaction := range aggDataTxs {
 			hash := transaction.Hash()
 			var fineTx *protocol.FineTx
@@ -393,8 +431,8 @@ func WriteClosedTx(transaction protocol.Transaction) (err error) {
 	}
 
 	hash := transaction.Hash()
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket(bucket)
 		err := b.Put(hash[:], transaction.Encode())
 		return err
 	})
@@ -414,9 +452,9 @@ func WriteToOwnStateTransitionkStash(st *protocol.StateTransition) {
 }
 
 func WriteDataSummary(ds *protocol.DataSummary) (err error) {
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx Tx) error {
 		var err error
-		b := tx.Bucket([]byte("datasummary"))
+		b := tx.Bucket("datasummary")
 		b.Put(ds.Address[:], ds.Encode())
 		return err
 	})
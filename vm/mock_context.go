@@ -1,6 +1,8 @@
 package vm
 
 import (
+	"errors"
+
 	"github.com/oigele/bazo-miner/protocol"
 )
 
@@ -18,3 +20,22 @@ func NewMockContext(byteCode []byte) *MockContext {
 func (mc *MockContext) SetContract(contract []byte) {
 	mc.Contract = contract
 }
+
+func (mc *MockContext) NewExternalContext(address [32]byte, data []byte, fee uint64) (Context, error) {
+	externalContext, err := mc.Context.NewExternalContext(address, data, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MockContext{*externalContext}, nil
+}
+
+func (mc *MockContext) CommitExternalContext(externalContext Context) error {
+	external, ok := externalContext.(*MockContext)
+	if !ok {
+		return errors.New("External context was not created by this context")
+	}
+
+	mc.Context.CommitExternalContext(&external.Context)
+	return nil
+}
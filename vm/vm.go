@@ -25,8 +25,19 @@ type Context interface {
 	GetTransactionData() []byte
 	GetFee() uint64
 	GetSig1() [64]byte
+	//Creates the context of a call of the contract with the given address hash made with CALLEXT.
+	NewExternalContext(address [32]byte, data []byte, fee uint64) (Context, error)
+	//Takes over the changes of a successful external call, the context has been created by NewExternalContext.
+	CommitExternalContext(externalContext Context) error
 }
 
+const (
+	MAX_EXTERNAL_CALL_DEPTH = 8
+	//The caller of an external contract keeps 1/EXTERNAL_CALL_GAS_RESERVE of its remaining gas, such that it can
+	//continue after a failed call.
+	EXTERNAL_CALL_GAS_RESERVE = 64
+)
+
 type VM struct {
 	code            []byte
 	pc              int // Program counter
@@ -34,6 +45,7 @@ type VM struct {
 	evaluationStack *Stack
 	callStack       *CallStack
 	context         Context
+	depth           int // Number of external calls this vm is nested in
 }
 
 func NewVM(context Context) VM {
@@ -529,8 +541,72 @@ func (vm *VM) Exec(trace bool) bool {
 				return false
 			}
 
-			fmt.Sprint("CALLEXT", transactionAddress, functionHash, argsToLoad)
-			//TODO: Invoke new transaction with function hash and arguments, waiting for integration in bazo blockchain to finish
+			if vm.depth >= MAX_EXTERNAL_CALL_DEPTH {
+				vm.evaluationStack.Push([]byte(opCode.Name + ": Maximum call depth reached"))
+				return false
+			}
+
+			//The arguments are passed in the same format as transaction data, followed by the function hash.
+			args := make([][]byte, int(argsToLoad))
+			for i := int(argsToLoad) - 1; i >= 0; i-- {
+				args[i], err = vm.PopBytes(opCode)
+				if err != nil {
+					vm.evaluationStack.Push([]byte(opCode.Name + ": " + err.Error()))
+					return false
+				}
+			}
+
+			var data []byte
+			for _, arg := range append(args, functionHash) {
+				if len(arg) == 0 || len(arg) > 256 {
+					vm.evaluationStack.Push([]byte(opCode.Name + ": Invalid argument size"))
+					return false
+				}
+				data = append(data, byte(len(arg)-1))
+				data = append(data, arg...)
+			}
+
+			var address [32]byte
+			copy(address[:], transactionAddress)
+
+			//The external contract gets the remaining gas of the caller except for a reserve, whatever it does not use
+			//is given back.
+			reserve := vm.fee / EXTERNAL_CALL_GAS_RESERVE
+			externalContext, err := vm.context.NewExternalContext(address, data, vm.fee-reserve)
+			if err != nil {
+				vm.evaluationStack.Push([]byte(opCode.Name + ": " + err.Error()))
+				return false
+			}
+
+			externalVM := NewVM(externalContext)
+			externalVM.depth = vm.depth + 1
+
+			//Changes of a failed call are never committed. The gas it used is charged and the caller continues with
+			//false on the stack.
+			success := externalVM.Exec(false)
+			vm.fee = reserve + externalVM.fee
+			if success {
+				if err = vm.context.CommitExternalContext(externalContext); err != nil {
+					vm.evaluationStack.Push([]byte(opCode.Name + ": " + err.Error()))
+					return false
+				}
+
+				//Everything left on the evaluation stack of the external contract is returned to the caller.
+				for _, element := range externalVM.evaluationStack.Stack {
+					err = vm.evaluationStack.Push(element)
+					if err != nil {
+						vm.evaluationStack.Push([]byte(opCode.Name + ": " + err.Error()))
+						return false
+					}
+				}
+			}
+
+			//The outcome of the call is pushed on top of the returned values.
+			err = vm.evaluationStack.Push(BoolToByteArray(success))
+			if err != nil {
+				vm.evaluationStack.Push([]byte(opCode.Name + ": " + err.Error()))
+				return false
+			}
 
 		case RET:
 			callstackTos, err := vm.callStack.Peek()
@@ -692,6 +692,192 @@ func TestVM_Exec_CallExt(t *testing.T) {
 	vm.Exec(false)
 }
 
+var externalContractAccountAddress = [64]byte{1}
+var externalContractAddress = protocol.SerializeHashContent(externalContractAccountAddress)
+
+//Adds the two arguments, stores the sum in the first contract variable and returns it.
+var externalAddContract = []byte{
+	CALLDATA,
+	POP, // Function hash
+	ADD,
+	DUP,
+	SSTORE, 0,
+	HALT,
+}
+
+func newExternalCallCode(argsToLoad byte) []byte {
+	code := []byte{
+		PUSH, 1, 0, 10,
+		PUSH, 1, 0, 8,
+		CALLEXT,
+	}
+	code = append(code, externalContractAddress[:]...)
+	code = append(code, 0, 0, 0, 1, argsToLoad)
+	return append(code, HALT)
+}
+
+func newExternalCallContext(code []byte, externalContract []byte) *MockContext {
+	mc := NewMockContext(code)
+	mc.Fee = 10000
+
+	externalAccount := protocol.Account{
+		Address:           externalContractAccountAddress,
+		Contract:          externalContract,
+		ContractVariables: []protocol.ByteArray{{0}},
+	}
+	mc.AccountLookup = func(address [32]byte) (*protocol.Account, error) {
+		if address != externalContractAddress {
+			return nil, nil
+		}
+		return &externalAccount, nil
+	}
+
+	return mc
+}
+
+func TestVM_Exec_CallExt_ReturnValue(t *testing.T) {
+	vm := NewTestVM([]byte{})
+	mc := newExternalCallContext(newExternalCallCode(2), externalAddContract)
+	vm.context = mc
+
+	if !vm.Exec(false) {
+		t.Fatalf("External call failed: %v", vm.GetErrorMsg())
+	}
+
+	success, _ := vm.evaluationStack.Pop()
+	if ByteArrayToInt(success) != 1 {
+		t.Errorf("Expected the external call to succeed but the flag was '%v'", success)
+	}
+
+	tos, _ := vm.evaluationStack.Pop()
+	if ByteArrayToInt(tos) != 18 {
+		t.Errorf("Expected return value to be '%v' but was '%v'", 18, ByteArrayToInt(tos))
+	}
+
+	variables := mc.GetExternalContractVariables()[externalContractAddress]
+	if len(variables) != 1 || ByteArrayToInt(variables[0]) != 18 {
+		t.Errorf("Expected external contract variable to be '%v' but was '%v'", 18, variables)
+	}
+
+	if vm.fee >= mc.Fee || vm.fee == 0 {
+		t.Errorf("Expected the gas of the external call to be charged to the caller, remaining fee is %v", vm.fee)
+	}
+}
+
+func TestVM_Exec_CallExt_ErrHalt(t *testing.T) {
+	externalContract := []byte{
+		PUSH, 0, 1,
+		SSTORE, 0,
+		ERRHALT,
+	}
+
+	vm := NewTestVM([]byte{})
+	mc := newExternalCallContext(newExternalCallCode(2), externalContract)
+	vm.context = mc
+
+	if !vm.Exec(false) {
+		t.Fatalf("Expected the caller to continue when the external contract halts with an error: %v", vm.GetErrorMsg())
+	}
+
+	if tos, _ := vm.evaluationStack.Pop(); ByteArrayToInt(tos) != 0 {
+		t.Errorf("Expected the failed external call to push false but was '%v'", tos)
+	}
+
+	if len(mc.GetExternalContractVariables()) != 0 {
+		t.Errorf("Expected changes of the failed external call to be discarded, but were %v", mc.GetExternalContractVariables())
+	}
+}
+
+func TestVM_Exec_CallExt_OutOfGas(t *testing.T) {
+	vm := NewTestVM([]byte{})
+	mc := newExternalCallContext(newExternalCallCode(2), externalAddContract)
+	//Enough for the call itself, but not for SSTORE in the external contract
+	mc.Fee = 1100
+	vm.context = mc
+
+	if !vm.Exec(false) {
+		t.Fatalf("Expected the caller to continue when the external contract runs out of gas: %v", vm.GetErrorMsg())
+	}
+
+	if tos, _ := vm.evaluationStack.Pop(); ByteArrayToInt(tos) != 0 {
+		t.Errorf("Expected the failed external call to push false but was '%v'", tos)
+	}
+
+	if len(mc.GetExternalContractVariables()) != 0 {
+		t.Errorf("Expected changes of the failed external call to be discarded, but were %v", mc.GetExternalContractVariables())
+	}
+}
+
+func TestVM_Exec_CallExt_UnknownContract(t *testing.T) {
+	vm := NewTestVM([]byte{})
+	mc := newExternalCallContext(newExternalCallCode(2), externalAddContract)
+	mc.AccountLookup = func(address [32]byte) (*protocol.Account, error) {
+		return nil, nil
+	}
+	vm.context = mc
+
+	if vm.Exec(false) {
+		t.Fatal("Expected execution to fail when the external contract does not exist")
+	}
+
+	expected := "callext: External account does not exist"
+	if actual := vm.GetErrorMsg(); actual != expected {
+		t.Errorf("Expected error message to be '%v' but was '%v'", expected, actual)
+	}
+}
+
+func TestVM_Exec_CallExt_Recursive(t *testing.T) {
+	code := newExternalCallCode(2)
+
+	vm := NewTestVM([]byte{})
+	//The external contract calls itself.
+	mc := newExternalCallContext(code, code)
+	vm.context = mc
+
+	//The external contract fails, the caller gets false
+	if !vm.Exec(false) {
+		t.Fatalf("Expected the caller to continue after the recursive external call failed: %v", vm.GetErrorMsg())
+	}
+
+	if tos, _ := vm.evaluationStack.Pop(); ByteArrayToInt(tos) != 0 {
+		t.Errorf("Expected recursive external calls to fail but the flag was '%v'", tos)
+	}
+}
+
+func TestVM_Exec_CallExt_CallerContinues(t *testing.T) {
+	externalContract := []byte{
+		PUSH, 0, 1,
+		SSTORE, 0,
+		ERRHALT,
+	}
+
+	//The caller stores the outcome of the call and keeps some of its gas for it
+	code := newExternalCallCode(2)
+	code = append(code[:len(code)-1], SSTORE, 0, HALT)
+
+	vm := NewTestVM([]byte{})
+	mc := newExternalCallContext(code, externalContract)
+	mc.ContractVariables = []protocol.ByteArray{{9}}
+	vm.context = mc
+
+	if !vm.Exec(false) {
+		t.Fatalf("Expected the caller to continue after the failed external call: %v", vm.GetErrorMsg())
+	}
+
+	mc.PersistChanges()
+	if variable, _ := mc.GetContractVariable(0); ByteArrayToInt(variable) != 0 {
+		t.Errorf("Expected the caller to store the failed outcome but the variable was '%v'", variable)
+	}
+
+	if len(mc.GetExternalContractVariables()) != 0 {
+		t.Errorf("Expected changes of the failed external call to be discarded, but were %v", mc.GetExternalContractVariables())
+	}
+
+	if vm.fee == 0 || vm.fee < mc.Fee/EXTERNAL_CALL_GAS_RESERVE-10 {
+		t.Errorf("Expected the caller to keep a reserve of its gas, remaining fee is %v", vm.fee)
+	}
+}
+
 func TestVM_Exec_Sload(t *testing.T) {
 	code := []byte{
 		SLOAD, 1,